@@ -0,0 +1,270 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultEncodeBudget is the total concurrent encode weight allowed when no
+// budget is configured explicitly.
+const DefaultEncodeBudget = 100
+
+// JobPriority orders jobs waiting for encode budget. Higher values are
+// granted first; jobs of equal priority are served in arrival order.
+type JobPriority int
+
+const (
+	// PriorityBulk is used for rule-based and back-catalog archives.
+	PriorityBulk JobPriority = 0
+
+	// PriorityLive is used for archives of live events that just ended.
+	PriorityLive JobPriority = 10
+)
+
+// EncodeProfile describes the output of an encode, used to estimate its cost.
+type EncodeProfile struct {
+	// Height is the output resolution height in pixels (e.g. 720, 1080, 2160).
+	Height int
+
+	// Codec is the output video codec ("h264", "hevc", "av1").
+	Codec string
+}
+
+// DefaultEncodeProfile is assumed for jobs that do not declare a profile.
+var DefaultEncodeProfile = EncodeProfile{Height: 1080, Codec: "h264"}
+
+// EstimateEncodeWeight returns the budget points an encode with the given
+// profile is expected to consume. H.264 costs scale with resolution; HEVC is
+// 1.5x and AV1 2x the H.264 cost. A 720p H.264 encode costs 15 points and a
+// 4K HEVC encode 60.
+func EstimateEncodeWeight(profile EncodeProfile) int {
+	if profile.Height == 0 && profile.Codec == "" {
+		profile = DefaultEncodeProfile
+	}
+
+	var base int
+	switch {
+	case profile.Height <= 480:
+		base = 8
+	case profile.Height <= 720:
+		base = 15
+	case profile.Height <= 1080:
+		base = 25
+	default:
+		base = 40
+	}
+
+	switch strings.ToLower(profile.Codec) {
+	case "hevc", "h265":
+		return base * 3 / 2
+	case "av1":
+		return base * 2
+	default:
+		return base
+	}
+}
+
+// ErrBudgetClosed is returned to waiters when the budget is shut down.
+var ErrBudgetClosed = errors.New("archive: encode budget closed")
+
+// BudgetClaim identifies the job requesting or holding encode budget.
+type BudgetClaim struct {
+	JobID       string      `json:"job_id"`
+	RecordingID string      `json:"recording_id"`
+	Weight      int         `json:"weight"`
+	Priority    JobPriority `json:"priority"`
+	Since       time.Time   `json:"since"`
+}
+
+// BudgetStatus is a snapshot of encode budget usage.
+type BudgetStatus struct {
+	Capacity     int           `json:"capacity"`
+	InUse        int           `json:"in_use"`
+	Available    int           `json:"available"`
+	Running      []BudgetClaim `json:"running"`
+	Queued       []BudgetClaim `json:"queued"`
+	QueuedDemand int           `json:"queued_demand"`
+}
+
+// waiter is a queued claim waiting to be granted.
+type waiter struct {
+	claim   BudgetClaim
+	seq     uint64
+	granted chan struct{}
+}
+
+// Budget enforces a total concurrent weight across encode stages. Claims that
+// do not fit wait in a priority-ordered queue and are granted strictly in
+// order, so a large high-priority encode cannot be starved by a stream of
+// small ones.
+type Budget struct {
+	mu       sync.Mutex
+	capacity int
+	inUse    int
+	running  map[string]BudgetClaim
+	queue    []*waiter
+	seq      uint64
+	closed   bool
+	done     chan struct{}
+
+	// now is overridable for testing.
+	now func() time.Time
+}
+
+// NewBudget creates a Budget with the given capacity in weight points.
+// Non-positive capacities fall back to DefaultEncodeBudget.
+func NewBudget(capacity int) *Budget {
+	if capacity <= 0 {
+		capacity = DefaultEncodeBudget
+	}
+	return &Budget{
+		capacity: capacity,
+		running:  make(map[string]BudgetClaim),
+		done:     make(chan struct{}),
+		now:      time.Now,
+	}
+}
+
+// Acquire blocks until the claim's weight fits within the budget, the context
+// is cancelled, or the budget is closed. Weights larger than the capacity are
+// clamped so oversized encodes can still run alone.
+func (b *Budget) Acquire(ctx context.Context, claim BudgetClaim) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBudgetClosed
+	}
+	if claim.Weight > b.capacity {
+		claim.Weight = b.capacity
+	}
+	if claim.Weight < 0 {
+		claim.Weight = 0
+	}
+	claim.Since = b.now()
+
+	b.seq++
+	w := &waiter{claim: claim, seq: b.seq, granted: make(chan struct{})}
+	b.queue = append(b.queue, w)
+	sort.SliceStable(b.queue, func(i, j int) bool {
+		if b.queue[i].claim.Priority != b.queue[j].claim.Priority {
+			return b.queue[i].claim.Priority > b.queue[j].claim.Priority
+		}
+		return b.queue[i].seq < b.queue[j].seq
+	})
+	b.grantLocked()
+	b.mu.Unlock()
+
+	select {
+	case <-w.granted:
+		return nil
+	case <-b.done:
+		return ErrBudgetClosed
+	case <-ctx.Done():
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		select {
+		case <-w.granted:
+			// Granted while we were cancelling; hand the weight back.
+			b.releaseLocked(claim.JobID)
+		default:
+			b.removeWaiterLocked(w)
+			b.grantLocked()
+		}
+		return ctx.Err()
+	}
+}
+
+// Release returns the weight held by the given job to the budget.
+func (b *Budget) Release(jobID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.releaseLocked(jobID)
+}
+
+// Close rejects all queued claims and any future Acquire calls.
+func (b *Budget) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	b.queue = nil
+	close(b.done)
+}
+
+// Status returns a snapshot of current usage and queued demand.
+func (b *Budget) Status() BudgetStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BudgetStatus{
+		Capacity:  b.capacity,
+		InUse:     b.inUse,
+		Available: b.capacity - b.inUse,
+		Running:   make([]BudgetClaim, 0, len(b.running)),
+		Queued:    make([]BudgetClaim, 0, len(b.queue)),
+	}
+	for _, c := range b.running {
+		status.Running = append(status.Running, c)
+	}
+	sort.Slice(status.Running, func(i, j int) bool {
+		return status.Running[i].Since.Before(status.Running[j].Since)
+	})
+	for _, w := range b.queue {
+		status.Queued = append(status.Queued, w.claim)
+		status.QueuedDemand += w.claim.Weight
+	}
+	return status
+}
+
+// grantLocked admits waiters from the head of the queue while they fit.
+// Must be called with b.mu held.
+func (b *Budget) grantLocked() {
+	for len(b.queue) > 0 {
+		head := b.queue[0]
+		if b.inUse+head.claim.Weight > b.capacity {
+			return
+		}
+		b.queue = b.queue[1:]
+		b.inUse += head.claim.Weight
+		head.claim.Since = b.now()
+		b.running[head.claim.JobID] = head.claim
+		close(head.granted)
+	}
+}
+
+// releaseLocked frees a running claim and grants queued waiters.
+// Must be called with b.mu held.
+func (b *Budget) releaseLocked(jobID string) {
+	claim, ok := b.running[jobID]
+	if !ok {
+		return
+	}
+	delete(b.running, jobID)
+	b.inUse -= claim.Weight
+	b.grantLocked()
+}
+
+// removeWaiterLocked drops a waiter from the queue.
+// Must be called with b.mu held.
+func (b *Budget) removeWaiterLocked(w *waiter) {
+	for i, q := range b.queue {
+		if q == w {
+			b.queue = append(b.queue[:i], b.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetTestNow replaces the time function for testing.
+func (b *Budget) SetTestNow(fn func() time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.now = fn
+}
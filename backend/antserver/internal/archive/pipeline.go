@@ -8,11 +8,18 @@
 package archive
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
 
+	"antserver/internal/commercial"
+	"antserver/internal/highlights"
+	"antserver/internal/poster"
+	"antserver/internal/trace"
+
 	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
 )
 
 // Stage names used in the pipeline.
@@ -34,6 +41,9 @@ const (
 	StatusRunning    JobStatus = "running"
 	StatusCompleted  JobStatus = "completed"
 	StatusFailed     JobStatus = "failed"
+
+	// StatusWaiting marks an encode stage queued for encode budget.
+	StatusWaiting JobStatus = "waiting"
 )
 
 // StageResult records the outcome of a single pipeline stage.
@@ -68,6 +78,31 @@ type ArchiveJob struct {
 	// CurrentStage is the name of the stage currently executing.
 	CurrentStage string
 
+	// Format is the container the recording was captured in ("mpegts" or
+	// "fmp4"). It is passed to the encode stage.
+	Format string
+
+	// Priority orders the job's encode stage against other jobs waiting
+	// for encode budget.
+	Priority JobPriority
+
+	// Profile is the encode output profile.
+	Profile EncodeProfile
+
+	// EncodeWeight is the budget cost of the encode stage, derived from Profile.
+	EncodeWeight int
+
+	// CorrelationID is inherited from the recorded event.
+	CorrelationID string
+
+	// Poster is the poster chosen during the trickplay stage, or nil when the
+	// generator's default poster is kept.
+	Poster *PosterSelection
+
+	// Highlights are the key moments found during commercial detection, or
+	// nil when no highlight detector is configured or it failed.
+	Highlights []highlights.Marker
+
 	// Stages holds the result of each pipeline stage in execution order.
 	Stages []StageResult
 
@@ -84,6 +119,7 @@ var (
 	ErrJobNotFound      = errors.New("archive: job not found")
 	ErrJobNotFailed     = errors.New("archive: job is not in failed state")
 	ErrNilDependency    = errors.New("archive: all stage dependencies must be non-nil")
+	ErrStageUnavailable = errors.New("archive: stage not available in this process")
 )
 
 // stageOrder defines the fixed execution sequence.
@@ -107,9 +143,30 @@ type CommercialDetector interface {
 	Detect(recordingID string) error
 }
 
+// DefaultRecordingFormat is assumed when the recording's capture format is unknown.
+const DefaultRecordingFormat = "mpegts"
+
+// EncodeRequest describes the input of the encode stage.
+type EncodeRequest struct {
+	// RecordingID is the recording being encoded.
+	RecordingID string
+
+	// Format is the container of the finalized recording ("mpegts" or "fmp4"),
+	// so encoders do not have to assume a .ts source.
+	Format string
+
+	// Profile is the requested output profile.
+	Profile EncodeProfile
+}
+
 // Encoder transcodes the recording into distribution formats.
 type Encoder interface {
-	Encode(recordingID string) error
+	Encode(req EncodeRequest) error
+}
+
+// RecordingFormatSource reports the container format a recording was captured in.
+type RecordingFormatSource interface {
+	RecordingFormat(recordingID string) (string, error)
 }
 
 // TrickplayGenerator creates trick-play thumbnails (preview sprites).
@@ -132,6 +189,59 @@ type Publisher interface {
 	Publish(recordingID string) error
 }
 
+// CutPointSource reports a recording's duration and detected commercial
+// breaks, used to keep poster candidates inside program content.
+type CutPointSource interface {
+	CutPoints(recordingID string) (durationMs int64, markers []commercial.Marker, err error)
+}
+
+// PosterScorer is implemented by trickplay generators that can analyse
+// candidate poster frames. It returns one score per analysed timestamp.
+type PosterScorer interface {
+	ScoreFrames(recordingID string, candidatesMs []int64) ([]poster.FrameScore, error)
+}
+
+// ArtworkPublisher is implemented by publishers that hand poster candidates
+// to the library's artwork candidates when a recording is published.
+type ArtworkPublisher interface {
+	PublishArtwork(recordingID string, selection PosterSelection) error
+}
+
+// HighlightDetector finds key moments, such as scoreboard or scene changes,
+// in a sports recording.
+type HighlightDetector interface {
+	DetectHighlights(recordingID string) ([]highlights.Marker, error)
+}
+
+// HighlightStore saves a recording's highlights so they can be shown with
+// the recording.
+type HighlightStore interface {
+	SaveHighlights(recordingID string, markers []highlights.Marker) error
+}
+
+// UnavailableStages implements every stage by failing with
+// ErrStageUnavailable. A pipeline built from it serves stored jobs through
+// GetStatus, ListJobs and JobsByCorrelationID in a process that does not run
+// the stages itself; retried jobs fail again at their current stage.
+type UnavailableStages struct{}
+
+func (UnavailableStages) Finalize(string) error      { return ErrStageUnavailable }
+func (UnavailableStages) Detect(string) error        { return ErrStageUnavailable }
+func (UnavailableStages) Encode(EncodeRequest) error { return ErrStageUnavailable }
+func (UnavailableStages) Generate(string) error      { return ErrStageUnavailable }
+func (UnavailableStages) Upload(string) error        { return ErrStageUnavailable }
+func (UnavailableStages) Index(string) error         { return ErrStageUnavailable }
+func (UnavailableStages) Publish(string) error       { return ErrStageUnavailable }
+
+// PosterSelection is the result of content-aware poster selection.
+type PosterSelection struct {
+	// PosterMs is the timestamp of the chosen poster frame.
+	PosterMs int64
+
+	// Candidates holds every scored frame, best first; the first is the poster.
+	Candidates []poster.FrameScore
+}
+
 // Pipeline orchestrates archive jobs through the stage sequence.
 type Pipeline struct {
 	mu   sync.RWMutex
@@ -145,6 +255,26 @@ type Pipeline struct {
 	indexer    SearchIndexer
 	publisher  Publisher
 
+	// formats resolves the capture format of a recording; nil means every
+	// recording is assumed to be DefaultRecordingFormat.
+	formats RecordingFormatSource
+
+	// budget limits the total weight of concurrently running encode stages;
+	// nil means encodes are not limited.
+	budget *Budget
+
+	// cutPoints enables content-aware poster selection; nil keeps the
+	// trickplay generator's default poster.
+	cutPoints CutPointSource
+
+	// highlightDetector and highlightStore enable highlight extraction; a
+	// nil detector skips it and a nil store keeps highlights on the job only.
+	highlightDetector HighlightDetector
+	highlightStore    HighlightStore
+
+	// store persists jobs on every change; nil keeps them in memory only.
+	store JobStore
+
 	// now is overridable for testing.
 	now func() time.Time
 }
@@ -177,27 +307,216 @@ func NewPipeline(
 	}, nil
 }
 
+// SetFormatSource configures where the pipeline looks up a recording's
+// capture format when a job is created.
+func (p *Pipeline) SetFormatSource(src RecordingFormatSource) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.formats = src
+}
+
+// SetBudget enables weighted admission of encode stages. Jobs still run
+// their earlier stages (finalize, commercial detection) immediately and only
+// wait when their encode would exceed the budget.
+func (p *Pipeline) SetBudget(b *Budget) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.budget = b
+}
+
+// SetCutPointSource enables content-aware poster selection. When the
+// trickplay generator implements PosterScorer and a recording has detected
+// commercials, poster candidates are drawn from program content and the best
+// scoring frame becomes the poster.
+func (p *Pipeline) SetCutPointSource(src CutPointSource) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cutPoints = src
+}
+
+// SetHighlightDetector enables highlight extraction alongside commercial
+// detection. Highlights are recorded on the job and, when store is non-nil,
+// saved with the recording. Extraction failures never fail the stage.
+func (p *Pipeline) SetHighlightDetector(detector HighlightDetector, store HighlightStore) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.highlightDetector = detector
+	p.highlightStore = store
+}
+
+// SetJobStore enables write-through persistence of jobs. Call Hydrate once
+// at startup to load the jobs stored before a restart.
+func (p *Pipeline) SetJobStore(store JobStore) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.store = store
+}
+
+// interruptedError is recorded on a stage that was running when antserver
+// stopped.
+const interruptedError = "archive: interrupted by restart"
+
+// HydrateWindow is how long after they last changed completed and failed
+// jobs are still loaded by Hydrate. Older finished jobs stay in the store.
+const HydrateWindow = 7 * 24 * time.Hour
+
+// Hydrate loads the unfinished jobs, and those finished within HydrateWindow,
+// into memory so GetStatus and Retry work after a restart. Jobs that were
+// running or waiting for budget are marked failed at their current stage, so
+// they can be retried. It returns the number of jobs loaded.
+func (p *Pipeline) Hydrate(ctx context.Context) (int, error) {
+	p.mu.RLock()
+	store := p.store
+	p.mu.RUnlock()
+	if store == nil {
+		return 0, nil
+	}
+
+	jobs, err := store.LoadJobs(ctx, p.now().Add(-HydrateWindow))
+	if err != nil {
+		return 0, err
+	}
+
+	var interrupted []*ArchiveJob
+	p.mu.Lock()
+	for _, job := range jobs {
+		if _, exists := p.jobs[job.ID]; exists {
+			continue
+		}
+		if job.Status != StatusCompleted && job.Status != StatusFailed {
+			markInterrupted(job, p.now())
+			interrupted = append(interrupted, job)
+		}
+		p.jobs[job.ID] = job
+	}
+	p.mu.Unlock()
+
+	for _, job := range interrupted {
+		trace.Entry(job.CorrelationID).WithFields(log.Fields{
+			"job_id":       job.ID,
+			"recording_id": job.RecordingID,
+			"stage":        job.CurrentStage,
+		}).Warn("archive job interrupted by restart")
+		p.persist(job)
+	}
+	log.WithFields(log.Fields{
+		"jobs":        len(jobs),
+		"interrupted": len(interrupted),
+	}).Info("archive jobs hydrated")
+	return len(jobs), nil
+}
+
+// markInterrupted fails the first unfinished stage of a job that was in
+// progress when antserver stopped.
+func markInterrupted(job *ArchiveJob, now time.Time) {
+	for i := range job.Stages {
+		if job.Stages[i].Status == StatusCompleted {
+			continue
+		}
+		job.Stages[i].Status = StatusFailed
+		job.Stages[i].Error = interruptedError
+		job.Stages[i].CompletedAt = now
+		job.CurrentStage = job.Stages[i].Name
+		break
+	}
+	job.Status = StatusFailed
+	job.UpdatedAt = now
+}
+
+// persistTimeout bounds a single job write.
+const persistTimeout = 5 * time.Second
+
+// persist writes a snapshot of the job to the store. Failures are logged;
+// the in-memory job stays authoritative.
+func (p *Pipeline) persist(job *ArchiveJob) {
+	p.mu.RLock()
+	store := p.store
+	var snap *ArchiveJob
+	if store != nil {
+		snap = job.snapshot()
+	}
+	p.mu.RUnlock()
+	if store == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), persistTimeout)
+	defer cancel()
+	if err := store.SaveJob(ctx, snap); err != nil {
+		trace.Entry(job.CorrelationID).WithError(err).WithFields(log.Fields{
+			"job_id":       job.ID,
+			"recording_id": job.RecordingID,
+			"status":       snap.Status,
+		}).Error("failed to persist archive job")
+	}
+}
+
+// Budget returns the configured encode budget, or nil if encodes are unlimited.
+func (p *Pipeline) Budget() *Budget {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.budget
+}
+
+// JobOptions controls how a job is scheduled.
+type JobOptions struct {
+	// Priority orders the encode stage when waiting for budget.
+	Priority JobPriority
+
+	// Profile is the encode output profile; zero uses DefaultEncodeProfile.
+	Profile EncodeProfile
+
+	// CorrelationID is the correlation ID of the recorded event.
+	CorrelationID string
+}
+
 // Start creates a new archive job and begins processing it through all stages.
 // Processing runs synchronously; wrap in a goroutine for async execution.
 func (p *Pipeline) Start(recordingID string) (*ArchiveJob, error) {
+	return p.StartWithOptions(context.Background(), recordingID, JobOptions{})
+}
+
+// StartWithOptions is like Start but accepts scheduling options. Cancelling
+// ctx stops the job before its next stage and abandons any wait for encode
+// budget; the job is then marked failed and can be retried.
+func (p *Pipeline) StartWithOptions(ctx context.Context, recordingID string, opts JobOptions) (*ArchiveJob, error) {
 	if recordingID == "" {
 		return nil, ErrEmptyRecordingID
 	}
 
+	profile := opts.Profile
+	if profile == (EncodeProfile{}) {
+		profile = DefaultEncodeProfile
+	}
+
 	job := &ArchiveJob{
-		ID:          uuid.New().String(),
-		RecordingID: recordingID,
-		Status:      StatusRunning,
-		CreatedAt:   p.now(),
-		UpdatedAt:   p.now(),
-		Stages:      makeStages(),
+		ID:           uuid.New().String(),
+		RecordingID:  recordingID,
+		Format:       p.recordingFormat(recordingID),
+		Priority:     opts.Priority,
+		Profile:      profile,
+		EncodeWeight: EstimateEncodeWeight(profile),
+		Status:       StatusRunning,
+		CreatedAt:    p.now(),
+		UpdatedAt:    p.now(),
+		Stages:       makeStages(),
+
+		CorrelationID: opts.CorrelationID,
 	}
 
 	p.mu.Lock()
 	p.jobs[job.ID] = job
 	p.mu.Unlock()
+	p.persist(job)
+
+	trace.Entry(job.CorrelationID).WithFields(log.Fields{
+		"job_id":       job.ID,
+		"recording_id": recordingID,
+		"format":       job.Format,
+		"priority":     job.Priority,
+	}).Info("archive job started")
 
-	p.runFromStage(job, 0)
+	p.runFromStage(ctx, job, 0)
 	return job, nil
 }
 
@@ -212,10 +531,49 @@ func (p *Pipeline) GetStatus(jobID string) (*ArchiveJob, error) {
 	}
 
 	// Return a copy to prevent data races on the caller side.
-	cp := *job
-	cp.Stages = make([]StageResult, len(job.Stages))
-	copy(cp.Stages, job.Stages)
-	return &cp, nil
+	return job.snapshot(), nil
+}
+
+// ListJobs returns snapshots of all archive jobs.
+func (p *Pipeline) ListJobs() []*ArchiveJob {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	jobs := make([]*ArchiveJob, 0, len(p.jobs))
+	for _, job := range p.jobs {
+		jobs = append(jobs, job.snapshot())
+	}
+	return jobs
+}
+
+// JobsByCorrelationID returns snapshots of the jobs carrying the given
+// correlation ID.
+func (p *Pipeline) JobsByCorrelationID(correlationID string) []*ArchiveJob {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var jobs []*ArchiveJob
+	for _, job := range p.jobs {
+		if correlationID != "" && job.CorrelationID == correlationID {
+			jobs = append(jobs, job.snapshot())
+		}
+	}
+	return jobs
+}
+
+// snapshot returns a copy of the job. Must be called with p.mu held.
+func (j *ArchiveJob) snapshot() *ArchiveJob {
+	cp := *j
+	cp.Stages = make([]StageResult, len(j.Stages))
+	copy(cp.Stages, j.Stages)
+	if j.Poster != nil {
+		sel := j.Poster.clone()
+		cp.Poster = &sel
+	}
+	if j.Highlights != nil {
+		cp.Highlights = append([]highlights.Marker(nil), j.Highlights...)
+	}
+	return &cp
 }
 
 // Retry resumes a failed job from the failed stage. All prior completed stages
@@ -255,24 +613,50 @@ func (p *Pipeline) Retry(jobID string) error {
 	job.Status = StatusRunning
 	job.UpdatedAt = p.now()
 	p.mu.Unlock()
+	p.persist(job)
 
-	p.runFromStage(job, resumeIdx)
+	p.runFromStage(context.Background(), job, resumeIdx)
 	return nil
 }
 
 // runFromStage executes pipeline stages starting at the given index.
-func (p *Pipeline) runFromStage(job *ArchiveJob, startIdx int) {
+func (p *Pipeline) runFromStage(ctx context.Context, job *ArchiveJob, startIdx int) {
 	for i := startIdx; i < len(stageOrder); i++ {
 		stageName := stageOrder[i]
 
+		// An encode under a budget waits for it before it starts running.
+		var budget *Budget
+		status := StatusRunning
+		if stageName == StageEncode {
+			if budget = p.Budget(); budget != nil {
+				status = StatusWaiting
+			}
+		}
+
 		p.mu.Lock()
 		job.CurrentStage = stageName
-		job.Stages[i].Status = StatusRunning
-		job.Stages[i].StartedAt = p.now()
+		job.Stages[i].Status = status
+		if status == StatusRunning {
+			job.Stages[i].StartedAt = p.now()
+		}
 		job.UpdatedAt = p.now()
 		p.mu.Unlock()
+		p.persist(job)
+
+		err := ctx.Err()
+		if err == nil {
+			if stageName == StageEncode {
+				err = p.runEncode(ctx, job, i, budget)
+			} else {
+				err = p.executeStage(stageName, job)
+			}
+		}
 
-		err := p.executeStage(stageName, job.RecordingID)
+		entry := trace.Entry(job.CorrelationID).WithFields(log.Fields{
+			"job_id":       job.ID,
+			"recording_id": job.RecordingID,
+			"stage":        stageName,
+		})
 
 		p.mu.Lock()
 		job.Stages[i].CompletedAt = p.now()
@@ -282,11 +666,15 @@ func (p *Pipeline) runFromStage(job *ArchiveJob, startIdx int) {
 			job.Status = StatusFailed
 			job.UpdatedAt = p.now()
 			p.mu.Unlock()
+			p.persist(job)
+			entry.WithError(err).Warn("archive stage failed")
 			return
 		}
 		job.Stages[i].Status = StatusCompleted
 		job.UpdatedAt = p.now()
 		p.mu.Unlock()
+		p.persist(job)
+		entry.Info("archive stage completed")
 	}
 
 	p.mu.Lock()
@@ -294,30 +682,226 @@ func (p *Pipeline) runFromStage(job *ArchiveJob, startIdx int) {
 	job.CurrentStage = ""
 	job.UpdatedAt = p.now()
 	p.mu.Unlock()
+	p.persist(job)
+
+	trace.Entry(job.CorrelationID).WithFields(log.Fields{
+		"job_id":       job.ID,
+		"recording_id": job.RecordingID,
+	}).Info("archive job completed")
+}
+
+// runEncode executes the encode stage, first acquiring budget when one is
+// given. The stage has already been persisted as waiting; it is persisted
+// again once the budget is acquired. The budget is released as soon as the
+// encoder returns, whether it succeeded or failed.
+func (p *Pipeline) runEncode(ctx context.Context, job *ArchiveJob, idx int, budget *Budget) error {
+	if budget == nil {
+		return p.executeStage(StageEncode, job)
+	}
+
+	claim := BudgetClaim{
+		JobID:       job.ID,
+		RecordingID: job.RecordingID,
+		Weight:      job.EncodeWeight,
+		Priority:    job.Priority,
+	}
+	if err := budget.Acquire(ctx, claim); err != nil {
+		return err
+	}
+	defer budget.Release(job.ID)
+
+	p.mu.Lock()
+	job.Stages[idx].Status = StatusRunning
+	job.Stages[idx].StartedAt = p.now()
+	job.UpdatedAt = p.now()
+	p.mu.Unlock()
+	p.persist(job)
+
+	return p.executeStage(StageEncode, job)
 }
 
 // executeStage dispatches to the correct stage implementation.
-func (p *Pipeline) executeStage(stage, recordingID string) error {
+func (p *Pipeline) executeStage(stage string, job *ArchiveJob) error {
+	recordingID := job.RecordingID
 	switch stage {
 	case StageFinalize:
 		return p.finalizer.Finalize(recordingID)
 	case StageDetectCommercials:
-		return p.detector.Detect(recordingID)
+		if err := p.detector.Detect(recordingID); err != nil {
+			return err
+		}
+		p.extractHighlights(job)
+		return nil
 	case StageEncode:
-		return p.encoder.Encode(recordingID)
+		return p.encoder.Encode(EncodeRequest{
+			RecordingID: recordingID,
+			Format:      job.Format,
+			Profile:     job.Profile,
+		})
 	case StageTrickplay:
-		return p.trickplay.Generate(recordingID)
+		if err := p.trickplay.Generate(recordingID); err != nil {
+			return err
+		}
+		p.selectPoster(job)
+		return nil
 	case StageUpload:
 		return p.uploader.Upload(recordingID)
 	case StageIndex:
 		return p.indexer.Index(recordingID)
 	case StagePublish:
-		return p.publisher.Publish(recordingID)
+		if err := p.publisher.Publish(recordingID); err != nil {
+			return err
+		}
+		p.publishArtwork(job)
+		return nil
 	default:
 		return errors.New("archive: unknown stage: " + stage)
 	}
 }
 
+// selectPoster scores candidate frames from the recording's program content
+// and records the best one on the job. Recordings without commercial data, and
+// generators that cannot score frames, keep the generator's default poster.
+// Failures are logged and never fail the stage.
+func (p *Pipeline) selectPoster(job *ArchiveJob) {
+	scorer, ok := p.trickplay.(PosterScorer)
+	if !ok {
+		return
+	}
+	p.mu.RLock()
+	src := p.cutPoints
+	p.mu.RUnlock()
+	if src == nil {
+		return
+	}
+
+	entry := trace.Entry(job.CorrelationID).WithFields(log.Fields{
+		"job_id":       job.ID,
+		"recording_id": job.RecordingID,
+	})
+
+	durationMs, markers, err := src.CutPoints(job.RecordingID)
+	if err != nil {
+		entry.WithError(err).Warn("poster selection skipped, cut points unavailable")
+		return
+	}
+	if len(markers) == 0 {
+		return
+	}
+
+	windows := poster.ContentWindows(durationMs, markers, commercial.PromptThreshold)
+	candidates := poster.CandidateTimes(windows, poster.DefaultCandidates)
+	if len(candidates) == 0 {
+		return
+	}
+
+	scores, err := scorer.ScoreFrames(job.RecordingID, candidates)
+	if err != nil {
+		entry.WithError(err).Warn("poster selection skipped, frame scoring failed")
+		return
+	}
+	ranked := poster.Rank(scores)
+	if len(ranked) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	job.Poster = &PosterSelection{PosterMs: ranked[0].AtMs, Candidates: ranked}
+	job.UpdatedAt = p.now()
+	p.mu.Unlock()
+
+	entry.WithFields(log.Fields{
+		"poster_ms":  ranked[0].AtMs,
+		"candidates": len(ranked),
+	}).Info("poster selected")
+}
+
+// extractHighlights runs the highlight detector and records its markers on
+// the job and in the highlight store. Failures are logged and never fail the
+// stage.
+func (p *Pipeline) extractHighlights(job *ArchiveJob) {
+	p.mu.RLock()
+	detector, store := p.highlightDetector, p.highlightStore
+	p.mu.RUnlock()
+	if detector == nil {
+		return
+	}
+
+	entry := trace.Entry(job.CorrelationID).WithFields(log.Fields{
+		"job_id":       job.ID,
+		"recording_id": job.RecordingID,
+	})
+
+	markers, err := detector.DetectHighlights(job.RecordingID)
+	if err != nil {
+		entry.WithError(err).Warn("highlight extraction skipped, detection failed")
+		return
+	}
+	markers = highlights.Normalize(markers)
+
+	p.mu.Lock()
+	job.Highlights = markers
+	job.UpdatedAt = p.now()
+	p.mu.Unlock()
+
+	if store != nil {
+		if err := store.SaveHighlights(job.RecordingID, markers); err != nil {
+			entry.WithError(err).Warn("highlights not saved")
+			return
+		}
+	}
+	entry.WithField("highlights", len(markers)).Info("highlights extracted")
+}
+
+// publishArtwork hands the job's poster candidates to the publisher, if it
+// accepts them. The recording is already published by then, so failures are
+// logged and never fail the stage; failing it would publish again on retry.
+func (p *Pipeline) publishArtwork(job *ArchiveJob) {
+	ap, ok := p.publisher.(ArtworkPublisher)
+	if !ok {
+		return
+	}
+	p.mu.RLock()
+	var sel *PosterSelection
+	if job.Poster != nil {
+		c := job.Poster.clone()
+		sel = &c
+	}
+	p.mu.RUnlock()
+	if sel == nil {
+		return
+	}
+	if err := ap.PublishArtwork(job.RecordingID, *sel); err != nil {
+		trace.Entry(job.CorrelationID).WithError(err).WithFields(log.Fields{
+			"job_id":       job.ID,
+			"recording_id": job.RecordingID,
+		}).Warn("poster artwork not published")
+	}
+}
+
+// clone returns a copy of the selection that shares no slices with it.
+func (s PosterSelection) clone() PosterSelection {
+	s.Candidates = append([]poster.FrameScore(nil), s.Candidates...)
+	return s
+}
+
+// recordingFormat resolves the capture format for a recording, falling back
+// to DefaultRecordingFormat when no source is configured or the lookup fails.
+func (p *Pipeline) recordingFormat(recordingID string) string {
+	p.mu.RLock()
+	src := p.formats
+	p.mu.RUnlock()
+
+	if src == nil {
+		return DefaultRecordingFormat
+	}
+	format, err := src.RecordingFormat(recordingID)
+	if err != nil || format == "" {
+		return DefaultRecordingFormat
+	}
+	return format
+}
+
 // makeStages initializes the stage result slice with all stages in pending state.
 func makeStages() []StageResult {
 	stages := make([]StageResult, len(stageOrder))
@@ -0,0 +1,186 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"antserver/internal/highlights"
+)
+
+// ErrNilDB is returned when a PostgresJobStore is created without a database.
+var ErrNilDB = errors.New("archive: db must not be nil")
+
+// JobStore persists archive jobs so they survive a restart. The pipeline
+// keeps jobs in memory and writes each one through on every change.
+type JobStore interface {
+	// SaveJob inserts or replaces the job.
+	SaveJob(ctx context.Context, job *ArchiveJob) error
+
+	// LoadJobs returns the stored jobs that are still pending, running or
+	// waiting, and the completed or failed jobs last updated at or after
+	// since, oldest first.
+	LoadJobs(ctx context.Context, since time.Time) ([]*ArchiveJob, error)
+}
+
+// PostgresJobStore stores archive jobs in the archive_jobs table.
+type PostgresJobStore struct {
+	db *sql.DB
+}
+
+// NewPostgresJobStore creates a JobStore backed by the given database.
+func NewPostgresJobStore(db *sql.DB) (*PostgresJobStore, error) {
+	if db == nil {
+		return nil, ErrNilDB
+	}
+	return &PostgresJobStore{db: db}, nil
+}
+
+// stageRecord is the stored form of a StageResult.
+type stageRecord struct {
+	Name        string    `json:"name"`
+	Status      JobStatus `json:"status"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// SaveJob upserts the job by ID.
+func (s *PostgresJobStore) SaveJob(ctx context.Context, job *ArchiveJob) error {
+	records := make([]stageRecord, len(job.Stages))
+	for i, st := range job.Stages {
+		records[i] = stageRecord(st)
+	}
+	stages, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("encode stages for job %s: %w", job.ID, err)
+	}
+	poster, err := nullableJSON(job.Poster != nil, job.Poster)
+	if err != nil {
+		return fmt.Errorf("encode poster for job %s: %w", job.ID, err)
+	}
+	marks, err := nullableJSON(job.Highlights != nil, job.Highlights)
+	if err != nil {
+		return fmt.Errorf("encode highlights for job %s: %w", job.ID, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO archive_jobs (
+			id, recording_id, status, current_stage, format, priority,
+			profile_height, profile_codec, encode_weight, correlation_id,
+			stages, poster, highlights, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			current_stage = EXCLUDED.current_stage,
+			stages = EXCLUDED.stages,
+			poster = EXCLUDED.poster,
+			highlights = EXCLUDED.highlights,
+			updated_at = EXCLUDED.updated_at`,
+		job.ID, job.RecordingID, string(job.Status), job.CurrentStage, job.Format, int(job.Priority),
+		job.Profile.Height, job.Profile.Codec, job.EncodeWeight, job.CorrelationID,
+		string(stages), poster, marks, job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("save archive job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// LoadJobs returns the unfinished jobs and the jobs finished since the given
+// time, ordered by creation time.
+func (s *PostgresJobStore) LoadJobs(ctx context.Context, since time.Time) ([]*ArchiveJob, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, recording_id, status, current_stage, format, priority,
+			profile_height, profile_codec, encode_weight, correlation_id,
+			stages, poster, highlights, created_at, updated_at
+		FROM archive_jobs
+		WHERE status NOT IN ($1, $2) OR updated_at >= $3
+		ORDER BY created_at`, string(StatusCompleted), string(StatusFailed), since)
+	if err != nil {
+		return nil, fmt.Errorf("query archive jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*ArchiveJob
+	for rows.Next() {
+		var (
+			job                    ArchiveJob
+			status                 string
+			priority               int
+			stages                 []byte
+			poster, highlightsJSON []byte
+		)
+		if err := rows.Scan(
+			&job.ID, &job.RecordingID, &status, &job.CurrentStage, &job.Format, &priority,
+			&job.Profile.Height, &job.Profile.Codec, &job.EncodeWeight, &job.CorrelationID,
+			&stages, &poster, &highlightsJSON, &job.CreatedAt, &job.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan archive job: %w", err)
+		}
+		job.Status = JobStatus(status)
+		job.Priority = JobPriority(priority)
+
+		var records []stageRecord
+		if err := json.Unmarshal(stages, &records); err != nil {
+			return nil, fmt.Errorf("decode stages for job %s: %w", job.ID, err)
+		}
+		job.Stages = make([]StageResult, len(records))
+		for i, r := range records {
+			job.Stages[i] = StageResult(r)
+		}
+		if len(poster) > 0 {
+			job.Poster = &PosterSelection{}
+			if err := json.Unmarshal(poster, job.Poster); err != nil {
+				return nil, fmt.Errorf("decode poster for job %s: %w", job.ID, err)
+			}
+		}
+		if len(highlightsJSON) > 0 {
+			if err := json.Unmarshal(highlightsJSON, &job.Highlights); err != nil {
+				return nil, fmt.Errorf("decode highlights for job %s: %w", job.ID, err)
+			}
+			if job.Highlights == nil {
+				job.Highlights = []highlights.Marker{}
+			}
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, rows.Err()
+}
+
+// RecordingHighlights returns the highlights stored with the most recently
+// updated job for the recording that has any, or nil when none does.
+func (s *PostgresJobStore) RecordingHighlights(ctx context.Context, recordingID string) ([]highlights.Marker, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT highlights FROM archive_jobs
+		WHERE recording_id = $1 AND highlights IS NOT NULL
+		ORDER BY updated_at DESC
+		LIMIT 1`, recordingID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query highlights for recording %s: %w", recordingID, err)
+	}
+
+	markers := []highlights.Marker{}
+	if err := json.Unmarshal(data, &markers); err != nil {
+		return nil, fmt.Errorf("decode highlights for recording %s: %w", recordingID, err)
+	}
+	return markers, nil
+}
+
+// nullableJSON encodes v, or returns nil for SQL NULL when present is false.
+func nullableJSON(present bool, v interface{}) (interface{}, error) {
+	if !present {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
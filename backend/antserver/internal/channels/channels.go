@@ -0,0 +1,181 @@
+// Package channels is the catalog of channels antserver can record, stored
+// in the channels table. Events refer to a channel by its call sign.
+package channels
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Sentinel errors returned by channel operations.
+var (
+	ErrNilDB           = errors.New("channels: db must not be nil")
+	ErrNotFound        = errors.New("channels: channel not found")
+	ErrDuplicate       = errors.New("channels: call sign already registered")
+	ErrCallSignMissing = errors.New("channels: call sign is required")
+	ErrNumberMissing   = errors.New("channels: number is required")
+)
+
+// Channel is a catalog entry.
+type Channel struct {
+	ID       string `json:"id"`
+	CallSign string `json:"call_sign"`
+	Number   string `json:"number"`
+	Name     string `json:"name"`
+	LogoURL  string `json:"logo_url,omitempty"`
+
+	// Devices lists the AntBox devices that can tune the channel.
+	Devices []string `json:"devices"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks the required fields and fills in defaults: the name falls
+// back to the call sign and a nil device list becomes empty.
+func (c *Channel) Validate() error {
+	c.CallSign = strings.TrimSpace(c.CallSign)
+	c.Number = strings.TrimSpace(c.Number)
+	if c.CallSign == "" {
+		return ErrCallSignMissing
+	}
+	if c.Number == "" {
+		return ErrNumberMissing
+	}
+	if c.Name == "" {
+		c.Name = c.CallSign
+	}
+	if c.Devices == nil {
+		c.Devices = []string{}
+	}
+	return nil
+}
+
+// Store reads and writes the channels table.
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore creates a Store backed by the given database.
+func NewStore(db *sql.DB) (*Store, error) {
+	if db == nil {
+		return nil, ErrNilDB
+	}
+	return &Store{db: db}, nil
+}
+
+const selectColumns = `id, call_sign, number, name, COALESCE(logo_url, ''), device_ids, created_at`
+
+// Create adds a channel and returns it with its ID and creation time.
+func (s *Store) Create(ctx context.Context, ch Channel) (*Channel, error) {
+	if err := ch.Validate(); err != nil {
+		return nil, err
+	}
+	devices, err := json.Marshal(ch.Devices)
+	if err != nil {
+		return nil, fmt.Errorf("encode devices for %s: %w", ch.CallSign, err)
+	}
+
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO channels (call_sign, number, name, logo_url, device_ids)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		ON CONFLICT (call_sign) DO NOTHING
+		RETURNING id, created_at`,
+		ch.CallSign, ch.Number, ch.Name, ch.LogoURL, string(devices)).Scan(&ch.ID, &ch.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicate, ch.CallSign)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("insert channel %s: %w", ch.CallSign, err)
+	}
+	return &ch, nil
+}
+
+// List returns every channel ordered by number, then call sign.
+func (s *Store) List(ctx context.Context) ([]*Channel, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+selectColumns+`
+		FROM channels
+		WHERE call_sign IS NOT NULL
+		ORDER BY number, call_sign`)
+	if err != nil {
+		return nil, fmt.Errorf("query channels: %w", err)
+	}
+	defer rows.Close()
+
+	result := []*Channel{}
+	for rows.Next() {
+		ch, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ch)
+	}
+	return result, rows.Err()
+}
+
+// Get returns the channel with the given ID.
+func (s *Store) Get(ctx context.Context, id string) (*Channel, error) {
+	return s.getBy(ctx, "id", id)
+}
+
+// GetByCallSign returns the channel with the given call sign.
+func (s *Store) GetByCallSign(ctx context.Context, callSign string) (*Channel, error) {
+	return s.getBy(ctx, "call_sign", callSign)
+}
+
+// getBy looks a channel up by id or call_sign. Only these fixed column names
+// are interpolated into the query.
+func (s *Store) getBy(ctx context.Context, col, value string) (*Channel, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+selectColumns+`
+		FROM channels
+		WHERE `+col+` = $1`, value)
+	ch, err := scanChannel(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, value)
+	}
+	return ch, err
+}
+
+// Delete removes the channel with the given ID.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM channels WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete channel %s: %w", id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete channel %s: %w", id, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanChannel(row scanner) (*Channel, error) {
+	var ch Channel
+	var devices []byte
+	if err := row.Scan(&ch.ID, &ch.CallSign, &ch.Number, &ch.Name, &ch.LogoURL, &devices, &ch.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan channel: %w", err)
+	}
+	if err := json.Unmarshal(devices, &ch.Devices); err != nil {
+		return nil, fmt.Errorf("decode devices for %s: %w", ch.CallSign, err)
+	}
+	if ch.Devices == nil {
+		ch.Devices = []string{}
+	}
+	return &ch, nil
+}
@@ -4,6 +4,8 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all AntServer configuration values loaded from environment variables.
@@ -26,12 +28,95 @@ type Config struct {
 	// MinioBucket is the default bucket for recording storage.
 	MinioBucket string
 
+	// SearchURL is the Meilisearch server recordings are indexed in, and
+	// SearchAPIKey its key. SearchRecordingsIndex names the index.
+	SearchURL             string
+	SearchAPIKey          string
+	SearchRecordingsIndex string
+
+	// RetentionInterval is how often recording retention policies are
+	// applied. Retention needs DatabaseURL.
+	RetentionInterval time.Duration
+
+	// DatabaseURL is the Postgres connection string for antserver's own
+	// tables. Empty disables the routes and jobs that need them.
+	DatabaseURL string
+
+	// ValidateChannels rejects events whose channel is not in the channel
+	// catalog. It needs DatabaseURL.
+	ValidateChannels bool
+
+	// RelatedChannels groups channels that carry the same programming, e.g.
+	// an SD and an HD feed, so tuner allocation and failover can use one for
+	// another. RELATED_CHANNELS separates groups with ";" and the channels
+	// of a group with ",": "ESPN,ESPN-HD;WFLA,WFLA-HD".
+	RelatedChannels [][]string
+
+	// IngestHost is the SRT/RTMP endpoint live captures connect to. Empty
+	// connects to each stream's channel as the host.
+	IngestHost string
+
+	// IngestSRTPort and IngestRTMPPort are the ingest endpoint's ports; RTMP
+	// is the fallback when SRT cannot connect.
+	IngestSRTPort  int
+	IngestRTMPPort int
+
+	// IngestMaxReconnectDuration bounds how long an ingest transport keeps
+	// reconnecting before it fails. Zero means no time limit.
+	IngestMaxReconnectDuration time.Duration
+
 	// HasuraEndpoint is the Hasura GraphQL API endpoint.
 	HasuraEndpoint string
 
 	// HasuraAdminSecret is the admin secret for Hasura API access.
 	HasuraAdminSecret string
 
+	// RecordingFormat is the default segment container for new recordings
+	// ("mpegts" or "fmp4").
+	RecordingFormat string
+
+	// ArchiveEncodeBudget is the total weight of archive encodes allowed to
+	// run concurrently (e.g. a 4K HEVC encode costs 60, a 720p H.264 encode 15).
+	ArchiveEncodeBudget int
+
+	// OperationalConfigPath is an optional JSON file of retry policies and
+	// drift settings. It is re-read on SIGHUP or POST /config/reload.
+	OperationalConfigPath string
+
+	// DVRWindow is how far behind live a catch-up playlist reaches.
+	DVRWindow time.Duration
+
+	// MediaSigningKey is the HMAC key signing catch-up playlist URLs. Empty
+	// uses a random key per process, so issued URLs stop working on restart.
+	MediaSigningKey string
+
+	// MediaURLTTL is how long signed catch-up playlist and segment URLs
+	// stay valid.
+	MediaURLTTL time.Duration
+
+	// MinAgentVersion is the oldest AntBox agent version the fleet is
+	// expected to run; older devices are flagged by GET /devices/versions.
+	MinAgentVersion string
+
+	// GuideURL is an upstream XMLTV guide pulled every GuideRefreshInterval.
+	// Empty disables the refresher.
+	GuideURL string
+
+	// GuideRefreshInterval is how often GuideURL is fetched.
+	GuideRefreshInterval time.Duration
+
+	// GuideMaxShift is the largest programme time change applied to an
+	// event automatically; larger shifts flag the event for review.
+	GuideMaxShift time.Duration
+
+	// GuideStaleAfter is how long the guide may go without a successful
+	// refresh before /health reports it as stale.
+	GuideStaleAfter time.Duration
+
+	// RequestTimeout is the default deadline for API requests. Routes that
+	// are expected to take longer have their own.
+	RequestTimeout time.Duration
+
 	// LogLevel controls the verbosity of structured logging.
 	LogLevel string
 }
@@ -39,15 +124,38 @@ type Config struct {
 // Load reads configuration from environment variables with sensible defaults.
 func Load() *Config {
 	return &Config{
-		Port:              getEnvInt("PORT", 8090),
-		RedisURL:          getEnv("REDIS_URL", "redis://localhost:6379"),
-		MinIOEndpoint:     getEnv("MINIO_ENDPOINT", "localhost:9000"),
-		MinIOAccessKey:    getEnv("MINIO_ACCESS_KEY", "minioadmin"),
-		MinIOSecretKey:    getEnv("MINIO_SECRET_KEY", "minioadmin"),
-		MinioBucket:       getEnv("MINIO_BUCKET", "recordings"),
-		HasuraEndpoint:    getEnv("HASURA_ENDPOINT", "http://localhost:8080/v1/graphql"),
-		HasuraAdminSecret: getEnv("HASURA_ADMIN_SECRET", ""),
-		LogLevel:          getEnv("LOG_LEVEL", "info"),
+		Port:                       getEnvInt("PORT", 8090),
+		RedisURL:                   getEnv("REDIS_URL", "redis://localhost:6379"),
+		MinIOEndpoint:              getEnv("MINIO_ENDPOINT", "localhost:9000"),
+		MinIOAccessKey:             getEnv("MINIO_ACCESS_KEY", "minioadmin"),
+		MinIOSecretKey:             getEnv("MINIO_SECRET_KEY", "minioadmin"),
+		MinioBucket:                getEnv("MINIO_BUCKET", "recordings"),
+		SearchURL:                  getEnv("MEILISEARCH_URL", "http://localhost:7700"),
+		SearchAPIKey:               getEnv("MEILISEARCH_MASTER_KEY", ""),
+		SearchRecordingsIndex:      getEnv("MEILISEARCH_RECORDINGS_INDEX", "recordings"),
+		RetentionInterval:          getEnvDuration("RETENTION_INTERVAL", time.Hour),
+		DatabaseURL:                getEnv("DATABASE_URL", ""),
+		ValidateChannels:           getEnvBool("VALIDATE_CHANNELS", false),
+		RelatedChannels:            getEnvGroups("RELATED_CHANNELS"),
+		IngestHost:                 getEnv("INGEST_HOST", ""),
+		IngestSRTPort:              getEnvInt("INGEST_SRT_PORT", 9000),
+		IngestRTMPPort:             getEnvInt("INGEST_RTMP_PORT", 1935),
+		IngestMaxReconnectDuration: getEnvDuration("INGEST_MAX_RECONNECT_DURATION", 0),
+		HasuraEndpoint:             getEnv("HASURA_ENDPOINT", "http://localhost:8080/v1/graphql"),
+		HasuraAdminSecret:          getEnv("HASURA_ADMIN_SECRET", ""),
+		RecordingFormat:            getEnv("RECORDING_FORMAT", "mpegts"),
+		ArchiveEncodeBudget:        getEnvInt("ARCHIVE_ENCODE_BUDGET", 100),
+		OperationalConfigPath:      getEnv("OPERATIONAL_CONFIG_PATH", ""),
+		DVRWindow:                  getEnvDuration("DVR_WINDOW", 2*time.Hour),
+		MediaSigningKey:            getEnv("MEDIA_SIGNING_KEY", ""),
+		MediaURLTTL:                getEnvDuration("MEDIA_URL_TTL", time.Hour),
+		MinAgentVersion:            getEnv("MIN_AGENT_VERSION", ""),
+		GuideURL:                   getEnv("GUIDE_URL", ""),
+		GuideRefreshInterval:       getEnvDuration("GUIDE_REFRESH_INTERVAL", time.Hour),
+		GuideMaxShift:              getEnvDuration("GUIDE_MAX_SHIFT", 2*time.Hour),
+		GuideStaleAfter:            getEnvDuration("GUIDE_STALE_AFTER", 6*time.Hour),
+		RequestTimeout:             getEnvDuration("REQUEST_TIMEOUT", 10*time.Second),
+		LogLevel:                   getEnv("LOG_LEVEL", "info"),
 	}
 }
 
@@ -66,3 +174,39 @@ func getEnvInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func getEnvBool(key string, fallback bool) bool {
+	if val, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if val, ok := os.LookupEnv(key); ok {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+// getEnvGroups parses a ";"-separated list of ","-separated groups. Blank
+// entries are dropped, as are groups left with fewer than two members.
+func getEnvGroups(key string) [][]string {
+	var groups [][]string
+	for _, raw := range strings.Split(os.Getenv(key), ";") {
+		var group []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				group = append(group, item)
+			}
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
@@ -2,7 +2,9 @@
 package coordinator
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -24,6 +26,8 @@ type TunerInfo struct {
 	TunerIndex int        `json:"tuner_index"`
 	State      TunerState `json:"state"`
 	EventID    string     `json:"event_id,omitempty"`
+	ChainID    string     `json:"chain_id,omitempty"`
+	Channel    string     `json:"channel,omitempty"`
 	AssignedAt time.Time  `json:"assigned_at,omitempty"`
 }
 
@@ -36,18 +40,47 @@ type Device struct {
 	Online      bool         `json:"online"`
 	LastSeenAt  time.Time    `json:"last_seen_at"`
 	RegisterdAt time.Time    `json:"registered_at"`
+
+	// Channels lists the channels the device can tune. Empty means the
+	// device's lineup is unknown and it is treated as carrying every channel.
+	Channels []string `json:"channels,omitempty"`
+
+	// AgentVersion is the agent version from the device's last heartbeat.
+	// Empty until the device reports one.
+	AgentVersion string `json:"agent_version,omitempty"`
+}
+
+// Allocation identifies the tuner an event was placed on and the channel it
+// should tune, which may be an equivalent of the requested one.
+type Allocation struct {
+	DeviceID   string `json:"device_id"`
+	TunerIndex int    `json:"tuner_index"`
+	Channel    string `json:"channel,omitempty"`
+	EventID    string `json:"event_id"`
 }
 
+// Sentinel errors.
+var (
+	ErrNoTunerForChannel = errors.New("coordinator: no available tuner carries the channel")
+	ErrNoFailoverTuner   = errors.New("coordinator: no alternate tuner available for failover")
+)
+
 // Coordinator manages AntBox devices and their tuner assignments.
 type Coordinator struct {
 	mu      sync.RWMutex
 	devices map[string]*Device
+
+	// related maps a channel to the set of channels that carry the same
+	// programming (e.g. an SD and an HD feed), used for allocation fallback
+	// and failover.
+	related map[string]map[string]bool
 }
 
 // New creates a new Coordinator.
 func New() *Coordinator {
 	return &Coordinator{
 		devices: make(map[string]*Device),
+		related: make(map[string]map[string]bool),
 	}
 }
 
@@ -125,6 +158,301 @@ func (c *Coordinator) AssignTuner(eventID string) (string, int, error) {
 	return "", 0, fmt.Errorf("no available tuners for event %s", eventID)
 }
 
+// SetDeviceChannels records the channel lineup of a device. An empty lineup
+// makes the device eligible for every channel.
+func (c *Coordinator) SetDeviceChannels(deviceID string, channels []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dev, ok := c.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("device not found: %s", deviceID)
+	}
+	dev.Channels = append([]string(nil), channels...)
+
+	log.WithFields(log.Fields{
+		"device_id": deviceID,
+		"channels":  len(channels),
+	}).Info("device channel lineup updated")
+
+	return nil
+}
+
+// RelateChannels groups channels that carry the same programming. A channel
+// can be tuned through any of its related channels when no device carrying
+// it has a free tuner. Groups are merged transitively.
+func (c *Coordinator) RelateChannels(channels ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group := make(map[string]bool)
+	for _, ch := range channels {
+		group[ch] = true
+		for other := range c.related[ch] {
+			group[other] = true
+		}
+	}
+	for ch := range group {
+		c.related[ch] = group
+	}
+}
+
+// AssignTunerForChannel assigns a free tuner on an online device that carries
+// the channel. Devices carrying the channel itself are preferred; related
+// channels are used only when none of them has a free tuner.
+func (c *Coordinator) AssignTunerForChannel(eventID, channel string) (Allocation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	alloc, ok := c.allocateLocked(eventID, "", channel, "")
+	if !ok {
+		return Allocation{}, fmt.Errorf("%w: %s (event %s)", ErrNoTunerForChannel, channel, eventID)
+	}
+	return alloc, nil
+}
+
+// FailoverTuner marks a tuner as failed and moves its event to a free tuner on
+// another online device that carries the same channel or a related one. The
+// failed tuner stays out of the pool until RecoverTuner is called. If no
+// alternate is free, the tuner is still marked failed and ErrNoFailoverTuner
+// is returned.
+func (c *Coordinator) FailoverTuner(deviceID string, tunerIndex int) (Allocation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dev, ok := c.devices[deviceID]
+	if !ok {
+		return Allocation{}, fmt.Errorf("device not found: %s", deviceID)
+	}
+	if tunerIndex < 0 || tunerIndex >= len(dev.Tuners) {
+		return Allocation{}, fmt.Errorf("invalid tuner index %d for device %s (has %d tuners)", tunerIndex, deviceID, len(dev.Tuners))
+	}
+
+	tuner := dev.Tuners[tunerIndex]
+	if tuner.State != TunerAssigned {
+		return Allocation{}, fmt.Errorf("tuner %d on device %s is not assigned (state: %s)", tunerIndex, deviceID, tuner.State)
+	}
+
+	eventID, chainID, channel := tuner.EventID, tuner.ChainID, tuner.Channel
+	tuner.State = TunerFailed
+	tuner.EventID = ""
+	tuner.ChainID = ""
+	tuner.AssignedAt = time.Time{}
+
+	alloc, ok := c.allocateLocked(eventID, chainID, channel, deviceID)
+	if !ok {
+		log.WithFields(log.Fields{
+			"device_id":   deviceID,
+			"tuner_index": tunerIndex,
+			"event_id":    eventID,
+			"channel":     channel,
+		}).Error("tuner failed, no alternate available")
+		return Allocation{}, fmt.Errorf("%w: event %s on %s", ErrNoFailoverTuner, eventID, channel)
+	}
+
+	log.WithFields(log.Fields{
+		"from_device": deviceID,
+		"from_tuner":  tunerIndex,
+		"to_device":   alloc.DeviceID,
+		"to_tuner":    alloc.TunerIndex,
+		"event_id":    eventID,
+		"channel":     alloc.Channel,
+	}).Warn("tuner failed over")
+
+	return alloc, nil
+}
+
+// RecoverTuner returns a failed tuner to the available pool.
+func (c *Coordinator) RecoverTuner(deviceID string, tunerIndex int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dev, ok := c.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("device not found: %s", deviceID)
+	}
+	if tunerIndex < 0 || tunerIndex >= len(dev.Tuners) {
+		return fmt.Errorf("invalid tuner index %d for device %s (has %d tuners)", tunerIndex, deviceID, len(dev.Tuners))
+	}
+
+	tuner := dev.Tuners[tunerIndex]
+	if tuner.State != TunerFailed {
+		return fmt.Errorf("tuner %d on device %s is not failed (state: %s)", tunerIndex, deviceID, tuner.State)
+	}
+	tuner.State = TunerAvailable
+	tuner.Channel = ""
+
+	log.WithFields(log.Fields{
+		"device_id":   deviceID,
+		"tuner_index": tunerIndex,
+	}).Info("tuner recovered")
+
+	return nil
+}
+
+// allocateLocked assigns the first free tuner, in device ID order, on an
+// online device other than excludeDevice that carries channel, falling back
+// to related channels. An empty channel matches every device.
+// Must be called with c.mu held for writing.
+func (c *Coordinator) allocateLocked(eventID, chainID, channel, excludeDevice string) (Allocation, bool) {
+	ids := make([]string, 0, len(c.devices))
+	for id := range c.devices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, want := range c.channelPreferenceLocked(channel) {
+		for _, id := range ids {
+			dev := c.devices[id]
+			if !dev.Online || id == excludeDevice || !dev.carries(want) {
+				continue
+			}
+			for _, tuner := range dev.Tuners {
+				if tuner.State != TunerAvailable {
+					continue
+				}
+				tuner.State = TunerAssigned
+				tuner.EventID = eventID
+				tuner.ChainID = chainID
+				tuner.Channel = want
+				tuner.AssignedAt = time.Now()
+
+				log.WithFields(log.Fields{
+					"device_id":   dev.ID,
+					"tuner_index": tuner.TunerIndex,
+					"event_id":    eventID,
+					"channel":     want,
+				}).Info("tuner assigned")
+
+				return Allocation{DeviceID: dev.ID, TunerIndex: tuner.TunerIndex, Channel: want, EventID: eventID}, true
+			}
+		}
+	}
+	return Allocation{}, false
+}
+
+// channelPreferenceLocked returns channel followed by its related channels in
+// name order. Must be called with c.mu held.
+func (c *Coordinator) channelPreferenceLocked(channel string) []string {
+	prefs := []string{channel}
+	var related []string
+	for other := range c.related[channel] {
+		if other != channel {
+			related = append(related, other)
+		}
+	}
+	sort.Strings(related)
+	return append(prefs, related...)
+}
+
+// carries reports whether the device can tune the channel.
+func (d *Device) carries(channel string) bool {
+	if channel == "" || len(d.Channels) == 0 {
+		return true
+	}
+	for _, ch := range d.Channels {
+		if ch == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// AssignChainTuner assigns a tuner to an event that belongs to a chain. The
+// first member of a chain is allocated like AssignTunerForChannel; later
+// members are handed the same tuner so the chain records contiguously on one
+// device, provided the device carries their channel or a related one. The
+// tuner stays reserved for the chain until ReleaseChain is called, so no other
+// event can take it between members.
+func (c *Coordinator) AssignChainTuner(chainID, eventID, channel string) (Allocation, error) {
+	if chainID == "" {
+		return c.AssignTunerForChannel(eventID, channel)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if dev, tuner := c.findChainTunerLocked(chainID); tuner != nil {
+		if !dev.Online {
+			return Allocation{}, fmt.Errorf("device %s holding chain %s is offline", dev.ID, chainID)
+		}
+		want, ok := c.carriedChannelLocked(dev, channel)
+		if !ok {
+			return Allocation{}, fmt.Errorf("%w: %s on device %s holding chain %s", ErrNoTunerForChannel, channel, dev.ID, chainID)
+		}
+		tuner.EventID = eventID
+		tuner.Channel = want
+		tuner.AssignedAt = time.Now()
+
+		log.WithFields(log.Fields{
+			"device_id":   dev.ID,
+			"tuner_index": tuner.TunerIndex,
+			"event_id":    eventID,
+			"chain_id":    chainID,
+			"channel":     want,
+		}).Info("chain tuner handed to next event")
+
+		return Allocation{DeviceID: dev.ID, TunerIndex: tuner.TunerIndex, Channel: want, EventID: eventID}, nil
+	}
+
+	alloc, ok := c.allocateLocked(eventID, chainID, channel, "")
+	if !ok {
+		return Allocation{}, fmt.Errorf("%w: %s (chain %s)", ErrNoTunerForChannel, channel, chainID)
+	}
+	return alloc, nil
+}
+
+// carriedChannelLocked returns the first of channel and its related channels
+// that the device carries. Must be called with c.mu held.
+func (c *Coordinator) carriedChannelLocked(dev *Device, channel string) (string, bool) {
+	for _, want := range c.channelPreferenceLocked(channel) {
+		if dev.carries(want) {
+			return want, true
+		}
+	}
+	return "", false
+}
+
+// ReleaseChain releases the tuner reserved for a chain. Releasing a chain
+// that holds no tuner is a no-op.
+func (c *Coordinator) ReleaseChain(chainID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dev, tuner := c.findChainTunerLocked(chainID)
+	if tuner == nil {
+		return
+	}
+
+	tuner.State = TunerAvailable
+	tuner.EventID = ""
+	tuner.ChainID = ""
+	tuner.Channel = ""
+	tuner.AssignedAt = time.Time{}
+
+	log.WithFields(log.Fields{
+		"device_id":   dev.ID,
+		"tuner_index": tuner.TunerIndex,
+		"chain_id":    chainID,
+	}).Info("chain tuner released")
+}
+
+// findChainTunerLocked returns the tuner reserved for a chain, if any.
+// Must be called with c.mu held.
+func (c *Coordinator) findChainTunerLocked(chainID string) (*Device, *TunerInfo) {
+	if chainID == "" {
+		return nil, nil
+	}
+	for _, dev := range c.devices {
+		for _, tuner := range dev.Tuners {
+			if tuner.State == TunerAssigned && tuner.ChainID == chainID {
+				return dev, tuner
+			}
+		}
+	}
+	return nil, nil
+}
+
 // ReleaseTuner releases a previously assigned tuner back to the available pool.
 func (c *Coordinator) ReleaseTuner(deviceID string, tunerIndex int) error {
 	c.mu.Lock()
@@ -147,6 +475,8 @@ func (c *Coordinator) ReleaseTuner(deviceID string, tunerIndex int) error {
 	oldEvent := tuner.EventID
 	tuner.State = TunerAvailable
 	tuner.EventID = ""
+	tuner.ChainID = ""
+	tuner.Channel = ""
 	tuner.AssignedAt = time.Time{}
 
 	log.WithFields(log.Fields{
@@ -177,6 +507,70 @@ func (c *Coordinator) GetAvailableTuners() []TunerInfo {
 	return result
 }
 
+// ChannelTunerCount returns how many working tuners on online devices can
+// tune the channel, whether or not they are currently assigned.
+func (c *Coordinator) ChannelTunerCount(channel string) int {
+	return c.ChannelTunerCountOn(channel, nil)
+}
+
+// ChannelTunerCountOn is ChannelTunerCount restricted to the listed devices.
+// A nil list counts every device.
+func (c *Coordinator) ChannelTunerCountOn(channel string, deviceIDs []string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	count := 0
+	for _, dev := range c.devices {
+		if !dev.Online || !dev.carries(channel) || !listed(deviceIDs, dev.ID) {
+			continue
+		}
+		for _, tuner := range dev.Tuners {
+			if tuner.State != TunerFailed {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// ChannelsShareTuner reports whether a working tuner on an online device can
+// tune both channels, so that recordings on one compete with the other.
+func (c *Coordinator) ChannelsShareTuner(channel, other string) bool {
+	return c.ChannelsShareTunerOn(channel, other, nil)
+}
+
+// ChannelsShareTunerOn is ChannelsShareTuner restricted to the listed
+// devices. A nil list considers every device.
+func (c *Coordinator) ChannelsShareTunerOn(channel, other string, deviceIDs []string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, dev := range c.devices {
+		if !dev.Online || !dev.carries(channel) || !dev.carries(other) || !listed(deviceIDs, dev.ID) {
+			continue
+		}
+		for _, tuner := range dev.Tuners {
+			if tuner.State != TunerFailed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listed reports whether id is in deviceIDs; a nil list includes every ID.
+func listed(deviceIDs []string, id string) bool {
+	if deviceIDs == nil {
+		return true
+	}
+	for _, d := range deviceIDs {
+		if d == id {
+			return true
+		}
+	}
+	return false
+}
+
 // GetDevice returns a copy of the device with the given ID.
 func (c *Coordinator) GetDevice(deviceID string) (*Device, error) {
 	c.mu.RLock()
@@ -187,13 +581,20 @@ func (c *Coordinator) GetDevice(deviceID string) (*Device, error) {
 		return nil, fmt.Errorf("device not found: %s", deviceID)
 	}
 
-	copy := *dev
-	copy.Tuners = make([]*TunerInfo, len(dev.Tuners))
-	for i, t := range dev.Tuners {
+	return dev.clone(), nil
+}
+
+// clone returns a copy of the device that shares no mutable state with it,
+// so callers can read it after the lock is released.
+func (d *Device) clone() *Device {
+	copy := *d
+	copy.Channels = append([]string(nil), d.Channels...)
+	copy.Tuners = make([]*TunerInfo, len(d.Tuners))
+	for i, t := range d.Tuners {
 		tc := *t
 		copy.Tuners[i] = &tc
 	}
-	return &copy, nil
+	return &copy
 }
 
 // SetDeviceOnline sets the online status of a device.
@@ -217,15 +618,38 @@ func (c *Coordinator) SetDeviceOnline(deviceID string, online bool) error {
 	return nil
 }
 
-// ListDevices returns a list of all registered devices.
+// RecordHeartbeat marks a device online and records the agent version it
+// reported. An empty version keeps the previously reported one.
+func (c *Coordinator) RecordHeartbeat(deviceID, agentVersion string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dev, ok := c.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("device not found: %s", deviceID)
+	}
+
+	dev.Online = true
+	dev.LastSeenAt = time.Now()
+	if agentVersion != "" && agentVersion != dev.AgentVersion {
+		log.WithFields(log.Fields{
+			"device_id": deviceID,
+			"from":      dev.AgentVersion,
+			"to":        agentVersion,
+		}).Info("device agent version changed")
+		dev.AgentVersion = agentVersion
+	}
+	return nil
+}
+
+// ListDevices returns copies of all registered devices.
 func (c *Coordinator) ListDevices() []*Device {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	result := make([]*Device, 0, len(c.devices))
 	for _, dev := range c.devices {
-		copy := *dev
-		result = append(result, &copy)
+		result = append(result, dev.clone())
 	}
 	return result
 }
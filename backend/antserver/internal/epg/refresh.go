@@ -0,0 +1,599 @@
+package epg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"antserver/internal/scheduler"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Default guide refresh settings.
+const (
+	// DefaultRefreshInterval is how often the upstream guide is fetched.
+	DefaultRefreshInterval = time.Hour
+
+	// DefaultMaxShift is the largest change to a programme's start or end
+	// that is applied to its event automatically. Larger shifts flag the
+	// event for review instead.
+	DefaultMaxShift = 2 * time.Hour
+
+	// DefaultStaleAfter is how long the guide may go without a successful
+	// refresh before it is reported as stale.
+	DefaultStaleAfter = 6 * time.Hour
+
+	// DefaultRetryBackoff is the wait after the first failed refresh. It
+	// doubles with each consecutive failure up to the refresh interval.
+	DefaultRetryBackoff = 30 * time.Second
+)
+
+// MatchWindow is how far apart two airings of the same programme may start
+// and still be treated as one programme that moved. Airings further apart
+// are different showings, e.g. a weekly repeat.
+const MatchWindow = 24 * time.Hour
+
+// Review reasons recorded on events by the refresher.
+const (
+	ReviewShiftTooLarge = "guide shift exceeds max shift"
+	ReviewStartedShift  = "guide times changed after event started"
+	ReviewRemoved       = "programme removed from guide"
+)
+
+// ErrInvalidRefreshConfig is returned by NewRefresher for unusable settings.
+var ErrInvalidRefreshConfig = errors.New("epg: invalid refresh config")
+
+// Key identifies a programme across guide revisions by channel, title and
+// sub-title; its times may change between revisions.
+func (e Entry) Key() string {
+	return e.Channel + "\x00" + e.Metadata.Title + "\x00" + e.Metadata.Tags["sub_title"]
+}
+
+// Change is a programme whose start or end time moved between revisions.
+type Change struct {
+	Old Entry `json:"old"`
+	New Entry `json:"new"`
+}
+
+// unchanged reports whether the programme kept its start and end times.
+func (c Change) unchanged() bool {
+	return c.Old.StartTime.Equal(c.New.StartTime) && c.Old.EndTime.Equal(c.New.EndTime)
+}
+
+// Shift returns the larger of the start and end time changes.
+func (c Change) Shift() time.Duration {
+	shift := absDuration(c.New.StartTime.Sub(c.Old.StartTime))
+	if d := absDuration(c.New.EndTime.Sub(c.Old.EndTime)); d > shift {
+		shift = d
+	}
+	return shift
+}
+
+// Diff is the difference between two guide revisions.
+type Diff struct {
+	Added   []Entry  `json:"added"`
+	Changed []Change `json:"changed"`
+	Removed []Entry  `json:"removed"`
+}
+
+// DiffEntries compares two guide revisions. Programmes with the same key are
+// paired by nearest start time within MatchWindow; paired programmes whose
+// times differ are changed, unpaired ones are added or removed. Each list
+// keeps the order of the revision it came from.
+func DiffEntries(old, new []Entry) Diff {
+	pairs, added, removed := matchEntries(old, new)
+
+	var d Diff
+	for _, j := range added {
+		d.Added = append(d.Added, new[j])
+	}
+	for j, i := range pairs {
+		if i < 0 {
+			continue
+		}
+		if !old[i].StartTime.Equal(new[j].StartTime) || !old[i].EndTime.Equal(new[j].EndTime) {
+			d.Changed = append(d.Changed, Change{Old: old[i], New: new[j]})
+		}
+	}
+	for _, i := range removed {
+		d.Removed = append(d.Removed, old[i])
+	}
+	return d
+}
+
+// matchEntries pairs new entries with old ones. pairs[j] is the index of the
+// old entry paired with new[j], or -1; added and removed list the unpaired
+// new and old indices in order.
+func matchEntries(old, new []Entry) (pairs []int, added, removed []int) {
+	byKey := make(map[string][]int)
+	for i, e := range old {
+		byKey[e.Key()] = append(byKey[e.Key()], i)
+	}
+
+	type candidate struct {
+		oldIdx, newIdx int
+		delta          time.Duration
+	}
+	var candidates []candidate
+	for j, e := range new {
+		for _, i := range byKey[e.Key()] {
+			if delta := absDuration(e.StartTime.Sub(old[i].StartTime)); delta <= MatchWindow {
+				candidates = append(candidates, candidate{i, j, delta})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool { return candidates[a].delta < candidates[b].delta })
+
+	pairs = make([]int, len(new))
+	for j := range pairs {
+		pairs[j] = -1
+	}
+	oldPaired := make([]bool, len(old))
+	for _, c := range candidates {
+		if pairs[c.newIdx] < 0 && !oldPaired[c.oldIdx] {
+			pairs[c.newIdx] = c.oldIdx
+			oldPaired[c.oldIdx] = true
+		}
+	}
+
+	for j, i := range pairs {
+		if i < 0 {
+			added = append(added, j)
+		}
+	}
+	for i, paired := range oldPaired {
+		if !paired {
+			removed = append(removed, i)
+		}
+	}
+	return pairs, added, removed
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// RefreshConfig holds the guide refresh settings.
+type RefreshConfig struct {
+	URL          string
+	Interval     time.Duration
+	MaxShift     time.Duration
+	StaleAfter   time.Duration
+	RetryBackoff time.Duration
+
+	// Client fetches the guide. Nil uses a client with FetchTimeout.
+	Client *http.Client
+}
+
+// DefaultRefreshConfig returns the default refresh settings for a guide URL.
+func DefaultRefreshConfig(url string) RefreshConfig {
+	return RefreshConfig{
+		URL:          url,
+		Interval:     DefaultRefreshInterval,
+		MaxShift:     DefaultMaxShift,
+		StaleAfter:   DefaultStaleAfter,
+		RetryBackoff: DefaultRetryBackoff,
+	}
+}
+
+// RefreshResult reports what one refresh changed.
+type RefreshResult struct {
+	NotModified bool     `json:"not_modified"`
+	Diff        Diff     `json:"diff"`
+	Adjusted    []string `json:"adjusted"`
+	Flagged     []string `json:"flagged"`
+}
+
+// RefreshStatus is a snapshot of the refresher for health reporting.
+type RefreshStatus struct {
+	URL                 string    `json:"url"`
+	LastAttempt         time.Time `json:"last_attempt,omitempty"`
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Entries             int       `json:"entries"`
+	Stale               bool      `json:"stale"`
+}
+
+// tracked is a stored guide entry and the event linked to it, if any.
+type tracked struct {
+	entry   Entry
+	eventID string
+}
+
+// Refresher periodically pulls an XMLTV guide and keeps the scheduler's
+// events for guide programmes in line with it. It is safe for concurrent use.
+type Refresher struct {
+	cfg   RefreshConfig
+	sched *scheduler.Scheduler
+
+	// refreshMu serialises refreshes; mu guards the fields below it.
+	refreshMu  sync.Mutex
+	mu         sync.Mutex
+	entries    []tracked
+	validators Validators
+
+	started     time.Time
+	lastAttempt time.Time
+	lastSuccess time.Time
+	lastErr     string
+	failures    int
+
+	now func() time.Time
+}
+
+// NewRefresher creates a Refresher that applies guide changes to sched.
+func NewRefresher(cfg RefreshConfig, sched *scheduler.Scheduler) (*Refresher, error) {
+	if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRefreshConfig, ErrInvalidURL)
+	}
+	if cfg.Interval <= 0 || cfg.MaxShift < 0 || cfg.StaleAfter <= 0 || cfg.RetryBackoff <= 0 {
+		return nil, fmt.Errorf("%w: interval %s, max shift %s, stale after %s, retry backoff %s",
+			ErrInvalidRefreshConfig, cfg.Interval, cfg.MaxShift, cfg.StaleAfter, cfg.RetryBackoff)
+	}
+	return &Refresher{
+		cfg:     cfg,
+		sched:   sched,
+		started: time.Now(),
+		now:     time.Now,
+	}, nil
+}
+
+// Interval returns the configured refresh interval.
+func (r *Refresher) Interval() time.Duration {
+	return r.cfg.Interval
+}
+
+// Run refreshes the guide immediately and then every interval until ctx is
+// cancelled, retrying failures with backoff. It pats on every iteration so
+// it can be supervised by the watchdog.
+func (r *Refresher) Run(ctx context.Context, pat func()) {
+	for {
+		pat()
+		r.Refresh(ctx)
+
+		timer := time.NewTimer(r.NextDelay())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// NextDelay returns the wait before the next refresh: the interval after a
+// success, or the retry backoff after consecutive failures.
+func (r *Refresher) NextDelay() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures == 0 {
+		return r.cfg.Interval
+	}
+	d := r.cfg.RetryBackoff
+	for i := 1; i < r.failures && d < r.cfg.Interval; i++ {
+		d *= 2
+	}
+	if d > r.cfg.Interval {
+		d = r.cfg.Interval
+	}
+	return d
+}
+
+// Refresh fetches the guide once and applies any changes. An unchanged guide
+// (HTTP 304) counts as a successful refresh.
+func (r *Refresher) Refresh(ctx context.Context) (RefreshResult, error) {
+	r.refreshMu.Lock()
+	defer r.refreshMu.Unlock()
+
+	r.mu.Lock()
+	prev := r.validators
+	r.lastAttempt = r.now()
+	r.mu.Unlock()
+
+	doc, validators, err := FetchConditional(ctx, r.cfg.Client, r.cfg.URL, prev)
+	if errors.Is(err, ErrNotModified) {
+		r.recordSuccess(validators)
+		log.WithField("url", r.cfg.URL).Debug("guide not modified")
+		return RefreshResult{NotModified: true}, nil
+	}
+	if err != nil {
+		r.recordFailure(err)
+		return RefreshResult{}, err
+	}
+
+	entries, skipped := doc.Entries()
+	result := r.apply(entries)
+	r.recordSuccess(validators)
+
+	log.WithFields(log.Fields{
+		"url":      r.cfg.URL,
+		"added":    len(result.Diff.Added),
+		"changed":  len(result.Diff.Changed),
+		"removed":  len(result.Diff.Removed),
+		"skipped":  len(skipped),
+		"adjusted": len(result.Adjusted),
+		"flagged":  len(result.Flagged),
+	}).Info("guide refreshed")
+	return result, nil
+}
+
+func (r *Refresher) recordSuccess(validators Validators) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.validators = validators
+	r.lastSuccess = r.now()
+	r.lastErr = ""
+	r.failures = 0
+}
+
+func (r *Refresher) recordFailure(err error) {
+	r.mu.Lock()
+	r.lastErr = err.Error()
+	r.failures++
+	failures := r.failures
+	r.mu.Unlock()
+
+	log.WithError(err).WithFields(log.Fields{
+		"url":      r.cfg.URL,
+		"failures": failures,
+		"retry_in": r.NextDelay().String(),
+	}).Warn("guide refresh failed")
+}
+
+// apply diffs entries against the stored guide, updates the affected events
+// and stores entries as the new guide. The caller holds refreshMu.
+//
+// The refresher never creates events; those come from an explicit import or
+// rule. Each entry is linked to the existing event for its programme, if
+// any, and only linked events are adjusted or flagged.
+func (r *Refresher) apply(entries []Entry) RefreshResult {
+	r.mu.Lock()
+	stored := r.entries
+	r.mu.Unlock()
+
+	old := make([]Entry, len(stored))
+	for i, t := range stored {
+		old[i] = t.entry
+	}
+	pairs, added, removed := matchEntries(old, entries)
+
+	result := RefreshResult{
+		Adjusted: []string{},
+		Flagged:  []string{},
+	}
+	next := make([]tracked, len(entries))
+	linked := make(map[string]bool)
+	for j, i := range pairs {
+		next[j].entry = entries[j]
+		if i >= 0 && stored[i].eventID != "" {
+			next[j].eventID = stored[i].eventID
+			linked[stored[i].eventID] = true
+		}
+	}
+	for _, j := range added {
+		next[j].entry = entries[j]
+		result.Diff.Added = append(result.Diff.Added, entries[j])
+	}
+
+	for j, i := range pairs {
+		var change Change
+		if i >= 0 {
+			change = Change{Old: stored[i].entry, New: entries[j]}
+			if !change.unchanged() {
+				result.Diff.Changed = append(result.Diff.Changed, change)
+			}
+		}
+		if next[j].eventID == "" {
+			// An event scheduled since the last refresh is compared
+			// against its own window rather than the previous guide.
+			ref := entries[j]
+			if i >= 0 {
+				ref = stored[i].entry
+			}
+			evt := r.findEvent(ref, linked)
+			if evt == nil {
+				continue
+			}
+			next[j].eventID = evt.ID
+			linked[evt.ID] = true
+			change = eventChange(evt, entries[j])
+		}
+		if change.unchanged() {
+			continue
+		}
+
+		switch r.applyChange(next[j].eventID, change) {
+		case changeAdjusted:
+			result.Adjusted = append(result.Adjusted, next[j].eventID)
+		case changeFlagged:
+			result.Flagged = append(result.Flagged, next[j].eventID)
+		}
+	}
+
+	for _, i := range removed {
+		result.Diff.Removed = append(result.Diff.Removed, stored[i].entry)
+		if r.flag(stored[i].eventID, ReviewRemoved) {
+			result.Flagged = append(result.Flagged, stored[i].eventID)
+		}
+	}
+
+	r.mu.Lock()
+	r.entries = next
+	r.mu.Unlock()
+	return result
+}
+
+// findEvent returns the unfinished event for the entry's programme that
+// starts nearest to it within MatchWindow, skipping events already linked to
+// another entry. It returns nil when there is none.
+func (r *Refresher) findEvent(e Entry, linked map[string]bool) *scheduler.Event {
+	var best *scheduler.Event
+	var bestDelta time.Duration
+	for _, evt := range r.sched.ListEvents() {
+		if linked[evt.ID] || isFinished(evt.State) {
+			continue
+		}
+		if (Entry{Channel: evt.Channel, Metadata: evt.Metadata}).Key() != e.Key() {
+			continue
+		}
+		delta := absDuration(evt.StartTime.Sub(e.StartTime))
+		if delta > MatchWindow {
+			continue
+		}
+		if best == nil || delta < bestDelta {
+			best, bestDelta = evt, delta
+		}
+	}
+	return best
+}
+
+// eventChange describes moving evt to the entry's window. An entry without
+// an end time uses its league duration, as the event did when it was created.
+func eventChange(evt *scheduler.Event, e Entry) Change {
+	current := Entry{Channel: evt.Channel, StartTime: evt.StartTime, EndTime: evt.EndTime, Metadata: evt.Metadata}
+	e.EndTime = entryEnd(e)
+	return Change{Old: current, New: e}
+}
+
+type changeOutcome int
+
+const (
+	changeIgnored changeOutcome = iota
+	changeAdjusted
+	changeFlagged
+)
+
+// applyChange moves the event linked to a changed programme, or flags it
+// when the shift is too large or the event has already started. Entries
+// without an end time end after their league duration, as the event did
+// when it was created.
+func (r *Refresher) applyChange(eventID string, change Change) changeOutcome {
+	if eventID == "" {
+		return changeIgnored
+	}
+	change.Old.EndTime = entryEnd(change.Old)
+	change.New.EndTime = entryEnd(change.New)
+	evt, err := r.sched.GetEvent(eventID)
+	if err != nil || isFinished(evt.State) {
+		return changeIgnored
+	}
+
+	fields := log.Fields{
+		"event_id":  eventID,
+		"shift":     change.Shift().String(),
+		"max_shift": r.cfg.MaxShift.String(),
+	}
+	if shift := change.Shift(); shift > r.cfg.MaxShift {
+		log.WithFields(fields).Warn("guide shift exceeds max shift")
+		if r.flag(eventID, ReviewShiftTooLarge) {
+			return changeFlagged
+		}
+		return changeIgnored
+	}
+
+	err = r.sched.Reschedule(eventID, change.New.StartTime, change.New.EndTime)
+	if errors.Is(err, scheduler.ErrEventStarted) {
+		if r.flag(eventID, ReviewStartedShift) {
+			return changeFlagged
+		}
+		return changeIgnored
+	}
+	if err != nil {
+		log.WithError(err).WithFields(fields).Error("failed to reschedule guide event")
+		return changeIgnored
+	}
+	log.WithFields(fields).Info("guide event window adjusted")
+	return changeAdjusted
+}
+
+// flag marks an unfinished event for review and reports whether it did.
+func (r *Refresher) flag(eventID, reason string) bool {
+	if eventID == "" {
+		return false
+	}
+	evt, err := r.sched.GetEvent(eventID)
+	if err != nil || isFinished(evt.State) {
+		return false
+	}
+	return r.sched.FlagForReview(eventID, reason) == nil
+}
+
+func isFinished(state scheduler.EventState) bool {
+	switch state {
+	case scheduler.StateComplete, scheduler.StateFailed, scheduler.StateCancelled:
+		return true
+	}
+	return false
+}
+
+// entryEnd returns the entry's end time, derived from its league when the
+// guide gave none.
+func entryEnd(e Entry) time.Time {
+	if e.EndTime.IsZero() {
+		return e.StartTime.Add(scheduler.LeagueDuration(e.Metadata.League))
+	}
+	return e.EndTime
+}
+
+// Airings returns the stored guide's airings of the programme with the given
+// title, for scheduler.AlternativeSource.
+func (r *Refresher) Airings(title string) []scheduler.Airing {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result []scheduler.Airing
+	for _, t := range r.entries {
+		if t.entry.Metadata.Title == title {
+			result = append(result, scheduler.Airing{
+				Channel:   t.entry.Channel,
+				Title:     title,
+				StartTime: t.entry.StartTime,
+				EndTime:   entryEnd(t.entry),
+			})
+		}
+	}
+	return result
+}
+
+// Status returns a snapshot of the refresher. The guide is stale when it has
+// not been refreshed successfully within StaleAfter, counting from startup
+// if it never has.
+func (r *Refresher) Status() RefreshStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	since := r.lastSuccess
+	if since.IsZero() {
+		since = r.started
+	}
+	return RefreshStatus{
+		URL:                 r.cfg.URL,
+		LastAttempt:         r.lastAttempt,
+		LastSuccess:         r.lastSuccess,
+		LastError:           r.lastErr,
+		ConsecutiveFailures: r.failures,
+		Entries:             len(r.entries),
+		Stale:               r.now().Sub(since) > r.cfg.StaleAfter,
+	}
+}
+
+// SetTestNow replaces the time function for testing. The startup time used
+// for staleness is reset to the new clock.
+func (r *Refresher) SetTestNow(fn func() time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.now = fn
+	r.started = fn()
+}
@@ -0,0 +1,322 @@
+// Package epg parses XMLTV program guides and maps their entries to
+// recording events.
+package epg
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"antserver/internal/scheduler"
+)
+
+// Limits applied when reading guides.
+const (
+	// MaxDocumentSize caps the size of an XMLTV document read from a request
+	// body or URL.
+	MaxDocumentSize = 10 << 20
+
+	// FetchTimeout bounds how long fetching a guide URL may take.
+	FetchTimeout = 15 * time.Second
+)
+
+// Sentinel errors returned by the epg package.
+var (
+	ErrDocumentTooLarge = errors.New("epg: document exceeds size limit")
+	ErrInvalidURL       = errors.New("epg: url must be http or https")
+	ErrNotModified      = errors.New("epg: guide not modified")
+)
+
+// Document is an XMLTV <tv> document.
+type Document struct {
+	XMLName    xml.Name    `xml:"tv"`
+	Channels   []Channel   `xml:"channel"`
+	Programmes []Programme `xml:"programme"`
+}
+
+// Channel is an XMLTV <channel> element.
+type Channel struct {
+	ID           string   `xml:"id,attr"`
+	DisplayNames []string `xml:"display-name"`
+}
+
+// Programme is an XMLTV <programme> element.
+type Programme struct {
+	Start      string   `xml:"start,attr"`
+	Stop       string   `xml:"stop,attr"`
+	Channel    string   `xml:"channel,attr"`
+	Title      string   `xml:"title"`
+	SubTitle   string   `xml:"sub-title"`
+	Desc       string   `xml:"desc"`
+	Categories []string `xml:"category"`
+}
+
+// Entry is a programme mapped to the fields of a scheduler event.
+type Entry struct {
+	// Index is the programme's position in the document.
+	Index int
+
+	Channel   string
+	StartTime time.Time
+	EndTime   time.Time
+	Metadata  scheduler.EventMetadata
+}
+
+// Validators are the HTTP cache validators of a downloaded guide, sent back
+// on the next download so an unchanged guide is not transferred again.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// Skipped describes a programme that could not be mapped to an event.
+type Skipped struct {
+	Index   int    `json:"index"`
+	Channel string `json:"channel,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// leagueCategories maps XMLTV categories (lower case) to league names used by
+// scheduler.LeagueDuration.
+var leagueCategories = map[string]string{
+	"nfl":               "NFL",
+	"nba":               "NBA",
+	"nhl":               "NHL",
+	"mlb":               "MLB",
+	"mls":               "MLS",
+	"epl":               "EPL",
+	"premier league":    "EPL",
+	"uefa":              "UEFA",
+	"champions league":  "UEFA",
+	"soccer":            "Soccer",
+	"football (soccer)": "Soccer",
+}
+
+// sportCategories maps XMLTV categories (lower case) to sport names.
+var sportCategories = map[string]string{
+	"basketball":        "Basketball",
+	"football":          "Football",
+	"american football": "Football",
+	"hockey":            "Hockey",
+	"ice hockey":        "Hockey",
+	"baseball":          "Baseball",
+	"soccer":            "Soccer",
+	"football (soccer)": "Soccer",
+}
+
+// leagueSports fills in the sport when only a league category is present.
+var leagueSports = map[string]string{
+	"NFL":    "Football",
+	"NBA":    "Basketball",
+	"NHL":    "Hockey",
+	"MLB":    "Baseball",
+	"MLS":    "Soccer",
+	"EPL":    "Soccer",
+	"UEFA":   "Soccer",
+	"Soccer": "Soccer",
+}
+
+// Parse decodes an XMLTV document, reading at most MaxDocumentSize bytes.
+func Parse(r io.Reader) (*Document, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxDocumentSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read xmltv: %w", err)
+	}
+	if len(data) > MaxDocumentSize {
+		return nil, ErrDocumentTooLarge
+	}
+
+	var doc Document
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse xmltv: %w", err)
+	}
+	return &doc, nil
+}
+
+// Fetch downloads and parses an XMLTV document from an http or https URL.
+func Fetch(ctx context.Context, client *http.Client, url string) (*Document, error) {
+	doc, _, err := FetchConditional(ctx, client, url, Validators{})
+	return doc, err
+}
+
+// FetchConditional is like Fetch but sends the validators of a previous
+// download. It returns ErrNotModified when the server answers 304, and the
+// validators of the response otherwise.
+func FetchConditional(ctx context.Context, client *http.Client, url string, prev Validators) (*Document, Validators, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, Validators{}, ErrInvalidURL
+	}
+	if client == nil {
+		client = &http.Client{Timeout: FetchTimeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, Validators{}, fmt.Errorf("build xmltv request: %w", err)
+	}
+	if prev.ETag != "" {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+	if prev.LastModified != "" {
+		req.Header.Set("If-Modified-Since", prev.LastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, Validators{}, fmt.Errorf("fetch xmltv: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, prev, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, Validators{}, fmt.Errorf("fetch xmltv: unexpected status %d", resp.StatusCode)
+	}
+	doc, err := Parse(resp.Body)
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	return doc, Validators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// Entries maps the document's programmes to event entries. Programmes that
+// cannot be mapped are returned as skipped with a reason; index is the
+// programme's position in the document.
+func (d *Document) Entries() ([]Entry, []Skipped) {
+	names := make(map[string]string, len(d.Channels))
+	for _, ch := range d.Channels {
+		if len(ch.DisplayNames) > 0 && strings.TrimSpace(ch.DisplayNames[0]) != "" {
+			names[ch.ID] = strings.TrimSpace(ch.DisplayNames[0])
+		}
+	}
+
+	var entries []Entry
+	var skipped []Skipped
+	for i, p := range d.Programmes {
+		entry, reason := p.toEntry(names)
+		if reason != "" {
+			skipped = append(skipped, Skipped{
+				Index:   i,
+				Channel: p.Channel,
+				Title:   strings.TrimSpace(p.Title),
+				Reason:  reason,
+			})
+			continue
+		}
+		entry.Index = i
+		entries = append(entries, entry)
+	}
+	return entries, skipped
+}
+
+// toEntry maps a programme to an entry, or returns the reason it was skipped.
+func (p Programme) toEntry(channelNames map[string]string) (Entry, string) {
+	channelID := strings.TrimSpace(p.Channel)
+	if channelID == "" {
+		return Entry{}, "missing channel"
+	}
+	title := strings.TrimSpace(p.Title)
+	if title == "" {
+		return Entry{}, "missing title"
+	}
+	if strings.TrimSpace(p.Start) == "" {
+		return Entry{}, "missing start time"
+	}
+
+	start, err := ParseTime(p.Start)
+	if err != nil {
+		return Entry{}, fmt.Sprintf("invalid start time %q", p.Start)
+	}
+
+	var end time.Time
+	if strings.TrimSpace(p.Stop) != "" {
+		end, err = ParseTime(p.Stop)
+		if err != nil {
+			return Entry{}, fmt.Sprintf("invalid stop time %q", p.Stop)
+		}
+		if !end.After(start) {
+			return Entry{}, "stop time is not after start time"
+		}
+	}
+
+	league, sport := classify(p.Categories)
+	if end.IsZero() && league == "" {
+		// The scheduler can only derive an end time from a league.
+		return Entry{}, "missing stop time"
+	}
+
+	channel := channelID
+	if name, ok := channelNames[channelID]; ok {
+		channel = name
+	}
+
+	meta := scheduler.EventMetadata{
+		League:      league,
+		Sport:       sport,
+		Title:       title,
+		Description: strings.TrimSpace(p.Desc),
+	}
+	if sub := strings.TrimSpace(p.SubTitle); sub != "" {
+		meta.Tags = map[string]string{"sub_title": sub}
+	}
+
+	return Entry{
+		Channel:   channel,
+		StartTime: start,
+		EndTime:   end,
+		Metadata:  meta,
+	}, ""
+}
+
+// classify derives the league and sport from XMLTV categories.
+func classify(categories []string) (league, sport string) {
+	for _, c := range categories {
+		key := strings.ToLower(strings.TrimSpace(c))
+		if l, ok := leagueCategories[key]; ok && (league == "" || league == "Soccer") {
+			league = l
+		}
+		if s, ok := sportCategories[key]; ok && sport == "" {
+			sport = s
+		}
+	}
+	if sport == "" {
+		sport = leagueSports[league]
+	}
+	return league, sport
+}
+
+// ParseTime parses an XMLTV timestamp ("YYYYMMDDhhmmss +zzzz"). The offset is
+// optional and defaults to UTC; trailing date components may be omitted.
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	digits, offset := s, ""
+	if i := strings.IndexAny(s, " +-"); i >= 0 {
+		digits, offset = s[:i], strings.TrimSpace(s[i:])
+	}
+
+	layouts := map[int]string{
+		14: "20060102150405",
+		12: "200601021504",
+		10: "2006010215",
+		8:  "20060102",
+	}
+	layout, ok := layouts[len(digits)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid xmltv time %q", s)
+	}
+
+	if offset == "" {
+		return time.ParseInLocation(layout, digits, time.UTC)
+	}
+	return time.Parse(layout+" -0700", digits+" "+offset)
+}
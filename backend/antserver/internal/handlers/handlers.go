@@ -2,12 +2,28 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"antserver/internal/archive"
+	"antserver/internal/channels"
 	"antserver/internal/coordinator"
+	"antserver/internal/epg"
+	"antserver/internal/highlights"
+	"antserver/internal/opconfig"
 	"antserver/internal/recorder"
+	"antserver/internal/retention"
 	"antserver/internal/scheduler"
+	"antserver/internal/semver"
+	"antserver/internal/stats"
+	"antserver/internal/trace"
+	"antserver/internal/urlsign"
+	"antserver/internal/watchdog"
 
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -18,14 +34,109 @@ type Handler struct {
 	Scheduler   *scheduler.Scheduler
 	Coordinator *coordinator.Coordinator
 	Recorder    *recorder.Recorder
+
+	// Capture supervises the ingest transport of each recording started by
+	// PUT /events/:id/start, resuming capture after transport failures. Nil
+	// leaves recordings unsupervised.
+	Capture *recorder.CaptureSupervisor
+
+	// EncodeBudget is the archive encode budget reported by
+	// GET /archive/budget. Nil when archiving is not configured.
+	EncodeBudget *archive.Budget
+
+	// GuideClient fetches guide URLs for POST /events/import. Nil uses a
+	// client with epg.FetchTimeout.
+	GuideClient *http.Client
+
+	// Stats serves GET /stats/reliability. Nil when no stats database is
+	// configured.
+	Stats *stats.Store
+
+	// Channels serves the channel catalog routes. Nil when no channel
+	// database is configured.
+	Channels *channels.Store
+
+	// Retention serves the recording retention policy routes. Nil when no
+	// database is configured.
+	Retention *retention.Store
+
+	// ValidateChannels makes CreateEvent reject channels missing from the
+	// catalog. It has no effect when Channels is nil.
+	ValidateChannels bool
+
+	// OpConfig serves the operational config routes. Nil when hot reload is
+	// not configured.
+	OpConfig *opconfig.Reloader
+
+	// Archive and Activity feed GET /trace/:correlationId. Either may be nil,
+	// in which case archive jobs or the activity timeline are left out.
+	Archive  *archive.Pipeline
+	Activity *trace.Log
+
+	// ArchiveJobs supplies the highlights stored with archive jobs, so the
+	// recording detail keeps them after a restart. Nil when no database is
+	// configured.
+	ArchiveJobs *archive.PostgresJobStore
+
+	// DVRWindow is how far behind live GET /recordings/:id/catchup.m3u8
+	// reaches. Zero uses recorder.DefaultDVRWindow.
+	DVRWindow time.Duration
+
+	// URLSigner signs the catch-up playlist URL returned by
+	// POST /events/:id/admit and checks it on GET /recordings/:id/catchup.m3u8,
+	// and Media presigns the segment URIs in that playlist. Catch-up is not
+	// served while either is nil.
+	URLSigner *urlsign.Signer
+	Media     MediaURLs
+
+	// Guide is the upstream guide refresher reported by GET /health. Nil
+	// when no guide URL is configured.
+	Guide *epg.Refresher
+
+	// Watchdog serves GET /health/loops and GET /ready. Nil reports no loops
+	// and always ready.
+	Watchdog *watchdog.Watchdog
+
+	// CommandMinAgentVersions maps a device command to the oldest agent
+	// version that supports it. Commands not listed run on any agent.
+	CommandMinAgentVersions map[string]string
+
+	// MinAgentVersion is the fleet baseline; GET /devices/versions flags
+	// devices below it. Empty disables the check.
+	MinAgentVersion string
 }
 
+// MediaURLs issues time-limited URLs for stored recording media.
+// storage.Storage implements it.
+type MediaURLs interface {
+	URL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// DefaultCommandMinAgentVersions returns the device commands that older
+// agents do not understand, with the agent version that introduced each.
+func DefaultCommandMinAgentVersions() map[string]string {
+	return map[string]string{
+		"set_output_format": "1.2.0",
+		"set_bitrate":       "1.3.0",
+	}
+}
+
+// ErrorCodeAgentTooOld is the code returned when a command needs a newer
+// agent than the device runs.
+const ErrorCodeAgentTooOld = "agent_too_old"
+
+// unknownAgentVersion groups devices without a usable version in the fleet
+// summary.
+const unknownAgentVersion = "unknown"
+
 // New creates a new Handler with the provided service components.
 func New(sched *scheduler.Scheduler, coord *coordinator.Coordinator, rec *recorder.Recorder) *Handler {
 	return &Handler{
 		Scheduler:   sched,
 		Coordinator: coord,
 		Recorder:    rec,
+
+		CommandMinAgentVersions: DefaultCommandMinAgentVersions(),
 	}
 }
 
@@ -34,16 +145,63 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	// Event routes
 	rg.POST("/events", h.CreateEvent)
 	rg.GET("/events", h.ListEvents)
+	rg.POST("/events/import", h.ImportEvents)
 	rg.GET("/events/:id", h.GetEvent)
+	rg.GET("/events/:id/alternatives", h.GetEventAlternatives)
 	rg.PUT("/events/:id/start", h.StartEvent)
 	rg.PUT("/events/:id/stop", h.StopEvent)
+	rg.POST("/events/:id/admit", h.AdmitEvent)
+
+	// Event chain routes
+	rg.GET("/chains/:id", h.GetChain)
+	rg.PUT("/chains/:id/cancel", h.CancelChain)
 
 	// Recording routes
 	rg.GET("/recordings", h.ListRecordings)
 	rg.GET("/recordings/:id", h.GetRecording)
+	rg.GET("/recordings/:id/highlights", h.GetRecordingHighlights)
+	rg.GET("/recordings/:id/playlist.m3u8", h.GetRecordingPlaylist)
+	rg.GET("/recordings/:id/catchup.m3u8", h.GetCatchupPlaylist)
+
+	// Archive routes
+	rg.GET("/archive/budget", h.GetArchiveBudget)
+
+	// Channel catalog routes
+	rg.POST("/channels", h.CreateChannel)
+	rg.GET("/channels", h.ListChannels)
+	rg.GET("/channels/:id", h.GetChannel)
+	rg.DELETE("/channels/:id", h.DeleteChannel)
+
+	// Retention policy routes
+	rg.GET("/retention/policies", h.ListRetentionPolicies)
+	rg.GET("/retention/policies/:familyId", h.GetRetentionPolicy)
+	rg.PUT("/retention/policies/:familyId", h.SetRetentionPolicy)
 
-	// Device command route
+	// Stats routes
+	rg.GET("/stats/reliability", h.GetReliabilityStats)
+
+	// Operational config routes
+	rg.GET("/config/effective", h.GetEffectiveConfig)
+	rg.POST("/config/reload", h.ReloadConfig)
+
+	// Trace route
+	rg.GET("/trace/:correlationId", h.GetTrace)
+
+	// Device routes
+	rg.GET("/devices", h.ListDevices)
+	rg.GET("/devices/versions", h.GetDeviceVersions)
+	rg.POST("/devices/:id/heartbeat", h.DeviceHeartbeat)
 	rg.POST("/devices/:id/command", h.SendDeviceCommand)
+	rg.PUT("/devices/:id/channels", h.SetDeviceChannels)
+	rg.POST("/devices/:id/tuners/:index/failover", h.FailoverTuner)
+}
+
+// RegisterHealthRoutes wires the health, loop health and readiness routes
+// onto the root router.
+func (h *Handler) RegisterHealthRoutes(r gin.IRoutes) {
+	r.GET("/health", h.Health)
+	r.GET("/health/loops", h.GetLoopHealth)
+	r.GET("/ready", h.Ready)
 }
 
 // --- Request/Response types ---
@@ -56,10 +214,165 @@ type CreateEventRequest struct {
 	Metadata  scheduler.EventMetadata `json:"metadata,omitempty"`
 }
 
+// StartEventRequest is the optional JSON body for starting an event.
+type StartEventRequest struct {
+	// Format selects the recording's segment container ("mpegts" or "fmp4").
+	// Empty uses the server default.
+	Format string `json:"format,omitempty"`
+}
+
+// ImportEventsRequest is the JSON body for importing events from a guide URL.
+// Guides can also be posted directly as an XML body.
+type ImportEventsRequest struct {
+	URL string `json:"url" binding:"required"`
+}
+
+// ImportEventsResponse reports the result of a bulk import.
+type ImportEventsResponse struct {
+	Created []string      `json:"created"`
+	Skipped []epg.Skipped `json:"skipped"`
+}
+
+// AdmitResponse is the catch-up manifest a viewer joining a live event plays
+// from. MediaURL is signed and stops working at ExpiresAt.
+type AdmitResponse struct {
+	EventID     string    `json:"event_id"`
+	RecordingID string    `json:"recording_id"`
+	MediaURL    string    `json:"media_url"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	DVRWindow   string    `json:"dvr_window"`
+}
+
+// CreateChannelRequest is the JSON body for adding a channel to the catalog.
+type CreateChannelRequest struct {
+	CallSign string   `json:"call_sign" binding:"required"`
+	Number   string   `json:"number" binding:"required"`
+	Name     string   `json:"name,omitempty"`
+	LogoURL  string   `json:"logo_url,omitempty"`
+	Devices  []string `json:"devices,omitempty"`
+}
+
+// RetentionPolicyRequest is the JSON body for setting a family's retention
+// policy. Zero disables the respective limit.
+type RetentionPolicyRequest struct {
+	KeepDays  int `json:"keep_days"`
+	KeepCount int `json:"keep_count"`
+}
+
+// RetryPolicyView is a retry policy as reported by GET /config/effective.
+type RetryPolicyView struct {
+	MaxAttempts int    `json:"max_attempts"`
+	Delay       string `json:"delay"`
+}
+
+// DriftView is the drift configuration as reported by GET /config/effective.
+type DriftView struct {
+	CheckInterval string `json:"check_interval"`
+	MaxDrift      string `json:"max_drift"`
+}
+
+// PaddingView is the default recording padding as reported by
+// GET /config/effective.
+type PaddingView struct {
+	PreRoll  string `json:"pre_roll"`
+	PostRoll string `json:"post_roll"`
+}
+
+// StallView is the stall configuration as reported by GET /config/effective.
+type StallView struct {
+	LoopMultiple float64 `json:"loop_multiple"`
+}
+
+// EffectiveConfigResponse reports the operational settings in force.
+type EffectiveConfigResponse struct {
+	Source        string                     `json:"source"`
+	LoadedAt      time.Time                  `json:"loaded_at"`
+	RetryPolicies map[string]RetryPolicyView `json:"retry_policies"`
+	Drift         DriftView                  `json:"drift"`
+	Padding       PaddingView                `json:"padding"`
+	Stall         StallView                  `json:"stall"`
+}
+
+// ReloadConfigResponse lists the settings changed by a reload.
+type ReloadConfigResponse struct {
+	Changes []opconfig.Change `json:"changes"`
+}
+
+// ReloadConfigError reports every problem found in a rejected reload.
+type ReloadConfigError struct {
+	Error  string   `json:"error"`
+	Errors []string `json:"errors"`
+}
+
 // DeviceCommandRequest is the JSON body for sending a command to a device.
 type DeviceCommandRequest struct {
 	Command string                 `json:"command" binding:"required"`
 	Params  map[string]interface{} `json:"params,omitempty"`
+
+	// EventID optionally names the event the command is issued for; the
+	// command then carries that event's correlation ID.
+	EventID string `json:"event_id,omitempty"`
+}
+
+// DeviceHeartbeatRequest is the JSON body of a device heartbeat.
+type DeviceHeartbeatRequest struct {
+	AgentVersion string `json:"agent_version"`
+}
+
+// AgentTooOldResponse rejects a command the device's agent cannot run.
+type AgentTooOldResponse struct {
+	Error           string `json:"error"`
+	Code            string `json:"code"`
+	RequiredVersion string `json:"required_version"`
+	AgentVersion    string `json:"agent_version,omitempty"`
+}
+
+// AgentVersionCount is the number of devices running an agent version.
+type AgentVersionCount struct {
+	Version string `json:"version"`
+	Devices int    `json:"devices"`
+}
+
+// DeviceVersionView identifies a device and its reported agent version.
+type DeviceVersionView struct {
+	DeviceID     string `json:"device_id"`
+	AgentVersion string `json:"agent_version,omitempty"`
+}
+
+// DeviceVersionsResponse summarizes agent versions across the fleet.
+// Versions are newest first, with devices that never reported a usable
+// version counted last as "unknown".
+type DeviceVersionsResponse struct {
+	Baseline      string              `json:"baseline,omitempty"`
+	Versions      []AgentVersionCount `json:"versions"`
+	BelowBaseline []DeviceVersionView `json:"below_baseline"`
+}
+
+// DeviceChannelsRequest is the JSON body for setting a device's channel lineup.
+type DeviceChannelsRequest struct {
+	Channels []string `json:"channels"`
+}
+
+// TraceResponse aggregates everything recorded under a correlation ID.
+type TraceResponse struct {
+	CorrelationID string                      `json:"correlation_id"`
+	Events        []*scheduler.Event          `json:"events"`
+	Recordings    []*recorder.RecordingStatus `json:"recordings"`
+	ArchiveJobs   []*archive.ArchiveJob       `json:"archive_jobs"`
+	Timeline      []trace.Activity            `json:"timeline"`
+}
+
+// HealthResponse is the body of GET /health. Status is "degraded" while the
+// upstream guide is stale.
+type HealthResponse struct {
+	Status string             `json:"status"`
+	Guide  *epg.RefreshStatus `json:"guide,omitempty"`
+}
+
+// LoopHealthResponse reports the internal loops supervised by the watchdog.
+type LoopHealthResponse struct {
+	Status string                `json:"status"`
+	Loops  []watchdog.LoopStatus `json:"loops"`
 }
 
 // ErrorResponse is the standard error response format.
@@ -67,6 +380,13 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// ValidationErrorResponse reports an invalid request field.
+type ValidationErrorResponse struct {
+	Error  string `json:"error"`
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
 // --- Event handlers ---
 
 // CreateEvent handles POST /api/v1/events.
@@ -92,7 +412,44 @@ func (h *Handler) CreateEvent(c *gin.Context) {
 		}
 	}
 
-	evt := h.Scheduler.CreateEvent(req.Channel, startTime, endTime, req.Metadata)
+	if h.ValidateChannels && h.Channels != nil {
+		_, err := h.Channels.GetByCallSign(c.Request.Context(), req.Channel)
+		if errors.Is(err, channels.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+				Error:  "channel " + req.Channel + " is not in the catalog",
+				Field:  "channel",
+				Reason: "unknown channel",
+			})
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("failed to look up channel")
+			respondStoreError(c, "failed to look up channel")
+			return
+		}
+	}
+
+	correlationID, err := requestCorrelationID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	evt, err := h.Scheduler.CreateEventWithCorrelationID(correlationID, req.Channel, startTime, endTime, req.Metadata)
+	var verr *scheduler.ValidationError
+	if errors.As(err, &verr) {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:  verr.Error(),
+			Field:  verr.Field,
+			Reason: verr.Reason.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.Header(trace.Header, evt.CorrelationID)
 
 	// Transition to scheduled state.
 	if err := h.Scheduler.Transition(evt.ID, scheduler.StateScheduled); err != nil {
@@ -106,6 +463,121 @@ func (h *Handler) CreateEvent(c *gin.Context) {
 	c.JSON(http.StatusCreated, evt)
 }
 
+// ImportEvents handles POST /api/v1/events/import.
+// The body is either an XMLTV document (Content-Type application/xml or
+// text/xml) or a JSON ImportEventsRequest naming a guide URL. Every mappable
+// programme becomes a scheduled event; the rest, including programmes whose
+// times the scheduler rejects, are reported as skipped. The
+// X-Correlation-ID header, when given, is carried by every created event, and
+// channels are checked against the catalog as in CreateEvent.
+func (h *Handler) ImportEvents(c *gin.Context) {
+	var doc *epg.Document
+	var err error
+
+	switch c.ContentType() {
+	case "application/xml", "text/xml":
+		doc, err = epg.Parse(c.Request.Body)
+	default:
+		var req ImportEventsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		doc, err = epg.Fetch(c.Request.Context(), h.GuideClient, req.URL)
+	}
+	if err != nil && requestTimedOut(c) {
+		respondTimeout(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	correlationID, err := requestCorrelationID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	entries, skipped := doc.Entries()
+	resp := ImportEventsResponse{
+		Created: make([]string, 0, len(entries)),
+		Skipped: skipped,
+	}
+	if resp.Skipped == nil {
+		resp.Skipped = []epg.Skipped{}
+	}
+
+	// Check every channel against the catalog before creating anything, so
+	// a failed lookup leaves no partial import behind.
+	unknown := make(map[string]bool)
+	if h.ValidateChannels && h.Channels != nil {
+		for _, entry := range entries {
+			if _, seen := unknown[entry.Channel]; seen {
+				continue
+			}
+			_, err := h.Channels.GetByCallSign(c.Request.Context(), entry.Channel)
+			if err != nil && !errors.Is(err, channels.ErrNotFound) {
+				log.WithError(err).Error("failed to look up channel")
+				respondStoreError(c, "failed to look up channel")
+				return
+			}
+			unknown[entry.Channel] = err != nil
+		}
+	}
+
+	for _, entry := range entries {
+		if unknown[entry.Channel] {
+			resp.Skipped = append(resp.Skipped, skippedEntry(entry, "unknown channel"))
+			continue
+		}
+		evt, err := h.Scheduler.CreateEventWithCorrelationID(correlationID, entry.Channel, entry.StartTime, entry.EndTime, entry.Metadata)
+		var verr *scheduler.ValidationError
+		if errors.As(err, &verr) {
+			resp.Skipped = append(resp.Skipped, skippedEntry(entry, verr.Reason.Error()))
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithField("channel", entry.Channel).Error("failed to create imported event")
+			resp.Skipped = append(resp.Skipped, skippedEntry(entry, "failed to schedule"))
+			continue
+		}
+		if err := h.Scheduler.Transition(evt.ID, scheduler.StateScheduled); err != nil {
+			log.WithError(err).WithField("event_id", evt.ID).Error("failed to transition imported event to scheduled")
+			if err := h.Scheduler.Transition(evt.ID, scheduler.StateCancelled); err != nil {
+				log.WithError(err).WithField("event_id", evt.ID).Error("failed to cancel unscheduled imported event")
+			}
+			resp.Skipped = append(resp.Skipped, skippedEntry(entry, "failed to schedule"))
+			continue
+		}
+		resp.Created = append(resp.Created, evt.ID)
+	}
+	sort.Slice(resp.Skipped, func(i, j int) bool {
+		return resp.Skipped[i].Index < resp.Skipped[j].Index
+	})
+	if correlationID != "" {
+		c.Header(trace.Header, correlationID)
+	}
+
+	log.WithFields(log.Fields{
+		"created": len(resp.Created),
+		"skipped": len(resp.Skipped),
+	}).Info("events imported from guide")
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// skippedEntry reports a mapped guide entry that was not imported.
+func skippedEntry(entry epg.Entry, reason string) epg.Skipped {
+	return epg.Skipped{
+		Index:   entry.Index,
+		Channel: entry.Channel,
+		Title:   entry.Metadata.Title,
+		Reason:  reason,
+	}
+}
+
 // ListEvents handles GET /api/v1/events.
 func (h *Handler) ListEvents(c *gin.Context) {
 	events := h.Scheduler.ListEvents()
@@ -123,31 +595,133 @@ func (h *Handler) GetEvent(c *gin.Context) {
 	c.JSON(http.StatusOK, evt)
 }
 
+// GetEventAlternatives handles GET /api/v1/events/:id/alternatives.
+// It lists other airings of the event's programme that fit within tuner
+// capacity, e.g. to offer when the event's own slot conflicts.
+func (h *Handler) GetEventAlternatives(c *gin.Context) {
+	alternatives, err := h.Scheduler.SuggestAlternatives(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, alternatives)
+}
+
 // StartEvent handles PUT /api/v1/events/:id/start.
-// Transitions the event through active -> recording and starts a recording session.
+// Transitions the event through active -> recording, assigns it a tuner that
+// carries its channel and starts a recording session. An event no tuner can
+// take fails with 409.
 func (h *Handler) StartEvent(c *gin.Context) {
 	id := c.Param("id")
 
+	var req StartEventRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	var format recorder.OutputFormat
+	if req.Format != "" {
+		var err error
+		format, err = recorder.ParseOutputFormat(req.Format)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
 	// Transition to active.
 	if err := h.Scheduler.Transition(id, scheduler.StateActive); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	// Place the event on a tuner that carries its channel, or a related one;
+	// chain members record on the tuner reserved for their chain.
+	evt, err := h.Scheduler.GetEvent(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	tuner, err := h.Coordinator.AssignChainTuner(evt.Metadata.ChainID, id, evt.Channel)
+	if err != nil {
+		if terr := h.Scheduler.Transition(id, scheduler.StateFailed); terr != nil {
+			log.WithError(terr).WithField("event_id", id).Error("failed to fail event without a tuner")
+		}
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.Scheduler.AssignDevice(id, tuner.DeviceID, tuner.TunerIndex); err != nil {
+		log.WithError(err).WithField("event_id", id).Warn("tuner assigned to unknown event")
+	}
+
 	// Transition to recording.
 	if err := h.Scheduler.Transition(id, scheduler.StateRecording); err != nil {
+		evt, _ = h.Scheduler.GetEvent(id)
+		h.releaseTuner(evt)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Start the recording.
-	evt, _ := h.Scheduler.GetEvent(id)
-	streamURL := "srt://" + evt.Channel + ":9000"
-	rec := h.Recorder.StartRecording(id, streamURL)
+	// Start the recording from the channel the tuner was given.
+	evt, _ = h.Scheduler.GetEvent(id)
+	streamURL := "srt://" + tuner.Channel + ":9000"
+	rec := h.Recorder.StartRecordingWithOptions(id, streamURL, recorder.RecordingOptions{
+		Format:        format,
+		CorrelationID: evt.CorrelationID,
+	})
+	if h.Capture != nil {
+		// Capture runs through the post-roll in effect when it starts.
+		_, end, _ := h.Scheduler.RecordingWindow(id)
+		if err := h.Capture.Start(rec.ID, tuner.Channel, end); err != nil {
+			log.WithError(err).WithField("recording_id", rec.ID).Error("failed to supervise capture")
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"event":     evt,
 		"recording": rec,
+		"tuner":     tuner,
+	})
+}
+
+// AdmitEvent handles POST /api/v1/events/:id/admit.
+// A viewer joining a live event gets a signed catch-up playlist URL for the
+// event's active recording, so playback can start up to DVRWindow behind
+// live.
+func (h *Handler) AdmitEvent(c *gin.Context) {
+	if h.URLSigner == nil || h.Media == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "catch-up playback not configured"})
+		return
+	}
+
+	id := c.Param("id")
+	if _, err := h.Scheduler.GetEvent(id); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	rec, err := h.Recorder.ActiveRecordingForEvent(id)
+	if err != nil {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "event is not live: " + id})
+		return
+	}
+
+	// Sign the catch-up path under the same prefix this route is mounted on.
+	prefix := strings.TrimSuffix(c.FullPath(), "/events/:id/admit")
+	mediaURL, expires := h.URLSigner.Sign(prefix + "/recordings/" + rec.ID + "/catchup.m3u8")
+
+	window := h.DVRWindow
+	if window <= 0 {
+		window = recorder.DefaultDVRWindow
+	}
+	c.JSON(http.StatusOK, AdmitResponse{
+		EventID:     id,
+		RecordingID: rec.ID,
+		MediaURL:    mediaURL,
+		ExpiresAt:   expires,
+		DVRWindow:   window.String(),
 	})
 }
 
@@ -168,6 +742,8 @@ func (h *Handler) StopEvent(c *gin.Context) {
 		return
 	}
 
+	h.stopCapture(id)
+
 	// Transition to finalizing.
 	if err := h.Scheduler.Transition(id, scheduler.StateFinalizing); err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
@@ -179,11 +755,103 @@ func (h *Handler) StopEvent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
+	h.releaseTuner(evt)
 
 	evt, _ = h.Scheduler.GetEvent(id)
 	c.JSON(http.StatusOK, evt)
 }
 
+// stopCapture ends supervision of an event's active recording, if any.
+func (h *Handler) stopCapture(eventID string) {
+	if h.Capture == nil {
+		return
+	}
+	if rec, err := h.Recorder.ActiveRecordingForEvent(eventID); err == nil {
+		h.Capture.Stop(rec.ID)
+	}
+}
+
+// releaseTuner frees the tuner of an event that has stopped recording. Chain
+// members leave it reserved until every member of the chain has finished.
+func (h *Handler) releaseTuner(evt *scheduler.Event) {
+	if evt.Metadata.ChainID != "" {
+		h.releaseFinishedChain(evt.Metadata.ChainID)
+		return
+	}
+	if evt.DeviceID == "" {
+		return
+	}
+	if err := h.Coordinator.ReleaseTuner(evt.DeviceID, evt.TunerIndex); err != nil {
+		log.WithError(err).WithField("event_id", evt.ID).Warn("failed to release event tuner")
+	}
+}
+
+// releaseFinishedChain frees a chain's tuner once none of its members is
+// left to record.
+func (h *Handler) releaseFinishedChain(chainID string) {
+	if chainID == "" {
+		return
+	}
+	members, err := h.Scheduler.ChainEvents(chainID)
+	if err != nil {
+		return
+	}
+	for _, evt := range members {
+		switch evt.State {
+		case scheduler.StateComplete, scheduler.StateFailed, scheduler.StateCancelled:
+		default:
+			return
+		}
+	}
+	h.Coordinator.ReleaseChain(chainID)
+}
+
+// --- Chain handlers ---
+
+// GetChain handles GET /api/v1/chains/:id.
+// It returns the chain's events in recording order.
+func (h *Handler) GetChain(c *gin.Context) {
+	events, err := h.Scheduler.ChainEvents(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// CancelChain handles PUT /api/v1/chains/:id/cancel.
+// Cancels every member that has not finished recording, stops and finalizes
+// the recording of a member that is recording, so what it captured is kept,
+// and frees the chain's tuner.
+func (h *Handler) CancelChain(c *gin.Context) {
+	id := c.Param("id")
+	cancelled, err := h.Scheduler.CancelChain(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	for _, eventID := range cancelled {
+		rec, err := h.Recorder.ActiveRecordingForEvent(eventID)
+		if err != nil {
+			continue
+		}
+		h.stopCapture(eventID)
+		if err := h.Recorder.StopRecording(rec.ID); err != nil {
+			log.WithError(err).WithField("recording_id", rec.ID).Error("failed to stop cancelled chain recording")
+			continue
+		}
+		if err := h.Recorder.FinalizeRecording(rec.ID); err != nil {
+			log.WithError(err).WithField("recording_id", rec.ID).Error("failed to finalize cancelled chain recording")
+		}
+	}
+	h.Coordinator.ReleaseChain(id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"chain_id":  id,
+		"cancelled": cancelled,
+	})
+}
+
 // --- Recording handlers ---
 
 // ListRecordings handles GET /api/v1/recordings.
@@ -193,6 +861,8 @@ func (h *Handler) ListRecordings(c *gin.Context) {
 }
 
 // GetRecording handles GET /api/v1/recordings/:id.
+// Highlights missing from the in-memory recording are read from the stored
+// archive jobs.
 func (h *Handler) GetRecording(c *gin.Context) {
 	id := c.Param("id")
 	status, err := h.Recorder.GetRecordingStatus(id)
@@ -200,37 +870,720 @@ func (h *Handler) GetRecording(c *gin.Context) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
 		return
 	}
+	if status.Highlights == nil && h.ArchiveJobs != nil {
+		markers, err := h.ArchiveJobs.RecordingHighlights(c.Request.Context(), id)
+		if err != nil {
+			log.WithError(err).WithField("recording_id", id).Warn("stored highlights not loaded")
+		}
+		status.Highlights = markers
+	}
 	c.JSON(http.StatusOK, status)
 }
 
-// --- Device handlers ---
-
-// SendDeviceCommand handles POST /api/v1/devices/:id/command.
-func (h *Handler) SendDeviceCommand(c *gin.Context) {
-	deviceID := c.Param("id")
-
-	var req DeviceCommandRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+// GetRecordingHighlights handles GET /api/v1/recordings/:id/highlights.
+// It serves the recording's highlight markers for the media detail, from
+// the recorder or, once the recording has left memory, from the stored
+// archive jobs. An archived recording without highlights returns an empty
+// list.
+func (h *Handler) GetRecordingHighlights(c *gin.Context) {
+	id := c.Param("id")
+	status, recErr := h.Recorder.GetRecordingStatus(id)
+	if recErr == nil && status.Highlights != nil {
+		c.JSON(http.StatusOK, status.Highlights)
 		return
 	}
 
-	// Verify the device exists.
-	dev, err := h.Coordinator.GetDevice(deviceID)
+	var markers []highlights.Marker
+	if h.ArchiveJobs != nil {
+		var err error
+		markers, err = h.ArchiveJobs.RecordingHighlights(c.Request.Context(), id)
+		if err != nil {
+			log.WithError(err).WithField("recording_id", id).Error("failed to load highlights")
+			respondStoreError(c, "failed to load highlights")
+			return
+		}
+	}
+	if markers == nil {
+		if recErr != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: recErr.Error()})
+			return
+		}
+		markers = []highlights.Marker{}
+	}
+	c.JSON(http.StatusOK, markers)
+}
+
+// GetRecordingPlaylist handles GET /api/v1/recordings/:id/playlist.m3u8.
+// It serves the live preview playlist for in-progress recordings and the
+// complete playlist once the recording has stopped.
+func (h *Handler) GetRecordingPlaylist(c *gin.Context) {
+	id := c.Param("id")
+	playlist, err := h.Recorder.Playlist(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
 		return
 	}
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(playlist))
+}
 
-	log.WithFields(log.Fields{
-		"device_id": deviceID,
+// GetCatchupPlaylist handles GET /api/v1/recordings/:id/catchup.m3u8.
+// It serves a sliding window of the last DVRWindow of an in-progress
+// recording so late viewers can start from the beginning of the window.
+// The request must carry the signature issued by POST /events/:id/admit,
+// and every segment URI in the playlist is presigned.
+func (h *Handler) GetCatchupPlaylist(c *gin.Context) {
+	if h.URLSigner == nil || h.Media == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "catch-up playback not configured"})
+		return
+	}
+	if err := h.URLSigner.Verify(c.Request.URL.Path, c.Request.URL.Query()); err != nil {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	ctx := c.Request.Context()
+	var signErr error
+	playlist, err := h.Recorder.SignedLivePlaylist(id, h.DVRWindow, func(key string) (string, error) {
+		u, err := h.Media.URL(ctx, key, h.URLSigner.TTL())
+		if err != nil {
+			signErr = err
+		}
+		return u, err
+	})
+	if errors.Is(err, recorder.ErrRecordingNotLive) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if signErr != nil {
+		log.WithError(err).WithField("recording_id", id).Error("failed to sign catch-up segments")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to sign catch-up segments"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(playlist))
+}
+
+// --- Archive handlers ---
+
+// GetArchiveBudget handles GET /api/v1/archive/budget.
+// It reports encode budget usage, running encodes and queued demand.
+func (h *Handler) GetArchiveBudget(c *gin.Context) {
+	if h.EncodeBudget == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "archive encode budget not configured"})
+		return
+	}
+	c.JSON(http.StatusOK, h.EncodeBudget.Status())
+}
+
+// --- Channel handlers ---
+
+// CreateChannel handles POST /api/v1/channels.
+func (h *Handler) CreateChannel(c *gin.Context) {
+	if h.Channels == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "channel catalog not configured"})
+		return
+	}
+
+	var req CreateChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ch, err := h.Channels.Create(c.Request.Context(), channels.Channel{
+		CallSign: req.CallSign,
+		Number:   req.Number,
+		Name:     req.Name,
+		LogoURL:  req.LogoURL,
+		Devices:  req.Devices,
+	})
+	switch {
+	case errors.Is(err, channels.ErrDuplicate):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	case errors.Is(err, channels.ErrCallSignMissing), errors.Is(err, channels.ErrNumberMissing):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		log.WithError(err).Error("failed to create channel")
+		respondStoreError(c, "failed to create channel")
+		return
+	}
+	c.JSON(http.StatusCreated, ch)
+}
+
+// ListChannels handles GET /api/v1/channels.
+func (h *Handler) ListChannels(c *gin.Context) {
+	if h.Channels == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "channel catalog not configured"})
+		return
+	}
+
+	list, err := h.Channels.List(c.Request.Context())
+	if err != nil {
+		log.WithError(err).Error("failed to list channels")
+		respondStoreError(c, "failed to list channels")
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetChannel handles GET /api/v1/channels/:id.
+func (h *Handler) GetChannel(c *gin.Context) {
+	if h.Channels == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "channel catalog not configured"})
+		return
+	}
+
+	ch, err := h.Channels.Get(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, channels.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("failed to get channel")
+		respondStoreError(c, "failed to get channel")
+		return
+	}
+	c.JSON(http.StatusOK, ch)
+}
+
+// DeleteChannel handles DELETE /api/v1/channels/:id.
+func (h *Handler) DeleteChannel(c *gin.Context) {
+	if h.Channels == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "channel catalog not configured"})
+		return
+	}
+
+	err := h.Channels.Delete(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, channels.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("failed to delete channel")
+		respondStoreError(c, "failed to delete channel")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// --- Retention handlers ---
+
+// ListRetentionPolicies handles GET /api/v1/retention/policies.
+func (h *Handler) ListRetentionPolicies(c *gin.Context) {
+	if h.Retention == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "recording retention not configured"})
+		return
+	}
+
+	policies, err := h.Retention.ListPolicies(c.Request.Context())
+	if err != nil {
+		log.WithError(err).Error("failed to list retention policies")
+		respondStoreError(c, "failed to list retention policies")
+		return
+	}
+	if policies == nil {
+		policies = []retention.Policy{}
+	}
+	c.JSON(http.StatusOK, policies)
+}
+
+// GetRetentionPolicy handles GET /api/v1/retention/policies/:familyId.
+func (h *Handler) GetRetentionPolicy(c *gin.Context) {
+	if h.Retention == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "recording retention not configured"})
+		return
+	}
+
+	policy, err := h.Retention.GetPolicy(c.Request.Context(), c.Param("familyId"))
+	if errors.Is(err, retention.ErrPolicyNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("failed to get retention policy")
+		respondStoreError(c, "failed to get retention policy")
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// SetRetentionPolicy handles PUT /api/v1/retention/policies/:familyId.
+// It creates or replaces the family's policy; the janitor applies it on its
+// next run.
+func (h *Handler) SetRetentionPolicy(c *gin.Context) {
+	if h.Retention == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "recording retention not configured"})
+		return
+	}
+
+	var req RetentionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	policy := retention.Policy{
+		FamilyID:  c.Param("familyId"),
+		KeepDays:  req.KeepDays,
+		KeepCount: req.KeepCount,
+	}
+	err := h.Retention.SetPolicy(c.Request.Context(), policy)
+	switch {
+	case errors.Is(err, retention.ErrEmptyFamilyID), errors.Is(err, retention.ErrInvalidPolicy):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		log.WithError(err).Error("failed to set retention policy")
+		respondStoreError(c, "failed to set retention policy")
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// --- Stats handlers ---
+
+// reliabilityDefaultRange is the report range used when from is omitted.
+const reliabilityDefaultRange = 30 * 24 * time.Hour
+
+// GetReliabilityStats handles GET /api/v1/stats/reliability.
+// Query parameters from and to are inclusive dates (YYYY-MM-DD); to defaults
+// to today and from to 30 days before to. worst limits the worst-offenders list.
+func (h *Handler) GetReliabilityStats(c *gin.Context) {
+	if h.Stats == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "recording stats not configured"})
+		return
+	}
+
+	to := time.Now().UTC()
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid to date, expected YYYY-MM-DD"})
+			return
+		}
+		to = t
+	}
+
+	from := to.Add(-reliabilityDefaultRange)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid from date, expected YYYY-MM-DD"})
+			return
+		}
+		from = t
+	}
+
+	worst := 0
+	if v := c.Query("worst"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "worst must be a positive integer"})
+			return
+		}
+		worst = n
+	}
+
+	report, err := h.Stats.Reliability(c.Request.Context(), from, to, worst)
+	if errors.Is(err, stats.ErrInvalidRange) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("failed to build reliability report")
+		respondStoreError(c, "failed to build reliability report")
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// --- Operational config handlers ---
+
+// GetEffectiveConfig handles GET /api/v1/config/effective.
+func (h *Handler) GetEffectiveConfig(c *gin.Context) {
+	if h.OpConfig == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "operational config reload not configured"})
+		return
+	}
+
+	eff := h.OpConfig.Effective()
+	resp := EffectiveConfigResponse{
+		Source:        eff.Source,
+		LoadedAt:      eff.LoadedAt,
+		RetryPolicies: make(map[string]RetryPolicyView, len(eff.Settings.RetryPolicies)),
+		Drift: DriftView{
+			CheckInterval: eff.Settings.Drift.CheckInterval.String(),
+			MaxDrift:      eff.Settings.Drift.MaxDrift.String(),
+		},
+		Padding: PaddingView{
+			PreRoll:  eff.Settings.Padding.PreRoll.String(),
+			PostRoll: eff.Settings.Padding.PostRoll.String(),
+		},
+		Stall: StallView{LoopMultiple: eff.Settings.Stall.LoopMultiple},
+	}
+	for rt, p := range eff.Settings.RetryPolicies {
+		resp.RetryPolicies[string(rt)] = RetryPolicyView{
+			MaxAttempts: p.MaxAttempts,
+			Delay:       p.Delay.String(),
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ReloadConfig handles POST /api/v1/config/reload.
+// It re-reads the config file; an invalid file is rejected as a whole and the
+// current settings are kept.
+func (h *Handler) ReloadConfig(c *gin.Context) {
+	if h.OpConfig == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "operational config reload not configured"})
+		return
+	}
+
+	changes, err := h.OpConfig.Reload()
+	if errors.Is(err, opconfig.ErrNoConfigFile) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, ReloadConfigError{
+			Error:  "config rejected, current settings kept",
+			Errors: strings.Split(err.Error(), "\n"),
+		})
+		return
+	}
+	if changes == nil {
+		changes = []opconfig.Change{}
+	}
+	c.JSON(http.StatusOK, ReloadConfigResponse{Changes: changes})
+}
+
+// --- Health handlers ---
+
+// Health handles GET /health. It always responds 200 so a stale guide does
+// not fail liveness checks.
+func (h *Handler) Health(c *gin.Context) {
+	resp := HealthResponse{Status: "ok"}
+	if h.Guide != nil {
+		st := h.Guide.Status()
+		resp.Guide = &st
+		if st.Stale {
+			resp.Status = "degraded"
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// loopHealth reports the watchdog's loops and whether the service is ready.
+func (h *Handler) loopHealth() (LoopHealthResponse, bool) {
+	resp := LoopHealthResponse{Status: "ok", Loops: []watchdog.LoopStatus{}}
+	if h.Watchdog == nil {
+		return resp, true
+	}
+	resp.Loops = h.Watchdog.Status()
+	ready := h.Watchdog.Ready()
+	if !ready {
+		resp.Status = "degraded"
+	}
+	return resp, ready
+}
+
+// GetLoopHealth handles GET /health/loops.
+// It always responds 200; use GET /ready for a status-code check.
+func (h *Handler) GetLoopHealth(c *gin.Context) {
+	resp, _ := h.loopHealth()
+	c.JSON(http.StatusOK, resp)
+}
+
+// Ready handles GET /ready. It responds 503 while any internal loop is
+// stalled.
+func (h *Handler) Ready(c *gin.Context) {
+	resp, ready := h.loopHealth()
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// --- Device handlers ---
+
+// SendDeviceCommand handles POST /api/v1/devices/:id/command.
+func (h *Handler) SendDeviceCommand(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	var req DeviceCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Verify the device exists.
+	dev, err := h.Coordinator.GetDevice(deviceID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if required, ok := h.CommandMinAgentVersions[req.Command]; ok {
+		min, err := semver.Parse(required)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if v, ok := parseAgentVersion(dev.AgentVersion); !ok || v.Less(min) {
+			c.JSON(http.StatusConflict, AgentTooOldResponse{
+				Error:           "command " + req.Command + " requires agent " + min.String() + " or newer",
+				Code:            ErrorCodeAgentTooOld,
+				RequiredVersion: min.String(),
+				AgentVersion:    dev.AgentVersion,
+			})
+			return
+		}
+	}
+
+	correlationID, err := requestCorrelationID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.EventID != "" {
+		evt, err := h.Scheduler.GetEvent(req.EventID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		correlationID = evt.CorrelationID
+	}
+
+	trace.Entry(correlationID).WithFields(log.Fields{
+		"device_id": deviceID,
+		"event_id":  req.EventID,
 		"command":   req.Command,
 		"params":    req.Params,
 	}).Info("device command received")
 
-	c.JSON(http.StatusAccepted, gin.H{
+	resp := gin.H{
 		"device_id": dev.ID,
 		"command":   req.Command,
 		"status":    "accepted",
+	}
+	if correlationID != "" {
+		resp["correlation_id"] = correlationID
+	}
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// ListDevices handles GET /api/v1/devices.
+func (h *Handler) ListDevices(c *gin.Context) {
+	devices := h.Coordinator.ListDevices()
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	c.JSON(http.StatusOK, devices)
+}
+
+// DeviceHeartbeat handles POST /api/v1/devices/:id/heartbeat.
+func (h *Handler) DeviceHeartbeat(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	var req DeviceHeartbeatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.AgentVersion != "" {
+		if _, err := semver.Parse(req.AgentVersion); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	if err := h.Coordinator.RecordHeartbeat(deviceID, req.AgentVersion); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	dev, _ := h.Coordinator.GetDevice(deviceID)
+	c.JSON(http.StatusOK, dev)
+}
+
+// GetDeviceVersions handles GET /api/v1/devices/versions.
+func (h *Handler) GetDeviceVersions(c *gin.Context) {
+	resp := DeviceVersionsResponse{
+		Baseline:      h.MinAgentVersion,
+		Versions:      []AgentVersionCount{},
+		BelowBaseline: []DeviceVersionView{},
+	}
+
+	var baseline semver.Version
+	if h.MinAgentVersion != "" {
+		v, err := semver.Parse(h.MinAgentVersion)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		baseline = v
+		resp.Baseline = v.String()
+	}
+
+	devices := h.Coordinator.ListDevices()
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+
+	counts := make(map[string]int)
+	parsed := make(map[string]semver.Version)
+	for _, dev := range devices {
+		v, ok := parseAgentVersion(dev.AgentVersion)
+		key := unknownAgentVersion
+		if ok {
+			key = v.String()
+			parsed[key] = v
+		}
+		counts[key]++
+
+		// Devices that never reported are treated as the oldest agents.
+		if h.MinAgentVersion != "" && (!ok || v.Less(baseline)) {
+			resp.BelowBaseline = append(resp.BelowBaseline, DeviceVersionView{
+				DeviceID:     dev.ID,
+				AgentVersion: dev.AgentVersion,
+			})
+		}
+	}
+
+	for key, n := range counts {
+		resp.Versions = append(resp.Versions, AgentVersionCount{Version: key, Devices: n})
+	}
+	sort.Slice(resp.Versions, func(i, j int) bool {
+		a, aok := parsed[resp.Versions[i].Version]
+		b, bok := parsed[resp.Versions[j].Version]
+		if aok != bok {
+			return aok
+		}
+		return semver.Compare(a, b) > 0
 	})
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// parseAgentVersion parses a reported agent version. ok is false when the
+// device never reported one or reported something unparseable.
+func parseAgentVersion(reported string) (v semver.Version, ok bool) {
+	if reported == "" {
+		return semver.Version{}, false
+	}
+	v, err := semver.Parse(reported)
+	return v, err == nil
+}
+
+// SetDeviceChannels handles PUT /api/v1/devices/:id/channels.
+// An empty list makes the device eligible for every channel.
+func (h *Handler) SetDeviceChannels(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	var req DeviceChannelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.Coordinator.SetDeviceChannels(deviceID, req.Channels); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	dev, _ := h.Coordinator.GetDevice(deviceID)
+	c.JSON(http.StatusOK, dev)
+}
+
+// FailoverTuner handles POST /api/v1/devices/:id/tuners/:index/failover.
+// It marks the tuner failed and moves its event to an alternate device that
+// carries the same or a related channel.
+func (h *Handler) FailoverTuner(c *gin.Context) {
+	deviceID := c.Param("id")
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "tuner index must be an integer"})
+		return
+	}
+
+	alloc, err := h.Coordinator.FailoverTuner(deviceID, index)
+	if errors.Is(err, coordinator.ErrNoFailoverTuner) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if alloc.EventID != "" {
+		if err := h.Scheduler.AssignDevice(alloc.EventID, alloc.DeviceID, alloc.TunerIndex); err != nil {
+			log.WithError(err).WithField("event_id", alloc.EventID).Warn("failed over tuner for unknown event")
+		}
+	}
+	c.JSON(http.StatusOK, alloc)
+}
+
+// --- Trace handlers ---
+
+// maxCorrelationIDLength bounds correlation IDs accepted from clients.
+const maxCorrelationIDLength = 128
+
+// requestCorrelationID returns the correlation ID sent in the request's
+// X-Correlation-ID header, or "" when none was sent.
+func requestCorrelationID(c *gin.Context) (string, error) {
+	id := strings.TrimSpace(c.GetHeader(trace.Header))
+	if len(id) > maxCorrelationIDLength {
+		return "", errors.New("X-Correlation-ID must be at most 128 characters")
+	}
+	return id, nil
+}
+
+// GetTrace handles GET /api/v1/trace/:correlationId.
+// It returns the events, recordings and archive jobs carrying the correlation
+// ID together with their activity log as one timeline, oldest first.
+func (h *Handler) GetTrace(c *gin.Context) {
+	id := c.Param("correlationId")
+
+	events := h.Scheduler.EventsByCorrelationID(id)
+	if len(events) == 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "no events with correlation id " + id})
+		return
+	}
+
+	resp := TraceResponse{
+		CorrelationID: id,
+		Events:        events,
+		Recordings:    []*recorder.RecordingStatus{},
+		ArchiveJobs:   []*archive.ArchiveJob{},
+		Timeline:      []trace.Activity{},
+	}
+	for _, rec := range h.Recorder.ListRecordings() {
+		if rec.CorrelationID == id {
+			resp.Recordings = append(resp.Recordings, rec)
+		}
+	}
+	sort.Slice(resp.Recordings, func(i, j int) bool {
+		return resp.Recordings[i].StartedAt.Before(resp.Recordings[j].StartedAt)
+	})
+	if h.Archive != nil {
+		resp.ArchiveJobs = append(resp.ArchiveJobs, h.Archive.JobsByCorrelationID(id)...)
+		sort.Slice(resp.ArchiveJobs, func(i, j int) bool {
+			return resp.ArchiveJobs[i].CreatedAt.Before(resp.ArchiveJobs[j].CreatedAt)
+		})
+	}
+	if h.Activity != nil {
+		resp.Timeline = h.Activity.Entries(id)
+		// Entries are in logging order; a stable sort keeps it for ties.
+		sort.SliceStable(resp.Timeline, func(i, j int) bool {
+			return resp.Timeline[i].At.Before(resp.Timeline[j].At)
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRequestTimeout bounds a request when its route has no override.
+const DefaultRequestTimeout = 10 * time.Second
+
+// ErrorCodeTimeout is returned with 504 when a request's deadline passes.
+const ErrorCodeTimeout = "request_timeout"
+
+// RequestTimeouts configures the deadline set on each request's context.
+type RequestTimeouts struct {
+	// Default applies to routes without an override. Zero or negative
+	// leaves those requests without a deadline.
+	Default time.Duration
+
+	// Routes overrides Default per route, keyed by method and full route
+	// path, e.g. "POST /api/v1/events/import".
+	Routes map[string]time.Duration
+}
+
+// DefaultRouteTimeouts returns the overrides for routes that are expected to
+// outlast DefaultRequestTimeout.
+func DefaultRouteTimeouts() map[string]time.Duration {
+	return map[string]time.Duration{
+		// Import may fetch a guide URL, which alone may take epg.FetchTimeout.
+		"POST /api/v1/events/import": 30 * time.Second,
+	}
+}
+
+// TimeoutResponse is the body returned when a request's deadline passes.
+type TimeoutResponse struct {
+	Error   string `json:"error"`
+	Code    string `json:"code"`
+	Timeout string `json:"timeout"`
+}
+
+// Timeout returns middleware that sets a per-route deadline on the request
+// context, so store queries made with c.Request.Context() are cancelled
+// when it passes. A handler that has not responded by then gets a 504.
+func Timeout(cfg RequestTimeouts) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, ok := cfg.Routes[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			d = cfg.Default
+		}
+		if d <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Set(timeoutKey, d)
+
+		c.Next()
+
+		if !c.Writer.Written() && requestTimedOut(c) {
+			respondTimeout(c)
+		}
+	}
+}
+
+// timeoutKey stores the route's timeout on the gin context for responses.
+const timeoutKey = "request_timeout"
+
+// requestTimedOut reports whether the request's deadline has passed.
+func requestTimedOut(c *gin.Context) bool {
+	return errors.Is(c.Request.Context().Err(), context.DeadlineExceeded)
+}
+
+func respondTimeout(c *gin.Context) {
+	resp := TimeoutResponse{Error: "request timed out", Code: ErrorCodeTimeout}
+	if d, ok := c.Get(timeoutKey); ok {
+		resp.Timeout = d.(time.Duration).String()
+	}
+	c.AbortWithStatusJSON(http.StatusGatewayTimeout, resp)
+}
+
+// respondStoreError reports a failed store call: 504 when the request's
+// deadline passed, otherwise 500 with msg.
+func respondStoreError(c *gin.Context, msg string) {
+	if requestTimedOut(c) {
+		respondTimeout(c)
+		return
+	}
+	c.JSON(http.StatusInternalServerError, ErrorResponse{Error: msg})
+}
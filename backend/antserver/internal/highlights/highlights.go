@@ -0,0 +1,70 @@
+// Package highlights holds the key moments of a sports recording, such as
+// scoring plays, that viewers can jump to like chapters. Markers come from a
+// detector run by the archive pipeline; this package only cleans them up.
+package highlights
+
+import "sort"
+
+// MinSpacingMs is the closest two markers may be. Detectors often report a
+// burst of scene changes around one play; only the most confident is kept.
+const MinSpacingMs = 10000
+
+// Kind classifies what a marker detected.
+type Kind string
+
+const (
+	// KindScoreChange marks a change on the on-screen scoreboard.
+	KindScoreChange Kind = "score_change"
+
+	// KindSceneChange marks a cut the detector judged significant, e.g. a
+	// replay starting.
+	KindSceneChange Kind = "scene_change"
+)
+
+// Marker is a highlight in a recording.
+type Marker struct {
+	// AtMs is the highlight's offset in milliseconds from recording start.
+	AtMs int64 `json:"at_ms"`
+
+	// Kind is what the detector saw.
+	Kind Kind `json:"kind"`
+
+	// Label is an optional description, e.g. "Touchdown, 14-7".
+	Label string `json:"label,omitempty"`
+
+	// Confidence is a value between 0.0 and 1.0 indicating detection certainty.
+	Confidence float64 `json:"confidence"`
+}
+
+// Normalize returns the markers ordered by time with negative offsets
+// dropped. Of markers closer than MinSpacingMs to a kept marker, only the
+// most confident survives; score changes win ties over scene changes.
+func Normalize(markers []Marker) []Marker {
+	sorted := make([]Marker, 0, len(markers))
+	for _, m := range markers {
+		if m.AtMs >= 0 {
+			sorted = append(sorted, m)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].AtMs < sorted[j].AtMs })
+
+	var result []Marker
+	for _, m := range sorted {
+		if n := len(result); n > 0 && m.AtMs-result[n-1].AtMs < MinSpacingMs {
+			if better(m, result[n-1]) {
+				result[n-1] = m
+			}
+			continue
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+// better reports whether a should replace b.
+func better(a, b Marker) bool {
+	if a.Confidence != b.Confidence {
+		return a.Confidence > b.Confidence
+	}
+	return a.Kind == KindScoreChange && b.Kind != KindScoreChange
+}
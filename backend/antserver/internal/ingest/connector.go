@@ -0,0 +1,386 @@
+package ingest
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Network connector defaults.
+const (
+	DefaultSRTPort     = 9000
+	DefaultRTMPPort    = 1935
+	DefaultDialTimeout = 5 * time.Second
+)
+
+// ErrHandshakeRejected is returned when the ingest endpoint answers a
+// connection attempt but refuses the stream.
+var ErrHandshakeRejected = errors.New("ingest: handshake rejected")
+
+// NetConnectorConfig holds the ingest endpoint a NetConnector dials.
+type NetConnectorConfig struct {
+	// Host is the ingest endpoint. Empty dials the stream ID as the host,
+	// matching the srt://<channel>:9000 stream URLs recordings start with.
+	Host string
+
+	// SRTPort and RTMPPort are the endpoint's ports. Zero uses
+	// DefaultSRTPort and DefaultRTMPPort.
+	SRTPort  int
+	RTMPPort int
+
+	// DialTimeout bounds each connection attempt, handshake included.
+	// Zero uses DefaultDialTimeout.
+	DialTimeout time.Duration
+}
+
+// NetConnector is the StreamConnector used in production. SRT connections
+// perform the caller side of the SRT v5 handshake, requesting the stream by
+// its stream ID; RTMP connections perform the RTMP handshake over TCP.
+// Keepalives are protocol keepalive packets, so a dead peer surfaces as a
+// write error. It is safe for concurrent use.
+type NetConnector struct {
+	cfg NetConnectorConfig
+
+	mu       sync.Mutex
+	conn     net.Conn
+	protocol string
+	start    time.Time
+
+	// peerSocket is the SRT socket ID assigned by the listener.
+	peerSocket uint32
+}
+
+// NewNetConnector creates a NetConnector for the given endpoint.
+func NewNetConnector(cfg NetConnectorConfig) *NetConnector {
+	if cfg.SRTPort <= 0 {
+		cfg.SRTPort = DefaultSRTPort
+	}
+	if cfg.RTMPPort <= 0 {
+		cfg.RTMPPort = DefaultRTMPPort
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = DefaultDialTimeout
+	}
+	return &NetConnector{cfg: cfg}
+}
+
+// address returns the endpoint for a stream on the given port.
+func (c *NetConnector) address(streamID string, port int) string {
+	host := c.cfg.Host
+	if host == "" {
+		host = streamID
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// ConnectSRT dials the SRT endpoint and completes the caller handshake.
+func (c *NetConnector) ConnectSRT(streamID string) error {
+	conn, err := net.DialTimeout("udp", c.address(streamID, c.cfg.SRTPort), c.cfg.DialTimeout)
+	if err != nil {
+		return fmt.Errorf("dial srt: %w", err)
+	}
+	start := time.Now()
+	if err := conn.SetDeadline(start.Add(c.cfg.DialTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	peer, err := srtHandshake(conn, streamID, start)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("srt handshake: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.replace(conn, "srt", start, peer)
+	return nil
+}
+
+// ConnectRTMP dials the RTMP endpoint and completes the RTMP handshake.
+func (c *NetConnector) ConnectRTMP(streamID string) error {
+	conn, err := net.DialTimeout("tcp", c.address(streamID, c.cfg.RTMPPort), c.cfg.DialTimeout)
+	if err != nil {
+		return fmt.Errorf("dial rtmp: %w", err)
+	}
+	start := time.Now()
+	if err := conn.SetDeadline(start.Add(c.cfg.DialTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := rtmpHandshake(conn); err != nil {
+		conn.Close()
+		return fmt.Errorf("rtmp handshake: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.replace(conn, "rtmp", start, 0)
+	return nil
+}
+
+// replace makes conn the current connection, closing any previous one.
+func (c *NetConnector) replace(conn net.Conn, protocol string, start time.Time, peer uint32) {
+	c.mu.Lock()
+	old := c.conn
+	c.conn = conn
+	c.protocol = protocol
+	c.start = start
+	c.peerSocket = peer
+	c.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+}
+
+// Close terminates the current connection. SRT peers are sent a shutdown
+// packet first. Closing without a connection is not an error.
+func (c *NetConnector) Close() error {
+	c.mu.Lock()
+	conn := c.conn
+	protocol := c.protocol
+	start := c.start
+	peer := c.peerSocket
+	c.conn = nil
+	c.protocol = ""
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	if protocol == "srt" {
+		conn.SetWriteDeadline(time.Now().Add(c.cfg.DialTimeout))
+		conn.Write(srtControl(srtShutdown, srtTimestamp(start), peer))
+	}
+	return conn.Close()
+}
+
+// SendKeepalive sends a keepalive on the current connection: an SRT
+// keepalive control packet, or an RTMP acknowledgement message.
+func (c *NetConnector) SendKeepalive() error {
+	c.mu.Lock()
+	conn := c.conn
+	protocol := c.protocol
+	start := c.start
+	peer := c.peerSocket
+	c.mu.Unlock()
+
+	if conn == nil {
+		return ErrNotConnected
+	}
+	if err := conn.SetWriteDeadline(time.Now().Add(c.cfg.DialTimeout)); err != nil {
+		return err
+	}
+
+	var err error
+	if protocol == "srt" {
+		_, err = conn.Write(srtControl(srtKeepalive, srtTimestamp(start), peer))
+	} else {
+		_, err = conn.Write(rtmpAcknowledgement)
+	}
+	return err
+}
+
+// SRT handshake constants, from the SRT protocol specification.
+const (
+	srtControlFlag   = 0x80000000
+	srtKeepalive     = 0x0001
+	srtShutdown      = 0x0005
+	srtHeaderSize    = 16
+	srtHandshakeSize = 48
+
+	srtHSInduction  = 0x00000001
+	srtHSConclusion = 0xFFFFFFFF
+
+	srtInductionVersion = 4
+	srtVersion          = 5
+	srtExtensionDGRAM   = 2
+	srtExtensionHSREQ   = 0x1
+	srtExtensionConfig  = 0x4
+
+	srtExtTypeHSREQ = 1
+	srtExtTypeSID   = 5
+
+	srtLibVersion = 0x00010502 // 1.5.2
+	srtFlags      = 0x3F       // TSBPD send/receive, crypt, drop, periodic NAK, rexmit
+	srtLatencyMS  = 120
+	srtMTU        = 1500
+	srtFlowWindow = 8192
+)
+
+// srtHandshake performs the induction and conclusion exchanges on conn and
+// returns the listener's socket ID.
+func srtHandshake(conn net.Conn, streamID string, start time.Time) (uint32, error) {
+	var random [8]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return 0, err
+	}
+	socketID := binary.BigEndian.Uint32(random[0:4]) &^ srtControlFlag
+	isn := binary.BigEndian.Uint32(random[4:8]) &^ srtControlFlag
+
+	induction := srtHandshakePacket(srtTimestamp(start), srtInductionVersion, srtExtensionDGRAM, isn, srtHSInduction, socketID, 0, nil)
+	if _, err := conn.Write(induction); err != nil {
+		return 0, err
+	}
+	reply, err := readSRTHandshake(conn)
+	if err != nil {
+		return 0, err
+	}
+	if reply.handshakeType != srtHSInduction || reply.version < srtVersion {
+		return 0, fmt.Errorf("%w: unexpected induction response (type %#x, version %d)", ErrHandshakeRejected, reply.handshakeType, reply.version)
+	}
+
+	ext := srtHSREQExtension()
+	ext = append(ext, srtStreamIDExtension(streamID)...)
+	conclusion := srtHandshakePacket(srtTimestamp(start), srtVersion, srtExtensionHSREQ|srtExtensionConfig, isn, srtHSConclusion, socketID, reply.cookie, ext)
+	if _, err := conn.Write(conclusion); err != nil {
+		return 0, err
+	}
+	reply, err = readSRTHandshake(conn)
+	if err != nil {
+		return 0, err
+	}
+	if reply.handshakeType != srtHSConclusion {
+		return 0, fmt.Errorf("%w: srt reason %d", ErrHandshakeRejected, reply.handshakeType)
+	}
+	return reply.socketID, nil
+}
+
+// srtHandshakeReply holds the handshake fields a caller acts on.
+type srtHandshakeReply struct {
+	version       uint32
+	handshakeType uint32
+	socketID      uint32
+	cookie        uint32
+}
+
+// readSRTHandshake reads packets until a handshake control packet arrives.
+func readSRTHandshake(conn net.Conn) (srtHandshakeReply, error) {
+	buf := make([]byte, srtMTU)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return srtHandshakeReply{}, err
+		}
+		if n < srtHeaderSize+srtHandshakeSize || binary.BigEndian.Uint32(buf[0:4])&0xFFFF0000 != srtControlFlag {
+			continue
+		}
+		cif := buf[srtHeaderSize:]
+		return srtHandshakeReply{
+			version:       binary.BigEndian.Uint32(cif[0:4]),
+			handshakeType: binary.BigEndian.Uint32(cif[20:24]),
+			socketID:      binary.BigEndian.Uint32(cif[24:28]),
+			cookie:        binary.BigEndian.Uint32(cif[28:32]),
+		}, nil
+	}
+}
+
+// srtHandshakePacket builds a handshake control packet. The destination
+// socket ID is zero until the connection is established.
+func srtHandshakePacket(timestamp, version uint32, extension uint16, isn, handshakeType, socketID, cookie uint32, ext []byte) []byte {
+	pkt := make([]byte, srtHeaderSize+srtHandshakeSize, srtHeaderSize+srtHandshakeSize+len(ext))
+	binary.BigEndian.PutUint32(pkt[0:4], srtControlFlag)
+	binary.BigEndian.PutUint32(pkt[8:12], timestamp)
+
+	cif := pkt[srtHeaderSize:]
+	binary.BigEndian.PutUint32(cif[0:4], version)
+	binary.BigEndian.PutUint16(cif[6:8], extension)
+	binary.BigEndian.PutUint32(cif[8:12], isn)
+	binary.BigEndian.PutUint32(cif[12:16], srtMTU)
+	binary.BigEndian.PutUint32(cif[16:20], srtFlowWindow)
+	binary.BigEndian.PutUint32(cif[20:24], handshakeType)
+	binary.BigEndian.PutUint32(cif[24:28], socketID)
+	binary.BigEndian.PutUint32(cif[28:32], cookie)
+	return append(pkt, ext...)
+}
+
+// srtHSREQExtension builds the handshake request extension advertising the
+// SRT version, flags and latency.
+func srtHSREQExtension() []byte {
+	ext := make([]byte, 16)
+	binary.BigEndian.PutUint16(ext[0:2], srtExtTypeHSREQ)
+	binary.BigEndian.PutUint16(ext[2:4], 3)
+	binary.BigEndian.PutUint32(ext[4:8], srtLibVersion)
+	binary.BigEndian.PutUint32(ext[8:12], srtFlags)
+	binary.BigEndian.PutUint16(ext[12:14], srtLatencyMS)
+	binary.BigEndian.PutUint16(ext[14:16], srtLatencyMS)
+	return ext
+}
+
+// srtStreamIDExtension builds the stream ID extension. The ID is padded to
+// whole 32-bit words, each stored in little-endian byte order.
+func srtStreamIDExtension(streamID string) []byte {
+	words := (len(streamID) + 3) / 4
+	ext := make([]byte, 4+words*4)
+	binary.BigEndian.PutUint16(ext[0:2], srtExtTypeSID)
+	binary.BigEndian.PutUint16(ext[2:4], uint16(words))
+
+	padded := make([]byte, words*4)
+	copy(padded, streamID)
+	for i := 0; i < words; i++ {
+		word := binary.BigEndian.Uint32(padded[i*4 : i*4+4])
+		binary.LittleEndian.PutUint32(ext[4+i*4:8+i*4], word)
+	}
+	return ext
+}
+
+// srtControl builds a control packet without a control information field
+// beyond the four reserved bytes.
+func srtControl(controlType uint16, timestamp, peer uint32) []byte {
+	pkt := make([]byte, srtHeaderSize+4)
+	binary.BigEndian.PutUint32(pkt[0:4], srtControlFlag|uint32(controlType)<<16)
+	binary.BigEndian.PutUint32(pkt[8:12], timestamp)
+	binary.BigEndian.PutUint32(pkt[12:16], peer)
+	return pkt
+}
+
+// srtTimestamp is the microseconds elapsed since the connection started,
+// wrapping as SRT timestamps do.
+func srtTimestamp(start time.Time) uint32 {
+	return uint32(time.Since(start).Microseconds())
+}
+
+// RTMP handshake constants.
+const (
+	rtmpVersion       = 3
+	rtmpHandshakeSize = 1536
+)
+
+// rtmpAcknowledgement is an RTMP Acknowledgement message (type 3) on the
+// protocol control chunk stream, used as a keepalive.
+var rtmpAcknowledgement = []byte{
+	0x02,             // fmt 0, chunk stream 2
+	0x00, 0x00, 0x00, // timestamp
+	0x00, 0x00, 0x04, // message length
+	0x03,                   // message type: acknowledgement
+	0x00, 0x00, 0x00, 0x00, // message stream ID
+	0x00, 0x00, 0x00, 0x00, // sequence number
+}
+
+// rtmpHandshake exchanges C0/C1, S0/S1/S2 and C2 on conn.
+func rtmpHandshake(conn net.Conn) error {
+	c0c1 := make([]byte, 1+rtmpHandshakeSize)
+	c0c1[0] = rtmpVersion
+	if _, err := rand.Read(c0c1[9:]); err != nil {
+		return err
+	}
+	if _, err := conn.Write(c0c1); err != nil {
+		return err
+	}
+
+	s0s1s2 := make([]byte, 1+2*rtmpHandshakeSize)
+	if _, err := io.ReadFull(conn, s0s1s2); err != nil {
+		return err
+	}
+	if s0s1s2[0] != rtmpVersion {
+		return fmt.Errorf("%w: rtmp version %d", ErrHandshakeRejected, s0s1s2[0])
+	}
+
+	// C2 echoes S1.
+	_, err := conn.Write(s0s1s2[1 : 1+rtmpHandshakeSize])
+	return err
+}
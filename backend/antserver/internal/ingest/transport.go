@@ -7,13 +7,18 @@
 //   - connected:    healthy connection on primary or fallback protocol
 //   - degraded:     reconnecting for >90s, stream may have gaps
 //   - reconnecting: actively attempting to re-establish connection
-//   - failed:       all reconnection attempts exhausted
+//   - failed:       all reconnection attempts exhausted, or the optional
+//     wall-clock reconnect budget spent
 package ingest
 
 import (
 	"errors"
 	"sync"
 	"time"
+
+	"antserver/internal/trace"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // TransportState represents the current connection state.
@@ -36,6 +41,18 @@ const (
 	KeepaliveInterval = 5 * time.Second
 )
 
+// TransportConfig holds optional Transport settings.
+type TransportConfig struct {
+	// MaxReconnectDuration bounds the wall-clock time spent reconnecting.
+	// The transport fails when either this budget or MaxReconnAttempts is
+	// exhausted, whichever comes first. Zero means no time limit.
+	MaxReconnectDuration time.Duration
+
+	// CorrelationID is attached to the transport's log entries so they can
+	// be traced back to the event being captured.
+	CorrelationID string
+}
+
 // Sentinel errors.
 var (
 	ErrAlreadyConnected = errors.New("ingest: already connected")
@@ -75,6 +92,8 @@ type Transport struct {
 	callbacks       []StateChangeFunc
 	reconnAttempts  int
 	reconnStartTime time.Time
+	maxReconnDur    time.Duration
+	correlationID   string
 
 	// stopKeepalive signals the keepalive goroutine to exit.
 	stopKeepalive chan struct{}
@@ -89,15 +108,25 @@ type Transport struct {
 
 // NewTransport creates a Transport backed by the given StreamConnector.
 func NewTransport(connector StreamConnector) (*Transport, error) {
+	return NewTransportWithConfig(connector, TransportConfig{})
+}
+
+// NewTransportWithConfig creates a Transport with the given settings.
+func NewTransportWithConfig(connector StreamConnector, cfg TransportConfig) (*Transport, error) {
 	if connector == nil {
 		return nil, ErrNilConnector
 	}
+	if cfg.MaxReconnectDuration < 0 {
+		return nil, errors.New("ingest: max reconnect duration must not be negative")
+	}
 	return &Transport{
-		connector: connector,
-		state:     StateDisconnected,
-		now:       time.Now,
-		sleep:     time.Sleep,
-		backoff:   InitialBackoff,
+		connector:     connector,
+		state:         StateDisconnected,
+		maxReconnDur:  cfg.MaxReconnectDuration,
+		correlationID: cfg.CorrelationID,
+		now:           time.Now,
+		sleep:         time.Sleep,
+		backoff:       InitialBackoff,
 	}, nil
 }
 
@@ -187,6 +216,11 @@ func (t *Transport) GetReconnAttempts() int {
 	return t.reconnAttempts
 }
 
+// CorrelationID returns the correlation ID the transport was created with.
+func (t *Transport) CorrelationID() string {
+	return t.correlationID
+}
+
 // OnStateChange registers a callback that fires whenever the transport state changes.
 func (t *Transport) OnStateChange(cb StateChangeFunc) {
 	t.mu.Lock()
@@ -236,8 +270,19 @@ func (t *Transport) reconnectLoop() {
 			t.mu.Unlock()
 			return
 		}
+		if t.maxReconnDur > 0 && elapsed >= t.maxReconnDur {
+			t.setState(StateFailed)
+			t.mu.Unlock()
+			return
+		}
 
 		backoff := t.backoff
+		if t.maxReconnDur > 0 {
+			// Don't sleep past the budget; make one last attempt at the deadline.
+			if remaining := t.maxReconnDur - elapsed; backoff > remaining {
+				backoff = remaining
+			}
+		}
 		streamID := t.streamID
 		t.reconnAttempts++
 		t.backoff *= BackoffMultiplier
@@ -321,6 +366,14 @@ func (t *Transport) setState(newState TransportState) {
 	old := t.state
 	t.state = newState
 
+	trace.Entry(t.correlationID).WithFields(log.Fields{
+		"stream_id":          t.streamID,
+		"protocol":           t.protocol,
+		"from":               old,
+		"to":                 newState,
+		"reconnect_attempts": t.reconnAttempts,
+	}).Info("transport state changed")
+
 	// Fire callbacks without holding the lock to avoid deadlocks.
 	cbs := make([]StateChangeFunc, len(t.callbacks))
 	copy(cbs, t.callbacks)
@@ -0,0 +1,317 @@
+// Package opconfig loads the hot-reloadable operational settings (retry
+// policies, drift detection, recording padding and stall thresholds) from a
+// JSON file and applies them to the scheduler and the loop watchdog without a
+// restart.
+package opconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"antserver/internal/scheduler"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SourceDefaults is reported as the source when no file has been applied.
+const SourceDefaults = "defaults"
+
+// ErrNoConfigFile is returned by Reload when no config file is configured.
+var ErrNoConfigFile = errors.New("opconfig: no config file configured")
+
+// File is the on-disk format. Fields left out keep their built-in defaults;
+// durations use Go duration syntax ("30s", "2m").
+//
+//	{
+//	  "retry_policies": {"tuner_failure": {"max_attempts": 3, "delay": "2m"}},
+//	  "drift": {"check_interval": "1m", "max_drift": "5m"},
+//	  "padding": {"pre_roll": "1m", "post_roll": "5m"},
+//	  "stall": {"loop_multiple": 3}
+//	}
+type File struct {
+	RetryPolicies map[string]FilePolicy `json:"retry_policies,omitempty"`
+	Drift         *FileDrift            `json:"drift,omitempty"`
+	Padding       *FilePadding          `json:"padding,omitempty"`
+	Stall         *FileStall            `json:"stall,omitempty"`
+}
+
+// FilePolicy is a retry policy as written in the config file.
+type FilePolicy struct {
+	MaxAttempts *int   `json:"max_attempts,omitempty"`
+	Delay       string `json:"delay,omitempty"`
+}
+
+// FileDrift is the drift configuration as written in the config file.
+type FileDrift struct {
+	CheckInterval string `json:"check_interval,omitempty"`
+	MaxDrift      string `json:"max_drift,omitempty"`
+}
+
+// FilePadding is the default recording padding as written in the config file.
+type FilePadding struct {
+	PreRoll  string `json:"pre_roll,omitempty"`
+	PostRoll string `json:"post_roll,omitempty"`
+}
+
+// FileStall is the stall configuration as written in the config file.
+type FileStall struct {
+	LoopMultiple *float64 `json:"loop_multiple,omitempty"`
+}
+
+// StallMonitor is a monitor whose stall threshold follows the operational
+// config. It is satisfied by *watchdog.Watchdog.
+type StallMonitor interface {
+	SetStallMultiple(multiple float64) error
+}
+
+// Parse decodes a config file and overlays it on the default settings. The
+// result is validated as a whole; all problems are reported together.
+func Parse(data []byte) (scheduler.Settings, error) {
+	var f File
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return scheduler.Settings{}, fmt.Errorf("parse operational config: %w", err)
+	}
+
+	settings := scheduler.DefaultSettings()
+	var errs []error
+
+	for name, fp := range f.RetryPolicies {
+		rt := scheduler.RetryType(name)
+		policy := settings.RetryPolicies[rt]
+		if fp.MaxAttempts != nil {
+			policy.MaxAttempts = *fp.MaxAttempts
+		}
+		if fp.Delay != "" {
+			d, err := time.ParseDuration(fp.Delay)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("retry_policies.%s.delay: %w", name, err))
+			} else {
+				policy.Delay = d
+			}
+		}
+		settings.RetryPolicies[rt] = policy
+	}
+
+	if f.Drift != nil {
+		if f.Drift.CheckInterval != "" {
+			d, err := time.ParseDuration(f.Drift.CheckInterval)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("drift.check_interval: %w", err))
+			} else {
+				settings.Drift.CheckInterval = d
+			}
+		}
+		if f.Drift.MaxDrift != "" {
+			d, err := time.ParseDuration(f.Drift.MaxDrift)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("drift.max_drift: %w", err))
+			} else {
+				settings.Drift.MaxDrift = d
+			}
+		}
+	}
+
+	if f.Padding != nil {
+		if f.Padding.PreRoll != "" {
+			d, err := time.ParseDuration(f.Padding.PreRoll)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("padding.pre_roll: %w", err))
+			} else {
+				settings.Padding.PreRoll = d
+			}
+		}
+		if f.Padding.PostRoll != "" {
+			d, err := time.ParseDuration(f.Padding.PostRoll)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("padding.post_roll: %w", err))
+			} else {
+				settings.Padding.PostRoll = d
+			}
+		}
+	}
+
+	if f.Stall != nil && f.Stall.LoopMultiple != nil {
+		settings.Stall.LoopMultiple = *f.Stall.LoopMultiple
+	}
+
+	// Unparseable values keep their defaults above, so validation only reports
+	// problems with values that were read successfully.
+	if err := settings.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return scheduler.Settings{}, err
+	}
+	return settings, nil
+}
+
+// Change is a single setting that differs between two configurations.
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Diff lists the settings that differ between prev and next, ordered by field.
+func Diff(prev, next scheduler.Settings) []Change {
+	var changes []Change
+	add := func(field string, before, after interface{}) {
+		b, a := fmt.Sprint(before), fmt.Sprint(after)
+		if b != a {
+			changes = append(changes, Change{Field: field, Old: b, New: a})
+		}
+	}
+
+	types := make(map[scheduler.RetryType]struct{})
+	for rt := range prev.RetryPolicies {
+		types[rt] = struct{}{}
+	}
+	for rt := range next.RetryPolicies {
+		types[rt] = struct{}{}
+	}
+	for rt := range types {
+		op, np := prev.RetryPolicies[rt], next.RetryPolicies[rt]
+		add("retry_policies."+string(rt)+".max_attempts", op.MaxAttempts, np.MaxAttempts)
+		add("retry_policies."+string(rt)+".delay", op.Delay, np.Delay)
+	}
+	add("drift.check_interval", prev.Drift.CheckInterval, next.Drift.CheckInterval)
+	add("drift.max_drift", prev.Drift.MaxDrift, next.Drift.MaxDrift)
+	add("padding.pre_roll", prev.Padding.PreRoll, next.Padding.PreRoll)
+	add("padding.post_roll", prev.Padding.PostRoll, next.Padding.PostRoll)
+	add("stall.loop_multiple", prev.Stall.LoopMultiple, next.Stall.LoopMultiple)
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// Effective describes the settings currently in force.
+type Effective struct {
+	Source   string
+	LoadedAt time.Time
+	Settings scheduler.Settings
+}
+
+// Reloader reads the config file and swaps the result into the scheduler and,
+// once SetStallMonitor is called, the stall monitor. Reloads are triggered
+// externally (SIGHUP or the admin endpoint).
+type Reloader struct {
+	mu       sync.Mutex
+	path     string
+	sched    *scheduler.Scheduler
+	monitor  StallMonitor
+	source   string
+	loadedAt time.Time
+
+	// Overridable for testing.
+	now func() time.Time
+}
+
+// NewReloader creates a Reloader for the given file. An empty path leaves the
+// scheduler on its built-in defaults and makes Reload return ErrNoConfigFile.
+func NewReloader(path string, sched *scheduler.Scheduler) (*Reloader, error) {
+	if sched == nil {
+		return nil, errors.New("opconfig: scheduler must not be nil")
+	}
+	return &Reloader{
+		path:     path,
+		sched:    sched,
+		source:   SourceDefaults,
+		loadedAt: time.Now(),
+		now:      time.Now,
+	}, nil
+}
+
+// SetTestNow overrides the clock used to stamp reloads.
+func (r *Reloader) SetTestNow(fn func() time.Time) {
+	r.mu.Lock()
+	r.now = fn
+	r.mu.Unlock()
+}
+
+// SetStallMonitor makes the monitor follow the stall thresholds, starting with
+// the ones currently in effect.
+func (r *Reloader) SetStallMonitor(m StallMonitor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := m.SetStallMultiple(r.sched.Settings().Stall.LoopMultiple); err != nil {
+		return err
+	}
+	r.monitor = m
+	return nil
+}
+
+// Reload reads and validates the config file and, if valid, installs it. On
+// any error the current settings stay in effect. It returns the applied
+// changes, which are also written to the log.
+func (r *Reloader) Reload() ([]Change, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.path == "" {
+		return nil, ErrNoConfigFile
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return nil, r.rejected(fmt.Errorf("read operational config: %w", err))
+	}
+	next, err := Parse(data)
+	if err != nil {
+		return nil, r.rejected(err)
+	}
+
+	prev := r.sched.Settings()
+	if err := r.sched.SetSettings(next); err != nil {
+		return nil, r.rejected(err)
+	}
+	if r.monitor != nil {
+		// Validation above guarantees the monitor accepts the threshold.
+		if err := r.monitor.SetStallMultiple(next.Stall.LoopMultiple); err != nil {
+			log.WithError(err).Error("stall threshold not applied")
+		}
+	}
+	r.source = "file:" + r.path
+	r.loadedAt = r.now()
+
+	changes := Diff(prev, next)
+	diff := make(log.Fields, len(changes))
+	for _, c := range changes {
+		diff[c.Field] = c.Old + " -> " + c.New
+	}
+	log.WithFields(log.Fields{
+		"path":    r.path,
+		"changes": len(changes),
+		"diff":    diff,
+	}).Info("operational config reloaded")
+
+	return changes, nil
+}
+
+// rejected logs a failed reload and returns err unchanged.
+func (r *Reloader) rejected(err error) error {
+	log.WithFields(log.Fields{
+		"path":  r.path,
+		"error": err.Error(),
+	}).Warn("operational config reload rejected, keeping current config")
+	return err
+}
+
+// Effective returns the settings currently in force and where they came from.
+func (r *Reloader) Effective() Effective {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Effective{
+		Source:   r.source,
+		LoadedAt: r.loadedAt,
+		Settings: r.sched.Settings(),
+	}
+}
@@ -0,0 +1,165 @@
+// Package poster chooses poster frames for recordings. It computes windows of
+// program content between detected commercials, spreads candidate timestamps
+// across them and ranks scored frames. It does no media I/O; frame analysis is
+// done by the trickplay generator.
+package poster
+
+import (
+	"sort"
+
+	"antserver/internal/commercial"
+)
+
+// Selection defaults.
+const (
+	// GuardMs is trimmed from content next to a commercial, where fades to
+	// black and bumpers are common.
+	GuardMs = 5000
+
+	// MinWindowMs is the shortest stretch of content worth sampling.
+	MinWindowMs = 10000
+
+	// DefaultCandidates is how many frames are scored per recording.
+	DefaultCandidates = 8
+
+	// MinLuma is the mean brightness below which a frame is treated as black.
+	MinLuma = 0.08
+)
+
+// Weights of the frame score components.
+const (
+	motionWeight = 0.6
+	lumaWeight   = 0.4
+)
+
+// Window is a span of program content in milliseconds from recording start.
+type Window struct {
+	StartMs int64 `json:"start_ms"`
+	EndMs   int64 `json:"end_ms"`
+}
+
+// Length returns the window length in milliseconds.
+func (w Window) Length() int64 { return w.EndMs - w.StartMs }
+
+// FrameScore is the analysis of a single candidate frame. Luma and Motion are
+// normalized to 0..1; Score is filled in by Rank.
+type FrameScore struct {
+	AtMs   int64   `json:"at_ms"`
+	Luma   float64 `json:"luma"`
+	Motion float64 `json:"motion"`
+	Score  float64 `json:"score"`
+}
+
+// ContentWindows returns the program content of a recording of the given
+// duration, excluding commercials at or above minConfidence. Content next to
+// a commercial is trimmed by GuardMs, and windows shorter than MinWindowMs are
+// dropped.
+func ContentWindows(durationMs int64, markers []commercial.Marker, minConfidence float64) []Window {
+	if durationMs <= 0 {
+		return nil
+	}
+
+	var breaks []commercial.Marker
+	for _, m := range markers {
+		if m.Confidence < minConfidence || m.EndMs <= m.StartMs {
+			continue
+		}
+		breaks = append(breaks, m)
+	}
+	sort.Slice(breaks, func(i, j int) bool { return breaks[i].StartMs < breaks[j].StartMs })
+
+	var windows []Window
+	add := func(start, end int64, guardStart, guardEnd bool) {
+		if guardStart {
+			start += GuardMs
+		}
+		if guardEnd {
+			end -= GuardMs
+		}
+		if start < 0 {
+			start = 0
+		}
+		if end > durationMs {
+			end = durationMs
+		}
+		if end-start >= MinWindowMs {
+			windows = append(windows, Window{StartMs: start, EndMs: end})
+		}
+	}
+
+	cursor := int64(0)
+	afterBreak := false
+	for _, b := range breaks {
+		if b.StartMs > cursor {
+			add(cursor, b.StartMs, afterBreak, true)
+		}
+		if b.EndMs > cursor {
+			// Overlapping breaks extend the current one.
+			cursor = b.EndMs
+		}
+		afterBreak = true
+	}
+	if cursor < durationMs {
+		add(cursor, durationMs, afterBreak, false)
+	}
+	return windows
+}
+
+// CandidateTimes spreads n timestamps across the windows in proportion to
+// their length, so every stretch of content is sampled evenly.
+func CandidateTimes(windows []Window, n int) []int64 {
+	var total int64
+	for _, w := range windows {
+		total += w.Length()
+	}
+	if total <= 0 || n <= 0 {
+		return nil
+	}
+
+	times := make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		// Midpoint of the i-th of n equal slices of content.
+		offset := (2*int64(i) + 1) * total / (2 * int64(n))
+		for _, w := range windows {
+			if offset < w.Length() {
+				times = append(times, w.StartMs+offset)
+				break
+			}
+			offset -= w.Length()
+		}
+	}
+	return times
+}
+
+// Rank scores frames and orders them best first. Near-black frames always
+// rank below frames with visible content; ties keep timestamp order.
+func Rank(frames []FrameScore) []FrameScore {
+	ranked := make([]FrameScore, len(frames))
+	for i, f := range frames {
+		f.Score = motionWeight*clamp(f.Motion) + lumaWeight*clamp(f.Luma)
+		ranked[i] = f
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if darkA, darkB := a.Luma < MinLuma, b.Luma < MinLuma; darkA != darkB {
+			return darkB
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.AtMs < b.AtMs
+	})
+	return ranked
+}
+
+func clamp(v float64) float64 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 1:
+		return 1
+	default:
+		return v
+	}
+}
@@ -0,0 +1,96 @@
+package recorder
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// OutputFormat is the container used for a recording's HLS segments.
+type OutputFormat string
+
+const (
+	// FormatMPEGTS writes classic MPEG-TS segments. Required by older
+	// players (e.g. legacy Roku firmware) that cannot handle fMP4.
+	FormatMPEGTS OutputFormat = "mpegts"
+
+	// FormatFMP4 writes fragmented MP4 (CMAF) segments with a shared
+	// initialization segment referenced via EXT-X-MAP.
+	FormatFMP4 OutputFormat = "fmp4"
+)
+
+// DefaultOutputFormat is used when no format is configured or requested.
+const DefaultOutputFormat = FormatMPEGTS
+
+// FMP4InitSegment is the name of the initialization segment for fMP4 recordings.
+const FMP4InitSegment = "init.mp4"
+
+// tsPacketSize is the fixed MPEG-TS packet length; every packet starts with 0x47.
+const tsPacketSize = 188
+
+// tsSyncByte marks the start of every MPEG-TS packet.
+const tsSyncByte = 0x47
+
+// fmp4BoxTypes are the ISO-BMFF box types that may open an fMP4 segment or
+// initialization segment.
+var fmp4BoxTypes = [][]byte{
+	[]byte("ftyp"),
+	[]byte("styp"),
+	[]byte("moof"),
+	[]byte("sidx"),
+}
+
+// ParseOutputFormat validates a format name. An empty string yields the default.
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch OutputFormat(s) {
+	case "":
+		return DefaultOutputFormat, nil
+	case FormatMPEGTS, FormatFMP4:
+		return OutputFormat(s), nil
+	default:
+		return "", fmt.Errorf("unsupported output format %q (expected %q or %q)", s, FormatMPEGTS, FormatFMP4)
+	}
+}
+
+// SegmentExtension returns the file extension used for media segments.
+func (f OutputFormat) SegmentExtension() string {
+	if f == FormatFMP4 {
+		return ".m4s"
+	}
+	return ".ts"
+}
+
+// ContainerExtension returns the file extension of the finalized recording.
+func (f OutputFormat) ContainerExtension() string {
+	if f == FormatFMP4 {
+		return ".mp4"
+	}
+	return ".ts"
+}
+
+// SegmentName returns the file name of the media segment with the given sequence number.
+func (f OutputFormat) SegmentName(sequence int) string {
+	return fmt.Sprintf("segment_%05d%s", sequence, f.SegmentExtension())
+}
+
+// DetectFormat inspects the leading bytes of a segment and reports which
+// container it holds. ok is false when the header matches neither format.
+func DetectFormat(header []byte) (format OutputFormat, ok bool) {
+	if len(header) >= 8 {
+		for _, box := range fmp4BoxTypes {
+			if bytes.Equal(header[4:8], box) {
+				return FormatFMP4, true
+			}
+		}
+	}
+
+	if len(header) > 0 && header[0] == tsSyncByte {
+		// When more than one packet is available, require the next sync byte
+		// too so a stray 0x47 is not mistaken for a transport stream.
+		if len(header) > tsPacketSize && header[tsPacketSize] != tsSyncByte {
+			return "", false
+		}
+		return FormatMPEGTS, true
+	}
+
+	return "", false
+}
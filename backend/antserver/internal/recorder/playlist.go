@@ -0,0 +1,147 @@
+package recorder
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// MediaSegment is a single HLS segment written for a recording.
+type MediaSegment struct {
+	// Sequence is the HLS media sequence number of this segment.
+	Sequence int `json:"sequence"`
+
+	// Name is the segment file name, relative to the recording's playlist.
+	Name string `json:"name"`
+
+	// Duration is the playback length of the segment.
+	Duration time.Duration `json:"duration"`
+
+	// CaptureIndex is the capture segment the media segment belongs to.
+	// A change between consecutive segments marks a discontinuity.
+	CaptureIndex int `json:"capture_index"`
+
+	// Gap marks a placeholder covering time lost to a capture gap. Its file
+	// is never written; the playlist tags it EXT-X-GAP so players skip it.
+	Gap bool `json:"gap,omitempty"`
+}
+
+// DefaultGapSegmentDuration is the length of the placeholder segments that
+// stand in for a gap when the recording has no media segment to match.
+const DefaultGapSegmentDuration = 6 * time.Second
+
+// gapSegments returns placeholder segments covering a gap of the given
+// length, continuing the sequence after segments. Placeholders are no
+// longer than the last media segment, so they never raise the playlist's
+// target duration, and belong to the capture that ended, so the resumed
+// capture still starts with a discontinuity.
+func gapSegments(format OutputFormat, segments []MediaSegment, captureIndex int, gap time.Duration) []MediaSegment {
+	size := DefaultGapSegmentDuration
+	if n := len(segments); n > 0 && segments[n-1].Duration > 0 {
+		size = segments[n-1].Duration
+	}
+
+	var out []MediaSegment
+	for remaining := gap; remaining > 0; remaining -= size {
+		seq := len(segments) + len(out)
+		out = append(out, MediaSegment{
+			Sequence:     seq,
+			Name:         format.SegmentName(seq),
+			Duration:     min(size, remaining),
+			CaptureIndex: captureIndex,
+			Gap:          true,
+		})
+	}
+	return out
+}
+
+// DefaultDVRWindow is how far back a live catch-up playlist reaches.
+const DefaultDVRWindow = 2 * time.Hour
+
+// liveWindow returns the most recent segments whose durations fit in window,
+// always keeping at least the newest segment, and the number of
+// discontinuities that fell out of the window before it.
+func liveWindow(segments []MediaSegment, window time.Duration) ([]MediaSegment, int) {
+	start := len(segments)
+	var total time.Duration
+	for start > 0 {
+		d := segments[start-1].Duration
+		if start < len(segments) && total+d > window {
+			break
+		}
+		total += d
+		start--
+	}
+
+	discontinuities := 0
+	for i := 1; i <= start && i < len(segments); i++ {
+		if segments[i].CaptureIndex != segments[i-1].CaptureIndex {
+			discontinuities++
+		}
+	}
+	return segments[start:], discontinuities
+}
+
+// renderPlaylist builds an HLS media playlist for the given segments.
+// ended appends EXT-X-ENDLIST for recordings that will not grow further.
+func renderPlaylist(format OutputFormat, segments []MediaSegment, ended bool) string {
+	return renderWindowPlaylist(format, segments, 0, ended, nil)
+}
+
+// renderWindowPlaylist is renderPlaylist for a window that may have dropped
+// earlier segments; discontinuitySeq counts the discontinuities dropped.
+// uri maps each segment and init segment name to the URI written for it;
+// nil writes the names as they are.
+func renderWindowPlaylist(format OutputFormat, segments []MediaSegment, discontinuitySeq int, ended bool, uri func(name string) string) string {
+	if uri == nil {
+		uri = func(name string) string { return name }
+	}
+
+	target := 1
+	for _, seg := range segments {
+		if secs := int(math.Ceil(seg.Duration.Seconds())); secs > target {
+			target = secs
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	if format == FormatFMP4 {
+		// EXT-X-MAP in media playlists without I-frames requires version 6;
+		// version 7 is the conventional baseline for CMAF output.
+		b.WriteString("#EXT-X-VERSION:7\n")
+	} else {
+		b.WriteString("#EXT-X-VERSION:3\n")
+	}
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", target)
+
+	mediaSequence := 0
+	if len(segments) > 0 {
+		mediaSequence = segments[0].Sequence
+	}
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", mediaSequence)
+	if discontinuitySeq > 0 {
+		fmt.Fprintf(&b, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", discontinuitySeq)
+	}
+
+	if format == FormatFMP4 {
+		fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\"\n", uri(FMP4InitSegment))
+	}
+
+	for i, seg := range segments {
+		if i > 0 && seg.CaptureIndex != segments[i-1].CaptureIndex {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		if seg.Gap {
+			b.WriteString("#EXT-X-GAP\n")
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", seg.Duration.Seconds(), uri(seg.Name))
+	}
+
+	if ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+
+	return b.String()
+}
@@ -2,10 +2,15 @@
 package recorder
 
 import (
+	"errors"
 	"fmt"
+	"path"
 	"sync"
 	"time"
 
+	"antserver/internal/highlights"
+	"antserver/internal/trace"
+
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
@@ -21,64 +26,153 @@ const (
 	RecordingFailed     RecordingState = "failed"
 )
 
+// ErrRecordingNotLive is returned when a live-only operation is requested
+// for a recording that has stopped.
+var ErrRecordingNotLive = errors.New("recorder: recording is not live")
+
+// CaptureSegment is a contiguous span of captured stream data. A recording
+// starts with a single segment; each resume after a transport failure opens a
+// new one.
+type CaptureSegment struct {
+	Index     int       `json:"index"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at,omitempty"`
+}
+
+// Gap marks a span of the recording during which no stream data was captured.
+// End is zero while the gap is still open.
+type Gap struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end,omitempty"`
+	Reason string    `json:"reason"`
+}
+
 // RecordingStatus provides a read-only view of a recording's current state.
 type RecordingStatus struct {
-	ID           string         `json:"id"`
-	EventID      string         `json:"event_id"`
-	StreamURL    string         `json:"stream_url"`
-	State        RecordingState `json:"state"`
-	StartedAt    time.Time      `json:"started_at"`
-	StoppedAt    time.Time      `json:"stopped_at,omitempty"`
-	FinalizedAt  time.Time      `json:"finalized_at,omitempty"`
-	BytesWritten int64          `json:"bytes_written"`
-	ErrorMessage string         `json:"error_message,omitempty"`
+	ID           string           `json:"id"`
+	EventID      string           `json:"event_id"`
+	StreamURL    string           `json:"stream_url"`
+	State        RecordingState   `json:"state"`
+	StartedAt    time.Time        `json:"started_at"`
+	StoppedAt    time.Time        `json:"stopped_at,omitempty"`
+	FinalizedAt  time.Time        `json:"finalized_at,omitempty"`
+	BytesWritten int64            `json:"bytes_written"`
+	ErrorMessage string           `json:"error_message,omitempty"`
+	Segments     []CaptureSegment `json:"segments"`
+	Gaps         []Gap            `json:"gaps"`
+	Format       OutputFormat     `json:"format"`
+
+	// DetectedFormat and FormatMismatch report the result of validating the
+	// first segment against the declared Format.
+	DetectedFormat OutputFormat `json:"detected_format,omitempty"`
+	FormatMismatch bool         `json:"format_mismatch,omitempty"`
+
+	// CorrelationID is inherited from the event being recorded.
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	// Highlights are key moments viewers can jump to, saved by the archive
+	// pipeline.
+	Highlights []highlights.Marker `json:"highlights,omitempty"`
 }
 
 // Recording is the internal representation of an active recording session.
 type Recording struct {
-	ID           string         `json:"id"`
-	EventID      string         `json:"event_id"`
-	StreamURL    string         `json:"stream_url"`
-	State        RecordingState `json:"state"`
-	StartedAt    time.Time      `json:"started_at"`
-	StoppedAt    time.Time      `json:"stopped_at,omitempty"`
-	FinalizedAt  time.Time      `json:"finalized_at,omitempty"`
-	BytesWritten int64          `json:"bytes_written"`
-	ErrorMessage string         `json:"error_message,omitempty"`
-	StoragePath  string         `json:"storage_path,omitempty"`
+	ID           string           `json:"id"`
+	EventID      string           `json:"event_id"`
+	StreamURL    string           `json:"stream_url"`
+	State        RecordingState   `json:"state"`
+	StartedAt    time.Time        `json:"started_at"`
+	StoppedAt    time.Time        `json:"stopped_at,omitempty"`
+	FinalizedAt  time.Time        `json:"finalized_at,omitempty"`
+	BytesWritten int64            `json:"bytes_written"`
+	ErrorMessage string           `json:"error_message,omitempty"`
+	StoragePath  string           `json:"storage_path,omitempty"`
+	Segments     []CaptureSegment `json:"segments"`
+	Gaps         []Gap            `json:"gaps"`
+	Format       OutputFormat     `json:"format"`
+
+	DetectedFormat OutputFormat   `json:"detected_format,omitempty"`
+	FormatMismatch bool           `json:"format_mismatch,omitempty"`
+	MediaSegments  []MediaSegment `json:"media_segments,omitempty"`
+	CorrelationID  string         `json:"correlation_id,omitempty"`
+
+	Highlights []highlights.Marker `json:"highlights,omitempty"`
 }
 
 // Recorder manages the lifecycle of recording sessions.
 type Recorder struct {
-	mu         sync.RWMutex
-	recordings map[string]*Recording
+	mu            sync.RWMutex
+	recordings    map[string]*Recording
+	defaultFormat OutputFormat
 }
 
-// New creates a new Recorder.
+// New creates a new Recorder that writes MPEG-TS segments by default.
 func New() *Recorder {
+	return NewWithFormat(DefaultOutputFormat)
+}
+
+// NewWithFormat creates a new Recorder with the given default output format.
+func NewWithFormat(defaultFormat OutputFormat) *Recorder {
+	if defaultFormat == "" {
+		defaultFormat = DefaultOutputFormat
+	}
 	return &Recorder{
-		recordings: make(map[string]*Recording),
+		recordings:    make(map[string]*Recording),
+		defaultFormat: defaultFormat,
 	}
 }
 
-// StartRecording initiates a new recording for the given event and stream URL.
+// StartRecording initiates a new recording for the given event and stream URL
+// using the recorder's default output format.
 func (r *Recorder) StartRecording(eventID, streamURL string) *Recording {
+	return r.StartRecordingWithFormat(eventID, streamURL, "")
+}
+
+// StartRecordingWithFormat initiates a new recording with an explicit output
+// format. An empty format falls back to the recorder's default.
+func (r *Recorder) StartRecordingWithFormat(eventID, streamURL string, format OutputFormat) *Recording {
+	return r.StartRecordingWithOptions(eventID, streamURL, RecordingOptions{Format: format})
+}
+
+// RecordingOptions holds optional settings for a new recording.
+type RecordingOptions struct {
+	// Format is the segment container; empty uses the recorder's default.
+	Format OutputFormat
+
+	// CorrelationID is the correlation ID of the event being recorded.
+	CorrelationID string
+}
+
+// StartRecordingWithOptions initiates a new recording with the given options.
+func (r *Recorder) StartRecordingWithOptions(eventID, streamURL string, opts RecordingOptions) *Recording {
+	format := opts.Format
+	if format == "" {
+		format = r.defaultFormat
+	}
+
+	now := time.Now()
 	rec := &Recording{
 		ID:        uuid.New().String(),
 		EventID:   eventID,
 		StreamURL: streamURL,
 		State:     RecordingStarting,
-		StartedAt: time.Now(),
+		StartedAt: now,
+		Segments:  []CaptureSegment{{Index: 0, StartedAt: now}},
+		Gaps:      []Gap{},
+		Format:    format,
+
+		CorrelationID: opts.CorrelationID,
 	}
 
 	r.mu.Lock()
 	r.recordings[rec.ID] = rec
 	r.mu.Unlock()
 
-	log.WithFields(log.Fields{
+	trace.Entry(rec.CorrelationID).WithFields(log.Fields{
 		"recording_id": rec.ID,
 		"event_id":     eventID,
 		"stream_url":   streamURL,
+		"format":       format,
 	}).Info("recording started")
 
 	// Move to active state immediately (in production this would happen
@@ -124,8 +218,12 @@ func (r *Recorder) StopRecording(recordingID string) error {
 
 	rec.State = RecordingFinalizing
 	rec.StoppedAt = time.Now()
+	rec.closeOpenGap(rec.StoppedAt)
+	if n := len(rec.Segments); n > 0 && rec.Segments[n-1].EndedAt.IsZero() {
+		rec.Segments[n-1].EndedAt = rec.StoppedAt
+	}
 
-	log.WithFields(log.Fields{
+	trace.Entry(rec.CorrelationID).WithFields(log.Fields{
 		"recording_id": recordingID,
 		"event_id":     rec.EventID,
 		"bytes":        rec.BytesWritten,
@@ -151,9 +249,9 @@ func (r *Recorder) FinalizeRecording(recordingID string) error {
 
 	rec.State = RecordingComplete
 	rec.FinalizedAt = time.Now()
-	rec.StoragePath = fmt.Sprintf("recordings/%s/%s.ts", rec.EventID, rec.ID)
+	rec.StoragePath = fmt.Sprintf("recordings/%s/%s%s", rec.EventID, rec.ID, rec.Format.ContainerExtension())
 
-	log.WithFields(log.Fields{
+	trace.Entry(rec.CorrelationID).WithFields(log.Fields{
 		"recording_id": recordingID,
 		"event_id":     rec.EventID,
 		"storage_path": rec.StoragePath,
@@ -163,6 +261,96 @@ func (r *Recorder) FinalizeRecording(recordingID string) error {
 	return nil
 }
 
+// BeginGap closes the current capture segment and opens a gap starting at the
+// given time. It is called when the ingest transport drops mid-recording.
+func (r *Recorder) BeginGap(recordingID string, at time.Time, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.recordings[recordingID]
+	if !ok {
+		return fmt.Errorf("recording not found: %s", recordingID)
+	}
+
+	if rec.State != RecordingActive {
+		return fmt.Errorf("recording %s is not active (state: %s)", recordingID, rec.State)
+	}
+
+	if n := len(rec.Gaps); n > 0 && rec.Gaps[n-1].End.IsZero() {
+		return fmt.Errorf("recording %s already has an open gap", recordingID)
+	}
+
+	if n := len(rec.Segments); n > 0 {
+		rec.Segments[n-1].EndedAt = at
+	}
+	rec.Gaps = append(rec.Gaps, Gap{Start: at, Reason: reason})
+
+	trace.Entry(rec.CorrelationID).WithFields(log.Fields{
+		"recording_id": recordingID,
+		"event_id":     rec.EventID,
+		"reason":       reason,
+	}).Warn("recording gap started")
+
+	return nil
+}
+
+// ResumeSegment closes the open gap at the given time and starts a new
+// capture segment. The gap is added to the recording's playlist as EXT-X-GAP
+// segments followed by a discontinuity.
+func (r *Recorder) ResumeSegment(recordingID string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.recordings[recordingID]
+	if !ok {
+		return fmt.Errorf("recording not found: %s", recordingID)
+	}
+
+	if rec.State != RecordingActive {
+		return fmt.Errorf("recording %s is not active (state: %s)", recordingID, rec.State)
+	}
+
+	n := len(rec.Gaps)
+	if n == 0 || !rec.Gaps[n-1].End.IsZero() {
+		return fmt.Errorf("recording %s has no open gap", recordingID)
+	}
+
+	rec.Gaps[n-1].End = at
+	gap := at.Sub(rec.Gaps[n-1].Start)
+	rec.MediaSegments = append(rec.MediaSegments, gapSegments(rec.Format, rec.MediaSegments, len(rec.Segments)-1, gap)...)
+	rec.Segments = append(rec.Segments, CaptureSegment{
+		Index:     len(rec.Segments),
+		StartedAt: at,
+	})
+
+	trace.Entry(rec.CorrelationID).WithFields(log.Fields{
+		"recording_id": recordingID,
+		"event_id":     rec.EventID,
+		"segment":      len(rec.Segments) - 1,
+		"gap":          gap,
+	}).Info("recording capture resumed")
+
+	return nil
+}
+
+// closeGap ends the recording's open gap, if any, at the given time.
+func (r *Recorder) closeGap(recordingID string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if rec, ok := r.recordings[recordingID]; ok {
+		rec.closeOpenGap(at)
+	}
+}
+
+// closeOpenGap ends any open gap at the given time.
+// Callers must hold the owning Recorder's lock for writing.
+func (rec *Recording) closeOpenGap(at time.Time) {
+	if n := len(rec.Gaps); n > 0 && rec.Gaps[n-1].End.IsZero() {
+		rec.Gaps[n-1].End = at
+	}
+}
+
 // FailRecording marks a recording as failed with the given error message.
 func (r *Recorder) FailRecording(recordingID, errMsg string) error {
 	r.mu.Lock()
@@ -177,7 +365,7 @@ func (r *Recorder) FailRecording(recordingID, errMsg string) error {
 	rec.ErrorMessage = errMsg
 	rec.StoppedAt = time.Now()
 
-	log.WithFields(log.Fields{
+	trace.Entry(rec.CorrelationID).WithFields(log.Fields{
 		"recording_id": recordingID,
 		"event_id":     rec.EventID,
 		"error":        errMsg,
@@ -196,17 +384,20 @@ func (r *Recorder) GetRecordingStatus(recordingID string) (*RecordingStatus, err
 		return nil, fmt.Errorf("recording not found: %s", recordingID)
 	}
 
-	return &RecordingStatus{
-		ID:           rec.ID,
-		EventID:      rec.EventID,
-		StreamURL:    rec.StreamURL,
-		State:        rec.State,
-		StartedAt:    rec.StartedAt,
-		StoppedAt:    rec.StoppedAt,
-		FinalizedAt:  rec.FinalizedAt,
-		BytesWritten: rec.BytesWritten,
-		ErrorMessage: rec.ErrorMessage,
-	}, nil
+	return rec.status(), nil
+}
+
+// ActiveRecordingForEvent returns the active recording of an event.
+func (r *Recorder) ActiveRecordingForEvent(eventID string) (*RecordingStatus, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, rec := range r.recordings {
+		if rec.EventID == eventID && rec.State == RecordingActive {
+			return rec.status(), nil
+		}
+	}
+	return nil, fmt.Errorf("no active recording for event: %s", eventID)
 }
 
 // ListRecordings returns a list of all recordings.
@@ -216,17 +407,228 @@ func (r *Recorder) ListRecordings() []*RecordingStatus {
 
 	result := make([]*RecordingStatus, 0, len(r.recordings))
 	for _, rec := range r.recordings {
-		result = append(result, &RecordingStatus{
-			ID:           rec.ID,
-			EventID:      rec.EventID,
-			StreamURL:    rec.StreamURL,
-			State:        rec.State,
-			StartedAt:    rec.StartedAt,
-			StoppedAt:    rec.StoppedAt,
-			FinalizedAt:  rec.FinalizedAt,
-			BytesWritten: rec.BytesWritten,
-			ErrorMessage: rec.ErrorMessage,
-		})
+		result = append(result, rec.status())
 	}
 	return result
 }
+
+// RecordingFormat returns the declared output format of a recording.
+func (r *Recorder) RecordingFormat(recordingID string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rec, ok := r.recordings[recordingID]
+	if !ok {
+		return "", fmt.Errorf("recording not found: %s", recordingID)
+	}
+	return string(rec.Format), nil
+}
+
+// SaveHighlights replaces the recording's highlights. It implements
+// archive.HighlightStore.
+func (r *Recorder) SaveHighlights(recordingID string, markers []highlights.Marker) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.recordings[recordingID]
+	if !ok {
+		return fmt.Errorf("recording not found: %s", recordingID)
+	}
+	rec.Highlights = copyHighlights(markers)
+	return nil
+}
+
+// AppendSegment registers a newly written media segment for an active
+// recording and returns it with its format-specific file name.
+func (r *Recorder) AppendSegment(recordingID string, duration time.Duration) (MediaSegment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.recordings[recordingID]
+	if !ok {
+		return MediaSegment{}, fmt.Errorf("recording not found: %s", recordingID)
+	}
+
+	if rec.State != RecordingActive {
+		return MediaSegment{}, fmt.Errorf("recording %s is not active (state: %s)", recordingID, rec.State)
+	}
+
+	seq := len(rec.MediaSegments)
+	seg := MediaSegment{
+		Sequence:     seq,
+		Name:         rec.Format.SegmentName(seq),
+		Duration:     duration,
+		CaptureIndex: len(rec.Segments) - 1,
+	}
+	rec.MediaSegments = append(rec.MediaSegments, seg)
+	return seg, nil
+}
+
+// Playlist renders the HLS media playlist for a recording. In-progress
+// recordings produce a live (open-ended) playlist; stopped recordings are
+// terminated with EXT-X-ENDLIST.
+func (r *Recorder) Playlist(recordingID string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rec, ok := r.recordings[recordingID]
+	if !ok {
+		return "", fmt.Errorf("recording not found: %s", recordingID)
+	}
+
+	ended := rec.State != RecordingStarting && rec.State != RecordingActive
+	return renderPlaylist(rec.Format, rec.MediaSegments, ended), nil
+}
+
+// LivePlaylist renders a sliding-window HLS playlist for an in-progress
+// recording, so late viewers can catch up from up to window behind live. The
+// window grows with the recording until it reaches window, then slides. A
+// non-positive window uses DefaultDVRWindow. Recordings that are no longer
+// live return ErrRecordingNotLive; use Playlist for those.
+func (r *Recorder) LivePlaylist(recordingID string, window time.Duration) (string, error) {
+	live, err := r.liveSnapshot(recordingID, window)
+	if err != nil {
+		return "", err
+	}
+	return renderWindowPlaylist(live.format, live.segments, live.discontinuities, false, nil), nil
+}
+
+// SignedLivePlaylist is LivePlaylist with every segment URI, and the fMP4
+// init segment, replaced by sign's URL for its storage key,
+// recordings/<event>/<recording>/<name>. An error from sign fails the
+// playlist, so an unsigned URI is never handed out.
+func (r *Recorder) SignedLivePlaylist(recordingID string, window time.Duration, sign func(key string) (string, error)) (string, error) {
+	live, err := r.liveSnapshot(recordingID, window)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(live.segments)+1)
+	if live.format == FormatFMP4 {
+		names = append(names, FMP4InitSegment)
+	}
+	for _, seg := range live.segments {
+		names = append(names, seg.Name)
+	}
+	signed := make(map[string]string, len(names))
+	for _, name := range names {
+		u, err := sign(path.Join(live.prefix, name))
+		if err != nil {
+			return "", fmt.Errorf("sign %s: %w", name, err)
+		}
+		signed[name] = u
+	}
+
+	uri := func(name string) string { return signed[name] }
+	return renderWindowPlaylist(live.format, live.segments, live.discontinuities, false, uri), nil
+}
+
+// liveRecording is the part of an in-progress recording a catch-up playlist
+// is rendered from, copied so rendering can run without the lock.
+type liveRecording struct {
+	format          OutputFormat
+	prefix          string
+	segments        []MediaSegment
+	discontinuities int
+}
+
+func (r *Recorder) liveSnapshot(recordingID string, window time.Duration) (liveRecording, error) {
+	if window <= 0 {
+		window = DefaultDVRWindow
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rec, ok := r.recordings[recordingID]
+	if !ok {
+		return liveRecording{}, fmt.Errorf("recording not found: %s", recordingID)
+	}
+	if rec.State != RecordingStarting && rec.State != RecordingActive {
+		return liveRecording{}, fmt.Errorf("%w: %s (state: %s)", ErrRecordingNotLive, recordingID, rec.State)
+	}
+
+	segments, discontinuities := liveWindow(rec.MediaSegments, window)
+	return liveRecording{
+		format:          rec.Format,
+		prefix:          fmt.Sprintf("recordings/%s/%s", rec.EventID, rec.ID),
+		segments:        append([]MediaSegment(nil), segments...),
+		discontinuities: discontinuities,
+	}, nil
+}
+
+// ValidateFirstSegment checks the leading bytes of a recording's first segment
+// against its declared format. A mismatch (e.g. the AntBox sending MPEG-TS for
+// an fMP4 recording) is flagged on the recording status and returned as an error.
+func (r *Recorder) ValidateFirstSegment(recordingID string, header []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.recordings[recordingID]
+	if !ok {
+		return fmt.Errorf("recording not found: %s", recordingID)
+	}
+
+	detected, known := DetectFormat(header)
+	rec.DetectedFormat = detected
+	rec.FormatMismatch = !known || detected != rec.Format
+
+	if rec.FormatMismatch {
+		trace.Entry(rec.CorrelationID).WithFields(log.Fields{
+			"recording_id": recordingID,
+			"declared":     rec.Format,
+			"detected":     detected,
+		}).Warn("recording segment format mismatch")
+
+		if !known {
+			return fmt.Errorf("recording %s: first segment is not a recognized container (declared %s)", recordingID, rec.Format)
+		}
+		return fmt.Errorf("recording %s: first segment is %s but recording is declared %s", recordingID, detected, rec.Format)
+	}
+
+	return nil
+}
+
+// status builds a read-only snapshot of the recording.
+// Callers must hold the owning Recorder's lock.
+func (rec *Recording) status() *RecordingStatus {
+	return &RecordingStatus{
+		ID:             rec.ID,
+		EventID:        rec.EventID,
+		StreamURL:      rec.StreamURL,
+		State:          rec.State,
+		StartedAt:      rec.StartedAt,
+		StoppedAt:      rec.StoppedAt,
+		FinalizedAt:    rec.FinalizedAt,
+		BytesWritten:   rec.BytesWritten,
+		ErrorMessage:   rec.ErrorMessage,
+		Segments:       copySegments(rec.Segments),
+		Gaps:           copyGaps(rec.Gaps),
+		Format:         rec.Format,
+		DetectedFormat: rec.DetectedFormat,
+		FormatMismatch: rec.FormatMismatch,
+		CorrelationID:  rec.CorrelationID,
+		Highlights:     copyHighlights(rec.Highlights),
+	}
+}
+
+func copySegments(in []CaptureSegment) []CaptureSegment {
+	out := make([]CaptureSegment, len(in))
+	copy(out, in)
+	return out
+}
+
+func copyHighlights(in []highlights.Marker) []highlights.Marker {
+	if in == nil {
+		return nil
+	}
+	out := make([]highlights.Marker, len(in))
+	copy(out, in)
+	return out
+}
+
+func copyGaps(in []Gap) []Gap {
+	out := make([]Gap, len(in))
+	copy(out, in)
+	return out
+}
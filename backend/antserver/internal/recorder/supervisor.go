@@ -0,0 +1,320 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"antserver/internal/ingest"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultResumeDelay is the pause between attempts to bring up a replacement
+// transport after the previous one failed.
+const DefaultResumeDelay = 10 * time.Second
+
+// GapReasonTransportFailed is recorded on gaps opened because the ingest
+// transport exhausted its reconnection attempts.
+const GapReasonTransportFailed = "transport_failed"
+
+// ErrNilTransportFactory is returned when a CaptureSupervisor is created
+// without a way to build replacement transports.
+var ErrNilTransportFactory = errors.New("recorder: transport factory must not be nil")
+
+// TransportFactory creates a fresh, disconnected transport for a stream.
+type TransportFactory func(streamID string) (*ingest.Transport, error)
+
+// capture tracks a single supervised recording.
+type capture struct {
+	recordingID string
+	streamID    string
+	endTime     time.Time
+	transport   *ingest.Transport
+	done        bool
+}
+
+// ended reports whether the event's end time has passed at now. Events
+// without an end time run until stopped.
+func (c *capture) ended(now time.Time) bool {
+	return !c.endTime.IsZero() && !now.Before(c.endTime)
+}
+
+// CaptureSupervisor keeps live recordings alive across transport failures.
+// When a supervised transport enters the failed state before the event's end
+// time, the supervisor opens a gap on the recording, builds a new transport
+// and resumes capture into a new segment. Failures at or after the end time
+// finalize the recording instead.
+type CaptureSupervisor struct {
+	mu       sync.Mutex
+	recorder *Recorder
+	factory  TransportFactory
+	captures map[string]*capture
+
+	resumeDelay time.Duration
+
+	// Overridable for testing.
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewCaptureSupervisor creates a CaptureSupervisor that records gaps and
+// segments on the given Recorder.
+func NewCaptureSupervisor(rec *Recorder, factory TransportFactory) (*CaptureSupervisor, error) {
+	if rec == nil {
+		return nil, errors.New("recorder: recorder must not be nil")
+	}
+	if factory == nil {
+		return nil, ErrNilTransportFactory
+	}
+	return &CaptureSupervisor{
+		recorder:    rec,
+		factory:     factory,
+		captures:    make(map[string]*capture),
+		resumeDelay: DefaultResumeDelay,
+		now:         time.Now,
+		sleep:       time.Sleep,
+	}, nil
+}
+
+// Supervise starts watching a connected transport that is feeding the given
+// recording. endTime is the scheduled end of the event; capture is only
+// resumed while it lies in the future.
+func (s *CaptureSupervisor) Supervise(recordingID, streamID string, endTime time.Time, tr *ingest.Transport) error {
+	if tr == nil {
+		return errors.New("recorder: transport must not be nil")
+	}
+	c, err := s.register(recordingID, streamID, endTime)
+	if err != nil {
+		return err
+	}
+	s.attach(c, tr)
+	return nil
+}
+
+// Start builds a transport for the stream, connects it and supervises it
+// for the given recording. If the first transport cannot be built or does
+// not connect, the recording starts with a gap and capture is resumed in the
+// background as if an established transport had failed.
+func (s *CaptureSupervisor) Start(recordingID, streamID string, endTime time.Time) error {
+	c, err := s.register(recordingID, streamID, endTime)
+	if err != nil {
+		return err
+	}
+
+	tr, err := s.factory(streamID)
+	if err == nil {
+		if err = tr.Connect(streamID); err == nil {
+			s.attach(c, tr)
+			return nil
+		}
+		tr.Disconnect()
+	}
+
+	log.WithFields(log.Fields{
+		"recording_id": recordingID,
+		"stream_id":    streamID,
+		"error":        err,
+	}).Warn("initial capture transport failed, resuming in background")
+
+	if err := s.recorder.BeginGap(recordingID, s.currentTime(), GapReasonTransportFailed); err != nil {
+		s.Stop(recordingID)
+		return err
+	}
+	go s.resume(c)
+	return nil
+}
+
+// register records a new capture for a recording that exists and is not
+// already supervised.
+func (s *CaptureSupervisor) register(recordingID, streamID string, endTime time.Time) (*capture, error) {
+	if _, err := s.recorder.GetRecordingStatus(recordingID); err != nil {
+		return nil, err
+	}
+
+	c := &capture{
+		recordingID: recordingID,
+		streamID:    streamID,
+		endTime:     endTime,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.captures[recordingID]; exists {
+		return nil, fmt.Errorf("recording %s is already supervised", recordingID)
+	}
+	s.captures[recordingID] = c
+	return c, nil
+}
+
+// Stop ends supervision of a recording and disconnects its transport.
+// Subsequent transport failures for it are ignored.
+func (s *CaptureSupervisor) Stop(recordingID string) {
+	var tr *ingest.Transport
+	s.mu.Lock()
+	if c, ok := s.captures[recordingID]; ok {
+		c.done = true
+		tr = c.transport
+		delete(s.captures, recordingID)
+	}
+	s.mu.Unlock()
+
+	if tr != nil {
+		tr.Disconnect()
+	}
+}
+
+// attach registers the failure callback on a transport and makes it the
+// current transport for the capture.
+func (s *CaptureSupervisor) attach(c *capture, tr *ingest.Transport) {
+	s.mu.Lock()
+	c.transport = tr
+	s.mu.Unlock()
+
+	tr.OnStateChange(func(old, new ingest.TransportState) {
+		if new != ingest.StateFailed {
+			return
+		}
+		s.handleFailure(c, tr)
+	})
+}
+
+// handleFailure disconnects the failed transport, releasing its connection,
+// and decides whether to resume or finalize.
+func (s *CaptureSupervisor) handleFailure(c *capture, tr *ingest.Transport) {
+	s.mu.Lock()
+	if c.done || c.transport != tr {
+		// Stale callback from a transport that has already been replaced.
+		s.mu.Unlock()
+		return
+	}
+	c.transport = nil
+	s.mu.Unlock()
+
+	tr.Disconnect()
+
+	now := s.currentTime()
+	if c.ended(now) {
+		s.finish(c, now)
+		return
+	}
+
+	if err := s.recorder.BeginGap(c.recordingID, now, GapReasonTransportFailed); err != nil {
+		log.WithError(err).WithField("recording_id", c.recordingID).Error("failed to record capture gap")
+		s.finish(c, now)
+		return
+	}
+
+	s.resume(c)
+}
+
+// resume keeps building replacement transports until one connects or the
+// event's end time passes.
+func (s *CaptureSupervisor) resume(c *capture) {
+	for attempt := 1; ; attempt++ {
+		s.mu.Lock()
+		done := c.done
+		delay := s.resumeDelay
+		now, sleep := s.now, s.sleep
+		s.mu.Unlock()
+		if done {
+			return
+		}
+
+		if c.ended(now()) {
+			s.finish(c, c.endTime)
+			return
+		}
+
+		tr, err := s.factory(c.streamID)
+		if err == nil {
+			if err = tr.Connect(c.streamID); err != nil {
+				tr.Disconnect()
+			}
+		}
+		if err == nil {
+			s.mu.Lock()
+			done := c.done
+			s.mu.Unlock()
+			if done {
+				tr.Disconnect()
+				return
+			}
+			if err := s.recorder.ResumeSegment(c.recordingID, now()); err != nil {
+				log.WithError(err).WithField("recording_id", c.recordingID).Error("failed to resume capture segment")
+				tr.Disconnect()
+				s.finish(c, now())
+				return
+			}
+			s.attach(c, tr)
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"recording_id": c.recordingID,
+			"stream_id":    c.streamID,
+			"attempt":      attempt,
+			"error":        err,
+		}).Warn("capture resume attempt failed")
+
+		sleep(delay)
+	}
+}
+
+// currentTime reads the supervisor's clock, which tests may replace while
+// captures are running.
+func (s *CaptureSupervisor) currentTime() time.Time {
+	s.mu.Lock()
+	now := s.now
+	s.mu.Unlock()
+	return now()
+}
+
+// finish stops supervision and finalizes the recording.
+func (s *CaptureSupervisor) finish(c *capture, at time.Time) {
+	s.mu.Lock()
+	if c.done {
+		s.mu.Unlock()
+		return
+	}
+	c.done = true
+	delete(s.captures, c.recordingID)
+	s.mu.Unlock()
+
+	s.recorder.closeGap(c.recordingID, at)
+	if err := s.recorder.StopRecording(c.recordingID); err != nil {
+		log.WithError(err).WithField("recording_id", c.recordingID).Error("failed to stop recording")
+		return
+	}
+	if err := s.recorder.FinalizeRecording(c.recordingID); err != nil {
+		log.WithError(err).WithField("recording_id", c.recordingID).Error("failed to finalize recording")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"recording_id": c.recordingID,
+		"at":           at,
+	}).Info("supervised capture finished")
+}
+
+// SetResumeDelay overrides the pause between resume attempts.
+func (s *CaptureSupervisor) SetResumeDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resumeDelay = d
+}
+
+// SetTestNow replaces the time function for testing.
+func (s *CaptureSupervisor) SetTestNow(fn func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = fn
+}
+
+// SetTestSleep replaces the sleep function for testing.
+func (s *CaptureSupervisor) SetTestSleep(fn func(time.Duration)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sleep = fn
+}
@@ -0,0 +1,72 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultSearchTimeout bounds each search index request.
+const DefaultSearchTimeout = 10 * time.Second
+
+// ErrEmptySearchURL is returned when a MeiliIndex is created without a URL.
+var ErrEmptySearchURL = errors.New("retention: search url must not be empty")
+
+// MeiliIndex removes recordings from a Meilisearch index. It implements
+// SearchIndex.
+type MeiliIndex struct {
+	baseURL string
+	apiKey  string
+	index   string
+	client  *http.Client
+}
+
+// NewMeiliIndex creates a MeiliIndex for the named index on the Meilisearch
+// server at baseURL. apiKey may be empty when the server has no master key.
+func NewMeiliIndex(baseURL, apiKey, index string) (*MeiliIndex, error) {
+	if baseURL == "" {
+		return nil, ErrEmptySearchURL
+	}
+	if index == "" {
+		return nil, errors.New("retention: search index name must not be empty")
+	}
+	return &MeiliIndex{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		index:   index,
+		client:  &http.Client{Timeout: DefaultSearchTimeout},
+	}, nil
+}
+
+// Remove deletes the recording's document. Meilisearch accepts deletes of
+// documents it does not hold, and a missing index means nothing is indexed,
+// so both succeed.
+func (m *MeiliIndex) Remove(ctx context.Context, recordingID string) error {
+	endpoint := fmt.Sprintf("%s/indexes/%s/documents/%s", m.baseURL, url.PathEscape(m.index), url.PathEscape(recordingID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("remove %s from search index: %w", recordingID, err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	default:
+		return fmt.Errorf("remove %s from search index: unexpected status %d", recordingID, resp.StatusCode)
+	}
+}
@@ -0,0 +1,355 @@
+// Package retention enforces per-family retention policies on DVR recordings.
+// A Janitor periodically finds recordings that fall outside their family's
+// policy and deletes their media from object storage, their search index
+// entry and finally their database row. Every step tolerates work that was
+// already done, so a run interrupted part-way is completed by the next one.
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"antserver/internal/watchdog"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultInterval is how often the janitor runs when started with Loop.
+const DefaultInterval = time.Hour
+
+// Sentinel errors returned by retention operations.
+var (
+	ErrNilDB          = errors.New("retention: db must not be nil")
+	ErrNilObjectStore = errors.New("retention: object store must not be nil")
+	ErrNilIndex       = errors.New("retention: search index must not be nil")
+	ErrEmptyFamilyID  = errors.New("retention: family id must not be empty")
+	ErrInvalidPolicy  = errors.New("retention: keep days and keep count must not be negative")
+	ErrPolicyNotFound = errors.New("retention: policy not found")
+)
+
+// Policy limits how many recordings a family keeps. A recording is expired
+// when it is older than KeepDays or falls outside the KeepCount most recent
+// recordings. Zero disables the respective limit.
+type Policy struct {
+	FamilyID  string `json:"family_id"`
+	KeepDays  int    `json:"keep_days"`
+	KeepCount int    `json:"keep_count"`
+}
+
+// Validate checks the policy for invalid values.
+func (p Policy) Validate() error {
+	if p.FamilyID == "" {
+		return ErrEmptyFamilyID
+	}
+	if p.KeepDays < 0 || p.KeepCount < 0 {
+		return ErrInvalidPolicy
+	}
+	return nil
+}
+
+// Recording is the subset of a DVR recording row needed to apply a policy.
+type Recording struct {
+	ID          string
+	FamilyID    string
+	StoragePath string
+	StartTime   time.Time
+}
+
+// Expired returns the recordings that fall outside the policy at now.
+// recordings may be in any order.
+func Expired(policy Policy, recordings []Recording, now time.Time) []Recording {
+	sorted := make([]Recording, len(recordings))
+	copy(sorted, recordings)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime.After(sorted[j].StartTime)
+	})
+
+	var cutoff time.Time
+	if policy.KeepDays > 0 {
+		cutoff = now.AddDate(0, 0, -policy.KeepDays)
+	}
+
+	var expired []Recording
+	for i, rec := range sorted {
+		overCount := policy.KeepCount > 0 && i >= policy.KeepCount
+		tooOld := policy.KeepDays > 0 && rec.StartTime.Before(cutoff)
+		if overCount || tooOld {
+			expired = append(expired, rec)
+		}
+	}
+	return expired
+}
+
+// ObjectStore lists and deletes recording media. Delete must succeed for keys
+// that do not exist. pkg/storage backends already behave this way and
+// satisfy the interface.
+type ObjectStore interface {
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// SearchIndex removes recordings from the search index. Remove must succeed
+// for recordings that are not indexed.
+type SearchIndex interface {
+	Remove(ctx context.Context, recordingID string) error
+}
+
+// Store persists retention policies and reads and deletes DVR recordings.
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore creates a Store backed by the given database.
+func NewStore(db *sql.DB) (*Store, error) {
+	if db == nil {
+		return nil, ErrNilDB
+	}
+	return &Store{db: db}, nil
+}
+
+// SetPolicy creates or replaces the policy for a family.
+func (s *Store) SetPolicy(ctx context.Context, p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO recording_retention_policies (family_id, keep_days, keep_count, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (family_id) DO UPDATE
+		SET keep_days = EXCLUDED.keep_days,
+		    keep_count = EXCLUDED.keep_count,
+		    updated_at = NOW()`,
+		p.FamilyID, p.KeepDays, p.KeepCount)
+	if err != nil {
+		return fmt.Errorf("set retention policy for family %s: %w", p.FamilyID, err)
+	}
+	return nil
+}
+
+// GetPolicy returns the policy for a family, or ErrPolicyNotFound.
+func (s *Store) GetPolicy(ctx context.Context, familyID string) (Policy, error) {
+	p := Policy{FamilyID: familyID}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT keep_days, keep_count FROM recording_retention_policies WHERE family_id = $1`,
+		familyID).Scan(&p.KeepDays, &p.KeepCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Policy{}, ErrPolicyNotFound
+	}
+	if err != nil {
+		return Policy{}, fmt.Errorf("get retention policy for family %s: %w", familyID, err)
+	}
+	return p, nil
+}
+
+// ListPolicies returns the policies of all families that have one.
+func (s *Store) ListPolicies(ctx context.Context) ([]Policy, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT family_id, keep_days, keep_count FROM recording_retention_policies ORDER BY family_id`)
+	if err != nil {
+		return nil, fmt.Errorf("list retention policies: %w", err)
+	}
+	defer rows.Close()
+
+	var policies []Policy
+	for rows.Next() {
+		var p Policy
+		if err := rows.Scan(&p.FamilyID, &p.KeepDays, &p.KeepCount); err != nil {
+			return nil, fmt.Errorf("scan retention policy: %w", err)
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// CompletedRecordings returns the family's completed recordings. Scheduled,
+// in-progress and failed recordings are never subject to retention.
+func (s *Store) CompletedRecordings(ctx context.Context, familyID string) ([]Recording, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, family_id, COALESCE(storage_path, ''), start_time
+		FROM dvr_recordings
+		WHERE family_id = $1 AND status = 'completed'
+		ORDER BY start_time DESC`,
+		familyID)
+	if err != nil {
+		return nil, fmt.Errorf("list recordings for family %s: %w", familyID, err)
+	}
+	defer rows.Close()
+
+	var recordings []Recording
+	for rows.Next() {
+		var r Recording
+		if err := rows.Scan(&r.ID, &r.FamilyID, &r.StoragePath, &r.StartTime); err != nil {
+			return nil, fmt.Errorf("scan recording: %w", err)
+		}
+		recordings = append(recordings, r)
+	}
+	return recordings, rows.Err()
+}
+
+// DeleteRecording removes a recording row. Deleting a row that no longer
+// exists is not an error.
+func (s *Store) DeleteRecording(ctx context.Context, recordingID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM dvr_recordings WHERE id = $1`, recordingID); err != nil {
+		return fmt.Errorf("delete recording %s: %w", recordingID, err)
+	}
+	return nil
+}
+
+// Result summarizes a single janitor run.
+type Result struct {
+	Families int `json:"families"`
+	Deleted  int `json:"deleted"`
+	Failed   int `json:"failed"`
+}
+
+// Janitor applies retention policies to stored recordings.
+type Janitor struct {
+	store   *Store
+	objects ObjectStore
+	index   SearchIndex
+
+	// now is overridable for testing.
+	now func() time.Time
+}
+
+// NewJanitor creates a Janitor. All dependencies are required.
+func NewJanitor(store *Store, objects ObjectStore, index SearchIndex) (*Janitor, error) {
+	if store == nil {
+		return nil, ErrNilDB
+	}
+	if objects == nil {
+		return nil, ErrNilObjectStore
+	}
+	if index == nil {
+		return nil, ErrNilIndex
+	}
+	return &Janitor{
+		store:   store,
+		objects: objects,
+		index:   index,
+		now:     time.Now,
+	}, nil
+}
+
+// RunOnce applies every family's policy once. A recording whose media or
+// index entry cannot be removed keeps its row so the next run retries it;
+// such failures are counted but do not stop the run.
+func (j *Janitor) RunOnce(ctx context.Context) (Result, error) {
+	var res Result
+
+	policies, err := j.store.ListPolicies(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	now := j.now()
+	for _, policy := range policies {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		recordings, err := j.store.CompletedRecordings(ctx, policy.FamilyID)
+		if err != nil {
+			return res, err
+		}
+		res.Families++
+
+		for _, rec := range Expired(policy, recordings, now) {
+			if err := j.delete(ctx, rec); err != nil {
+				res.Failed++
+				log.WithFields(log.Fields{
+					"recording_id": rec.ID,
+					"family_id":    rec.FamilyID,
+					"error":        err,
+				}).Error("retention delete failed")
+				continue
+			}
+			res.Deleted++
+			log.WithFields(log.Fields{
+				"recording_id": rec.ID,
+				"family_id":    rec.FamilyID,
+				"storage_path": rec.StoragePath,
+				"start_time":   rec.StartTime,
+			}).Info("recording deleted by retention policy")
+		}
+	}
+
+	return res, nil
+}
+
+// delete removes a recording's media, index entry and row, in that order,
+// so a row is only dropped once nothing else refers to it.
+func (j *Janitor) delete(ctx context.Context, rec Recording) error {
+	if rec.StoragePath != "" {
+		keys, err := j.mediaKeys(ctx, rec.StoragePath)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := j.objects.Delete(ctx, key); err != nil {
+				return fmt.Errorf("delete object %s: %w", key, err)
+			}
+		}
+	}
+	if err := j.index.Remove(ctx, rec.ID); err != nil {
+		return fmt.Errorf("remove from search index: %w", err)
+	}
+	return j.store.DeleteRecording(ctx, rec.ID)
+}
+
+// mediaKeys returns the stored keys of a recording's media. With
+// storagePath recordings/<event>/<recording>.ts that is every key under the
+// recording's prefix recordings/<event>/<recording>: the container, its
+// playlist (<recording>.m3u8) and its HLS segments (<recording>/...). The
+// event's directory is listed rather than the bare prefix so
+// directory-based backends find the keys too.
+func (j *Janitor) mediaKeys(ctx context.Context, storagePath string) ([]string, error) {
+	stem := strings.TrimSuffix(storagePath, path.Ext(storagePath))
+	listPrefix := stem
+	if dir := path.Dir(storagePath); dir != "." {
+		listPrefix = dir + "/"
+	}
+
+	listed, err := j.objects.List(ctx, listPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("list objects under %s: %w", listPrefix, err)
+	}
+	var keys []string
+	for _, key := range listed {
+		if key == storagePath || strings.HasPrefix(key, stem+".") || strings.HasPrefix(key, stem+"/") {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Loop returns a watchdog loop that calls RunOnce immediately and then every
+// interval. A non-positive interval uses DefaultInterval.
+func (j *Janitor) Loop(interval time.Duration) watchdog.LoopFunc {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return watchdog.Every(interval, func(ctx context.Context) {
+		res, err := j.RunOnce(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.WithError(err).Error("retention run failed")
+		} else if res.Deleted > 0 || res.Failed > 0 {
+			log.WithFields(log.Fields{
+				"families": res.Families,
+				"deleted":  res.Deleted,
+				"failed":   res.Failed,
+			}).Info("retention run completed")
+		}
+	})
+}
+
+// SetTestNow replaces the time function for testing.
+func (j *Janitor) SetTestNow(fn func() time.Time) {
+	j.now = fn
+}
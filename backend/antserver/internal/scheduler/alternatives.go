@@ -0,0 +1,176 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// AlternativeKind describes how an alternative relates to the original event.
+type AlternativeKind string
+
+const (
+	// AlternativeRerun is another airing on the event's own channel.
+	AlternativeRerun AlternativeKind = "rerun"
+
+	// AlternativeOtherChannel is an airing on a different channel.
+	AlternativeOtherChannel AlternativeKind = "other_channel"
+)
+
+// Airing is a guide showing of a programme.
+type Airing struct {
+	Channel   string
+	Title     string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// Alternative is an airing an event could record instead of its own slot
+// without exceeding tuner capacity.
+type Alternative struct {
+	Channel   string          `json:"channel"`
+	StartTime time.Time       `json:"start_time"`
+	EndTime   time.Time       `json:"end_time"`
+	Kind      AlternativeKind `json:"kind"`
+}
+
+// AlternativeSource supplies the guide airings and tuner capacity that
+// SuggestAlternatives plans around.
+type AlternativeSource interface {
+	// Airings returns the known airings of the programme with the given
+	// title.
+	Airings(title string) []Airing
+
+	// Tuners returns how many tuners can tune the channel. Zero means the
+	// channel is not in the lineup.
+	Tuners(channel string) int
+
+	// SharesTuners reports whether some tuner that can tune channel can
+	// also tune other, so events on other compete for channel's tuners.
+	SharesTuners(channel, other string) bool
+}
+
+// SetAlternativeSource installs the source used by SuggestAlternatives.
+func (s *Scheduler) SetAlternativeSource(src AlternativeSource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alternatives = src
+}
+
+// SuggestAlternatives returns other airings of the event's programme that
+// start in the future on a channel in the lineup, are not already recorded
+// and overlap fewer unfinished events competing for the channel's tuners
+// than the channel has. Results are ordered by start time; the list is empty
+// when nothing fits or no source is set.
+func (s *Scheduler) SuggestAlternatives(eventID string) ([]Alternative, error) {
+	s.mu.RLock()
+	evt, ok := s.events[eventID]
+	if !ok {
+		s.mu.RUnlock()
+		return nil, fmt.Errorf("event not found: %s", eventID)
+	}
+	src := s.alternatives
+	title, channel, start := evt.Metadata.Title, evt.Channel, evt.StartTime
+	eventChannels := make(map[string]bool)
+	for _, other := range s.events {
+		if !isFinished(other.State) {
+			eventChannels[other.Channel] = true
+		}
+	}
+	s.mu.RUnlock()
+
+	result := []Alternative{}
+	if src == nil || title == "" {
+		return result, nil
+	}
+
+	// Look up airings and capacity without holding the lock; the source may
+	// call back into other components.
+	airings := src.Airings(title)
+	tuners := make(map[string]int)
+	competing := make(map[string]map[string]bool)
+	for _, a := range airings {
+		if _, ok := tuners[a.Channel]; ok {
+			continue
+		}
+		tuners[a.Channel] = src.Tuners(a.Channel)
+		competing[a.Channel] = make(map[string]bool)
+		for other := range eventChannels {
+			competing[a.Channel][other] = other == a.Channel || src.SharesTuners(a.Channel, other)
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.clock.Now()
+	for _, a := range airings {
+		if a.Channel == channel && a.StartTime.Equal(start) {
+			continue
+		}
+		if !a.StartTime.After(now) || !a.EndTime.After(a.StartTime) {
+			continue
+		}
+		if s.scheduledLocked(a) || s.overlappingLocked(eventID, competing[a.Channel], a.StartTime, a.EndTime) >= tuners[a.Channel] {
+			continue
+		}
+
+		kind := AlternativeOtherChannel
+		if a.Channel == channel {
+			kind = AlternativeRerun
+		}
+		result = append(result, Alternative{
+			Channel:   a.Channel,
+			StartTime: a.StartTime,
+			EndTime:   a.EndTime,
+			Kind:      kind,
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].StartTime.Before(result[j].StartTime) })
+	return result, nil
+}
+
+// scheduledLocked reports whether an unfinished event already records the
+// airing. Must be called with s.mu held.
+func (s *Scheduler) scheduledLocked(a Airing) bool {
+	for _, evt := range s.events {
+		if !isFinished(evt.State) && evt.Channel == a.Channel && evt.Metadata.Title == a.Title && evt.StartTime.Equal(a.StartTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlappingLocked counts unfinished events other than excludeID on the
+// competing channels whose window overlaps [start, end). Must be called with
+// s.mu held.
+func (s *Scheduler) overlappingLocked(excludeID string, competing map[string]bool, start, end time.Time) int {
+	count := 0
+	for id, evt := range s.events {
+		if id == excludeID || isFinished(evt.State) || !competing[evt.Channel] {
+			continue
+		}
+		if evt.StartTime.Before(end) && eventEnd(evt).After(start) {
+			count++
+		}
+	}
+	return count
+}
+
+// eventEnd returns the event's end time, assuming its league's duration when
+// it has none.
+func eventEnd(evt *Event) time.Time {
+	if evt.EndTime.IsZero() {
+		return evt.StartTime.Add(LeagueDuration(evt.Metadata.League))
+	}
+	return evt.EndTime
+}
+
+func isFinished(state EventState) bool {
+	switch state {
+	case StateComplete, StateFailed, StateCancelled:
+		return true
+	}
+	return false
+}
@@ -3,10 +3,15 @@
 package scheduler
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"antserver/internal/trace"
+
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
@@ -22,17 +27,59 @@ const (
 	StateFinalizing EventState = "finalizing"
 	StateComplete   EventState = "complete"
 	StateFailed     EventState = "failed"
+	StateCancelled  EventState = "cancelled"
 )
 
 // validTransitions defines which state transitions are allowed.
 var validTransitions = map[EventState][]EventState{
-	StatePending:    {StateScheduled, StateFailed},
-	StateScheduled:  {StateActive, StateFailed},
-	StateActive:     {StateRecording, StateFailed},
-	StateRecording:  {StateFinalizing, StateFailed},
+	StatePending:    {StateScheduled, StateFailed, StateCancelled},
+	StateScheduled:  {StateActive, StateFailed, StateCancelled},
+	StateActive:     {StateRecording, StateFailed, StateCancelled},
+	StateRecording:  {StateFinalizing, StateFailed, StateCancelled},
 	StateFinalizing: {StateComplete, StateFailed},
 }
 
+// ErrChainOutOfOrder is returned when a chained event is activated while an
+// earlier member of its chain has not finished recording.
+var ErrChainOutOfOrder = errors.New("scheduler: earlier chain member has not finished recording")
+
+// ErrChainNotFound is returned when no events belong to the given chain.
+var ErrChainNotFound = errors.New("scheduler: chain not found")
+
+// ErrEventStarted is returned when rescheduling an event that is no longer
+// pending or scheduled.
+var ErrEventStarted = errors.New("scheduler: event has already started")
+
+// PastStartTolerance is how far in the past a new event may start, allowing
+// for clock skew and events created just after they began.
+const PastStartTolerance = 5 * time.Minute
+
+// Event time validation errors.
+var (
+	ErrZeroStartTime  = errors.New("zero start time")
+	ErrEndBeforeStart = errors.New("end before start")
+	ErrStartInPast    = errors.New("start in the past")
+)
+
+// ErrDuplicateChainPosition is the validation reason for an event that takes
+// a position already held by another member of its chain.
+var ErrDuplicateChainPosition = errors.New("duplicate chain position")
+
+// ValidationError describes an invalid event field. Reason is one of the
+// event time validation errors or ErrDuplicateChainPosition.
+type ValidationError struct {
+	Field  string
+	Reason error
+	Detail string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %v: %s", e.Field, e.Reason, e.Detail)
+}
+
+// Unwrap returns the validation reason so callers can use errors.Is.
+func (e *ValidationError) Unwrap() error { return e.Reason }
+
 // RetryType categorizes retriable failure modes.
 type RetryType string
 
@@ -89,6 +136,94 @@ func DefaultDriftConfig() DriftConfig {
 	}
 }
 
+// PaddingConfig is the default padding recorded around every event: capture
+// is due PreRoll before the event starts and runs PostRoll past its end.
+type PaddingConfig struct {
+	PreRoll  time.Duration
+	PostRoll time.Duration
+}
+
+// StallConfig controls when a supervised internal loop is reported stalled.
+type StallConfig struct {
+	// LoopMultiple is how many expected intervals a loop may go without
+	// reporting progress before it is considered stalled.
+	LoopMultiple float64
+}
+
+// DefaultStallConfig returns the standard stall thresholds.
+func DefaultStallConfig() StallConfig {
+	return StallConfig{LoopMultiple: 3}
+}
+
+// Settings holds the scheduler's tunable operational values. A Settings value
+// is treated as immutable once installed; reloads swap in a new one.
+type Settings struct {
+	RetryPolicies map[RetryType]RetryPolicy
+	Drift         DriftConfig
+	Padding       PaddingConfig
+	Stall         StallConfig
+}
+
+// DefaultSettings returns the built-in retry policies, drift configuration
+// and stall thresholds, with no padding.
+func DefaultSettings() Settings {
+	return Settings{
+		RetryPolicies: DefaultRetryPolicies(),
+		Drift:         DefaultDriftConfig(),
+		Stall:         DefaultStallConfig(),
+	}
+}
+
+// Validate checks every field and reports all problems at once.
+func (s Settings) Validate() error {
+	var errs []error
+	for _, rt := range []RetryType{RetryTunerFailure, RetryIngestFailure, RetryDrift} {
+		if _, ok := s.RetryPolicies[rt]; !ok {
+			errs = append(errs, fmt.Errorf("retry_policies: missing policy for %s", rt))
+		}
+	}
+	for rt, p := range s.RetryPolicies {
+		switch rt {
+		case RetryTunerFailure, RetryIngestFailure, RetryDrift:
+		default:
+			errs = append(errs, fmt.Errorf("retry_policies: unknown retry type %q", rt))
+			continue
+		}
+		if p.MaxAttempts < 0 {
+			errs = append(errs, fmt.Errorf("retry_policies.%s.max_attempts: must not be negative", rt))
+		}
+		if p.Delay < 0 {
+			errs = append(errs, fmt.Errorf("retry_policies.%s.delay: must not be negative", rt))
+		}
+	}
+	if s.Drift.CheckInterval <= 0 {
+		errs = append(errs, errors.New("drift.check_interval: must be positive"))
+	}
+	if s.Drift.MaxDrift <= 0 {
+		errs = append(errs, errors.New("drift.max_drift: must be positive"))
+	}
+	if s.Padding.PreRoll < 0 {
+		errs = append(errs, errors.New("padding.pre_roll: must not be negative"))
+	}
+	if s.Padding.PostRoll < 0 {
+		errs = append(errs, errors.New("padding.post_roll: must not be negative"))
+	}
+	if s.Stall.LoopMultiple < 1 {
+		errs = append(errs, errors.New("stall.loop_multiple: must be at least 1"))
+	}
+	return errors.Join(errs...)
+}
+
+// clone returns a copy of s that shares no mutable state with it.
+func (s Settings) clone() Settings {
+	policies := make(map[RetryType]RetryPolicy, len(s.RetryPolicies))
+	for k, v := range s.RetryPolicies {
+		policies[k] = v
+	}
+	s.RetryPolicies = policies
+	return s
+}
+
 // EventMetadata holds supplementary information about an event.
 type EventMetadata struct {
 	League      string            `json:"league,omitempty"`
@@ -96,6 +231,13 @@ type EventMetadata struct {
 	Title       string            `json:"title,omitempty"`
 	Description string            `json:"description,omitempty"`
 	Tags        map[string]string `json:"tags,omitempty"`
+
+	// ChainID links events that must record back to back on the same tuner,
+	// e.g. pre-game, game and post-game coverage.
+	ChainID string `json:"chain_id,omitempty"`
+
+	// ChainPosition orders events within a chain, starting at 0.
+	ChainPosition int `json:"chain_position,omitempty"`
 }
 
 // Event represents a scheduled recording event.
@@ -111,6 +253,18 @@ type Event struct {
 
 	// RetryAttempts tracks retries per failure type.
 	RetryAttempts map[RetryType]int `json:"retry_attempts"`
+
+	// DeviceID and TunerIndex record the tuner the event was assigned to.
+	DeviceID   string `json:"device_id,omitempty"`
+	TunerIndex int    `json:"tuner_index,omitempty"`
+
+	// CorrelationID ties the event to its recordings, commands and archive
+	// job in logs and traces.
+	CorrelationID string `json:"correlation_id"`
+
+	// ReviewReason is set when an automated change to the event needs an
+	// operator's attention, e.g. a guide update that moved it too far.
+	ReviewReason string `json:"review_reason,omitempty"`
 }
 
 // TimeProvider is an interface for getting the current time, enabling test injection.
@@ -126,38 +280,95 @@ func (RealClock) Now() time.Time { return time.Now() }
 
 // Scheduler manages the lifecycle of recording events.
 type Scheduler struct {
-	mu            sync.RWMutex
-	events        map[string]*Event
-	retryPolicies map[RetryType]RetryPolicy
-	driftConfig   DriftConfig
-	clock         TimeProvider
+	mu     sync.RWMutex
+	events map[string]*Event
+	clock  TimeProvider
+
+	// alternatives supplies airings and capacity to SuggestAlternatives.
+	alternatives AlternativeSource
+
+	// settings is read on every retry and drift decision so reloads take
+	// effect without restarting.
+	settings atomic.Pointer[Settings]
 }
 
 // New creates a new Scheduler with default policies.
 func New() *Scheduler {
-	return &Scheduler{
-		events:        make(map[string]*Event),
-		retryPolicies: DefaultRetryPolicies(),
-		driftConfig:   DefaultDriftConfig(),
-		clock:         RealClock{},
-	}
+	return NewWithClock(RealClock{})
 }
 
 // NewWithClock creates a new Scheduler with a custom time provider (for testing).
 func NewWithClock(clock TimeProvider) *Scheduler {
-	return &Scheduler{
-		events:        make(map[string]*Event),
-		retryPolicies: DefaultRetryPolicies(),
-		driftConfig:   DefaultDriftConfig(),
-		clock:         clock,
+	s := &Scheduler{
+		events: make(map[string]*Event),
+		clock:  clock,
 	}
+	defaults := DefaultSettings()
+	s.settings.Store(&defaults)
+	return s
+}
+
+// Settings returns a copy of the settings currently in effect.
+func (s *Scheduler) Settings() Settings {
+	return s.settings.Load().clone()
+}
+
+// SetSettings validates and atomically installs new settings. Retry counters
+// already recorded on events are kept; the next retry decision is made against
+// the new policies. Invalid settings are rejected and the current ones kept.
+func (s *Scheduler) SetSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	installed := settings.clone()
+	s.settings.Store(&installed)
+	return nil
+}
+
+// ValidateEventTimes checks the times of an event about to be created against
+// the scheduler's clock. A zero end time is allowed; CreateEvent derives it
+// from the league when one is given.
+func (s *Scheduler) ValidateEventTimes(startTime, endTime time.Time) error {
+	if startTime.IsZero() {
+		return &ValidationError{Field: "start_time", Reason: ErrZeroStartTime, Detail: "start time is required"}
+	}
+	if !endTime.IsZero() && !endTime.After(startTime) {
+		return &ValidationError{
+			Field:  "end_time",
+			Reason: ErrEndBeforeStart,
+			Detail: fmt.Sprintf("end %s is not after start %s", endTime.Format(time.RFC3339), startTime.Format(time.RFC3339)),
+		}
+	}
+	if earliest := s.clock.Now().Add(-PastStartTolerance); startTime.Before(earliest) {
+		return &ValidationError{
+			Field:  "start_time",
+			Reason: ErrStartInPast,
+			Detail: fmt.Sprintf("start %s is more than %s in the past", startTime.Format(time.RFC3339), PastStartTolerance),
+		}
+	}
+	return nil
 }
 
 // CreateEvent creates a new event and places it into the pending state.
 // If the metadata includes a league and end time is zero, the end time is
-// computed from the league's default duration.
-func (s *Scheduler) CreateEvent(channel string, startTime, endTime time.Time, metadata EventMetadata) *Event {
+// computed from the league's default duration. Times that fail
+// ValidateEventTimes, and a chain position held by another member of the
+// chain that is not cancelled, are rejected with a *ValidationError.
+func (s *Scheduler) CreateEvent(channel string, startTime, endTime time.Time, metadata EventMetadata) (*Event, error) {
+	return s.CreateEventWithCorrelationID("", channel, startTime, endTime, metadata)
+}
+
+// CreateEventWithCorrelationID is like CreateEvent but uses the given
+// correlation ID. An empty ID generates a new one.
+func (s *Scheduler) CreateEventWithCorrelationID(correlationID, channel string, startTime, endTime time.Time, metadata EventMetadata) (*Event, error) {
+	if err := s.ValidateEventTimes(startTime, endTime); err != nil {
+		return nil, err
+	}
+
 	now := s.clock.Now()
+	if correlationID == "" {
+		correlationID = trace.NewID()
+	}
 
 	if endTime.IsZero() && metadata.League != "" {
 		endTime = startTime.Add(LeagueDuration(metadata.League))
@@ -173,13 +384,18 @@ func (s *Scheduler) CreateEvent(channel string, startTime, endTime time.Time, me
 		CreatedAt:     now,
 		UpdatedAt:     now,
 		RetryAttempts: make(map[RetryType]int),
+		CorrelationID: correlationID,
 	}
 
 	s.mu.Lock()
+	if err := s.checkChainPositionLocked(metadata); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
 	s.events[evt.ID] = evt
 	s.mu.Unlock()
 
-	log.WithFields(log.Fields{
+	trace.Entry(correlationID).WithFields(log.Fields{
 		"event_id": evt.ID,
 		"channel":  channel,
 		"start":    startTime,
@@ -187,7 +403,7 @@ func (s *Scheduler) CreateEvent(channel string, startTime, endTime time.Time, me
 		"state":    evt.State,
 	}).Info("event created")
 
-	return evt
+	return evt, nil
 }
 
 // Transition moves an event to the given target state if the transition is valid.
@@ -204,11 +420,18 @@ func (s *Scheduler) Transition(eventID string, target EventState) error {
 		return fmt.Errorf("invalid transition: %s -> %s", evt.State, target)
 	}
 
+	if target == StateActive && evt.Metadata.ChainID != "" {
+		if blocker := s.chainBlockerLocked(evt); blocker != nil {
+			return fmt.Errorf("%w: event %s waits for %s (position %d, state %s)",
+				ErrChainOutOfOrder, eventID, blocker.ID, blocker.Metadata.ChainPosition, blocker.State)
+		}
+	}
+
 	old := evt.State
 	evt.State = target
 	evt.UpdatedAt = s.clock.Now()
 
-	log.WithFields(log.Fields{
+	trace.Entry(evt.CorrelationID).WithFields(log.Fields{
 		"event_id": eventID,
 		"from":     old,
 		"to":       target,
@@ -228,14 +451,14 @@ func (s *Scheduler) Retry(eventID string, retryType RetryType) (bool, error) {
 		return false, fmt.Errorf("event not found: %s", eventID)
 	}
 
-	policy, ok := s.retryPolicies[retryType]
+	policy, ok := s.settings.Load().RetryPolicies[retryType]
 	if !ok {
 		return false, fmt.Errorf("unknown retry type: %s", retryType)
 	}
 
 	current := evt.RetryAttempts[retryType]
 	if current >= policy.MaxAttempts {
-		log.WithFields(log.Fields{
+		trace.Entry(evt.CorrelationID).WithFields(log.Fields{
 			"event_id":   eventID,
 			"retry_type": retryType,
 			"attempts":   current,
@@ -247,7 +470,7 @@ func (s *Scheduler) Retry(eventID string, retryType RetryType) (bool, error) {
 	evt.RetryAttempts[retryType] = current + 1
 	evt.UpdatedAt = s.clock.Now()
 
-	log.WithFields(log.Fields{
+	trace.Entry(evt.CorrelationID).WithFields(log.Fields{
 		"event_id":   eventID,
 		"retry_type": retryType,
 		"attempt":    current + 1,
@@ -260,7 +483,7 @@ func (s *Scheduler) Retry(eventID string, retryType RetryType) (bool, error) {
 
 // GetRetryDelay returns the delay for the given retry type.
 func (s *Scheduler) GetRetryDelay(retryType RetryType) (time.Duration, error) {
-	policy, ok := s.retryPolicies[retryType]
+	policy, ok := s.settings.Load().RetryPolicies[retryType]
 	if !ok {
 		return 0, fmt.Errorf("unknown retry type: %s", retryType)
 	}
@@ -268,7 +491,9 @@ func (s *Scheduler) GetRetryDelay(retryType RetryType) (time.Duration, error) {
 }
 
 // CheckDrift determines whether the event's actual start has drifted beyond
-// the acceptable threshold. Returns the drift duration and whether it exceeds the max.
+// the acceptable threshold. Drift is measured from the start of the event's
+// recording window, so it includes the pre-roll. Returns the drift duration
+// and whether it exceeds the max.
 func (s *Scheduler) CheckDrift(eventID string) (time.Duration, bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -278,25 +503,52 @@ func (s *Scheduler) CheckDrift(eventID string) (time.Duration, bool, error) {
 		return 0, false, fmt.Errorf("event not found: %s", eventID)
 	}
 
+	settings := s.settings.Load()
+	start, _ := settings.Padding.window(evt)
 	now := s.clock.Now()
-	if now.Before(evt.StartTime) {
+	if now.Before(start) {
 		return 0, false, nil
 	}
 
-	drift := now.Sub(evt.StartTime)
-	exceeded := drift > s.driftConfig.MaxDrift
+	maxDrift := settings.Drift.MaxDrift
+	drift := now.Sub(start)
+	exceeded := drift > maxDrift
 
 	if exceeded {
-		log.WithFields(log.Fields{
+		trace.Entry(evt.CorrelationID).WithFields(log.Fields{
 			"event_id":  eventID,
 			"drift":     drift,
-			"max_drift": s.driftConfig.MaxDrift,
+			"max_drift": maxDrift,
 		}).Warn("drift threshold exceeded")
 	}
 
 	return drift, exceeded, nil
 }
 
+// RecordingWindow returns when the event's capture is due to start and end:
+// its scheduled times widened by the padding currently in effect. A zero end
+// time stays zero.
+func (s *Scheduler) RecordingWindow(eventID string) (time.Time, time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	evt, ok := s.events[eventID]
+	if !ok {
+		return time.Time{}, time.Time{}, fmt.Errorf("event not found: %s", eventID)
+	}
+	start, end := s.settings.Load().Padding.window(evt)
+	return start, end, nil
+}
+
+// window applies the padding to an event's scheduled times.
+func (p PaddingConfig) window(evt *Event) (time.Time, time.Time) {
+	end := evt.EndTime
+	if !end.IsZero() {
+		end = end.Add(p.PostRoll)
+	}
+	return evt.StartTime.Add(-p.PreRoll), end
+}
+
 // GetEvent returns a copy of the event with the given ID.
 func (s *Scheduler) GetEvent(eventID string) (*Event, error) {
 	s.mu.RLock()
@@ -308,13 +560,18 @@ func (s *Scheduler) GetEvent(eventID string) (*Event, error) {
 	}
 
 	// Return a copy to prevent external mutation.
+	return copyEvent(evt), nil
+}
+
+// copyEvent returns a copy of evt that shares no mutable state with it.
+func copyEvent(evt *Event) *Event {
 	copy := *evt
 	copyRetries := make(map[RetryType]int, len(evt.RetryAttempts))
 	for k, v := range evt.RetryAttempts {
 		copyRetries[k] = v
 	}
 	copy.RetryAttempts = copyRetries
-	return &copy, nil
+	return &copy
 }
 
 // ListEvents returns a snapshot of all events.
@@ -324,12 +581,233 @@ func (s *Scheduler) ListEvents() []*Event {
 
 	result := make([]*Event, 0, len(s.events))
 	for _, evt := range s.events {
-		copy := *evt
-		result = append(result, &copy)
+		result = append(result, copyEvent(evt))
+	}
+	return result
+}
+
+// EventsByCorrelationID returns copies of the events carrying the given
+// correlation ID, ordered by creation time.
+func (s *Scheduler) EventsByCorrelationID(correlationID string) []*Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []*Event
+	for _, evt := range s.events {
+		if correlationID != "" && evt.CorrelationID == correlationID {
+			result = append(result, copyEvent(evt))
+		}
 	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
 	return result
 }
 
+// AssignDevice records the device and tuner an event is recording on.
+func (s *Scheduler) AssignDevice(eventID, deviceID string, tunerIndex int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evt, ok := s.events[eventID]
+	if !ok {
+		return fmt.Errorf("event not found: %s", eventID)
+	}
+
+	evt.DeviceID = deviceID
+	evt.TunerIndex = tunerIndex
+	evt.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// Reschedule moves a pending or scheduled event to a new window. As in
+// CreateEvent, a zero end time is computed from the event's league, and an
+// end that is not after the start is rejected with a *ValidationError.
+func (s *Scheduler) Reschedule(eventID string, startTime, endTime time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evt, ok := s.events[eventID]
+	if !ok {
+		return fmt.Errorf("event not found: %s", eventID)
+	}
+	if evt.State != StatePending && evt.State != StateScheduled {
+		return fmt.Errorf("%w: event %s is %s", ErrEventStarted, eventID, evt.State)
+	}
+
+	if endTime.IsZero() && evt.Metadata.League != "" {
+		endTime = startTime.Add(LeagueDuration(evt.Metadata.League))
+	}
+	if !endTime.IsZero() && !endTime.After(startTime) {
+		return &ValidationError{
+			Field:  "end_time",
+			Reason: ErrEndBeforeStart,
+			Detail: fmt.Sprintf("end %s is not after start %s", endTime.Format(time.RFC3339), startTime.Format(time.RFC3339)),
+		}
+	}
+
+	trace.Entry(evt.CorrelationID).WithFields(log.Fields{
+		"event_id":  eventID,
+		"old_start": evt.StartTime,
+		"old_end":   evt.EndTime,
+		"start":     startTime,
+		"end":       endTime,
+	}).Info("event rescheduled")
+
+	evt.StartTime = startTime
+	evt.EndTime = endTime
+	evt.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+// FlagForReview records why an event needs an operator's attention. The
+// event's state and window are left unchanged.
+func (s *Scheduler) FlagForReview(eventID, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evt, ok := s.events[eventID]
+	if !ok {
+		return fmt.Errorf("event not found: %s", eventID)
+	}
+
+	evt.ReviewReason = reason
+	evt.UpdatedAt = s.clock.Now()
+
+	trace.Entry(evt.CorrelationID).WithFields(log.Fields{
+		"event_id": eventID,
+		"reason":   reason,
+	}).Warn("event flagged for review")
+	return nil
+}
+
+// PruneEvents removes events in a terminal state (complete, failed or
+// cancelled) whose end time is before the cutoff. It returns the number of
+// events removed.
+func (s *Scheduler) PruneEvents(before time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for id, evt := range s.events {
+		if !isFinished(evt.State) {
+			continue
+		}
+		if evt.EndTime.Before(before) {
+			delete(s.events, id)
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		log.WithFields(log.Fields{
+			"before":  before,
+			"removed": removed,
+		}).Info("pruned finished events")
+	}
+	return removed
+}
+
+// ChainEvents returns copies of the events in a chain ordered by position.
+func (s *Scheduler) ChainEvents(chainID string) ([]*Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	members := s.chainMembersLocked(chainID)
+	if len(members) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrChainNotFound, chainID)
+	}
+
+	result := make([]*Event, len(members))
+	for i, evt := range members {
+		result[i] = copyEvent(evt)
+	}
+	return result, nil
+}
+
+// CancelChain cancels every member of a chain that has not yet finished
+// recording. Members that are finalizing or already terminal are left as is.
+// It returns the IDs of the cancelled events.
+func (s *Scheduler) CancelChain(chainID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := s.chainMembersLocked(chainID)
+	if len(members) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrChainNotFound, chainID)
+	}
+
+	now := s.clock.Now()
+	var cancelled []string
+	for _, evt := range members {
+		if !isValidTransition(evt.State, StateCancelled) {
+			continue
+		}
+		evt.State = StateCancelled
+		evt.UpdatedAt = now
+		cancelled = append(cancelled, evt.ID)
+	}
+
+	log.WithFields(log.Fields{
+		"chain_id":  chainID,
+		"cancelled": cancelled,
+	}).Info("event chain cancelled")
+
+	return cancelled, nil
+}
+
+// chainMembersLocked returns the events of a chain ordered by position, then
+// start time. Must be called with s.mu held.
+func (s *Scheduler) chainMembersLocked(chainID string) []*Event {
+	if chainID == "" {
+		return nil
+	}
+
+	var members []*Event
+	for _, evt := range s.events {
+		if evt.Metadata.ChainID == chainID {
+			members = append(members, evt)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Metadata.ChainPosition != members[j].Metadata.ChainPosition {
+			return members[i].Metadata.ChainPosition < members[j].Metadata.ChainPosition
+		}
+		return members[i].StartTime.Before(members[j].StartTime)
+	})
+	return members
+}
+
+// checkChainPositionLocked rejects metadata whose chain position is already
+// held by a member of the chain that has not been cancelled. Must be called
+// with s.mu held.
+func (s *Scheduler) checkChainPositionLocked(metadata EventMetadata) error {
+	for _, other := range s.chainMembersLocked(metadata.ChainID) {
+		if other.State == StateCancelled || other.Metadata.ChainPosition != metadata.ChainPosition {
+			continue
+		}
+		return &ValidationError{
+			Field:  "metadata.chain_position",
+			Reason: ErrDuplicateChainPosition,
+			Detail: fmt.Sprintf("position %d of chain %s is held by event %s", metadata.ChainPosition, metadata.ChainID, other.ID),
+		}
+	}
+	return nil
+}
+
+// chainBlockerLocked returns an earlier chain member that is still waiting to
+// record or recording, or nil if evt may start. Must be called with s.mu held.
+func (s *Scheduler) chainBlockerLocked(evt *Event) *Event {
+	for _, other := range s.chainMembersLocked(evt.Metadata.ChainID) {
+		if other.Metadata.ChainPosition >= evt.Metadata.ChainPosition {
+			break
+		}
+		switch other.State {
+		case StatePending, StateScheduled, StateActive, StateRecording:
+			return other
+		}
+	}
+	return nil
+}
+
 // isValidTransition checks if moving from current to target state is allowed.
 func isValidTransition(current, target EventState) bool {
 	allowed, ok := validTransitions[current]
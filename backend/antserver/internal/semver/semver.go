@@ -0,0 +1,143 @@
+// Package semver parses and compares the version strings reported by AntBox
+// agents. Older agents report two-segment versions ("1.4") and some prefix a
+// "v"; both are accepted. Build metadata is ignored, a pre-release sorts
+// before its release and pre-releases are ordered by their identifiers, as in
+// semver.
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalid is returned for strings that are not a version.
+var ErrInvalid = errors.New("semver: invalid version")
+
+// Version is a parsed agent version.
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string
+}
+
+// Parse parses "1.4.2", "v1.4.2", "1.4" or "1.5.0-rc.1+build7".
+func Parse(s string) (Version, error) {
+	raw := strings.TrimSpace(s)
+	raw = strings.TrimPrefix(strings.TrimPrefix(raw, "v"), "V")
+	if i := strings.IndexByte(raw, '+'); i >= 0 {
+		raw = raw[:i]
+	}
+
+	var v Version
+	if i := strings.IndexByte(raw, '-'); i >= 0 {
+		v.Pre = raw[i+1:]
+		raw = raw[:i]
+		if v.Pre == "" {
+			return Version{}, fmt.Errorf("%w: %q", ErrInvalid, s)
+		}
+	}
+
+	parts := strings.Split(raw, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Version{}, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	nums := [3]int{}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return Version{}, fmt.Errorf("%w: %q", ErrInvalid, s)
+		}
+		nums[i] = n
+	}
+	v.Major, v.Minor, v.Patch = nums[0], nums[1], nums[2]
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 as a is older than, equal to or newer than b.
+func Compare(a, b Version) int {
+	for _, d := range [...]int{a.Major - b.Major, a.Minor - b.Minor, a.Patch - b.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case a.Pre == b.Pre:
+		return 0
+	case a.Pre == "":
+		return 1
+	case b.Pre == "":
+		return -1
+	}
+	return comparePre(strings.Split(a.Pre, "."), strings.Split(b.Pre, "."))
+}
+
+// comparePre orders pre-release identifiers as semver does: numeric
+// identifiers compare numerically and sort before alphanumeric ones, others
+// compare in ASCII order, and a shorter list sorts first when it is a prefix
+// of the longer one.
+func comparePre(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareIdentifier(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareIdentifier(a, b string) int {
+	an, bn := isNumeric(a), isNumeric(b)
+	switch {
+	case an && bn:
+		// Compare by length first so identifiers of any size work without
+		// overflowing an int; leading zeros are not valid in semver.
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+	case an:
+		return -1
+	case bn:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Less reports whether v is older than o.
+func (v Version) Less(o Version) bool {
+	return Compare(v, o) < 0
+}
+
+// String returns the canonical three-segment form without a "v" prefix.
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
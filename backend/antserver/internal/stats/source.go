@@ -0,0 +1,103 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+)
+
+// LiveSource derives outcomes from the in-memory scheduler and recorder.
+// Events still in progress and cancelled events are not reported; cancelling
+// is a user decision, not a reliability failure.
+type LiveSource struct {
+	scheduler *scheduler.Scheduler
+	recorder  *recorder.Recorder
+
+	// since is when the in-memory state began; zero means complete.
+	since time.Time
+}
+
+// NewLiveSource creates a LiveSource. rec may be nil, in which case gap
+// seconds are not reported.
+func NewLiveSource(sched *scheduler.Scheduler, rec *recorder.Recorder) (*LiveSource, error) {
+	if sched == nil {
+		return nil, errors.New("stats: scheduler must not be nil")
+	}
+	return &LiveSource{scheduler: sched, recorder: rec}, nil
+}
+
+// Outcomes implements Source.
+func (s *LiveSource) Outcomes(ctx context.Context, from, to time.Time) ([]Outcome, error) {
+	gaps := s.gapSecondsByEvent()
+
+	var outcomes []Outcome
+	for _, evt := range s.scheduler.ListEvents() {
+		if evt.StartTime.Before(from) || !evt.StartTime.Before(to) {
+			continue
+		}
+
+		var result Result
+		switch evt.State {
+		case scheduler.StateComplete:
+			result = ResultCompleted
+		case scheduler.StateFailed:
+			result = ResultFailed
+		default:
+			continue
+		}
+
+		outcomes = append(outcomes, Outcome{
+			EventID:    evt.ID,
+			Channel:    evt.Channel,
+			DeviceID:   evt.DeviceID,
+			League:     evt.Metadata.League,
+			StartTime:  evt.StartTime,
+			Result:     result,
+			Retries:    evt.RetryAttempts,
+			GapSeconds: gaps[evt.ID],
+		})
+	}
+	return outcomes, nil
+}
+
+// HasData implements CoverageSource. A day has raw data when at least one
+// event, in any state, starts within it and the source has been collecting
+// since before the day began; a day that started before a restart only
+// holds the events created since and is left as stored.
+func (s *LiveSource) HasData(from, to time.Time) bool {
+	if from.Before(s.since) {
+		return false
+	}
+	for _, evt := range s.scheduler.ListEvents() {
+		if !evt.StartTime.Before(from) && evt.StartTime.Before(to) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetSince records when the source started collecting, typically process
+// start. Days that began earlier are only partially covered.
+func (s *LiveSource) SetSince(t time.Time) {
+	s.since = t
+}
+
+// gapSecondsByEvent sums closed capture gaps across each event's recordings.
+func (s *LiveSource) gapSecondsByEvent() map[string]float64 {
+	gaps := make(map[string]float64)
+	if s.recorder == nil {
+		return gaps
+	}
+	for _, rec := range s.recorder.ListRecordings() {
+		for _, gap := range rec.Gaps {
+			if gap.End.IsZero() {
+				continue
+			}
+			gaps[rec.EventID] += gap.End.Sub(gap.Start).Seconds()
+		}
+	}
+	return gaps
+}
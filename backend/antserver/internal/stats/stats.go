@@ -0,0 +1,475 @@
+// Package stats rolls recording outcomes up into daily aggregates and
+// reports recording reliability by channel, device and league.
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"antserver/internal/scheduler"
+	"antserver/internal/watchdog"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Default rollup settings.
+const (
+	// DefaultRerollDays is how many days before today are rolled up again on
+	// every run, so archive results that arrive late are still counted.
+	DefaultRerollDays = 3
+
+	// DefaultInterval is how often the rollup job runs when started with Loop.
+	DefaultInterval = time.Hour
+
+	// DefaultWorstOffenders is the number of entries in the worst-offenders list.
+	DefaultWorstOffenders = 5
+)
+
+// UnknownDimension is reported for outcomes without a channel, device or league.
+const UnknownDimension = "unknown"
+
+// dayLayout is the date format used for rollup days and report ranges.
+const dayLayout = "2006-01-02"
+
+// Sentinel errors returned by stats operations.
+var (
+	ErrNilDB         = errors.New("stats: db must not be nil")
+	ErrNilSource     = errors.New("stats: outcome source must not be nil")
+	ErrInvalidRange  = errors.New("stats: from must not be after to")
+	ErrUnknownResult = errors.New("stats: unknown outcome result")
+)
+
+// Result is the final outcome of a recording event.
+type Result string
+
+const (
+	ResultCompleted Result = "completed"
+	ResultFailed    Result = "failed"
+	ResultPreempted Result = "preempted"
+)
+
+// Outcome is the raw result of a single recording event.
+type Outcome struct {
+	EventID    string
+	Channel    string
+	DeviceID   string
+	League     string
+	StartTime  time.Time
+	Result     Result
+	Retries    map[scheduler.RetryType]int
+	GapSeconds float64
+	Failovers  int
+}
+
+// Source supplies outcomes of events that finished, filtered by start time
+// in [from, to).
+type Source interface {
+	Outcomes(ctx context.Context, from, to time.Time) ([]Outcome, error)
+}
+
+// CoverageSource is a Source that can tell whether it holds raw data for a
+// period. Rollup leaves days without raw data as stored, so a source that
+// has lost its data, such as in-memory state after a restart, never
+// overwrites persisted aggregates with zeros.
+type CoverageSource interface {
+	Source
+	HasData(from, to time.Time) bool
+}
+
+// DailyStat is one aggregate row of the recording_stats table.
+type DailyStat struct {
+	Day        time.Time                   `json:"day"`
+	Channel    string                      `json:"channel"`
+	DeviceID   string                      `json:"device_id"`
+	League     string                      `json:"league"`
+	Completed  int                         `json:"completed"`
+	Failed     int                         `json:"failed"`
+	Preempted  int                         `json:"preempted"`
+	Retries    map[scheduler.RetryType]int `json:"retries"`
+	GapSeconds float64                     `json:"gap_seconds"`
+	Failovers  int                         `json:"failovers"`
+}
+
+// Aggregate groups outcomes into DailyStat rows for the given day, one per
+// channel, device and league. Outcomes are attributed to day regardless of
+// when they ended, so events spanning midnight count towards their start date.
+func Aggregate(day time.Time, outcomes []Outcome) ([]DailyStat, error) {
+	type key struct{ channel, device, league string }
+	rows := make(map[key]*DailyStat)
+	var order []key
+
+	for _, o := range outcomes {
+		k := key{dimension(o.Channel), dimension(o.DeviceID), dimension(o.League)}
+		row, ok := rows[k]
+		if !ok {
+			row = &DailyStat{
+				Day:      day,
+				Channel:  k.channel,
+				DeviceID: k.device,
+				League:   k.league,
+				Retries:  make(map[scheduler.RetryType]int),
+			}
+			rows[k] = row
+			order = append(order, k)
+		}
+
+		switch o.Result {
+		case ResultCompleted:
+			row.Completed++
+		case ResultFailed:
+			row.Failed++
+		case ResultPreempted:
+			row.Preempted++
+		default:
+			return nil, fmt.Errorf("%w: %q for event %s", ErrUnknownResult, o.Result, o.EventID)
+		}
+		for retryType, n := range o.Retries {
+			row.Retries[retryType] += n
+		}
+		row.GapSeconds += o.GapSeconds
+		row.Failovers += o.Failovers
+	}
+
+	result := make([]DailyStat, 0, len(order))
+	for _, k := range order {
+		result = append(result, *rows[k])
+	}
+	return result, nil
+}
+
+func dimension(v string) string {
+	if v == "" {
+		return UnknownDimension
+	}
+	return v
+}
+
+// Group is the reliability summary of one channel, device or league.
+type Group struct {
+	Key         string                      `json:"key"`
+	Total       int                         `json:"total"`
+	Completed   int                         `json:"completed"`
+	Failed      int                         `json:"failed"`
+	Preempted   int                         `json:"preempted"`
+	SuccessRate float64                     `json:"success_rate"`
+	Retries     map[scheduler.RetryType]int `json:"retries"`
+	GapSeconds  float64                     `json:"gap_seconds"`
+	Failovers   int                         `json:"failovers"`
+}
+
+// Offender is an entry in the worst-offenders list.
+type Offender struct {
+	Dimension string `json:"dimension"`
+	Group
+}
+
+// ReliabilityReport summarizes recording reliability over a date range.
+type ReliabilityReport struct {
+	From           string     `json:"from"`
+	To             string     `json:"to"`
+	Overall        Group      `json:"overall"`
+	ByChannel      []Group    `json:"by_channel"`
+	ByDevice       []Group    `json:"by_device"`
+	ByLeague       []Group    `json:"by_league"`
+	WorstOffenders []Offender `json:"worst_offenders"`
+}
+
+// Store reads and writes the recording_stats table.
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore creates a Store backed by the given database.
+func NewStore(db *sql.DB) (*Store, error) {
+	if db == nil {
+		return nil, ErrNilDB
+	}
+	return &Store{db: db}, nil
+}
+
+// ReplaceDay atomically replaces all aggregate rows for a day, so rolling up
+// the same day again never double-counts.
+func (s *Store) ReplaceDay(ctx context.Context, day time.Time, rows []DailyStat) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin stats rollup: %w", err)
+	}
+	defer tx.Rollback()
+
+	dayStr := day.Format(dayLayout)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recording_stats WHERE day = $1`, dayStr); err != nil {
+		return fmt.Errorf("clear stats for %s: %w", dayStr, err)
+	}
+
+	for _, row := range rows {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO recording_stats
+				(day, channel, device_id, league, completed, failed, preempted,
+				 tuner_retries, ingest_retries, drift_retries, gap_seconds, failovers)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			dayStr, row.Channel, row.DeviceID, row.League,
+			row.Completed, row.Failed, row.Preempted,
+			row.Retries[scheduler.RetryTunerFailure], row.Retries[scheduler.RetryIngestFailure], row.Retries[scheduler.RetryDrift],
+			row.GapSeconds, row.Failovers)
+		if err != nil {
+			return fmt.Errorf("insert stats for %s: %w", dayStr, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit stats for %s: %w", dayStr, err)
+	}
+	return nil
+}
+
+// groupColumns maps report dimensions to recording_stats columns. Only these
+// fixed names are interpolated into queries.
+var groupColumns = map[string]string{
+	"channel": "channel",
+	"device":  "device_id",
+	"league":  "league",
+}
+
+// Reliability builds a report for days in [from, to], inclusive.
+func (s *Store) Reliability(ctx context.Context, from, to time.Time, worst int) (*ReliabilityReport, error) {
+	if from.After(to) {
+		return nil, ErrInvalidRange
+	}
+	if worst <= 0 {
+		worst = DefaultWorstOffenders
+	}
+
+	report := &ReliabilityReport{
+		From: from.Format(dayLayout),
+		To:   to.Format(dayLayout),
+	}
+
+	var err error
+	if report.ByChannel, err = s.groupBy(ctx, "channel", report.From, report.To); err != nil {
+		return nil, err
+	}
+	if report.ByDevice, err = s.groupBy(ctx, "device", report.From, report.To); err != nil {
+		return nil, err
+	}
+	if report.ByLeague, err = s.groupBy(ctx, "league", report.From, report.To); err != nil {
+		return nil, err
+	}
+
+	report.Overall = Group{Key: "all", Retries: make(map[scheduler.RetryType]int)}
+	for _, g := range report.ByChannel {
+		report.Overall.add(g)
+	}
+	report.Overall.finish()
+
+	report.WorstOffenders = worstOffenders(worst, map[string][]Group{
+		"channel": report.ByChannel,
+		"device":  report.ByDevice,
+		"league":  report.ByLeague,
+	})
+	return report, nil
+}
+
+// groupBy sums recording_stats rows for one dimension.
+func (s *Store) groupBy(ctx context.Context, dim, from, to string) ([]Group, error) {
+	col := groupColumns[dim]
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+col+`, SUM(completed), SUM(failed), SUM(preempted),
+		       SUM(tuner_retries), SUM(ingest_retries), SUM(drift_retries),
+		       SUM(gap_seconds), SUM(failovers)
+		FROM recording_stats
+		WHERE day BETWEEN $1 AND $2
+		GROUP BY `+col+`
+		ORDER BY `+col,
+		from, to)
+	if err != nil {
+		return nil, fmt.Errorf("query stats by %s: %w", dim, err)
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		var g Group
+		var tuner, ingest, drift int
+		if err := rows.Scan(&g.Key, &g.Completed, &g.Failed, &g.Preempted,
+			&tuner, &ingest, &drift, &g.GapSeconds, &g.Failovers); err != nil {
+			return nil, fmt.Errorf("scan stats by %s: %w", dim, err)
+		}
+		g.Retries = map[scheduler.RetryType]int{
+			scheduler.RetryTunerFailure:  tuner,
+			scheduler.RetryIngestFailure: ingest,
+			scheduler.RetryDrift:         drift,
+		}
+		g.finish()
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// add accumulates another group's counters.
+func (g *Group) add(o Group) {
+	g.Completed += o.Completed
+	g.Failed += o.Failed
+	g.Preempted += o.Preempted
+	g.GapSeconds += o.GapSeconds
+	g.Failovers += o.Failovers
+	for k, v := range o.Retries {
+		g.Retries[k] += v
+	}
+}
+
+// finish computes the derived fields.
+func (g *Group) finish() {
+	g.Total = g.Completed + g.Failed + g.Preempted
+	if g.Total > 0 {
+		g.SuccessRate = float64(g.Completed) / float64(g.Total)
+	}
+}
+
+// worstOffenders returns the n groups with the most unsuccessful events,
+// ties broken by lower success rate. Groups without failures are omitted.
+func worstOffenders(n int, groups map[string][]Group) []Offender {
+	var all []Offender
+	for dim, gs := range groups {
+		for _, g := range gs {
+			if g.Failed+g.Preempted == 0 {
+				continue
+			}
+			all = append(all, Offender{Dimension: dim, Group: g})
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		fi, fj := all[i].Failed+all[i].Preempted, all[j].Failed+all[j].Preempted
+		if fi != fj {
+			return fi > fj
+		}
+		if all[i].SuccessRate != all[j].SuccessRate {
+			return all[i].SuccessRate < all[j].SuccessRate
+		}
+		if all[i].Dimension != all[j].Dimension {
+			return all[i].Dimension < all[j].Dimension
+		}
+		return all[i].Key < all[j].Key
+	})
+
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// RollupConfig controls the rollup job.
+type RollupConfig struct {
+	// RerollDays is how many days before today are rolled up again on each
+	// run. Zero uses DefaultRerollDays.
+	RerollDays int
+
+	// RawRetention is how long finished events are kept after their end time
+	// once rolled up. Zero keeps them indefinitely.
+	RawRetention time.Duration
+
+	// Location defines day boundaries. Nil uses UTC.
+	Location *time.Location
+}
+
+// Pruner removes raw event data that has already been rolled up.
+type Pruner interface {
+	PruneEvents(before time.Time) int
+}
+
+// Rollup periodically aggregates outcomes into the recording_stats table.
+type Rollup struct {
+	source Source
+	store  *Store
+	pruner Pruner
+	cfg    RollupConfig
+
+	// now is overridable for testing.
+	now func() time.Time
+}
+
+// NewRollup creates a Rollup job. pruner may be nil, in which case raw data
+// is never pruned.
+func NewRollup(source Source, store *Store, pruner Pruner, cfg RollupConfig) (*Rollup, error) {
+	if source == nil {
+		return nil, ErrNilSource
+	}
+	if store == nil {
+		return nil, ErrNilDB
+	}
+	if cfg.RerollDays <= 0 {
+		cfg.RerollDays = DefaultRerollDays
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	return &Rollup{
+		source: source,
+		store:  store,
+		pruner: pruner,
+		cfg:    cfg,
+		now:    time.Now,
+	}, nil
+}
+
+// RunOnce rolls up today and the RerollDays days before it, then prunes raw
+// events older than the rolled-up window and RawRetention. Days a
+// CoverageSource holds no raw data for are skipped.
+func (r *Rollup) RunOnce(ctx context.Context) error {
+	now := r.now().In(r.cfg.Location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, r.cfg.Location)
+	first := today.AddDate(0, 0, -r.cfg.RerollDays)
+	coverage, _ := r.source.(CoverageSource)
+
+	for day := first; !day.After(today); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		if coverage != nil && !coverage.HasData(day, next) {
+			log.WithField("day", day.Format(dayLayout)).Debug("stats rollup skipped day without raw data")
+			continue
+		}
+		outcomes, err := r.source.Outcomes(ctx, day, next)
+		if err != nil {
+			return fmt.Errorf("load outcomes for %s: %w", day.Format(dayLayout), err)
+		}
+		rows, err := Aggregate(day, outcomes)
+		if err != nil {
+			return err
+		}
+		if err := r.store.ReplaceDay(ctx, day, rows); err != nil {
+			return err
+		}
+	}
+
+	if r.pruner != nil && r.cfg.RawRetention > 0 {
+		// Never prune events that a later run may still need to re-roll.
+		cutoff := now.Add(-r.cfg.RawRetention)
+		if cutoff.After(first) {
+			cutoff = first
+		}
+		r.pruner.PruneEvents(cutoff)
+	}
+
+	return nil
+}
+
+// Loop returns a watchdog loop that calls RunOnce immediately and then every
+// interval. A non-positive interval uses DefaultInterval.
+func (r *Rollup) Loop(interval time.Duration) watchdog.LoopFunc {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return watchdog.Every(interval, func(ctx context.Context) {
+		if err := r.RunOnce(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.WithError(err).Error("stats rollup failed")
+		}
+	})
+}
+
+// SetTestNow replaces the time function for testing.
+func (r *Rollup) SetTestNow(fn func() time.Time) {
+	r.now = fn
+}
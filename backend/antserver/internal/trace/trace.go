@@ -0,0 +1,135 @@
+// Package trace carries correlation IDs across the scheduler, recorder,
+// ingest and archive components and keeps a per-correlation activity log
+// built from their log entries.
+package trace
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Header is the HTTP header a correlation ID is accepted from and
+	// forwarded in.
+	Header = "X-Correlation-ID"
+
+	// Field is the log field holding the correlation ID.
+	Field = "correlation_id"
+)
+
+// Default activity log bounds.
+const (
+	DefaultMaxIDs   = 1000
+	DefaultMaxPerID = 500
+)
+
+// NewID returns a new correlation ID.
+func NewID() string {
+	return uuid.New().String()
+}
+
+// Entry returns a log entry carrying the correlation ID. An empty ID yields a
+// plain entry, so callers need not check.
+func Entry(correlationID string) *log.Entry {
+	if correlationID == "" {
+		return log.NewEntry(log.StandardLogger())
+	}
+	return log.WithField(Field, correlationID)
+}
+
+// Activity is a single log entry recorded against a correlation ID.
+type Activity struct {
+	At      time.Time              `json:"at"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Log is a logrus hook that indexes every entry carrying a correlation ID.
+// It keeps the most recent maxPerID entries for each of the most recently
+// seen maxIDs correlation IDs. It is safe for concurrent use.
+type Log struct {
+	mu       sync.RWMutex
+	entries  map[string][]Activity
+	order    []string
+	maxIDs   int
+	maxPerID int
+}
+
+// NewLog creates an activity log. Non-positive bounds use the defaults.
+func NewLog(maxIDs, maxPerID int) *Log {
+	if maxIDs <= 0 {
+		maxIDs = DefaultMaxIDs
+	}
+	if maxPerID <= 0 {
+		maxPerID = DefaultMaxPerID
+	}
+	return &Log{
+		entries:  make(map[string][]Activity),
+		maxIDs:   maxIDs,
+		maxPerID: maxPerID,
+	}
+}
+
+// Levels implements log.Hook.
+func (l *Log) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements log.Hook.
+func (l *Log) Fire(entry *log.Entry) error {
+	id, _ := entry.Data[Field].(string)
+	if id == "" {
+		return nil
+	}
+
+	fields := make(map[string]interface{}, len(entry.Data)-1)
+	for k, v := range entry.Data {
+		if k == Field {
+			continue
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		fields[k] = v
+	}
+	act := Activity{
+		At:      entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+		Fields:  fields,
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	existing, ok := l.entries[id]
+	if !ok {
+		l.order = append(l.order, id)
+		if len(l.order) > l.maxIDs {
+			delete(l.entries, l.order[0])
+			l.order = l.order[1:]
+		}
+	}
+	existing = append(existing, act)
+	if len(existing) > l.maxPerID {
+		existing = existing[len(existing)-l.maxPerID:]
+	}
+	l.entries[id] = existing
+	return nil
+}
+
+// Entries returns a copy of the activity recorded for a correlation ID, in
+// the order it was logged.
+func (l *Log) Entries(correlationID string) []Activity {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	src := l.entries[correlationID]
+	out := make([]Activity, len(src))
+	copy(out, src)
+	return out
+}
@@ -0,0 +1,407 @@
+// Package watchdog supervises antserver's long-running internal loops. Each
+// loop pats the watchdog on every iteration; a loop that stops patting for
+// longer than a multiple of its expected interval, panics or returns is
+// reported as stalled and restarted with exponential backoff. While any loop
+// is stalled the service is not ready.
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Default watchdog settings.
+const (
+	// DefaultStallMultiple is how many expected intervals a loop may go
+	// without patting before it is considered stalled.
+	DefaultStallMultiple = 3
+
+	// DefaultCheckInterval is how often Run checks the registered loops.
+	DefaultCheckInterval = 10 * time.Second
+
+	// DefaultRestartBackoff is the wait after the first restart of a loop
+	// before it may be restarted again. It doubles with each consecutive
+	// restart up to DefaultMaxRestartBackoff.
+	DefaultRestartBackoff    = 5 * time.Second
+	DefaultMaxRestartBackoff = 5 * time.Minute
+)
+
+// maxStackDump bounds the goroutine dump logged when a loop stalls.
+const maxStackDump = 1 << 20
+
+// Sentinel errors returned by watchdog operations.
+var (
+	ErrInvalidConfig   = errors.New("watchdog: invalid config")
+	ErrDuplicateLoop   = errors.New("watchdog: loop already registered")
+	ErrInvalidInterval = errors.New("watchdog: loop interval must be positive")
+	ErrNilLoop         = errors.New("watchdog: loop func must not be nil")
+)
+
+// Config holds the watchdog settings.
+type Config struct {
+	StallMultiple     float64
+	CheckInterval     time.Duration
+	RestartBackoff    time.Duration
+	MaxRestartBackoff time.Duration
+}
+
+// DefaultConfig returns the default watchdog settings.
+func DefaultConfig() Config {
+	return Config{
+		StallMultiple:     DefaultStallMultiple,
+		CheckInterval:     DefaultCheckInterval,
+		RestartBackoff:    DefaultRestartBackoff,
+		MaxRestartBackoff: DefaultMaxRestartBackoff,
+	}
+}
+
+// LoopFunc is a supervised loop. It must call pat on every iteration and
+// return when ctx is cancelled.
+type LoopFunc func(ctx context.Context, pat func())
+
+// Every returns a LoopFunc that calls fn immediately and then every
+// interval, patting before each call.
+func Every(interval time.Duration, fn func(ctx context.Context)) LoopFunc {
+	return func(ctx context.Context, pat func()) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			pat()
+			fn(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// LoopStatus is a snapshot of a supervised loop.
+type LoopStatus struct {
+	Name          string    `json:"name"`
+	Interval      string    `json:"interval"`
+	LastActivity  time.Time `json:"last_activity"`
+	Stalled       bool      `json:"stalled"`
+	Restarts      int       `json:"restarts"`
+	Panics        int       `json:"panics"`
+	LastPanic     string    `json:"last_panic,omitempty"`
+	NextRestartAt time.Time `json:"next_restart_at,omitempty"`
+}
+
+// loop is the watchdog's record of a registered loop. gen increases on every
+// (re)start so pats and panics from an abandoned goroutine are ignored.
+type loop struct {
+	name     string
+	interval time.Duration
+	run      LoopFunc
+
+	gen    int
+	cancel context.CancelFunc
+
+	lastActivity time.Time
+	stalled      bool
+	exited       bool
+
+	restarts    int
+	attempts    int // consecutive restarts, for backoff
+	lastRestart time.Time
+	nextRestart time.Time
+
+	panics    int
+	lastPanic string
+}
+
+// Watchdog supervises registered loops. It is safe for concurrent use.
+type Watchdog struct {
+	mu      sync.Mutex
+	cfg     Config
+	loops   map[string]*loop
+	ctx     context.Context
+	started bool
+	now     func() time.Time
+}
+
+// New creates a Watchdog.
+func New(cfg Config) (*Watchdog, error) {
+	if cfg.StallMultiple < 1 || cfg.CheckInterval <= 0 || cfg.RestartBackoff <= 0 || cfg.MaxRestartBackoff < cfg.RestartBackoff {
+		return nil, fmt.Errorf("%w: %+v", ErrInvalidConfig, cfg)
+	}
+	return &Watchdog{
+		cfg:   cfg,
+		loops: make(map[string]*loop),
+		ctx:   context.Background(),
+		now:   time.Now,
+	}, nil
+}
+
+// SetStallMultiple changes how many expected intervals a loop may go without
+// patting before it is considered stalled. It applies from the next Check.
+func (w *Watchdog) SetStallMultiple(multiple float64) error {
+	if multiple < 1 {
+		return fmt.Errorf("%w: stall multiple %v is below 1", ErrInvalidConfig, multiple)
+	}
+	w.mu.Lock()
+	w.cfg.StallMultiple = multiple
+	w.mu.Unlock()
+	return nil
+}
+
+// Register adds a loop expected to pat at least once per interval. If the
+// watchdog has already been started the loop starts immediately.
+func (w *Watchdog) Register(name string, interval time.Duration, run LoopFunc) error {
+	if interval <= 0 {
+		return ErrInvalidInterval
+	}
+	if run == nil {
+		return ErrNilLoop
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, exists := w.loops[name]; exists {
+		return fmt.Errorf("%w: %s", ErrDuplicateLoop, name)
+	}
+	l := &loop{name: name, interval: interval, run: run}
+	w.loops[name] = l
+	if w.started {
+		l.lastActivity = w.now()
+		w.startLocked(l)
+	}
+	return nil
+}
+
+// Start starts every registered loop under ctx. Loops registered later start
+// as they are registered.
+func (w *Watchdog) Start(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.started {
+		return
+	}
+	w.ctx = ctx
+	w.started = true
+	now := w.now()
+	for _, l := range w.loops {
+		l.lastActivity = now
+		w.startLocked(l)
+	}
+}
+
+// Run starts the loops and checks them every CheckInterval until ctx is
+// cancelled.
+func (w *Watchdog) Run(ctx context.Context) {
+	w.Start(ctx)
+
+	ticker := time.NewTicker(w.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
+
+// startLocked runs a new generation of the loop. The caller holds w.mu.
+func (w *Watchdog) startLocked(l *loop) {
+	l.gen++
+	l.exited = false
+	ctx, cancel := context.WithCancel(w.ctx)
+	l.cancel = cancel
+	go w.supervise(ctx, l, l.gen)
+}
+
+// supervise runs one generation of a loop, recording a panic or an
+// unexpected return so the next Check restarts it.
+func (w *Watchdog) supervise(ctx context.Context, l *loop, gen int) {
+	defer func() {
+		r := recover()
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		if l.gen != gen {
+			return
+		}
+		if r != nil {
+			l.panics++
+			l.lastPanic = fmt.Sprint(r)
+			l.exited = true
+			log.WithFields(log.Fields{
+				"loop":  l.name,
+				"panic": l.lastPanic,
+				"stack": string(debug.Stack()),
+			}).Error("watchdog loop panicked")
+			return
+		}
+		if ctx.Err() == nil {
+			l.exited = true
+			log.WithField("loop", l.name).Warn("watchdog loop exited")
+		}
+	}()
+
+	l.run(ctx, func() { w.pat(l, gen) })
+}
+
+// pat records activity for one generation of a loop.
+func (w *Watchdog) pat(l *loop, gen int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if l.gen != gen {
+		return
+	}
+	l.lastActivity = w.now()
+	if l.stalled {
+		l.stalled = false
+		log.WithFields(log.Fields{
+			"loop":     l.name,
+			"restarts": l.restarts,
+		}).Info("watchdog loop recovered")
+	}
+}
+
+// Check marks loops that stopped patting, panicked or returned as stalled
+// and restarts them once their backoff has elapsed. A goroutine dump is
+// logged when a loop first stalls.
+func (w *Watchdog) Check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.started {
+		return
+	}
+	now := w.now()
+	for _, name := range w.namesLocked() {
+		l := w.loops[name]
+		limit := time.Duration(float64(l.interval) * w.cfg.StallMultiple)
+		idle := now.Sub(l.lastActivity)
+
+		if !l.exited && !l.stalled && idle <= limit {
+			// Healthy for a full backoff window: forget earlier restarts.
+			if l.attempts > 0 && now.Sub(l.lastRestart) >= w.cfg.MaxRestartBackoff {
+				l.attempts = 0
+			}
+			continue
+		}
+
+		if !l.stalled {
+			l.stalled = true
+			log.WithFields(log.Fields{
+				"loop":     l.name,
+				"idle":     idle.String(),
+				"limit":    limit.String(),
+				"exited":   l.exited,
+				"restarts": l.restarts,
+			}).Error("watchdog loop stalled")
+			logGoroutines(l.name)
+		}
+
+		if now.Before(l.nextRestart) {
+			continue
+		}
+		l.cancel()
+		l.restarts++
+		l.attempts++
+		l.lastRestart = now
+		l.nextRestart = now.Add(w.backoff(l.attempts))
+		log.WithFields(log.Fields{
+			"loop":         l.name,
+			"restarts":     l.restarts,
+			"next_restart": l.nextRestart,
+		}).Warn("watchdog restarting loop")
+		w.startLocked(l)
+	}
+}
+
+// backoff returns the wait after the given number of consecutive restarts.
+func (w *Watchdog) backoff(attempts int) time.Duration {
+	d := w.cfg.RestartBackoff
+	for i := 1; i < attempts && d < w.cfg.MaxRestartBackoff; i++ {
+		d *= 2
+	}
+	if d > w.cfg.MaxRestartBackoff {
+		d = w.cfg.MaxRestartBackoff
+	}
+	return d
+}
+
+// Ready reports whether no registered loop is stalled.
+func (w *Watchdog) Ready() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, l := range w.loops {
+		if l.stalled {
+			return false
+		}
+	}
+	return true
+}
+
+// Status returns a snapshot of every registered loop, ordered by name.
+func (w *Watchdog) Status() []LoopStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	result := make([]LoopStatus, 0, len(w.loops))
+	for _, name := range w.namesLocked() {
+		l := w.loops[name]
+		st := LoopStatus{
+			Name:         l.name,
+			Interval:     l.interval.String(),
+			LastActivity: l.lastActivity,
+			Stalled:      l.stalled,
+			Restarts:     l.restarts,
+			Panics:       l.panics,
+			LastPanic:    l.lastPanic,
+		}
+		if l.stalled {
+			st.NextRestartAt = l.nextRestart
+		}
+		result = append(result, st)
+	}
+	return result
+}
+
+func (w *Watchdog) namesLocked() []string {
+	names := make([]string, 0, len(w.loops))
+	for name := range w.loops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetTestNow replaces the time function for testing.
+func (w *Watchdog) SetTestNow(fn func() time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.now = fn
+}
+
+// logGoroutines logs the stacks of all goroutines to aid postmortems.
+func logGoroutines(loopName string) {
+	buf := make([]byte, maxStackDump)
+	n := runtime.Stack(buf, true)
+	log.WithFields(log.Fields{
+		"loop":       loopName,
+		"goroutines": string(buf[:n]),
+	}).Error("watchdog goroutine dump")
+}
@@ -4,15 +4,37 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"antserver/internal/archive"
+	"antserver/internal/channels"
 	"antserver/internal/config"
 	"antserver/internal/coordinator"
+	"antserver/internal/epg"
 	"antserver/internal/handlers"
+	"antserver/internal/ingest"
+	"antserver/internal/opconfig"
 	"antserver/internal/recorder"
+	"antserver/internal/retention"
 	"antserver/internal/scheduler"
+	"antserver/internal/semver"
+	"antserver/internal/stats"
+	"antserver/internal/trace"
+	"antserver/internal/urlsign"
+	"antserver/internal/watchdog"
 
+	"github.com/acamarata/nself-tv/pkg/storage"
 	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -27,6 +49,10 @@ func main() {
 	log.SetLevel(level)
 	log.SetFormatter(&log.JSONFormatter{})
 
+	// Index log entries by correlation ID for GET /api/v1/trace.
+	activity := trace.NewLog(trace.DefaultMaxIDs, trace.DefaultMaxPerID)
+	log.AddHook(activity)
+
 	log.WithFields(log.Fields{
 		"port":           cfg.Port,
 		"redis_url":      cfg.RedisURL,
@@ -36,10 +62,193 @@ func main() {
 	// Initialize core components.
 	sched := scheduler.New()
 	coord := coordinator.New()
-	rec := recorder.New()
+	for _, group := range cfg.RelatedChannels {
+		coord.RelateChannels(group...)
+	}
+	format, err := recorder.ParseOutputFormat(cfg.RecordingFormat)
+	if err != nil {
+		log.WithError(err).Fatal("invalid RECORDING_FORMAT")
+	}
+	rec := recorder.NewWithFormat(format)
+	budget := archive.NewBudget(cfg.ArchiveEncodeBudget)
+
+	// Supervise live capture so recordings resume after transport failures.
+	ingestEndpoint := ingest.NetConnectorConfig{
+		Host:     cfg.IngestHost,
+		SRTPort:  cfg.IngestSRTPort,
+		RTMPPort: cfg.IngestRTMPPort,
+	}
+	if cfg.IngestMaxReconnectDuration < 0 {
+		log.WithField("value", cfg.IngestMaxReconnectDuration).Fatal("invalid INGEST_MAX_RECONNECT_DURATION")
+	}
+	transportConfig := ingest.TransportConfig{MaxReconnectDuration: cfg.IngestMaxReconnectDuration}
+	capture, err := recorder.NewCaptureSupervisor(rec, func(streamID string) (*ingest.Transport, error) {
+		return ingest.NewTransportWithConfig(ingest.NewNetConnector(ingestEndpoint), transportConfig)
+	})
+	if err != nil {
+		log.WithError(err).Fatal("failed to create capture supervisor")
+	}
+
+	// Load operational settings and reload them on SIGHUP.
+	reloader, err := opconfig.NewReloader(cfg.OperationalConfigPath, sched)
+	if err != nil {
+		log.WithError(err).Fatal("failed to create config reloader")
+	}
+	if cfg.OperationalConfigPath != "" {
+		if _, err := reloader.Reload(); err != nil {
+			log.WithError(err).Fatal("invalid OPERATIONAL_CONFIG_PATH")
+		}
+		go reloadOnSIGHUP(reloader)
+	}
+
+	if cfg.MinAgentVersion != "" {
+		if _, err := semver.Parse(cfg.MinAgentVersion); err != nil {
+			log.WithError(err).Fatal("invalid MIN_AGENT_VERSION")
+		}
+	}
+
+	// Supervise internal loops; a stalled loop fails /ready.
+	wd, err := watchdog.New(watchdog.DefaultConfig())
+	if err != nil {
+		log.WithError(err).Fatal("failed to create watchdog")
+	}
+	if err := reloader.SetStallMonitor(wd); err != nil {
+		log.WithError(err).Fatal("failed to apply stall thresholds")
+	}
+
+	// Open the database when one is configured; the stores backed by it
+	// stay disabled otherwise.
+	var db *sql.DB
+	if cfg.DatabaseURL != "" {
+		db, err = sql.Open("postgres", cfg.DatabaseURL)
+		if err != nil {
+			log.WithError(err).Fatal("invalid DATABASE_URL")
+		}
+	}
+
+	// Serve the channel catalog from the database.
+	var channelStore *channels.Store
+	if db != nil {
+		channelStore, err = channels.NewStore(db)
+		if err != nil {
+			log.WithError(err).Fatal("failed to create channel store")
+		}
+	} else if cfg.ValidateChannels {
+		log.Warn("VALIDATE_CHANNELS has no effect without DATABASE_URL")
+	}
+
+	// Read archive jobs, and the highlights stored with them, from the
+	// database. antserver runs no archive stages itself, so its pipeline
+	// serves the stored jobs: hydrating it at startup restores the jobs that
+	// were unfinished or recently finished, and marks those interrupted by
+	// the restart failed.
+	var jobStore *archive.PostgresJobStore
+	var pipeline *archive.Pipeline
+	if db != nil {
+		jobStore, err = archive.NewPostgresJobStore(db)
+		if err != nil {
+			log.WithError(err).Fatal("failed to create archive job store")
+		}
+		stages := archive.UnavailableStages{}
+		pipeline, err = archive.NewPipeline(stages, stages, stages, stages, stages, stages, stages)
+		if err != nil {
+			log.WithError(err).Fatal("failed to create archive pipeline")
+		}
+		pipeline.SetJobStore(jobStore)
+		ctx, cancel := context.WithTimeout(context.Background(), hydrateTimeout)
+		_, err = pipeline.Hydrate(ctx)
+		cancel()
+		if err != nil {
+			log.WithError(err).Fatal("failed to load archive jobs")
+		}
+	}
+
+	// Roll recording outcomes up into daily reliability stats.
+	var statsStore *stats.Store
+	if db != nil {
+		statsStore, err = stats.NewStore(db)
+		if err != nil {
+			log.WithError(err).Fatal("failed to create stats store")
+		}
+		source, err := stats.NewLiveSource(sched, rec)
+		if err != nil {
+			log.WithError(err).Fatal("failed to create stats source")
+		}
+		// Days that began before this process are only partially in memory.
+		source.SetSince(time.Now())
+		rollup, err := stats.NewRollup(source, statsStore, sched, stats.RollupConfig{})
+		if err != nil {
+			log.WithError(err).Fatal("failed to create stats rollup")
+		}
+		if err := wd.Register("stats-rollup", stats.DefaultInterval, rollup.Loop(stats.DefaultInterval)); err != nil {
+			log.WithError(err).Fatal("failed to register stats rollup")
+		}
+	}
+
+	// Recording media lives in MinIO.
+	objects, err := storage.NewS3Storage(minioURL(cfg.MinIOEndpoint), "us-east-1",
+		cfg.MinIOAccessKey, cfg.MinIOSecretKey, cfg.MinioBucket, true)
+	if err != nil {
+		log.WithError(err).Fatal("failed to create recording object store")
+	}
+
+	// Sign the catch-up playlist URLs handed to viewers joining live events.
+	signingKey := []byte(cfg.MediaSigningKey)
+	if len(signingKey) == 0 {
+		signingKey = make([]byte, 32)
+		if _, err := rand.Read(signingKey); err != nil {
+			log.WithError(err).Fatal("failed to generate media signing key")
+		}
+		log.Warn("MEDIA_SIGNING_KEY not set; signed catch-up URLs will not survive a restart")
+	}
+	signer, err := urlsign.NewSigner(signingKey, cfg.MediaURLTTL)
+	if err != nil {
+		log.WithError(err).Fatal("invalid MEDIA_SIGNING_KEY")
+	}
+
+	// Apply recording retention policies: expired recordings lose their
+	// media in MinIO, their search index entry and then their row.
+	var retentionStore *retention.Store
+	if db != nil {
+		retentionStore, err = retention.NewStore(db)
+		if err != nil {
+			log.WithError(err).Fatal("failed to create retention store")
+		}
+		index, err := retention.NewMeiliIndex(cfg.SearchURL, cfg.SearchAPIKey, cfg.SearchRecordingsIndex)
+		if err != nil {
+			log.WithError(err).Fatal("invalid MEILISEARCH_URL settings")
+		}
+		janitor, err := retention.NewJanitor(retentionStore, objects, index)
+		if err != nil {
+			log.WithError(err).Fatal("failed to create retention janitor")
+		}
+		if err := wd.Register("retention", cfg.RetentionInterval, janitor.Loop(cfg.RetentionInterval)); err != nil {
+			log.WithError(err).Fatal("failed to register retention janitor")
+		}
+	}
+
+	// Pull the upstream guide on an interval when one is configured.
+	var guide *epg.Refresher
+	if cfg.GuideURL != "" {
+		guideCfg := epg.DefaultRefreshConfig(cfg.GuideURL)
+		guideCfg.Interval = cfg.GuideRefreshInterval
+		guideCfg.MaxShift = cfg.GuideMaxShift
+		guideCfg.StaleAfter = cfg.GuideStaleAfter
+		guide, err = epg.NewRefresher(guideCfg, sched)
+		if err != nil {
+			log.WithError(err).Fatal("invalid GUIDE_URL settings")
+		}
+		if err := wd.Register("guide-refresh", guide.Interval(), guide.Run); err != nil {
+			log.WithError(err).Fatal("failed to register guide refresher")
+		}
+	}
+	go wd.Run(context.Background())
+
+	// Suggest other airings from the guide when an event's slot conflicts.
+	sched.SetAlternativeSource(alternativeSource{guide: guide, coord: coord, catalog: channelStore})
 
 	// Build the Gin router.
-	router := setupRouter(sched, coord, rec)
+	router := setupRouter(sched, coord, rec, capture, budget, reloader, activity, wd, guide, channelStore, retentionStore, pipeline, jobStore, statsStore, signer, objects, cfg)
 
 	// Start the HTTP server.
 	addr := fmt.Sprintf(":%d", cfg.Port)
@@ -49,22 +258,123 @@ func main() {
 	}
 }
 
+// hydrateTimeout bounds loading the stored archive jobs at startup.
+const hydrateTimeout = 30 * time.Second
+
+// catalogLookupTimeout bounds each channel catalog query made while
+// suggesting alternatives.
+const catalogLookupTimeout = 5 * time.Second
+
+// alternativeSource offers guide airings and tuner capacity to
+// scheduler.SuggestAlternatives. Capacity comes from the coordinator, which
+// knows each device's reported lineup, whether it is online and which tuners
+// have failed. When the channel catalog is configured it narrows that to the
+// devices the channel is registered on, and channels missing from the
+// catalog have no capacity. A catalog entry listing no devices, or a failed
+// lookup, falls back to every device.
+type alternativeSource struct {
+	guide   *epg.Refresher
+	coord   *coordinator.Coordinator
+	catalog *channels.Store
+}
+
+func (a alternativeSource) Airings(title string) []scheduler.Airing {
+	if a.guide == nil {
+		return nil
+	}
+	return a.guide.Airings(title)
+}
+
+func (a alternativeSource) Tuners(channel string) int {
+	devices, ok := a.catalogDevices(channel)
+	if !ok {
+		return 0
+	}
+	return a.coord.ChannelTunerCountOn(channel, devices)
+}
+
+func (a alternativeSource) SharesTuners(channel, other string) bool {
+	devices, ok := a.catalogDevices(channel)
+	if !ok {
+		return false
+	}
+	return a.coord.ChannelsShareTunerOn(channel, other, devices)
+}
+
+// catalogDevices returns the devices the catalog registers channel on, nil
+// for every device, and false when the catalog does not list the channel.
+func (a alternativeSource) catalogDevices(channel string) ([]string, bool) {
+	if a.catalog == nil {
+		return nil, true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), catalogLookupTimeout)
+	defer cancel()
+
+	ch, err := a.catalog.GetByCallSign(ctx, channel)
+	if errors.Is(err, channels.ErrNotFound) {
+		return nil, false
+	}
+	if err != nil {
+		log.WithError(err).WithField("channel", channel).Warn("channel catalog lookup failed; using every device")
+		return nil, true
+	}
+	if len(ch.Devices) == 0 {
+		return nil, true
+	}
+	return ch.Devices, true
+}
+
+// minioURL adds the http scheme MinIO endpoints are usually configured
+// without.
+func minioURL(endpoint string) string {
+	if strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+	return "http://" + endpoint
+}
+
+// reloadOnSIGHUP re-reads the operational config each time SIGHUP arrives.
+// Rejected reloads are logged by the reloader and the current config is kept.
+func reloadOnSIGHUP(reloader *opconfig.Reloader) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	for range sigs {
+		reloader.Reload()
+	}
+}
+
 // setupRouter creates and configures the Gin engine with all routes.
-func setupRouter(sched *scheduler.Scheduler, coord *coordinator.Coordinator, rec *recorder.Recorder) *gin.Engine {
+func setupRouter(sched *scheduler.Scheduler, coord *coordinator.Coordinator, rec *recorder.Recorder, capture *recorder.CaptureSupervisor, budget *archive.Budget, reloader *opconfig.Reloader, activity *trace.Log, wd *watchdog.Watchdog, guide *epg.Refresher, channelStore *channels.Store, retentionStore *retention.Store, pipeline *archive.Pipeline, jobStore *archive.PostgresJobStore, statsStore *stats.Store, signer *urlsign.Signer, media handlers.MediaURLs, cfg *config.Config) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 
 	router := gin.New()
 	router.Use(gin.Recovery())
-
-	// Health check endpoint.
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	router.Use(handlers.Timeout(handlers.RequestTimeouts{
+		Default: cfg.RequestTimeout,
+		Routes:  handlers.DefaultRouteTimeouts(),
+	}))
 
 	// API v1 routes.
 	v1 := router.Group("/api/v1")
 	h := handlers.New(sched, coord, rec)
+	h.Capture = capture
+	h.EncodeBudget = budget
+	h.OpConfig = reloader
+	h.Activity = activity
+	h.Watchdog = wd
+	h.Guide = guide
+	h.Channels = channelStore
+	h.Retention = retentionStore
+	h.Archive = pipeline
+	h.ArchiveJobs = jobStore
+	h.ValidateChannels = cfg.ValidateChannels
+	h.Stats = statsStore
+	h.DVRWindow = cfg.DVRWindow
+	h.URLSigner = signer
+	h.Media = media
+	h.MinAgentVersion = cfg.MinAgentVersion
 	h.RegisterRoutes(v1)
+	h.RegisterHealthRoutes(router)
 
 	return router
 }
@@ -0,0 +1,241 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"antserver/internal/coordinator"
+	"antserver/internal/handlers"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+	"antserver/internal/semver"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSemverParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"1.4.2", "1.4.2"},
+		{"v1.4.2", "1.4.2"},
+		{"V2.0.0", "2.0.0"},
+		{"1.4", "1.4.0"},
+		{"v1.4", "1.4.0"},
+		{" 1.4.2 ", "1.4.2"},
+		{"1.5.0-rc.1", "1.5.0-rc.1"},
+		{"1.5.0+build7", "1.5.0"},
+		{"1.5.0-rc.1+build7", "1.5.0-rc.1"},
+	}
+	for _, tt := range tests {
+		v, err := semver.Parse(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, v.String(), tt.in)
+	}
+
+	for _, in := range []string{"", "v", "1", "1.2.3.4", "1..2", "a.b.c", "1.2.x", "1.2.3-", "-1.2.3", "1.-2.3"} {
+		_, err := semver.Parse(in)
+		assert.ErrorIs(t, err, semver.ErrInvalid, in)
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.4.2", "1.4.2", 0},
+		{"1.4", "1.4.0", 0},
+		{"v1.4.0", "1.4", 0},
+		{"1.4.2", "1.4.10", -1},
+		{"1.10.0", "1.9.9", 1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.5.0-rc.1", "1.5.0", -1},
+		{"1.5.0-rc.1", "1.4.9", 1},
+		{"1.5.0-beta", "1.5.0-rc.1", -1},
+		{"1.5.0-rc.2", "1.5.0-rc.10", -1},
+		{"1.5.0-rc.1", "1.5.0-rc.1.1", -1},
+		{"1.5.0-alpha.1", "1.5.0-alpha.beta", -1},
+		{"1.5.0-beta.11", "1.5.0-beta.2", 1},
+		{"1.5.0+a", "1.5.0+b", 0},
+	}
+	for _, tt := range tests {
+		a, err := semver.Parse(tt.a)
+		require.NoError(t, err)
+		b, err := semver.Parse(tt.b)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, semver.Compare(a, b), "%s vs %s", tt.a, tt.b)
+		assert.Equal(t, -tt.want, semver.Compare(b, a), "%s vs %s", tt.b, tt.a)
+		assert.Equal(t, tt.want < 0, a.Less(b))
+	}
+}
+
+func TestSemverComparePrecedenceChain(t *testing.T) {
+	// The precedence example from the semver specification, section 11.
+	chain := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0",
+	}
+	for i := 1; i < len(chain); i++ {
+		a, err := semver.Parse(chain[i-1])
+		require.NoError(t, err)
+		b, err := semver.Parse(chain[i])
+		require.NoError(t, err)
+		assert.True(t, a.Less(b), "%s < %s", chain[i-1], chain[i])
+	}
+}
+
+func setupVersionRouter(t *testing.T, baseline string) (*gin.Engine, *coordinator.Coordinator) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	coord := coordinator.New()
+	h := handlers.New(scheduler.New(), coord, recorder.New())
+	h.MinAgentVersion = baseline
+
+	router := gin.New()
+	h.RegisterRoutes(router.Group("/api/v1"))
+	return router, coord
+}
+
+func postJSON(router *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestDeviceHeartbeat_RecordsAgentVersion(t *testing.T) {
+	router, coord := setupVersionRouter(t, "")
+	_, err := coord.RegisterDevice("antbox-001", "Living Room", 2)
+	require.NoError(t, err)
+	require.NoError(t, coord.SetDeviceOnline("antbox-001", false))
+
+	w := postJSON(router, "/api/v1/devices/antbox-001/heartbeat", map[string]string{"agent_version": "v1.3"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	dev, err := coord.GetDevice("antbox-001")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.3", dev.AgentVersion)
+	assert.True(t, dev.Online)
+
+	// A heartbeat without a version keeps the last reported one.
+	w = postJSON(router, "/api/v1/devices/antbox-001/heartbeat", map[string]string{})
+	require.Equal(t, http.StatusOK, w.Code)
+	dev, _ = coord.GetDevice("antbox-001")
+	assert.Equal(t, "v1.3", dev.AgentVersion)
+
+	// The version shows up in the device listing.
+	req := httptest.NewRequest("GET", "/api/v1/devices", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var devices []coordinator.Device
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &devices))
+	require.Len(t, devices, 1)
+	assert.Equal(t, "v1.3", devices[0].AgentVersion)
+
+	w = postJSON(router, "/api/v1/devices/antbox-001/heartbeat", map[string]string{"agent_version": "latest"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/api/v1/devices/missing/heartbeat", map[string]string{"agent_version": "1.0.0"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSendDeviceCommand_AgentVersionGating(t *testing.T) {
+	router, coord := setupVersionRouter(t, "")
+	for _, id := range []string{"old", "new", "silent"} {
+		_, err := coord.RegisterDevice(id, id, 1)
+		require.NoError(t, err)
+	}
+	require.NoError(t, coord.RecordHeartbeat("old", "1.2"))
+	require.NoError(t, coord.RecordHeartbeat("new", "v1.3.0"))
+
+	required := handlers.DefaultCommandMinAgentVersions()["set_bitrate"]
+	require.Equal(t, "1.3.0", required)
+
+	tests := []struct {
+		device  string
+		command string
+		code    int
+	}{
+		{"old", "set_bitrate", http.StatusConflict},
+		{"new", "set_bitrate", http.StatusAccepted},
+		{"silent", "set_bitrate", http.StatusConflict},
+		{"old", "set_output_format", http.StatusAccepted},
+		{"silent", "tune", http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.device+"/"+tt.command, func(t *testing.T) {
+			w := postJSON(router, "/api/v1/devices/"+tt.device+"/command", map[string]string{"command": tt.command})
+			require.Equal(t, tt.code, w.Code, w.Body.String())
+			if tt.code != http.StatusConflict {
+				return
+			}
+			var resp handlers.AgentTooOldResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, handlers.ErrorCodeAgentTooOld, resp.Code)
+			assert.Equal(t, required, resp.RequiredVersion)
+		})
+	}
+}
+
+func TestGetDeviceVersions_FleetSummary(t *testing.T) {
+	router, coord := setupVersionRouter(t, "v1.3")
+	reports := map[string]string{
+		"a": "1.2.0",
+		"b": "v1.3",
+		"c": "1.3.0",
+		"d": "1.10.1",
+		"e": "",
+	}
+	for id, v := range reports {
+		_, err := coord.RegisterDevice(id, id, 1)
+		require.NoError(t, err)
+		require.NoError(t, coord.RecordHeartbeat(id, v))
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/devices/versions", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp handlers.DeviceVersionsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "1.3.0", resp.Baseline)
+	assert.Equal(t, []handlers.AgentVersionCount{
+		{Version: "1.10.1", Devices: 1},
+		{Version: "1.3.0", Devices: 2},
+		{Version: "1.2.0", Devices: 1},
+		{Version: "unknown", Devices: 1},
+	}, resp.Versions)
+	assert.Equal(t, []handlers.DeviceVersionView{
+		{DeviceID: "a", AgentVersion: "1.2.0"},
+		{DeviceID: "e"},
+	}, resp.BelowBaseline)
+}
+
+func TestGetDeviceVersions_NoBaseline(t *testing.T) {
+	router, coord := setupVersionRouter(t, "")
+	_, err := coord.RegisterDevice("a", "a", 1)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/api/v1/devices/versions", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp handlers.DeviceVersionsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Empty(t, resp.Baseline)
+	assert.Equal(t, []handlers.AgentVersionCount{{Version: "unknown", Devices: 1}}, resp.Versions)
+	assert.Empty(t, resp.BelowBaseline)
+}
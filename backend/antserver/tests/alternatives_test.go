@@ -0,0 +1,233 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"antserver/internal/coordinator"
+	"antserver/internal/handlers"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLineup is an AlternativeSource backed by fixed airings, per-channel
+// tuner counts and groups of channels tuned by the same tuners.
+type fakeLineup struct {
+	airings []scheduler.Airing
+	tuners  map[string]int
+	shared  [][]string
+}
+
+func (f *fakeLineup) Airings(title string) []scheduler.Airing {
+	var result []scheduler.Airing
+	for _, a := range f.airings {
+		if a.Title == title {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+func (f *fakeLineup) Tuners(channel string) int { return f.tuners[channel] }
+
+func (f *fakeLineup) SharesTuners(channel, other string) bool {
+	for _, group := range f.shared {
+		if contains(group, channel) && contains(group, other) {
+			return true
+		}
+	}
+	return channel == other
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// at returns a time on 2026-02-13, the mock clock's day, or the next day for
+// hours past 24.
+func at(hour int) time.Time {
+	return time.Date(2026, 2, 13, 0, 0, 0, 0, time.UTC).Add(time.Duration(hour) * time.Hour)
+}
+
+func airing(channel string, startHour, endHour int) scheduler.Airing {
+	return scheduler.Airing{Channel: channel, Title: "Celtics at Knicks", StartTime: at(startHour), EndTime: at(endHour)}
+}
+
+// conflictingSchedule has one tuner for ESPN and ESPN2, a separate pair for
+// ABC, a Lakers game 19:00-22:00 and a Celtics game 20:00-22:00 that
+// conflicts with it.
+func conflictingSchedule(t *testing.T, airings ...scheduler.Airing) (*scheduler.Scheduler, *scheduler.Event) {
+	t.Helper()
+	s := scheduler.NewWithClock(newMockClock())
+	createEvent(t, s, "ESPN", at(19), at(22), scheduler.EventMetadata{Title: "Warriors at Lakers"})
+	celtics := createEvent(t, s, "ESPN2", at(20), at(22), scheduler.EventMetadata{Title: "Celtics at Knicks"})
+	s.SetAlternativeSource(&fakeLineup{
+		airings: airings,
+		tuners:  map[string]int{"ESPN": 1, "ESPN2": 1, "ABC": 2},
+		shared:  [][]string{{"ESPN", "ESPN2"}},
+	})
+	return s, celtics
+}
+
+func TestSuggestAlternatives(t *testing.T) {
+	s, celtics := conflictingSchedule(t,
+		airing("ESPN2", 20, 22), // the event's own slot
+		airing("ESPN2", 25, 27), // overnight rerun
+		airing("ESPN2", 21, 23), // still overlaps the Lakers game
+		airing("NBATV", 23, 25), // not in the lineup
+		airing("ABC", 21, 23),   // overlaps, but ABC has a second tuner
+		airing("ESPN2", 10, 12), // already aired
+		airing("ABC", 30, 32),   // next afternoon
+	)
+
+	alts, err := s.SuggestAlternatives(celtics.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []scheduler.Alternative{
+		{Channel: "ABC", StartTime: at(21), EndTime: at(23), Kind: scheduler.AlternativeOtherChannel},
+		{Channel: "ESPN2", StartTime: at(25), EndTime: at(27), Kind: scheduler.AlternativeRerun},
+		{Channel: "ABC", StartTime: at(30), EndTime: at(32), Kind: scheduler.AlternativeOtherChannel},
+	}, alts)
+}
+
+func TestSuggestAlternatives_SkipsScheduledAndFinishedEvents(t *testing.T) {
+	s, celtics := conflictingSchedule(t, airing("ESPN2", 25, 27), airing("ABC", 30, 32))
+
+	// The rerun is already being recorded by another event.
+	createEvent(t, s, "ESPN2", at(25), at(27), scheduler.EventMetadata{Title: "Celtics at Knicks"})
+
+	// A cancelled event no longer holds a tuner.
+	blocker := createEvent(t, s, "ABC", at(30), at(32), scheduler.EventMetadata{Title: "Local News"})
+	createEvent(t, s, "ABC", at(30), at(32), scheduler.EventMetadata{Title: "Local Weather"})
+	alts, err := s.SuggestAlternatives(celtics.ID)
+	require.NoError(t, err)
+	assert.Empty(t, alts, "ABC's two tuners are taken")
+
+	require.NoError(t, s.Transition(blocker.ID, scheduler.StateCancelled))
+	alts, err = s.SuggestAlternatives(celtics.ID)
+	require.NoError(t, err)
+	require.Len(t, alts, 1)
+	assert.Equal(t, "ABC", alts[0].Channel)
+}
+
+func TestSuggestAlternatives_CountsOnlyCompetingChannels(t *testing.T) {
+	s, celtics := conflictingSchedule(t, airing("ESPN2", 25, 27))
+
+	// ABC has its own tuners, so its recordings leave the rerun free.
+	createEvent(t, s, "ABC", at(25), at(27), scheduler.EventMetadata{Title: "Late Movie"})
+	alts, err := s.SuggestAlternatives(celtics.ID)
+	require.NoError(t, err)
+	require.Len(t, alts, 1)
+
+	// An ESPN recording takes the tuner ESPN2 shares.
+	createEvent(t, s, "ESPN", at(25), at(27), scheduler.EventMetadata{Title: "SportsCenter"})
+	alts, err = s.SuggestAlternatives(celtics.ID)
+	require.NoError(t, err)
+	assert.Empty(t, alts)
+}
+
+func TestSuggestAlternatives_NoneAvailable(t *testing.T) {
+	s, celtics := conflictingSchedule(t, airing("ESPN2", 21, 23), airing("NBATV", 23, 25))
+	alts, err := s.SuggestAlternatives(celtics.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, alts)
+	assert.Empty(t, alts)
+
+	// Without a source there is nothing to suggest.
+	plain := scheduler.NewWithClock(newMockClock())
+	evt := createEvent(t, plain, "ESPN2", at(20), at(22), scheduler.EventMetadata{Title: "Celtics at Knicks"})
+	alts, err = plain.SuggestAlternatives(evt.ID)
+	require.NoError(t, err)
+	assert.Empty(t, alts)
+
+	_, err = plain.SuggestAlternatives("missing")
+	assert.Error(t, err)
+}
+
+func TestChannelTunerCount(t *testing.T) {
+	coord := coordinator.New()
+	_, err := coord.RegisterDevice("antbox-001", "Living Room", 2)
+	require.NoError(t, err)
+	_, err = coord.RegisterDevice("antbox-002", "Attic", 1)
+	require.NoError(t, err)
+	require.NoError(t, coord.SetDeviceChannels("antbox-002", []string{"ESPN"}))
+
+	assert.Equal(t, 3, coord.ChannelTunerCount("ESPN"))
+	assert.Equal(t, 2, coord.ChannelTunerCount("ABC"), "an unknown lineup carries every channel")
+
+	require.NoError(t, coord.SetDeviceOnline("antbox-001", false))
+	assert.Equal(t, 1, coord.ChannelTunerCount("ESPN"))
+	assert.Equal(t, 0, coord.ChannelTunerCount("ABC"))
+}
+
+func TestChannelsShareTuner(t *testing.T) {
+	coord := coordinator.New()
+	_, err := coord.RegisterDevice("antbox-001", "Living Room", 1)
+	require.NoError(t, err)
+	require.NoError(t, coord.SetDeviceChannels("antbox-001", []string{"ESPN", "ESPN2"}))
+	_, err = coord.RegisterDevice("antbox-002", "Attic", 1)
+	require.NoError(t, err)
+	require.NoError(t, coord.SetDeviceChannels("antbox-002", []string{"ABC"}))
+
+	assert.True(t, coord.ChannelsShareTuner("ESPN", "ESPN2"))
+	assert.True(t, coord.ChannelsShareTuner("ABC", "ABC"))
+	assert.False(t, coord.ChannelsShareTuner("ESPN", "ABC"))
+
+	require.NoError(t, coord.SetDeviceOnline("antbox-001", false))
+	assert.False(t, coord.ChannelsShareTuner("ESPN", "ESPN2"))
+}
+
+func TestGetEventAlternatives(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s, celtics := conflictingSchedule(t, airing("ESPN2", 25, 27))
+	h := handlers.New(s, coordinator.New(), recorder.New())
+	router := gin.New()
+	h.RegisterRoutes(router.Group("/api/v1"))
+
+	req := httptest.NewRequest("GET", "/api/v1/events/"+celtics.ID+"/alternatives", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var alts []scheduler.Alternative
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &alts))
+	require.Len(t, alts, 1)
+	assert.Equal(t, scheduler.AlternativeRerun, alts[0].Kind)
+
+	req = httptest.NewRequest("GET", "/api/v1/events/missing/alternatives", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestChannelCapacityOnDevices(t *testing.T) {
+	coord := coordinator.New()
+	_, err := coord.RegisterDevice("antbox-001", "Living Room", 2)
+	require.NoError(t, err)
+	require.NoError(t, coord.SetDeviceChannels("antbox-001", []string{"ESPN", "ESPN2"}))
+	_, err = coord.RegisterDevice("antbox-002", "Attic", 1)
+	require.NoError(t, err)
+	require.NoError(t, coord.SetDeviceChannels("antbox-002", []string{"ESPN", "ESPN2"}))
+
+	// Only the devices the catalog registers the channel on count.
+	assert.Equal(t, 3, coord.ChannelTunerCountOn("ESPN", nil))
+	assert.Equal(t, 1, coord.ChannelTunerCountOn("ESPN", []string{"antbox-002"}))
+	assert.Equal(t, 0, coord.ChannelTunerCountOn("ESPN", []string{}))
+	assert.Equal(t, 0, coord.ChannelTunerCountOn("ESPN", []string{"antbox-404"}))
+
+	assert.True(t, coord.ChannelsShareTunerOn("ESPN", "ESPN2", []string{"antbox-002"}))
+	require.NoError(t, coord.SetDeviceOnline("antbox-002", false))
+	assert.False(t, coord.ChannelsShareTunerOn("ESPN", "ESPN2", []string{"antbox-002"}))
+	assert.True(t, coord.ChannelsShareTunerOn("ESPN", "ESPN2", nil))
+}
@@ -0,0 +1,318 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"antserver/internal/archive"
+	"antserver/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingEncoder blocks each Encode call until the test releases it.
+type blockingEncoder struct {
+	mu      sync.Mutex
+	started chan string
+	release map[string]chan error
+}
+
+func newBlockingEncoder() *blockingEncoder {
+	return &blockingEncoder{
+		started: make(chan string, 16),
+		release: make(map[string]chan error),
+	}
+}
+
+func (b *blockingEncoder) gate(recordingID string) chan error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch, ok := b.release[recordingID]
+	if !ok {
+		ch = make(chan error, 1)
+		b.release[recordingID] = ch
+	}
+	return ch
+}
+
+func (b *blockingEncoder) Encode(req archive.EncodeRequest) error {
+	ch := b.gate(req.RecordingID)
+	b.started <- req.RecordingID
+	return <-ch
+}
+
+func (b *blockingEncoder) finish(recordingID string, err error) {
+	b.gate(recordingID) <- err
+}
+
+func (b *blockingEncoder) waitStarted(t *testing.T) string {
+	t.Helper()
+	select {
+	case id := <-b.started:
+		return id
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for encode to start")
+		return ""
+	}
+}
+
+func (b *blockingEncoder) assertNotStarted(t *testing.T) {
+	t.Helper()
+	select {
+	case id := <-b.started:
+		t.Fatalf("encode for %s started but should be waiting for budget", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func newBudgetPipeline(t *testing.T, capacity int) (*archive.Pipeline, *archive.Budget, *blockingEncoder, *mockDetector) {
+	f, d, _, tp, u, i, p := newMocks()
+	enc := newBlockingEncoder()
+	pipeline, err := archive.NewPipeline(f, d, enc, tp, u, i, p)
+	require.NoError(t, err)
+	budget := archive.NewBudget(capacity)
+	pipeline.SetBudget(budget)
+	return pipeline, budget, enc, d
+}
+
+func waitForQueued(t *testing.T, b *archive.Budget, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return len(b.Status().Queued) == n
+	}, 2*time.Second, 5*time.Millisecond)
+}
+
+func waitForJobStatus(t *testing.T, p *archive.Pipeline, recordingID string, status archive.JobStatus) *archive.ArchiveJob {
+	t.Helper()
+	var job *archive.ArchiveJob
+	require.Eventually(t, func() bool {
+		for _, j := range p.ListJobs() {
+			if j.RecordingID == recordingID && j.Status == status {
+				job = j
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, 5*time.Millisecond)
+	return job
+}
+
+var (
+	profile4KHEVC  = archive.EncodeProfile{Height: 2160, Codec: "hevc"}
+	profile720H264 = archive.EncodeProfile{Height: 720, Codec: "h264"}
+)
+
+func TestEstimateEncodeWeight(t *testing.T) {
+	assert.Equal(t, 60, archive.EstimateEncodeWeight(profile4KHEVC))
+	assert.Equal(t, 15, archive.EstimateEncodeWeight(profile720H264))
+	assert.Equal(t, 25, archive.EstimateEncodeWeight(archive.EncodeProfile{}))
+	assert.Equal(t, 50, archive.EstimateEncodeWeight(archive.EncodeProfile{Height: 1080, Codec: "av1"}))
+}
+
+func TestBudget_EnforcesCapacity(t *testing.T) {
+	pipeline, budget, enc, _ := newBudgetPipeline(t, 100)
+
+	start := func(id string, profile archive.EncodeProfile) {
+		go pipeline.StartWithOptions(context.Background(), id, archive.JobOptions{Profile: profile})
+	}
+
+	start("rec-4k", profile4KHEVC)
+	require.Equal(t, "rec-4k", enc.waitStarted(t))
+
+	start("rec-720-a", profile720H264)
+	require.Equal(t, "rec-720-a", enc.waitStarted(t))
+
+	// 60 + 15 + 15 + 15 = 105 exceeds the budget, so the third 720p waits.
+	start("rec-720-b", profile720H264)
+	require.Equal(t, "rec-720-b", enc.waitStarted(t))
+	start("rec-720-c", profile720H264)
+	waitForQueued(t, budget, 1)
+	enc.assertNotStarted(t)
+
+	status := budget.Status()
+	assert.Equal(t, 90, status.InUse)
+	assert.Equal(t, 10, status.Available)
+	assert.Len(t, status.Running, 3)
+	assert.Equal(t, 15, status.QueuedDemand)
+
+	enc.finish("rec-720-a", nil)
+	assert.Equal(t, "rec-720-c", enc.waitStarted(t))
+
+	enc.finish("rec-4k", nil)
+	enc.finish("rec-720-b", nil)
+	enc.finish("rec-720-c", nil)
+	waitForJobStatus(t, pipeline, "rec-720-c", archive.StatusCompleted)
+	assert.Equal(t, 0, budget.Status().InUse)
+}
+
+func TestBudget_LiveBeforeBulk(t *testing.T) {
+	pipeline, budget, enc, _ := newBudgetPipeline(t, 60)
+
+	go pipeline.StartWithOptions(context.Background(), "rec-running", archive.JobOptions{Profile: profile4KHEVC})
+	require.Equal(t, "rec-running", enc.waitStarted(t))
+
+	go pipeline.StartWithOptions(context.Background(), "rec-bulk", archive.JobOptions{
+		Priority: archive.PriorityBulk,
+		Profile:  profile720H264,
+	})
+	waitForQueued(t, budget, 1)
+
+	go pipeline.StartWithOptions(context.Background(), "rec-live", archive.JobOptions{
+		Priority: archive.PriorityLive,
+		Profile:  profile4KHEVC,
+	})
+	waitForQueued(t, budget, 2)
+
+	queued := budget.Status().Queued
+	assert.Equal(t, "rec-live", queued[0].RecordingID)
+	assert.Equal(t, "rec-bulk", queued[1].RecordingID)
+
+	// The live job is at the head of the queue, so the bulk job must not
+	// overtake it even though 15 points would fit once budget frees up.
+	enc.finish("rec-running", nil)
+	assert.Equal(t, "rec-live", enc.waitStarted(t))
+	enc.assertNotStarted(t)
+
+	enc.finish("rec-live", nil)
+	assert.Equal(t, "rec-bulk", enc.waitStarted(t))
+	enc.finish("rec-bulk", nil)
+	waitForJobStatus(t, pipeline, "rec-bulk", archive.StatusCompleted)
+}
+
+func TestBudget_EarlyStagesProceedWhileEncodeWaits(t *testing.T) {
+	pipeline, budget, enc, detector := newBudgetPipeline(t, 60)
+
+	go pipeline.StartWithOptions(context.Background(), "rec-running", archive.JobOptions{Profile: profile4KHEVC})
+	require.Equal(t, "rec-running", enc.waitStarted(t))
+
+	go pipeline.StartWithOptions(context.Background(), "rec-waiting", archive.JobOptions{Profile: profile4KHEVC})
+	waitForQueued(t, budget, 1)
+
+	detector.mu.Lock()
+	assert.Contains(t, detector.ids, "rec-waiting")
+	detector.mu.Unlock()
+
+	job := waitForJobStatus(t, pipeline, "rec-waiting", archive.StatusRunning)
+	snapshot, err := pipeline.GetStatus(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, archive.StageEncode, snapshot.CurrentStage)
+	for _, st := range snapshot.Stages {
+		switch st.Name {
+		case archive.StageFinalize, archive.StageDetectCommercials:
+			assert.Equal(t, archive.StatusCompleted, st.Status)
+		case archive.StageEncode:
+			assert.Equal(t, archive.StatusWaiting, st.Status)
+		}
+	}
+
+	enc.finish("rec-running", nil)
+	assert.Equal(t, "rec-waiting", enc.waitStarted(t))
+	enc.finish("rec-waiting", nil)
+	waitForJobStatus(t, pipeline, "rec-waiting", archive.StatusCompleted)
+}
+
+func TestBudget_ReleasedOnCancellation(t *testing.T) {
+	pipeline, budget, enc, _ := newBudgetPipeline(t, 60)
+
+	go pipeline.StartWithOptions(context.Background(), "rec-running", archive.JobOptions{Profile: profile4KHEVC})
+	require.Equal(t, "rec-running", enc.waitStarted(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pipeline.StartWithOptions(ctx, "rec-cancelled", archive.JobOptions{Profile: profile4KHEVC})
+	waitForQueued(t, budget, 1)
+
+	cancel()
+	job := waitForJobStatus(t, pipeline, "rec-cancelled", archive.StatusFailed)
+	assert.Equal(t, archive.StageEncode, job.CurrentStage)
+	for _, st := range job.Stages {
+		if st.Name == archive.StageEncode {
+			assert.Equal(t, context.Canceled.Error(), st.Error)
+		}
+	}
+	waitForQueued(t, budget, 0)
+
+	enc.finish("rec-running", nil)
+	waitForJobStatus(t, pipeline, "rec-running", archive.StatusCompleted)
+
+	status := budget.Status()
+	assert.Equal(t, 0, status.InUse)
+	assert.Empty(t, status.Running)
+}
+
+func TestBudget_ReleasedOnEncodeFailure(t *testing.T) {
+	pipeline, budget, enc, _ := newBudgetPipeline(t, 60)
+
+	go pipeline.StartWithOptions(context.Background(), "rec-fail", archive.JobOptions{Profile: profile4KHEVC})
+	require.Equal(t, "rec-fail", enc.waitStarted(t))
+	assert.Equal(t, 60, budget.Status().InUse)
+
+	enc.finish("rec-fail", errors.New("ffmpeg exited 1"))
+	waitForJobStatus(t, pipeline, "rec-fail", archive.StatusFailed)
+	assert.Equal(t, 0, budget.Status().InUse)
+}
+
+func TestBudget_AcquireCancelledWhileQueued(t *testing.T) {
+	budget := archive.NewBudget(10)
+	require.NoError(t, budget.Acquire(context.Background(), archive.BudgetClaim{JobID: "a", Weight: 10}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := budget.Acquire(ctx, archive.BudgetClaim{JobID: "b", Weight: 5})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, budget.Status().Queued)
+
+	budget.Release("a")
+	assert.Equal(t, 0, budget.Status().InUse)
+}
+
+func TestBudget_Close(t *testing.T) {
+	budget := archive.NewBudget(10)
+	require.NoError(t, budget.Acquire(context.Background(), archive.BudgetClaim{JobID: "a", Weight: 10}))
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- budget.Acquire(context.Background(), archive.BudgetClaim{JobID: "b", Weight: 5})
+	}()
+	waitForQueued(t, budget, 1)
+
+	budget.Close()
+	assert.ErrorIs(t, <-errCh, archive.ErrBudgetClosed)
+	assert.ErrorIs(t, budget.Acquire(context.Background(), archive.BudgetClaim{JobID: "c"}), archive.ErrBudgetClosed)
+}
+
+func TestGetArchiveBudget(t *testing.T) {
+	router, _, _, _ := setupTestRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/archive/budget", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	gin.SetMode(gin.TestMode)
+	budget := archive.NewBudget(100)
+	require.NoError(t, budget.Acquire(context.Background(), archive.BudgetClaim{JobID: "job-1", RecordingID: "rec-1", Weight: 60}))
+
+	h := handlers.New(nil, nil, nil)
+	h.EncodeBudget = budget
+	r := gin.New()
+	h.RegisterRoutes(r.Group("/api/v1"))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/archive/budget", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var status archive.BudgetStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, 100, status.Capacity)
+	assert.Equal(t, 60, status.InUse)
+	assert.Equal(t, 40, status.Available)
+	require.Len(t, status.Running, 1)
+	assert.Equal(t, "rec-1", status.Running[0].RecordingID)
+}
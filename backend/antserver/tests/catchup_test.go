@@ -0,0 +1,292 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"antserver/internal/coordinator"
+	"antserver/internal/handlers"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+	"antserver/internal/urlsign"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSegmenter writes fixed-length segments into a recording the way the
+// ingest segmenter does.
+type mockSegmenter struct {
+	t        *testing.T
+	rec      *recorder.Recorder
+	id       string
+	duration time.Duration
+}
+
+func (m *mockSegmenter) write(n int) {
+	m.t.Helper()
+	for i := 0; i < n; i++ {
+		_, err := m.rec.AppendSegment(m.id, m.duration)
+		require.NoError(m.t, err)
+	}
+}
+
+var segmentLine = regexp.MustCompile(`(?m)^segment_\d+\.ts$`)
+
+func windowSegments(t *testing.T, playlist string) []string {
+	t.Helper()
+	return segmentLine.FindAllString(playlist, -1)
+}
+
+func TestLivePlaylist_GrowsThenSlides(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+	seg := &mockSegmenter{t: t, rec: r, id: rec.ID, duration: 6 * time.Second}
+	const window = 30 * time.Second
+
+	// Until the window is full the playlist grows from the first segment.
+	seg.write(3)
+	pl, err := r.LivePlaylist(rec.ID, window)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"segment_00000.ts", "segment_00001.ts", "segment_00002.ts"}, windowSegments(t, pl))
+	assert.Contains(t, pl, "#EXT-X-MEDIA-SEQUENCE:0\n")
+	assert.NotContains(t, pl, "#EXT-X-ENDLIST")
+
+	seg.write(2)
+	pl, err = r.LivePlaylist(rec.ID, window)
+	require.NoError(t, err)
+	assert.Len(t, windowSegments(t, pl), 5)
+
+	// Past the window the oldest segments drop off.
+	seg.write(3)
+	pl, err = r.LivePlaylist(rec.ID, window)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"segment_00003.ts", "segment_00004.ts", "segment_00005.ts", "segment_00006.ts", "segment_00007.ts",
+	}, windowSegments(t, pl))
+	assert.Contains(t, pl, "#EXT-X-MEDIA-SEQUENCE:3\n")
+
+	// The full playlist is unaffected.
+	full, err := r.Playlist(rec.ID)
+	require.NoError(t, err)
+	assert.Len(t, windowSegments(t, full), 8)
+}
+
+func TestLivePlaylist_KeepsNewestSegment(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+	_, err := r.AppendSegment(rec.ID, 10*time.Second)
+	require.NoError(t, err)
+
+	pl, err := r.LivePlaylist(rec.ID, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"segment_00000.ts"}, windowSegments(t, pl))
+}
+
+func TestLivePlaylist_DiscontinuitySequence(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+	seg := &mockSegmenter{t: t, rec: r, id: rec.ID, duration: 6 * time.Second}
+	seg.write(2)
+
+	now := time.Now()
+	require.NoError(t, r.BeginGap(rec.ID, now, recorder.GapReasonTransportFailed))
+	require.NoError(t, r.ResumeSegment(rec.ID, now.Add(30*time.Second)))
+	seg.write(3)
+
+	// The window starts after the discontinuity, which is counted.
+	pl, err := r.LivePlaylist(rec.ID, 18*time.Second)
+	require.NoError(t, err)
+	assert.Contains(t, pl, "#EXT-X-DISCONTINUITY-SEQUENCE:1\n")
+	assert.NotContains(t, pl, "#EXT-X-DISCONTINUITY\n")
+	assert.NotContains(t, pl, "#EXT-X-GAP")
+
+	// A window spanning the gap keeps the tag inline instead, after the
+	// placeholders covering the 30s gap.
+	pl, err = r.LivePlaylist(rec.ID, 24*time.Second)
+	require.NoError(t, err)
+	assert.NotContains(t, pl, "#EXT-X-DISCONTINUITY-SEQUENCE")
+	assert.Contains(t, pl, "#EXT-X-GAP\n#EXTINF:6.000,\nsegment_00006.ts\n#EXT-X-DISCONTINUITY\n")
+}
+
+func TestLivePlaylist_NotLive(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+	require.NoError(t, r.StopRecording(rec.ID))
+
+	_, err := r.LivePlaylist(rec.ID, time.Minute)
+	assert.ErrorIs(t, err, recorder.ErrRecordingNotLive)
+
+	_, err = r.LivePlaylist("missing", time.Minute)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, recorder.ErrRecordingNotLive)
+}
+
+// fakeMediaURLs presigns keys the way the object store does, recording the
+// expiry it was asked for. fail makes every request fail.
+type fakeMediaURLs struct {
+	expiry time.Duration
+	fail   bool
+}
+
+func (f *fakeMediaURLs) URL(_ context.Context, key string, expiry time.Duration) (string, error) {
+	if f.fail {
+		return "", errors.New("object store unavailable")
+	}
+	f.expiry = expiry
+	return "https://media.example/" + key + "?X-Amz-Signature=sig", nil
+}
+
+var presignedSegmentLine = regexp.MustCompile(`(?m)^https://media\.example/\S+$`)
+
+func setupCatchupRouter(t *testing.T) (*gin.Engine, *handlers.Handler, *urlsign.Signer) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	signer, err := urlsign.NewSigner([]byte("catch-up-test-key"), time.Minute)
+	require.NoError(t, err)
+
+	h := handlers.New(scheduler.New(), coordinator.New(), recorder.New())
+	h.DVRWindow = 12 * time.Second
+	h.URLSigner = signer
+	h.Media = &fakeMediaURLs{}
+	router := gin.New()
+	h.RegisterRoutes(router.Group("/api/v1"))
+	return router, h, signer
+}
+
+func TestGetCatchupPlaylist(t *testing.T) {
+	router, h, signer := setupCatchupRouter(t)
+	rec := h.Recorder
+
+	recording := rec.StartRecording("event-001", "srt://ESPN:9000")
+	(&mockSegmenter{t: t, rec: rec, id: recording.ID, duration: 6 * time.Second}).write(4)
+
+	get := func(id string) *httptest.ResponseRecorder {
+		signed, _ := signer.Sign("/api/v1/recordings/" + id + "/catchup.m3u8")
+		return getPath(router, signed)
+	}
+
+	w := get(recording.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/vnd.apple.mpegurl", w.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(w.Body.String(), "#EXTM3U\n"))
+
+	// Every segment in the window is a presigned storage URL; none is left
+	// as a bare name.
+	prefix := "https://media.example/recordings/event-001/" + recording.ID + "/"
+	assert.Equal(t, []string{
+		prefix + "segment_00002.ts?X-Amz-Signature=sig",
+		prefix + "segment_00003.ts?X-Amz-Signature=sig",
+	}, presignedSegmentLine.FindAllString(w.Body.String(), -1))
+	assert.Empty(t, windowSegments(t, w.Body.String()))
+	assert.Equal(t, time.Minute, h.Media.(*fakeMediaURLs).expiry)
+
+	require.NoError(t, rec.StopRecording(recording.ID))
+	assert.Equal(t, http.StatusConflict, get(recording.ID).Code)
+	assert.Equal(t, http.StatusNotFound, get("missing").Code)
+}
+
+func TestGetCatchupPlaylist_SignsInitSegment(t *testing.T) {
+	router, h, signer := setupCatchupRouter(t)
+	recording := h.Recorder.StartRecordingWithFormat("event-001", "srt://ESPN:9000", recorder.FormatFMP4)
+	_, err := h.Recorder.AppendSegment(recording.ID, 6*time.Second)
+	require.NoError(t, err)
+
+	signed, _ := signer.Sign("/api/v1/recordings/" + recording.ID + "/catchup.m3u8")
+	w := getPath(router, signed)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(),
+		`#EXT-X-MAP:URI="https://media.example/recordings/event-001/`+recording.ID+`/init.mp4?X-Amz-Signature=sig"`)
+}
+
+func TestGetCatchupPlaylist_RejectsUnsignedURLs(t *testing.T) {
+	router, h, signer := setupCatchupRouter(t)
+	recording := h.Recorder.StartRecording("event-001", "srt://ESPN:9000")
+	(&mockSegmenter{t: t, rec: h.Recorder, id: recording.ID, duration: 6 * time.Second}).write(2)
+	path := "/api/v1/recordings/" + recording.ID + "/catchup.m3u8"
+
+	assert.Equal(t, http.StatusForbidden, getPath(router, path).Code, "unsigned")
+
+	// A token issued for another recording does not open this one.
+	other, _ := signer.Sign("/api/v1/recordings/other/catchup.m3u8")
+	assert.Equal(t, http.StatusForbidden, getPath(router, path+other[strings.Index(other, "?"):]).Code, "other path")
+
+	// Moving the expiry forward invalidates the token.
+	signed, expires := signer.Sign(path)
+	extended := strings.Replace(signed, strconv.FormatInt(expires.Unix(), 10), strconv.FormatInt(expires.Add(time.Hour).Unix(), 10), 1)
+	assert.Equal(t, http.StatusForbidden, getPath(router, extended).Code, "tampered expiry")
+
+	// Once the expiry passes the URL stops working.
+	assert.Equal(t, http.StatusOK, getPath(router, signed).Code)
+	signer.SetTestNow(func() time.Time { return expires })
+	w := getPath(router, signed)
+	assert.Equal(t, http.StatusForbidden, w.Code, "expired")
+	assert.Contains(t, w.Body.String(), urlsign.ErrExpired.Error())
+}
+
+func TestGetCatchupPlaylist_SigningFailure(t *testing.T) {
+	router, h, signer := setupCatchupRouter(t)
+	h.Media = &fakeMediaURLs{fail: true}
+	recording := h.Recorder.StartRecording("event-001", "srt://ESPN:9000")
+	(&mockSegmenter{t: t, rec: h.Recorder, id: recording.ID, duration: 6 * time.Second}).write(1)
+
+	signed, _ := signer.Sign("/api/v1/recordings/" + recording.ID + "/catchup.m3u8")
+	w := getPath(router, signed)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "segment_")
+}
+
+func TestGetCatchupPlaylist_NotConfigured(t *testing.T) {
+	router, _, _, rec := setupTestRouter()
+	recording := rec.StartRecording("event-001", "srt://ESPN:9000")
+
+	w := getPath(router, "/api/v1/recordings/"+recording.ID+"/catchup.m3u8")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestAdmitEvent_ReturnsCatchupManifest(t *testing.T) {
+	router, h, _ := setupCatchupRouter(t)
+	start := time.Now().Add(time.Hour)
+	evt, err := h.Scheduler.CreateEvent("ESPN", start, start.Add(time.Hour), scheduler.EventMetadata{Title: "Game"})
+	require.NoError(t, err)
+
+	admit := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/events/"+id+"/admit", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, admit("missing").Code)
+	assert.Equal(t, http.StatusConflict, admit(evt.ID).Code, "no recording yet")
+
+	recording := h.Recorder.StartRecording(evt.ID, "srt://ESPN:9000")
+	(&mockSegmenter{t: t, rec: h.Recorder, id: recording.ID, duration: 6 * time.Second}).write(3)
+
+	w := admit(evt.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp handlers.AdmitResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, evt.ID, resp.EventID)
+	assert.Equal(t, recording.ID, resp.RecordingID)
+	assert.Equal(t, "12s", resp.DVRWindow)
+	assert.True(t, strings.HasPrefix(resp.MediaURL, "/api/v1/recordings/"+recording.ID+"/catchup.m3u8?"))
+	assert.WithinDuration(t, time.Now().Add(time.Minute), resp.ExpiresAt, 2*time.Second)
+
+	// The returned URL plays the catch-up window.
+	pl := getPath(router, resp.MediaURL)
+	require.Equal(t, http.StatusOK, pl.Code)
+	assert.Len(t, presignedSegmentLine.FindAllString(pl.Body.String(), -1), 2)
+
+	require.NoError(t, h.Recorder.StopRecording(recording.ID))
+	assert.Equal(t, http.StatusConflict, admit(evt.ID).Code, "no longer live")
+}
@@ -0,0 +1,325 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"antserver/internal/coordinator"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createGameChain creates pre-game, game and post-game events chained under
+// the given ID and moves them to scheduled. Members are created out of order
+// to check that position, not creation order, decides the sequence.
+func createGameChain(t *testing.T, s *scheduler.Scheduler, chainID string) (pre, game, post *scheduler.Event) {
+	t.Helper()
+	start := time.Now().Add(time.Hour)
+	meta := func(title string, pos int) scheduler.EventMetadata {
+		return scheduler.EventMetadata{League: "NBA", Title: title, ChainID: chainID, ChainPosition: pos}
+	}
+
+	post = createEvent(t, s, "ESPN", start.Add(3*time.Hour), start.Add(4*time.Hour), meta("Post-game", 2))
+	game = createEvent(t, s, "ESPN", start.Add(time.Hour), start.Add(3*time.Hour), meta("Warriors at Lakers", 1))
+	pre = createEvent(t, s, "ESPN", start, start.Add(time.Hour), meta("Pre-game", 0))
+
+	for _, evt := range []*scheduler.Event{pre, game, post} {
+		require.NoError(t, s.Transition(evt.ID, scheduler.StateScheduled))
+	}
+	return pre, game, post
+}
+
+func recordThrough(t *testing.T, s *scheduler.Scheduler, eventID string) {
+	t.Helper()
+	for _, state := range []scheduler.EventState{scheduler.StateActive, scheduler.StateRecording, scheduler.StateFinalizing} {
+		require.NoError(t, s.Transition(eventID, state))
+	}
+}
+
+func TestChainEventsOrderedByPosition(t *testing.T) {
+	s := scheduler.NewWithClock(newMockClock())
+	pre, game, post := createGameChain(t, s, "chain-1")
+
+	events, err := s.ChainEvents("chain-1")
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, pre.ID, events[0].ID)
+	assert.Equal(t, game.ID, events[1].ID)
+	assert.Equal(t, post.ID, events[2].ID)
+
+	_, err = s.ChainEvents("missing")
+	assert.ErrorIs(t, err, scheduler.ErrChainNotFound)
+}
+
+func TestChainRecordsInOrder(t *testing.T) {
+	s := scheduler.NewWithClock(newMockClock())
+	pre, game, post := createGameChain(t, s, "chain-1")
+
+	err := s.Transition(game.ID, scheduler.StateActive)
+	assert.ErrorIs(t, err, scheduler.ErrChainOutOfOrder)
+	err = s.Transition(post.ID, scheduler.StateActive)
+	assert.ErrorIs(t, err, scheduler.ErrChainOutOfOrder)
+
+	recordThrough(t, s, pre.ID)
+
+	// The game can start once the pre-game is finalizing; the post-game still waits.
+	require.NoError(t, s.Transition(game.ID, scheduler.StateActive))
+	assert.ErrorIs(t, s.Transition(post.ID, scheduler.StateActive), scheduler.ErrChainOutOfOrder)
+
+	require.NoError(t, s.Transition(game.ID, scheduler.StateRecording))
+	require.NoError(t, s.Transition(game.ID, scheduler.StateFailed))
+	assert.NoError(t, s.Transition(post.ID, scheduler.StateActive), "a failed member must not block the rest of the chain")
+}
+
+func TestChainAllocatesSameTuner(t *testing.T) {
+	c := coordinator.New()
+	_, err := c.RegisterDevice("antbox-1", "Living Room", 2)
+	require.NoError(t, err)
+	_, err = c.RegisterDevice("antbox-2", "Den", 2)
+	require.NoError(t, err)
+
+	first, err := c.AssignChainTuner("chain-1", "pre", "ESPN")
+	require.NoError(t, err)
+
+	// An unrelated event must not take the chain's tuner between members.
+	otherDev, otherTuner, err := c.AssignTuner("unrelated")
+	require.NoError(t, err)
+	assert.False(t, otherDev == first.DeviceID && otherTuner == first.TunerIndex)
+
+	for _, eventID := range []string{"game", "post"} {
+		got, err := c.AssignChainTuner("chain-1", eventID, "ESPN")
+		require.NoError(t, err)
+		assert.Equal(t, first.DeviceID, got.DeviceID)
+		assert.Equal(t, first.TunerIndex, got.TunerIndex)
+	}
+
+	dev, err := c.GetDevice(first.DeviceID)
+	require.NoError(t, err)
+	assert.Equal(t, "post", dev.Tuners[first.TunerIndex].EventID)
+	assert.Equal(t, "chain-1", dev.Tuners[first.TunerIndex].ChainID)
+	assert.Equal(t, "ESPN", dev.Tuners[first.TunerIndex].Channel)
+	assert.Len(t, c.GetAvailableTuners(), 2)
+
+	c.ReleaseChain("chain-1")
+	assert.Len(t, c.GetAvailableTuners(), 3)
+	c.ReleaseChain("chain-1")
+	assert.Len(t, c.GetAvailableTuners(), 3)
+}
+
+func TestChainTunerCarriesChannel(t *testing.T) {
+	c := coordinator.New()
+	_, err := c.RegisterDevice("antbox-1", "Living Room", 1)
+	require.NoError(t, err)
+	_, err = c.RegisterDevice("antbox-2", "Den", 1)
+	require.NoError(t, err)
+	require.NoError(t, c.SetDeviceChannels("antbox-1", []string{"CBS"}))
+	require.NoError(t, c.SetDeviceChannels("antbox-2", []string{"ESPN", "ESPN2"}))
+	c.RelateChannels("ESPN", "ESPN-HD")
+
+	first, err := c.AssignChainTuner("chain-1", "pre", "ESPN")
+	require.NoError(t, err)
+	assert.Equal(t, "antbox-2", first.DeviceID)
+	assert.Equal(t, "ESPN", first.Channel)
+
+	// Later members retune the chain's tuner to their own channel.
+	next, err := c.AssignChainTuner("chain-1", "game", "ESPN2")
+	require.NoError(t, err)
+	assert.Equal(t, first.DeviceID, next.DeviceID)
+	assert.Equal(t, "ESPN2", next.Channel)
+
+	next, err = c.AssignChainTuner("chain-1", "post", "ESPN-HD")
+	require.NoError(t, err)
+	assert.Equal(t, "ESPN", next.Channel, "a related channel the device carries")
+
+	_, err = c.AssignChainTuner("chain-1", "extra", "CBS")
+	assert.ErrorIs(t, err, coordinator.ErrNoTunerForChannel)
+
+	_, err = c.AssignChainTuner("chain-2", "other", "NBC")
+	assert.ErrorIs(t, err, coordinator.ErrNoTunerForChannel)
+}
+
+func TestChainTunerOfflineDevice(t *testing.T) {
+	c := coordinator.New()
+	_, err := c.RegisterDevice("antbox-1", "Living Room", 1)
+	require.NoError(t, err)
+
+	first, err := c.AssignChainTuner("chain-1", "pre", "ESPN")
+	require.NoError(t, err)
+	require.NoError(t, c.SetDeviceOnline(first.DeviceID, false))
+
+	_, err = c.AssignChainTuner("chain-1", "game", "ESPN")
+	assert.Error(t, err)
+}
+
+func TestChainRejectsDuplicatePosition(t *testing.T) {
+	s := scheduler.NewWithClock(newMockClock())
+	pre, _, _ := createGameChain(t, s, "chain-1")
+
+	start := time.Now().Add(5 * time.Hour)
+	meta := scheduler.EventMetadata{Title: "Second game", ChainID: "chain-1", ChainPosition: 1}
+	_, err := s.CreateEvent("ESPN", start, start.Add(time.Hour), meta)
+	var verr *scheduler.ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, "metadata.chain_position", verr.Field)
+	assert.ErrorIs(t, err, scheduler.ErrDuplicateChainPosition)
+
+	// Other chains and cancelled members do not hold the position.
+	meta.ChainID = "chain-2"
+	_, err = s.CreateEvent("ESPN", start, start.Add(time.Hour), meta)
+	assert.NoError(t, err)
+
+	require.NoError(t, s.Transition(pre.ID, scheduler.StateCancelled))
+	meta = scheduler.EventMetadata{Title: "Pre-game", ChainID: "chain-1", ChainPosition: 0}
+	_, err = s.CreateEvent("ESPN", start, start.Add(time.Hour), meta)
+	assert.NoError(t, err)
+}
+
+func TestCancelChain(t *testing.T) {
+	s := scheduler.NewWithClock(newMockClock())
+	pre, game, post := createGameChain(t, s, "chain-1")
+	recordThrough(t, s, pre.ID)
+	require.NoError(t, s.Transition(game.ID, scheduler.StateActive))
+	require.NoError(t, s.Transition(game.ID, scheduler.StateRecording))
+
+	cancelled, err := s.CancelChain("chain-1")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{game.ID, post.ID}, cancelled)
+
+	for id, want := range map[string]scheduler.EventState{
+		pre.ID:  scheduler.StateFinalizing,
+		game.ID: scheduler.StateCancelled,
+		post.ID: scheduler.StateCancelled,
+	} {
+		evt, err := s.GetEvent(id)
+		require.NoError(t, err)
+		assert.Equal(t, want, evt.State)
+	}
+
+	_, err = s.CancelChain("missing")
+	assert.ErrorIs(t, err, scheduler.ErrChainNotFound)
+}
+
+func TestCancelChainEndpoint(t *testing.T) {
+	router, sched, coord, _ := setupTestRouter()
+	_, err := coord.RegisterDevice("antbox-1", "Living Room", 1)
+	require.NoError(t, err)
+
+	pre, game, post := createGameChain(t, sched, "chain-1")
+	_, err = coord.AssignChainTuner("chain-1", pre.ID, "ESPN")
+	require.NoError(t, err)
+	require.Empty(t, coord.GetAvailableTuners())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/api/v1/chains/chain-1/cancel", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Cancelled []string `json:"cancelled"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.ElementsMatch(t, []string{pre.ID, game.ID, post.ID}, resp.Cancelled)
+	assert.Len(t, coord.GetAvailableTuners(), 1)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/chains/chain-1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var events []scheduler.Event
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+	require.Len(t, events, 3)
+	for _, evt := range events {
+		assert.Equal(t, scheduler.StateCancelled, evt.State)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/api/v1/chains/missing/cancel", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func putPath(router http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", path, nil))
+	return w
+}
+
+func TestChainEndpointsShareTunerAndStopCapture(t *testing.T) {
+	router, sched, coord, rec := setupTestRouter()
+	_, err := coord.RegisterDevice("antbox-1", "Living Room", 1)
+	require.NoError(t, err)
+	_, err = coord.RegisterDevice("antbox-2", "Den", 1)
+	require.NoError(t, err)
+
+	start := time.Now().Add(time.Hour)
+	meta := func(title string, pos int) scheduler.EventMetadata {
+		return scheduler.EventMetadata{Title: title, ChainID: "chain-1", ChainPosition: pos}
+	}
+	pre := createEvent(t, sched, "ESPN", start, start.Add(time.Hour), meta("Pre-game", 0))
+	game := createEvent(t, sched, "ESPN", start.Add(time.Hour), start.Add(3*time.Hour), meta("Game", 1))
+	for _, evt := range []*scheduler.Event{pre, game} {
+		require.NoError(t, sched.Transition(evt.ID, scheduler.StateScheduled))
+	}
+
+	type startResponse struct {
+		Recording struct {
+			ID string `json:"id"`
+		} `json:"recording"`
+		Tuner *coordinator.Allocation `json:"tuner"`
+	}
+	startEvent := func(id string) startResponse {
+		t.Helper()
+		w := putPath(router, "/api/v1/events/"+id+"/start")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp startResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotNil(t, resp.Tuner)
+		return resp
+	}
+
+	first := startEvent(pre.ID)
+	assert.Len(t, coord.GetAvailableTuners(), 1)
+	require.Equal(t, http.StatusOK, putPath(router, "/api/v1/events/"+pre.ID+"/stop").Code)
+	assert.Len(t, coord.GetAvailableTuners(), 1, "the tuner stays reserved between members")
+
+	second := startEvent(game.ID)
+	assert.Equal(t, first.Tuner.DeviceID, second.Tuner.DeviceID)
+	assert.Equal(t, first.Tuner.TunerIndex, second.Tuner.TunerIndex)
+
+	w := putPath(router, "/api/v1/chains/chain-1/cancel")
+	require.Equal(t, http.StatusOK, w.Code)
+	status, err := rec.GetRecordingStatus(second.Recording.ID)
+	require.NoError(t, err)
+	assert.Equal(t, recorder.RecordingComplete, status.State, "cancelling the chain stops and finalizes the member's recording")
+	assert.Len(t, coord.GetAvailableTuners(), 2)
+}
+
+func TestChainTunerReleasedWhenLastMemberCompletes(t *testing.T) {
+	router, sched, coord, _ := setupTestRouter()
+	_, err := coord.RegisterDevice("antbox-1", "Living Room", 1)
+	require.NoError(t, err)
+
+	start := time.Now().Add(time.Hour)
+	evt := createEvent(t, sched, "ESPN", start, start.Add(time.Hour), scheduler.EventMetadata{ChainID: "chain-1"})
+	require.NoError(t, sched.Transition(evt.ID, scheduler.StateScheduled))
+
+	require.Equal(t, http.StatusOK, putPath(router, "/api/v1/events/"+evt.ID+"/start").Code)
+	assert.Empty(t, coord.GetAvailableTuners())
+	require.Equal(t, http.StatusOK, putPath(router, "/api/v1/events/"+evt.ID+"/stop").Code)
+	assert.Len(t, coord.GetAvailableTuners(), 1)
+}
+
+func TestChainStartWithoutTuner(t *testing.T) {
+	router, sched, _, _ := setupTestRouter()
+	start := time.Now().Add(time.Hour)
+	evt := createEvent(t, sched, "ESPN", start, start.Add(time.Hour), scheduler.EventMetadata{ChainID: "chain-1"})
+	require.NoError(t, sched.Transition(evt.ID, scheduler.StateScheduled))
+
+	assert.Equal(t, http.StatusConflict, putPath(router, "/api/v1/events/"+evt.ID+"/start").Code)
+	stored, err := sched.GetEvent(evt.ID)
+	require.NoError(t, err)
+	assert.Equal(t, scheduler.StateFailed, stored.State)
+}
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"antserver/internal/channels"
+	"antserver/internal/coordinator"
+	"antserver/internal/handlers"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	channelInsert     = `INSERT INTO channels`
+	channelSelect     = `SELECT id, call_sign, number, name, COALESCE(logo_url, ''), device_ids, created_at`
+	channelByCallSign = `WHERE call_sign = $1`
+	channelByID       = `WHERE id = $1`
+	channelDelete     = `DELETE FROM channels WHERE id = $1`
+)
+
+var channelCreatedAt = time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC)
+
+func channelRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "call_sign", "number", "name", "logo_url", "device_ids", "created_at"})
+}
+
+func setupChannelRouter(t *testing.T, validate bool) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+
+	store, err := channels.NewStore(db)
+	require.NoError(t, err)
+
+	// The mock clock keeps the sample guide's programmes in the future.
+	h := handlers.New(scheduler.NewWithClock(newMockClock()), coordinator.New(), recorder.New())
+	h.Channels = store
+	h.ValidateChannels = validate
+
+	router := gin.New()
+	h.RegisterRoutes(router.Group("/api/v1"))
+	return router, mock
+}
+
+func TestChannelStore_NilDB(t *testing.T) {
+	_, err := channels.NewStore(nil)
+	assert.ErrorIs(t, err, channels.ErrNilDB)
+}
+
+func TestChannels_CRUD(t *testing.T) {
+	router, mock := setupChannelRouter(t, false)
+
+	// Create.
+	mock.ExpectQuery(regexp.QuoteMeta(channelInsert)).
+		WithArgs("ESPN", "206", "ESPN", "https://logos.example/espn.png", `["antbox-001","antbox-002"]`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("ch-1", channelCreatedAt))
+
+	w := postJSON(router, "/api/v1/channels", map[string]interface{}{
+		"call_sign": "ESPN",
+		"number":    "206",
+		"logo_url":  "https://logos.example/espn.png",
+		"devices":   []string{"antbox-001", "antbox-002"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var created channels.Channel
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "ch-1", created.ID)
+	assert.Equal(t, "ESPN", created.Name, "name defaults to the call sign")
+	assert.Equal(t, []string{"antbox-001", "antbox-002"}, created.Devices)
+
+	// List.
+	mock.ExpectQuery(regexp.QuoteMeta(channelSelect)).
+		WillReturnRows(channelRows().
+			AddRow("ch-2", "FOX", "11", "FOX", "", []byte(`[]`), channelCreatedAt).
+			AddRow("ch-1", "ESPN", "206", "ESPN", "https://logos.example/espn.png", []byte(`["antbox-001","antbox-002"]`), channelCreatedAt))
+
+	req := httptest.NewRequest("GET", "/api/v1/channels", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var list []channels.Channel
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, "FOX", list[0].CallSign)
+	assert.Equal(t, []string{}, list[0].Devices)
+	assert.Equal(t, created.Devices, list[1].Devices)
+
+	// Get.
+	mock.ExpectQuery(regexp.QuoteMeta(channelByID)).WithArgs("ch-1").
+		WillReturnRows(channelRows().
+			AddRow("ch-1", "ESPN", "206", "ESPN", "", []byte(`["antbox-001"]`), channelCreatedAt))
+
+	req = httptest.NewRequest("GET", "/api/v1/channels/ch-1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Delete, then delete again.
+	mock.ExpectExec(regexp.QuoteMeta(channelDelete)).WithArgs("ch-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(channelDelete)).WithArgs("ch-1").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	req = httptest.NewRequest("DELETE", "/api/v1/channels/ch-1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	req = httptest.NewRequest("DELETE", "/api/v1/channels/ch-1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestChannels_CreateErrors(t *testing.T) {
+	router, mock := setupChannelRouter(t, false)
+
+	// Duplicate call sign: ON CONFLICT DO NOTHING returns no row.
+	mock.ExpectQuery(regexp.QuoteMeta(channelInsert)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}))
+	w := postJSON(router, "/api/v1/channels", map[string]string{"call_sign": "ESPN", "number": "206"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = postJSON(router, "/api/v1/channels", map[string]string{"call_sign": "ESPN"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/api/v1/channels", map[string]string{"call_sign": "  ", "number": "206"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mock.ExpectQuery(regexp.QuoteMeta(channelByID)).WithArgs("missing").WillReturnError(sql.ErrNoRows)
+	req := httptest.NewRequest("GET", "/api/v1/channels/missing", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestChannels_NotConfigured(t *testing.T) {
+	router, _, _, _ := setupTestRouter()
+	req := httptest.NewRequest("GET", "/api/v1/channels", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func eventBody(channel string) map[string]interface{} {
+	return map[string]interface{}{
+		"channel":    channel,
+		"start_time": time.Now().Add(time.Hour).Format(time.RFC3339),
+	}
+}
+
+func TestCreateEvent_ChannelValidation(t *testing.T) {
+	t.Run("unknown channel rejected", func(t *testing.T) {
+		router, mock := setupChannelRouter(t, true)
+		mock.ExpectQuery(regexp.QuoteMeta(channelByCallSign)).WithArgs("NOPE").WillReturnError(sql.ErrNoRows)
+
+		w := postJSON(router, "/api/v1/events", eventBody("NOPE"))
+		require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+		var resp handlers.ValidationErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "channel", resp.Field)
+		assert.Equal(t, "unknown channel", resp.Reason)
+	})
+
+	t.Run("known channel accepted", func(t *testing.T) {
+		router, mock := setupChannelRouter(t, true)
+		mock.ExpectQuery(regexp.QuoteMeta(channelByCallSign)).WithArgs("ESPN").
+			WillReturnRows(channelRows().AddRow("ch-1", "ESPN", "206", "ESPN", "", []byte(`[]`), channelCreatedAt))
+
+		w := postJSON(router, "/api/v1/events", eventBody("ESPN"))
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	})
+
+	t.Run("validation disabled", func(t *testing.T) {
+		router, _ := setupChannelRouter(t, false)
+		w := postJSON(router, "/api/v1/events", eventBody("NOPE"))
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	})
+
+	t.Run("lookup failure", func(t *testing.T) {
+		router, mock := setupChannelRouter(t, true)
+		mock.ExpectQuery(regexp.QuoteMeta(channelByCallSign)).WithArgs("ESPN").WillReturnError(errors.New("connection reset"))
+
+		w := postJSON(router, "/api/v1/events", eventBody("ESPN"))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
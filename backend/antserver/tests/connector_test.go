@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"antserver/internal/ingest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// srtListener answers the SRT caller handshake on a local UDP port. reject,
+// when non-zero, is returned as the conclusion's handshake type.
+type srtListener struct {
+	conn     *net.UDPConn
+	reject   uint32
+	streamID chan string
+	packets  chan uint32
+}
+
+func newSRTListener(t *testing.T, reject uint32) *srtListener {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	l := &srtListener{conn: conn, reject: reject, streamID: make(chan string, 1), packets: make(chan uint32, 16)}
+	go l.serve()
+	return l
+}
+
+func (l *srtListener) port() int {
+	return l.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (l *srtListener) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		header := binary.BigEndian.Uint32(buf[0:4])
+		if header != 0x80000000 {
+			l.packets <- header
+			continue
+		}
+
+		cif := buf[16:n]
+		reply := make([]byte, 64)
+		binary.BigEndian.PutUint32(reply[0:4], 0x80000000)
+		binary.BigEndian.PutUint32(reply[16:20], 5)
+		binary.BigEndian.PutUint32(reply[40:44], 77) // listener socket ID
+		binary.BigEndian.PutUint32(reply[44:48], 0xC00C1E)
+
+		switch binary.BigEndian.Uint32(cif[20:24]) {
+		case 1: // induction
+			binary.BigEndian.PutUint32(reply[36:40], 1)
+		default: // conclusion
+			if binary.BigEndian.Uint32(cif[28:32]) != 0xC00C1E {
+				continue
+			}
+			l.streamID <- srtExtensionStreamID(cif[48:])
+			if l.reject != 0 {
+				binary.BigEndian.PutUint32(reply[36:40], l.reject)
+			} else {
+				binary.BigEndian.PutUint32(reply[36:40], 0xFFFFFFFF)
+			}
+		}
+		l.conn.WriteToUDP(reply, addr)
+	}
+}
+
+// srtExtensionStreamID finds the stream ID extension and decodes its
+// little-endian words.
+func srtExtensionStreamID(ext []byte) string {
+	for len(ext) >= 4 {
+		typ := binary.BigEndian.Uint16(ext[0:2])
+		words := int(binary.BigEndian.Uint16(ext[2:4]))
+		body := ext[4 : 4+words*4]
+		if typ == 5 {
+			var out []byte
+			for i := 0; i < len(body); i += 4 {
+				out = append(out, body[i+3], body[i+2], body[i+1], body[i])
+			}
+			for len(out) > 0 && out[len(out)-1] == 0 {
+				out = out[:len(out)-1]
+			}
+			return string(out)
+		}
+		ext = ext[4+words*4:]
+	}
+	return ""
+}
+
+// rtmpServer completes the RTMP handshake for each connection and reports
+// how many bytes the client sent afterwards.
+func rtmpServer(t *testing.T) (int, chan int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan int, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				c0c1 := make([]byte, 1537)
+				if _, err := io.ReadFull(conn, c0c1); err != nil {
+					return
+				}
+				s := make([]byte, 1+2*1536)
+				s[0] = 3
+				copy(s[1+1536:], c0c1[1:])
+				conn.Write(s)
+				c2 := make([]byte, 1536)
+				if _, err := io.ReadFull(conn, c2); err != nil {
+					return
+				}
+				n, _ := io.Copy(io.Discard, conn)
+				received <- int(n)
+			}(conn)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, received
+}
+
+// closedUDPPort returns a local UDP port with nothing listening on it.
+func closedUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+	return port
+}
+
+func TestNetConnector_SRTHandshake(t *testing.T) {
+	l := newSRTListener(t, 0)
+	c := ingest.NewNetConnector(ingest.NetConnectorConfig{Host: "127.0.0.1", SRTPort: l.port(), DialTimeout: time.Second})
+
+	require.NoError(t, c.ConnectSRT("espn-hd"))
+	assert.Equal(t, "espn-hd", <-l.streamID)
+
+	require.NoError(t, c.SendKeepalive())
+	assert.Equal(t, uint32(0x80010000), <-l.packets)
+
+	require.NoError(t, c.Close())
+	assert.Equal(t, uint32(0x80050000), <-l.packets)
+	assert.ErrorIs(t, c.SendKeepalive(), ingest.ErrNotConnected)
+}
+
+func TestNetConnector_SRTRejected(t *testing.T) {
+	l := newSRTListener(t, 1003)
+	c := ingest.NewNetConnector(ingest.NetConnectorConfig{Host: "127.0.0.1", SRTPort: l.port(), DialTimeout: time.Second})
+
+	err := c.ConnectSRT("espn-hd")
+	assert.ErrorIs(t, err, ingest.ErrHandshakeRejected)
+	assert.ErrorIs(t, c.SendKeepalive(), ingest.ErrNotConnected)
+}
+
+func TestNetConnector_RTMPHandshake(t *testing.T) {
+	port, received := rtmpServer(t)
+	c := ingest.NewNetConnector(ingest.NetConnectorConfig{Host: "127.0.0.1", RTMPPort: port, DialTimeout: time.Second})
+
+	require.NoError(t, c.ConnectRTMP("espn-hd"))
+	require.NoError(t, c.SendKeepalive())
+	require.NoError(t, c.Close())
+	assert.Equal(t, 16, <-received, "one acknowledgement message")
+}
+
+func TestNetConnector_TransportFallsBackToRTMP(t *testing.T) {
+	port, _ := rtmpServer(t)
+	c := ingest.NewNetConnector(ingest.NetConnectorConfig{
+		Host:        "127.0.0.1",
+		SRTPort:     closedUDPPort(t),
+		RTMPPort:    port,
+		DialTimeout: 200 * time.Millisecond,
+	})
+	tr, err := ingest.NewTransport(c)
+	require.NoError(t, err)
+
+	require.NoError(t, tr.Connect("espn-hd"))
+	assert.Equal(t, "rtmp", tr.GetProtocol())
+	require.NoError(t, tr.Disconnect())
+}
+
+func TestNetConnector_HostDefaultsToStreamID(t *testing.T) {
+	l := newSRTListener(t, 0)
+	c := ingest.NewNetConnector(ingest.NetConnectorConfig{SRTPort: l.port(), DialTimeout: time.Second})
+
+	require.NoError(t, c.ConnectSRT("127.0.0.1"))
+	assert.Equal(t, "127.0.0.1", <-l.streamID)
+	require.NoError(t, c.Close())
+}
@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
 	"antserver/internal/coordinator"
@@ -238,6 +240,50 @@ func TestListDevices(t *testing.T) {
 	assert.Len(t, devices, 2)
 }
 
+// TestListDevicesReturnsCopies reads the listed tuners while others are
+// assigned and released; run with -race to catch shared state.
+func TestListDevicesReturnsCopies(t *testing.T) {
+	c := coordinator.New()
+	_, err := c.RegisterDevice("antbox-001", "Box 1", 2)
+	require.NoError(t, err)
+	require.NoError(t, c.SetDeviceChannels("antbox-001", []string{"ESPN"}))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			alloc, err := c.AssignTunerForChannel(fmt.Sprintf("evt-%d", i), "ESPN")
+			if err != nil {
+				continue
+			}
+			c.ReleaseTuner(alloc.DeviceID, alloc.TunerIndex)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			for _, dev := range c.ListDevices() {
+				for _, tuner := range dev.Tuners {
+					_ = tuner.State
+					_ = tuner.EventID
+				}
+			}
+		}
+	}()
+	wg.Wait()
+
+	devices := c.ListDevices()
+	require.Len(t, devices, 1)
+	devices[0].Tuners[0].State = coordinator.TunerFailed
+	devices[0].Channels[0] = "CBS"
+
+	dev, err := c.GetDevice("antbox-001")
+	require.NoError(t, err)
+	assert.Equal(t, coordinator.TunerAvailable, dev.Tuners[0].State)
+	assert.Equal(t, []string{"ESPN"}, dev.Channels)
+}
+
 func TestAssignAndReleaseFullCycle(t *testing.T) {
 	c := coordinator.New()
 	_, err := c.RegisterDevice("antbox-001", "Test", 2)
@@ -273,3 +319,111 @@ func TestAssignAndReleaseFullCycle(t *testing.T) {
 	available = c.GetAvailableTuners()
 	assert.Len(t, available, 1) // Tuner 1 was released, tuner 0 re-assigned.
 }
+
+// --- Channel lineup and failover ---
+
+// newLineupCoordinator registers two single-tuner devices with overlapping
+// lineups: both carry ESPN, only box-b carries TSN1.
+func newLineupCoordinator(t *testing.T) *coordinator.Coordinator {
+	t.Helper()
+	c := coordinator.New()
+	_, err := c.RegisterDevice("box-a", "Den", 1)
+	require.NoError(t, err)
+	_, err = c.RegisterDevice("box-b", "Basement", 1)
+	require.NoError(t, err)
+	require.NoError(t, c.SetDeviceChannels("box-a", []string{"ESPN", "FOX"}))
+	require.NoError(t, c.SetDeviceChannels("box-b", []string{"ESPN", "TSN1"}))
+	return c
+}
+
+func TestAssignTunerForChannel(t *testing.T) {
+	c := newLineupCoordinator(t)
+
+	alloc, err := c.AssignTunerForChannel("evt-tsn", "TSN1")
+	require.NoError(t, err)
+	assert.Equal(t, "box-b", alloc.DeviceID, "only box-b carries TSN1")
+	assert.Equal(t, "TSN1", alloc.Channel)
+
+	alloc, err = c.AssignTunerForChannel("evt-espn", "ESPN")
+	require.NoError(t, err)
+	assert.Equal(t, "box-a", alloc.DeviceID, "box-b's tuner is busy")
+
+	_, err = c.AssignTunerForChannel("evt-espn-2", "ESPN")
+	assert.ErrorIs(t, err, coordinator.ErrNoTunerForChannel)
+
+	_, err = c.AssignTunerForChannel("evt-cbc", "CBC")
+	assert.ErrorIs(t, err, coordinator.ErrNoTunerForChannel)
+}
+
+func TestAssignTunerForChannel_UnknownLineupCarriesAll(t *testing.T) {
+	c := coordinator.New()
+	_, err := c.RegisterDevice("box-a", "Den", 1)
+	require.NoError(t, err)
+
+	alloc, err := c.AssignTunerForChannel("evt-1", "CBC")
+	require.NoError(t, err)
+	assert.Equal(t, "box-a", alloc.DeviceID)
+}
+
+func TestAssignTunerForChannel_RelatedChannel(t *testing.T) {
+	c := newLineupCoordinator(t)
+	c.RelateChannels("TSN1", "TSN1 HD")
+	require.NoError(t, c.SetDeviceChannels("box-a", []string{"TSN1 HD"}))
+
+	_, err := c.AssignTunerForChannel("evt-1", "TSN1")
+	require.NoError(t, err)
+
+	alloc, err := c.AssignTunerForChannel("evt-2", "TSN1")
+	require.NoError(t, err)
+	assert.Equal(t, "box-a", alloc.DeviceID)
+	assert.Equal(t, "TSN1 HD", alloc.Channel)
+}
+
+func TestFailoverTuner(t *testing.T) {
+	c := newLineupCoordinator(t)
+
+	first, err := c.AssignTunerForChannel("evt-game", "ESPN")
+	require.NoError(t, err)
+	require.Equal(t, "box-a", first.DeviceID)
+
+	alloc, err := c.FailoverTuner(first.DeviceID, first.TunerIndex)
+	require.NoError(t, err)
+	assert.Equal(t, "box-b", alloc.DeviceID)
+	assert.Equal(t, "evt-game", alloc.EventID)
+	assert.Equal(t, "ESPN", alloc.Channel)
+
+	failed, err := c.GetDevice("box-a")
+	require.NoError(t, err)
+	assert.Equal(t, coordinator.TunerFailed, failed.Tuners[0].State)
+	assert.Empty(t, failed.Tuners[0].EventID)
+
+	moved, err := c.GetDevice("box-b")
+	require.NoError(t, err)
+	assert.Equal(t, coordinator.TunerAssigned, moved.Tuners[0].State)
+	assert.Equal(t, "evt-game", moved.Tuners[0].EventID)
+
+	// The failed tuner is not reused until recovered.
+	_, err = c.AssignTunerForChannel("evt-other", "FOX")
+	assert.ErrorIs(t, err, coordinator.ErrNoTunerForChannel)
+	require.NoError(t, c.RecoverTuner("box-a", 0))
+	_, err = c.AssignTunerForChannel("evt-other", "FOX")
+	assert.NoError(t, err)
+}
+
+func TestFailoverTuner_NoAlternate(t *testing.T) {
+	c := newLineupCoordinator(t)
+
+	// Only box-b carries TSN1, so there is nowhere to fail over to.
+	alloc, err := c.AssignTunerForChannel("evt-tsn", "TSN1")
+	require.NoError(t, err)
+
+	_, err = c.FailoverTuner(alloc.DeviceID, alloc.TunerIndex)
+	assert.ErrorIs(t, err, coordinator.ErrNoFailoverTuner)
+
+	dev, err := c.GetDevice("box-b")
+	require.NoError(t, err)
+	assert.Equal(t, coordinator.TunerFailed, dev.Tuners[0].State)
+
+	_, err = c.FailoverTuner("box-a", 0)
+	assert.Error(t, err, "unassigned tuners cannot fail over")
+}
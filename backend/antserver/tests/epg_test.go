@@ -0,0 +1,282 @@
+package tests
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"antserver/internal/coordinator"
+	"antserver/internal/epg"
+	"antserver/internal/handlers"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+	"antserver/internal/trace"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleXMLTV = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE tv SYSTEM "xmltv.dtd">
+<tv generator-info-name="test">
+  <channel id="espn.us">
+    <display-name>ESPN</display-name>
+  </channel>
+  <channel id="tsn1.ca">
+    <display-name>TSN1</display-name>
+  </channel>
+  <programme start="20260213190000 -0500" stop="20260213223000 -0500" channel="espn.us">
+    <title lang="en">Warriors at Lakers</title>
+    <desc lang="en">Regular season matchup.</desc>
+    <category lang="en">Sports</category>
+    <category lang="en">Basketball</category>
+    <category lang="en">NBA</category>
+  </programme>
+  <programme start="20260214000000 +0000" channel="tsn1.ca">
+    <title lang="en">Maple Leafs at Canadiens</title>
+    <category lang="en">NHL</category>
+  </programme>
+  <programme start="20260214150000 +0000" stop="20260214170000 +0000" channel="fox.us">
+    <title lang="en">Arsenal vs Chelsea</title>
+    <sub-title lang="en">Matchweek 25</sub-title>
+    <category lang="en">Soccer</category>
+    <category lang="en">Premier League</category>
+  </programme>
+  <programme start="not-a-time" stop="20260214170000 +0000" channel="espn.us">
+    <title lang="en">Broken Start</title>
+  </programme>
+  <programme start="20260214180000 +0000" stop="20260214170000 +0000" channel="espn.us">
+    <title lang="en">Backwards</title>
+  </programme>
+  <programme start="20260214180000 +0000" channel="espn.us">
+    <title lang="en">SportsCenter</title>
+  </programme>
+  <programme start="20260214180000 +0000" stop="20260214190000 +0000" channel="">
+    <title lang="en">No Channel</title>
+  </programme>
+</tv>`
+
+func TestParseXMLTVTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"20260213190000 -0500", time.Date(2026, 2, 14, 0, 0, 0, 0, time.UTC)},
+		{"20260213190000 +0000", time.Date(2026, 2, 13, 19, 0, 0, 0, time.UTC)},
+		{"20260213190000", time.Date(2026, 2, 13, 19, 0, 0, 0, time.UTC)},
+		{"202602131930 +0100", time.Date(2026, 2, 13, 18, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := epg.ParseTime(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.True(t, tt.want.Equal(got), "%s: got %s", tt.in, got)
+	}
+
+	_, err := epg.ParseTime("2026-02-13T19:00:00Z")
+	assert.Error(t, err)
+}
+
+func TestXMLTVEntries(t *testing.T) {
+	doc, err := epg.Parse(strings.NewReader(sampleXMLTV))
+	require.NoError(t, err)
+
+	entries, skipped := doc.Entries()
+	require.Len(t, entries, 3)
+
+	nba := entries[0]
+	assert.Equal(t, "ESPN", nba.Channel)
+	assert.True(t, time.Date(2026, 2, 14, 0, 0, 0, 0, time.UTC).Equal(nba.StartTime))
+	assert.True(t, time.Date(2026, 2, 14, 3, 30, 0, 0, time.UTC).Equal(nba.EndTime))
+	assert.Equal(t, "NBA", nba.Metadata.League)
+	assert.Equal(t, "Basketball", nba.Metadata.Sport)
+	assert.Equal(t, "Warriors at Lakers", nba.Metadata.Title)
+	assert.Equal(t, "Regular season matchup.", nba.Metadata.Description)
+
+	nhl := entries[1]
+	assert.Equal(t, "TSN1", nhl.Channel)
+	assert.Equal(t, "NHL", nhl.Metadata.League)
+	assert.Equal(t, "Hockey", nhl.Metadata.Sport)
+	assert.True(t, nhl.EndTime.IsZero(), "end time is left for the scheduler to derive from the league")
+
+	soccer := entries[2]
+	assert.Equal(t, "fox.us", soccer.Channel, "channels without a display name keep their id")
+	assert.Equal(t, "EPL", soccer.Metadata.League)
+	assert.Equal(t, "Soccer", soccer.Metadata.Sport)
+	assert.Equal(t, "Matchweek 25", soccer.Metadata.Tags["sub_title"])
+
+	reasons := make(map[string]string, len(skipped))
+	for _, s := range skipped {
+		reasons[s.Title] = s.Reason
+	}
+	assert.Len(t, skipped, 4)
+	assert.Contains(t, reasons["Broken Start"], "invalid start time")
+	assert.Equal(t, "stop time is not after start time", reasons["Backwards"])
+	assert.Equal(t, "missing stop time", reasons["SportsCenter"])
+	assert.Equal(t, "missing channel", reasons["No Channel"])
+}
+
+func TestParseXMLTVMalformed(t *testing.T) {
+	_, err := epg.Parse(strings.NewReader(`<tv><programme start="x"`))
+	assert.Error(t, err)
+}
+
+// setupImportRouter returns a router whose scheduler clock is set before the
+// programmes in sampleXMLTV.
+func setupImportRouter() (*gin.Engine, *scheduler.Scheduler) {
+	gin.SetMode(gin.TestMode)
+	sched := scheduler.NewWithClock(newMockClock())
+	router := gin.New()
+	handlers.New(sched, coordinator.New(), recorder.New()).RegisterRoutes(router.Group("/api/v1"))
+	return router, sched
+}
+
+func TestImportEvents_XMLBody(t *testing.T) {
+	router, sched := setupImportRouter()
+
+	req := httptest.NewRequest("POST", "/api/v1/events/import", strings.NewReader(sampleXMLTV))
+	req.Header.Set("Content-Type", "application/xml")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Created []string      `json:"created"`
+		Skipped []epg.Skipped `json:"skipped"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Created, 3)
+	assert.Len(t, resp.Skipped, 4)
+
+	for _, id := range resp.Created {
+		evt, err := sched.GetEvent(id)
+		require.NoError(t, err)
+		assert.Equal(t, scheduler.StateScheduled, evt.State)
+		if evt.Metadata.League == "NHL" {
+			assert.Equal(t, scheduler.LeagueDuration("NHL"), evt.EndTime.Sub(evt.StartTime))
+		}
+	}
+}
+
+func TestImportEvents_URL(t *testing.T) {
+	guide := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(sampleXMLTV))
+	}))
+	defer guide.Close()
+
+	router, _ := setupImportRouter()
+
+	body, _ := json.Marshal(map[string]string{"url": guide.URL + "/guide.xml"})
+	req := httptest.NewRequest("POST", "/api/v1/events/import", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Created []string `json:"created"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Created, 3)
+}
+
+func TestImportEvents_PastProgrammesSkipped(t *testing.T) {
+	router, sched, _, _ := setupTestRouter()
+
+	w := postXMLTV(router, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Created []string      `json:"created"`
+		Skipped []epg.Skipped `json:"skipped"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Empty(t, resp.Created)
+	require.Len(t, resp.Skipped, 7)
+	assert.Equal(t, epg.Skipped{Index: 0, Channel: "ESPN", Title: "Warriors at Lakers", Reason: "start in the past"}, resp.Skipped[0])
+	assert.Empty(t, sched.ListEvents())
+}
+
+func TestImportEvents_BadInput(t *testing.T) {
+	router, sched, _, _ := setupTestRouter()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"malformed xml", "text/xml", "<tv><programme"},
+		{"missing url", "application/json", "{}"},
+		{"non-http url", "application/json", `{"url":"file:///etc/passwd"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/events/import", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+	assert.Empty(t, sched.ListEvents())
+}
+
+func postXMLTV(router http.Handler, correlationID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/v1/events/import", strings.NewReader(sampleXMLTV))
+	req.Header.Set("Content-Type", "application/xml")
+	if correlationID != "" {
+		req.Header.Set(trace.Header, correlationID)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestImportEvents_CorrelationIDAndCatalog(t *testing.T) {
+	router, mock := setupChannelRouter(t, true)
+	mock.ExpectQuery(regexp.QuoteMeta(channelByCallSign)).WithArgs("ESPN").
+		WillReturnRows(channelRows().AddRow("ch-1", "ESPN", "206", "ESPN", "", []byte(`[]`), channelCreatedAt))
+	mock.ExpectQuery(regexp.QuoteMeta(channelByCallSign)).WithArgs("TSN1").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(regexp.QuoteMeta(channelByCallSign)).WithArgs("fox.us").
+		WillReturnRows(channelRows().AddRow("ch-2", "fox.us", "", "FOX", "", []byte(`[]`), channelCreatedAt))
+
+	w := postXMLTV(router, "guide-sync-42")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "guide-sync-42", w.Header().Get(trace.Header))
+
+	var resp struct {
+		Created []string      `json:"created"`
+		Skipped []epg.Skipped `json:"skipped"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Created, 2)
+	require.Len(t, resp.Skipped, 5)
+	assert.Equal(t, epg.Skipped{Index: 1, Channel: "TSN1", Title: "Maple Leafs at Canadiens", Reason: "unknown channel"}, resp.Skipped[0])
+
+	for _, id := range resp.Created {
+		w := getPath(router, "/api/v1/events/"+id)
+		require.Equal(t, http.StatusOK, w.Code)
+		var evt scheduler.Event
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &evt))
+		assert.Equal(t, "guide-sync-42", evt.CorrelationID)
+	}
+}
+
+func TestImportEvents_CatalogLookupFailure(t *testing.T) {
+	router, mock := setupChannelRouter(t, true)
+	mock.ExpectQuery(regexp.QuoteMeta(channelByCallSign)).WithArgs("ESPN").WillReturnError(errors.New("connection reset"))
+
+	w := postXMLTV(router, "")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	w = getPath(router, "/api/v1/events")
+	assert.JSONEq(t, `[]`, w.Body.String(), "nothing is created when the catalog cannot be checked")
+}
@@ -0,0 +1,290 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"antserver/internal/archive"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tsHeader returns two MPEG-TS packets worth of bytes with valid sync bytes.
+func tsHeader() []byte {
+	buf := make([]byte, 2*188)
+	buf[0] = 0x47
+	buf[188] = 0x47
+	return buf
+}
+
+// fmp4Header returns the start of an fMP4 init segment (ftyp box).
+func fmp4Header(box string) []byte {
+	return append([]byte{0x00, 0x00, 0x00, 0x18}, []byte(box+"iso6")...)
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	f, err := recorder.ParseOutputFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, recorder.FormatMPEGTS, f)
+
+	f, err = recorder.ParseOutputFormat("fmp4")
+	require.NoError(t, err)
+	assert.Equal(t, recorder.FormatFMP4, f)
+
+	_, err = recorder.ParseOutputFormat("mkv")
+	assert.Error(t, err)
+}
+
+func TestStartRecording_DefaultFormat(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+	assert.Equal(t, recorder.FormatMPEGTS, rec.Format)
+
+	r = recorder.NewWithFormat(recorder.FormatFMP4)
+	rec = r.StartRecording("event-001", "srt://ESPN:9000")
+	assert.Equal(t, recorder.FormatFMP4, rec.Format)
+
+	rec = r.StartRecordingWithFormat("event-002", "srt://ESPN:9000", recorder.FormatMPEGTS)
+	assert.Equal(t, recorder.FormatMPEGTS, rec.Format)
+}
+
+func TestAppendSegment_NamingByFormat(t *testing.T) {
+	r := recorder.New()
+	ts := r.StartRecordingWithFormat("event-001", "srt://ESPN:9000", recorder.FormatMPEGTS)
+	mp4 := r.StartRecordingWithFormat("event-002", "srt://ESPN:9000", recorder.FormatFMP4)
+
+	seg, err := r.AppendSegment(ts.ID, 6*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "segment_00000.ts", seg.Name)
+
+	seg, err = r.AppendSegment(mp4.ID, 6*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "segment_00000.m4s", seg.Name)
+}
+
+func TestPlaylist_MPEGTS(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecordingWithFormat("event-001", "srt://ESPN:9000", recorder.FormatMPEGTS)
+	_, _ = r.AppendSegment(rec.ID, 6*time.Second)
+	_, _ = r.AppendSegment(rec.ID, 5500*time.Millisecond)
+
+	pl, err := r.Playlist(rec.ID)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(pl, "#EXTM3U\n"))
+	assert.Contains(t, pl, "#EXT-X-VERSION:3\n")
+	assert.Contains(t, pl, "#EXT-X-TARGETDURATION:6\n")
+	assert.NotContains(t, pl, "#EXT-X-MAP")
+	assert.Contains(t, pl, "#EXTINF:6.000,\nsegment_00000.ts\n")
+	assert.Contains(t, pl, "#EXTINF:5.500,\nsegment_00001.ts\n")
+	assert.NotContains(t, pl, "#EXT-X-ENDLIST", "active recording playlist must stay open")
+}
+
+func TestPlaylist_FMP4EmitsMap(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecordingWithFormat("event-001", "srt://ESPN:9000", recorder.FormatFMP4)
+	_, _ = r.AppendSegment(rec.ID, 4*time.Second)
+
+	pl, err := r.Playlist(rec.ID)
+	require.NoError(t, err)
+
+	assert.Contains(t, pl, "#EXT-X-VERSION:7\n")
+	assert.Contains(t, pl, "#EXT-X-MAP:URI=\"init.mp4\"\n")
+	mapIdx := strings.Index(pl, "#EXT-X-MAP")
+	segIdx := strings.Index(pl, "segment_00000.m4s")
+	assert.Less(t, mapIdx, segIdx, "EXT-X-MAP must precede the first segment")
+}
+
+func TestPlaylist_EndListAfterStop(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+	_, _ = r.AppendSegment(rec.ID, 6*time.Second)
+	require.NoError(t, r.StopRecording(rec.ID))
+
+	pl, err := r.Playlist(rec.ID)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(pl, "#EXT-X-ENDLIST\n"))
+}
+
+func TestPlaylist_DiscontinuityAfterGap(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+	_, _ = r.AppendSegment(rec.ID, 6*time.Second)
+
+	now := time.Now()
+	require.NoError(t, r.BeginGap(rec.ID, now, recorder.GapReasonTransportFailed))
+	require.NoError(t, r.ResumeSegment(rec.ID, now.Add(15*time.Second)))
+	seg, err := r.AppendSegment(rec.ID, 6*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 4, seg.Sequence)
+
+	// The 15s gap is covered by placeholders no longer than the segment
+	// before it, and the resumed capture starts with a discontinuity.
+	pl, err := r.Playlist(rec.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(pl, "#EXT-X-GAP\n"))
+	assert.Contains(t, pl, "segment_00000.ts\n#EXT-X-GAP\n#EXTINF:6.000,\nsegment_00001.ts\n")
+	assert.Contains(t, pl, "#EXT-X-GAP\n#EXTINF:3.000,\nsegment_00003.ts\n#EXT-X-DISCONTINUITY\n#EXTINF:6.000,\nsegment_00004.ts\n")
+	assert.Equal(t, 1, strings.Count(pl, "#EXT-X-DISCONTINUITY\n"))
+	assert.Contains(t, pl, "#EXT-X-TARGETDURATION:6\n")
+}
+
+func TestFinalizeRecording_StoragePathByFormat(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecordingWithFormat("event-001", "srt://ESPN:9000", recorder.FormatFMP4)
+	require.NoError(t, r.StopRecording(rec.ID))
+	require.NoError(t, r.FinalizeRecording(rec.ID))
+
+	assert.True(t, strings.HasSuffix(rec.StoragePath, ".mp4"))
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   recorder.OutputFormat
+		ok     bool
+	}{
+		{"mpegts two packets", tsHeader(), recorder.FormatMPEGTS, true},
+		{"mpegts single byte", []byte{0x47}, recorder.FormatMPEGTS, true},
+		{"mpegts broken second sync", append([]byte{0x47}, make([]byte, 200)...), "", false},
+		{"fmp4 init segment", fmp4Header("ftyp"), recorder.FormatFMP4, true},
+		{"fmp4 media segment", fmp4Header("styp"), recorder.FormatFMP4, true},
+		{"fmp4 fragment", fmp4Header("moof"), recorder.FormatFMP4, true},
+		{"garbage", []byte("not a video"), "", false},
+		{"empty", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := recorder.DetectFormat(tt.header)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateFirstSegment_Match(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecordingWithFormat("event-001", "srt://ESPN:9000", recorder.FormatFMP4)
+
+	require.NoError(t, r.ValidateFirstSegment(rec.ID, fmp4Header("ftyp")))
+
+	status, err := r.GetRecordingStatus(rec.ID)
+	require.NoError(t, err)
+	assert.False(t, status.FormatMismatch)
+	assert.Equal(t, recorder.FormatFMP4, status.DetectedFormat)
+}
+
+func TestValidateFirstSegment_Mismatch(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecordingWithFormat("event-001", "srt://ESPN:9000", recorder.FormatFMP4)
+
+	err := r.ValidateFirstSegment(rec.ID, tsHeader())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mpegts")
+
+	status, err := r.GetRecordingStatus(rec.ID)
+	require.NoError(t, err)
+	assert.True(t, status.FormatMismatch)
+	assert.Equal(t, recorder.FormatMPEGTS, status.DetectedFormat)
+	assert.Equal(t, recorder.FormatFMP4, status.Format)
+}
+
+func TestValidateFirstSegment_Unrecognized(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+
+	assert.Error(t, r.ValidateFirstSegment(rec.ID, []byte("<html>")))
+
+	status, err := r.GetRecordingStatus(rec.ID)
+	require.NoError(t, err)
+	assert.True(t, status.FormatMismatch)
+}
+
+func TestPipeline_EncodeRequestCarriesFormat(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecordingWithFormat("event-001", "srt://ESPN:9000", recorder.FormatFMP4)
+
+	pipeline, _, _, enc, _, _, _, _ := newPipeline(t)
+	pipeline.SetFormatSource(r)
+
+	job, err := pipeline.Start(rec.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "fmp4", job.Format)
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+	require.Len(t, enc.reqs, 1)
+	assert.Equal(t, rec.ID, enc.reqs[0].RecordingID)
+	assert.Equal(t, "fmp4", enc.reqs[0].Format)
+}
+
+func TestPipeline_EncodeRequestDefaultsToMPEGTS(t *testing.T) {
+	pipeline, _, _, enc, _, _, _, _ := newPipeline(t)
+
+	_, err := pipeline.Start("rec-unknown")
+	require.NoError(t, err)
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+	require.Len(t, enc.reqs, 1)
+	assert.Equal(t, archive.DefaultRecordingFormat, enc.reqs[0].Format)
+}
+
+func TestStartEvent_WithFormatAndPlaylist(t *testing.T) {
+	router, sched, coord, rec := setupTestRouter()
+	_, err := coord.RegisterDevice("antbox-1", "Living Room", 1)
+	require.NoError(t, err)
+	evt := createEvent(t, sched, "ESPN", time.Now(), time.Now().Add(3*time.Hour), scheduler.EventMetadata{})
+	require.NoError(t, sched.Transition(evt.ID, scheduler.StateScheduled))
+
+	body, _ := json.Marshal(map[string]string{"format": "fmp4"})
+	req := httptest.NewRequest("PUT", "/api/v1/events/"+evt.ID+"/start", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Recording recorder.Recording `json:"recording"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, recorder.FormatFMP4, resp.Recording.Format)
+
+	_, err = rec.AppendSegment(resp.Recording.ID, 6*time.Second)
+	require.NoError(t, err)
+
+	req = httptest.NewRequest("GET", "/api/v1/recordings/"+resp.Recording.ID+"/playlist.m3u8", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/vnd.apple.mpegurl", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "#EXT-X-MAP:URI=\"init.mp4\"")
+	assert.Contains(t, w.Body.String(), "segment_00000.m4s")
+}
+
+func TestStartEvent_InvalidFormat(t *testing.T) {
+	router, sched, _, _ := setupTestRouter()
+	evt := createEvent(t, sched, "ESPN", time.Now(), time.Now().Add(3*time.Hour), scheduler.EventMetadata{})
+	require.NoError(t, sched.Transition(evt.ID, scheduler.StateScheduled))
+
+	body, _ := json.Marshal(map[string]string{"format": "mkv"})
+	req := httptest.NewRequest("PUT", "/api/v1/events/"+evt.ID+"/start", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	stored, err := sched.GetEvent(evt.ID)
+	require.NoError(t, err)
+	assert.Equal(t, scheduler.StateScheduled, stored.State, "event must not transition on invalid format")
+}
@@ -0,0 +1,467 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"antserver/internal/coordinator"
+	"antserver/internal/epg"
+	"antserver/internal/handlers"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// guideBefore and guideAfter are two revisions of the same guide: the Lakers
+// game slips an hour, the Bruins game moves four hours (beyond the max
+// shift), SportsCenter is unchanged, the Arsenal match is dropped and a
+// Red Sox game is added. The morning show ended before the refresh.
+const guideBefore = `<?xml version="1.0" encoding="UTF-8"?>
+<tv>
+  <channel id="espn.us"><display-name>ESPN</display-name></channel>
+  <programme start="20260213060000 +0000" stop="20260213080000 +0000" channel="espn.us">
+    <title>Morning Show</title>
+  </programme>
+  <programme start="20260214170000 +0000" stop="20260214180000 +0000" channel="espn.us">
+    <title>SportsCenter</title>
+  </programme>
+  <programme start="20260214190000 +0000" stop="20260214220000 +0000" channel="espn.us">
+    <title>Warriors at Lakers</title>
+    <category>NBA</category>
+  </programme>
+  <programme start="20260215000000 +0000" stop="20260215030000 +0000" channel="espn.us">
+    <title>Rangers at Bruins</title>
+    <category>NHL</category>
+  </programme>
+  <programme start="20260214150000 +0000" stop="20260214170000 +0000" channel="espn.us">
+    <title>Arsenal vs Chelsea</title>
+    <category>EPL</category>
+  </programme>
+</tv>`
+
+const guideAfter = `<?xml version="1.0" encoding="UTF-8"?>
+<tv>
+  <channel id="espn.us"><display-name>ESPN</display-name></channel>
+  <programme start="20260213060000 +0000" stop="20260213080000 +0000" channel="espn.us">
+    <title>Morning Show</title>
+  </programme>
+  <programme start="20260214170000 +0000" stop="20260214180000 +0000" channel="espn.us">
+    <title>SportsCenter</title>
+  </programme>
+  <programme start="20260214200000 +0000" stop="20260214230000 +0000" channel="espn.us">
+    <title>Warriors at Lakers</title>
+    <category>NBA</category>
+  </programme>
+  <programme start="20260215040000 +0000" stop="20260215070000 +0000" channel="espn.us">
+    <title>Rangers at Bruins</title>
+    <category>NHL</category>
+  </programme>
+  <programme start="20260214220000 +0000" stop="20260215020000 +0000" channel="espn.us">
+    <title>Yankees at Red Sox</title>
+    <category>MLB</category>
+  </programme>
+</tv>`
+
+// guideUpstream serves the current guide revision with an ETag and honours
+// If-None-Match.
+type guideUpstream struct {
+	mu       sync.Mutex
+	body     string
+	etag     string
+	status   int
+	requests []http.Header
+}
+
+func (u *guideUpstream) set(body, etag string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.body, u.etag, u.status = body, etag, 0
+}
+
+func (u *guideUpstream) fail(status int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.status = status
+}
+
+func (u *guideUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests = append(u.requests, r.Header.Clone())
+
+	if u.status != 0 {
+		w.WriteHeader(u.status)
+		return
+	}
+	if u.etag != "" && r.Header.Get("If-None-Match") == u.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", u.etag)
+	w.Header().Set("Last-Modified", "Fri, 13 Feb 2026 11:00:00 GMT")
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(u.body))
+}
+
+func newGuideRefresher(t *testing.T, sched *scheduler.Scheduler) (*epg.Refresher, *guideUpstream, *syncClock) {
+	t.Helper()
+	upstream := &guideUpstream{}
+	upstream.set(guideBefore, `"v1"`)
+	srv := httptest.NewServer(upstream)
+	t.Cleanup(srv.Close)
+
+	cfg := epg.DefaultRefreshConfig(srv.URL + "/guide.xml")
+	cfg.Client = srv.Client()
+	r, err := epg.NewRefresher(cfg, sched)
+	require.NoError(t, err)
+
+	clock := &syncClock{now: time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC)}
+	r.SetTestNow(clock.Now)
+	return r, upstream, clock
+}
+
+func parseEntries(t *testing.T, xmltv string) []epg.Entry {
+	t.Helper()
+	doc, err := epg.Parse(strings.NewReader(xmltv))
+	require.NoError(t, err)
+	entries, skipped := doc.Entries()
+	require.Empty(t, skipped)
+	return entries
+}
+
+func titles(entries []epg.Entry) []string {
+	result := make([]string, len(entries))
+	for i, e := range entries {
+		result[i] = e.Metadata.Title
+	}
+	return result
+}
+
+// scheduleProgrammes creates scheduled events for the named programmes of an
+// XMLTV guide, as an import of those programmes would.
+func scheduleProgrammes(t *testing.T, sched *scheduler.Scheduler, xmltv string, names ...string) {
+	t.Helper()
+	for _, e := range parseEntries(t, xmltv) {
+		for _, name := range names {
+			if e.Metadata.Title != name {
+				continue
+			}
+			evt := createEvent(t, sched, e.Channel, e.StartTime, e.EndTime, e.Metadata)
+			require.NoError(t, sched.Transition(evt.ID, scheduler.StateScheduled))
+		}
+	}
+}
+
+func eventByTitle(t *testing.T, sched *scheduler.Scheduler, title string) *scheduler.Event {
+	t.Helper()
+	for _, evt := range sched.ListEvents() {
+		if evt.Metadata.Title == title {
+			return evt
+		}
+	}
+	t.Fatalf("no event titled %q", title)
+	return nil
+}
+
+func TestDiffEntries(t *testing.T) {
+	diff := epg.DiffEntries(parseEntries(t, guideBefore), parseEntries(t, guideAfter))
+
+	assert.Equal(t, []string{"Yankees at Red Sox"}, titles(diff.Added))
+	assert.Equal(t, []string{"Arsenal vs Chelsea"}, titles(diff.Removed))
+	require.Len(t, diff.Changed, 2)
+	assert.Equal(t, "Warriors at Lakers", diff.Changed[0].New.Metadata.Title)
+	assert.Equal(t, time.Hour, diff.Changed[0].Shift())
+	assert.Equal(t, "Rangers at Bruins", diff.Changed[1].New.Metadata.Title)
+	assert.Equal(t, 4*time.Hour, diff.Changed[1].Shift())
+
+	unchanged := epg.DiffEntries(parseEntries(t, guideBefore), parseEntries(t, guideBefore))
+	assert.Empty(t, unchanged.Added)
+	assert.Empty(t, unchanged.Changed)
+	assert.Empty(t, unchanged.Removed)
+}
+
+func TestDiffEntries_RepeatsPairByNearestStart(t *testing.T) {
+	show := func(day int, hour int) epg.Entry {
+		start := time.Date(2026, 2, day, hour, 0, 0, 0, time.UTC)
+		return epg.Entry{
+			Channel:   "ESPN",
+			StartTime: start,
+			EndTime:   start.Add(time.Hour),
+			Metadata:  scheduler.EventMetadata{Title: "NFL Live"},
+		}
+	}
+
+	// Monday's airing drops off, Tuesday's slips half an hour and next
+	// Monday's is new: a week apart is a different airing, not a shift.
+	old := []epg.Entry{show(9, 16), show(10, 16)}
+	next := []epg.Entry{show(10, 16), show(16, 16)}
+	next[0].StartTime = next[0].StartTime.Add(30 * time.Minute)
+
+	diff := epg.DiffEntries(old, next)
+	require.Len(t, diff.Changed, 1)
+	assert.Equal(t, old[1].StartTime, diff.Changed[0].Old.StartTime)
+	require.Len(t, diff.Added, 1)
+	assert.Equal(t, next[1].StartTime, diff.Added[0].StartTime)
+	require.Len(t, diff.Removed, 1)
+	assert.Equal(t, old[0].StartTime, diff.Removed[0].StartTime)
+}
+
+func TestGuideRefresher_AppliesChanges(t *testing.T) {
+	sched := scheduler.NewWithClock(newMockClock())
+	scheduleProgrammes(t, sched, guideBefore, "SportsCenter", "Warriors at Lakers", "Rangers at Bruins", "Arsenal vs Chelsea")
+	r, upstream, _ := newGuideRefresher(t, sched)
+
+	result, err := r.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, result.Diff.Added, 5)
+	assert.Empty(t, result.Adjusted)
+	assert.Empty(t, result.Flagged)
+	assert.Len(t, sched.ListEvents(), 4)
+	bruins := eventByTitle(t, sched, "Rangers at Bruins")
+
+	upstream.set(guideAfter, `"v2"`)
+	result, err = r.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, result.Diff.Changed, 2)
+	assert.Len(t, result.Diff.Added, 1)
+	assert.Len(t, result.Adjusted, 1)
+	assert.Len(t, result.Flagged, 2)
+	assert.Len(t, sched.ListEvents(), 4, "the refresher never creates events")
+
+	// Within the max shift the window follows the guide.
+	lakers := eventByTitle(t, sched, "Warriors at Lakers")
+	assert.Equal(t, time.Date(2026, 2, 14, 20, 0, 0, 0, time.UTC), lakers.StartTime.UTC())
+	assert.Equal(t, time.Date(2026, 2, 14, 23, 0, 0, 0, time.UTC), lakers.EndTime.UTC())
+	assert.Empty(t, lakers.ReviewReason)
+
+	// Beyond it the window is kept and the event flagged.
+	moved := eventByTitle(t, sched, "Rangers at Bruins")
+	assert.Equal(t, bruins.StartTime, moved.StartTime)
+	assert.Equal(t, epg.ReviewShiftTooLarge, moved.ReviewReason)
+
+	removed := eventByTitle(t, sched, "Arsenal vs Chelsea")
+	assert.Equal(t, epg.ReviewRemoved, removed.ReviewReason)
+	assert.Equal(t, scheduler.StateScheduled, removed.State, "removed programmes are flagged, not cancelled")
+
+	assert.Empty(t, eventByTitle(t, sched, "SportsCenter").ReviewReason)
+}
+
+func TestGuideRefresher_NoEventsWithoutSchedule(t *testing.T) {
+	sched := scheduler.NewWithClock(newMockClock())
+	r, upstream, _ := newGuideRefresher(t, sched)
+
+	result, err := r.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, result.Diff.Added, 5)
+	upstream.set(guideAfter, `"v2"`)
+	result, err = r.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, result.Diff.Changed, 2)
+	assert.Empty(t, result.Adjusted)
+	assert.Empty(t, result.Flagged)
+	assert.Empty(t, sched.ListEvents(), "guide programmes are only recorded once scheduled")
+}
+
+func TestGuideRefresher_LinksEventsScheduledLater(t *testing.T) {
+	sched := scheduler.NewWithClock(newMockClock())
+	r, upstream, _ := newGuideRefresher(t, sched)
+	_, err := r.Refresh(context.Background())
+	require.NoError(t, err)
+
+	// Scheduled from the first revision after it was pulled, and the Red
+	// Sox game at a time the guide later corrects.
+	scheduleProgrammes(t, sched, guideBefore, "Warriors at Lakers")
+	redSox := createEvent(t, sched, "ESPN", time.Date(2026, 2, 14, 21, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 15, 1, 0, 0, 0, time.UTC), scheduler.EventMetadata{Title: "Yankees at Red Sox", League: "MLB"})
+
+	upstream.set(guideAfter, `"v2"`)
+	result, err := r.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, result.Adjusted, 2)
+	assert.Empty(t, result.Flagged)
+
+	lakers := eventByTitle(t, sched, "Warriors at Lakers")
+	assert.Equal(t, time.Date(2026, 2, 14, 20, 0, 0, 0, time.UTC), lakers.StartTime.UTC())
+	evt, err := sched.GetEvent(redSox.ID)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 2, 14, 22, 0, 0, 0, time.UTC), evt.StartTime.UTC())
+	assert.Equal(t, time.Date(2026, 2, 15, 2, 0, 0, 0, time.UTC), evt.EndTime.UTC())
+}
+
+func TestGuideRefresher_EntriesWithoutEndTime(t *testing.T) {
+	// Neither revision gives a stop time, so the game lasts its league's
+	// duration. The event was scheduled by hand without a league and must
+	// still get an end time when the guide moves it.
+	const before = `<?xml version="1.0" encoding="UTF-8"?>
+<tv>
+  <channel id="espn.us"><display-name>ESPN</display-name></channel>
+  <programme start="20260214170000 +0000" channel="espn.us"><title>Warriors at Lakers</title><category>NBA</category></programme>
+</tv>`
+	const after = `<?xml version="1.0" encoding="UTF-8"?>
+<tv>
+  <channel id="espn.us"><display-name>ESPN</display-name></channel>
+  <programme start="20260214180000 +0000" channel="espn.us"><title>Warriors at Lakers</title><category>NBA</category></programme>
+</tv>`
+
+	sched := scheduler.NewWithClock(newMockClock())
+	start := time.Date(2026, 2, 14, 17, 0, 0, 0, time.UTC)
+	evt := createEvent(t, sched, "ESPN", start, start.Add(3*time.Hour), scheduler.EventMetadata{Title: "Warriors at Lakers"})
+	require.NoError(t, sched.Transition(evt.ID, scheduler.StateScheduled))
+
+	r, upstream, _ := newGuideRefresher(t, sched)
+	upstream.set(before, `"v1"`)
+	_, err := r.Refresh(context.Background())
+	require.NoError(t, err)
+
+	upstream.set(after, `"v2"`)
+	result, err := r.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{evt.ID}, result.Adjusted)
+	assert.Empty(t, result.Flagged)
+
+	moved, err := sched.GetEvent(evt.ID)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 2, 14, 18, 0, 0, 0, time.UTC), moved.StartTime.UTC())
+	assert.Equal(t, time.Date(2026, 2, 14, 21, 0, 0, 0, time.UTC), moved.EndTime.UTC())
+}
+
+func TestGuideRefresher_StartedEventFlagged(t *testing.T) {
+	sched := scheduler.NewWithClock(newMockClock())
+	scheduleProgrammes(t, sched, guideBefore, "Warriors at Lakers")
+	r, upstream, _ := newGuideRefresher(t, sched)
+	_, err := r.Refresh(context.Background())
+	require.NoError(t, err)
+
+	lakers := eventByTitle(t, sched, "Warriors at Lakers")
+	require.NoError(t, sched.Transition(lakers.ID, scheduler.StateActive))
+
+	upstream.set(guideAfter, `"v2"`)
+	_, err = r.Refresh(context.Background())
+	require.NoError(t, err)
+
+	evt, err := sched.GetEvent(lakers.ID)
+	require.NoError(t, err)
+	assert.Equal(t, lakers.StartTime, evt.StartTime)
+	assert.Equal(t, epg.ReviewStartedShift, evt.ReviewReason)
+}
+
+func TestGuideRefresher_ConditionalRequests(t *testing.T) {
+	sched := scheduler.NewWithClock(newMockClock())
+	r, upstream, _ := newGuideRefresher(t, sched)
+
+	_, err := r.Refresh(context.Background())
+	require.NoError(t, err)
+	result, err := r.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.True(t, result.NotModified)
+	assert.Empty(t, sched.ListEvents(), "the refresher creates nothing")
+
+	upstream.mu.Lock()
+	require.Len(t, upstream.requests, 2)
+	assert.Empty(t, upstream.requests[0].Get("If-None-Match"))
+	assert.Equal(t, `"v1"`, upstream.requests[1].Get("If-None-Match"))
+	assert.Equal(t, "Fri, 13 Feb 2026 11:00:00 GMT", upstream.requests[1].Get("If-Modified-Since"))
+	upstream.mu.Unlock()
+
+	st := r.Status()
+	assert.Equal(t, 5, st.Entries)
+	assert.False(t, st.LastSuccess.IsZero())
+}
+
+func TestGuideRefresher_RetryBackoffAndStaleness(t *testing.T) {
+	sched := scheduler.NewWithClock(newMockClock())
+	r, upstream, clock := newGuideRefresher(t, sched)
+	assert.Equal(t, epg.DefaultRefreshInterval, r.NextDelay())
+
+	upstream.fail(http.StatusBadGateway)
+	for _, want := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute} {
+		_, err := r.Refresh(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, want, r.NextDelay())
+	}
+	for i := 0; i < 10; i++ {
+		r.Refresh(context.Background())
+	}
+	assert.Equal(t, epg.DefaultRefreshInterval, r.NextDelay(), "capped at the interval")
+
+	st := r.Status()
+	assert.Equal(t, 13, st.ConsecutiveFailures)
+	assert.Contains(t, st.LastError, "502")
+	assert.False(t, st.Stale)
+
+	clock.Advance(epg.DefaultStaleAfter + time.Second)
+	assert.True(t, r.Status().Stale)
+
+	upstream.set(guideBefore, `"v1"`)
+	_, err := r.Refresh(context.Background())
+	require.NoError(t, err)
+	st = r.Status()
+	assert.False(t, st.Stale)
+	assert.Zero(t, st.ConsecutiveFailures)
+	assert.Empty(t, st.LastError)
+	assert.Equal(t, epg.DefaultRefreshInterval, r.NextDelay())
+}
+
+func TestNewRefresher_InvalidConfig(t *testing.T) {
+	_, err := epg.NewRefresher(epg.DefaultRefreshConfig("ftp://guide.example/xmltv"), scheduler.New())
+	assert.ErrorIs(t, err, epg.ErrInvalidRefreshConfig)
+
+	cfg := epg.DefaultRefreshConfig("https://guide.example/xmltv")
+	cfg.Interval = 0
+	_, err = epg.NewRefresher(cfg, scheduler.New())
+	assert.ErrorIs(t, err, epg.ErrInvalidRefreshConfig)
+}
+
+func TestHealth_GuideStaleness(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sched := scheduler.New()
+	r, upstream, clock := newGuideRefresher(t, sched)
+
+	h := handlers.New(sched, coordinator.New(), recorder.New())
+	h.Guide = r
+	router := gin.New()
+	h.RegisterHealthRoutes(router)
+
+	get := func() handlers.HealthResponse {
+		req := httptest.NewRequest("GET", "/health", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp handlers.HealthResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	_, err := r.Refresh(context.Background())
+	require.NoError(t, err)
+	resp := get()
+	assert.Equal(t, "ok", resp.Status)
+	require.NotNil(t, resp.Guide)
+	assert.Equal(t, 5, resp.Guide.Entries)
+
+	upstream.fail(http.StatusInternalServerError)
+	clock.Advance(epg.DefaultStaleAfter + time.Minute)
+	r.Refresh(context.Background())
+
+	resp = get()
+	assert.Equal(t, "degraded", resp.Status)
+	assert.True(t, resp.Guide.Stale)
+	assert.Equal(t, 1, resp.Guide.ConsecutiveFailures)
+
+	// Without a refresher there is nothing to report.
+	h = handlers.New(sched, coordinator.New(), recorder.New())
+	router = gin.New()
+	h.RegisterHealthRoutes(router)
+	resp = get()
+	assert.Equal(t, "ok", resp.Status)
+	assert.Nil(t, resp.Guide)
+}
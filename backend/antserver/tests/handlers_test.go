@@ -123,6 +123,61 @@ func TestCreateEvent_InvalidEndTime(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestCreateEvent_TimeValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clock := newMockClock()
+	now := clock.Now()
+
+	router := gin.New()
+	h := handlers.New(scheduler.NewWithClock(clock), coordinator.New(), recorder.New())
+	h.RegisterRoutes(router.Group("/api/v1"))
+
+	tests := []struct {
+		name   string
+		start  time.Time
+		end    time.Time
+		league string
+		code   int
+		field  string
+		reason string
+	}{
+		{name: "valid", start: now.Add(time.Hour), end: now.Add(2 * time.Hour), code: http.StatusCreated},
+		{name: "league end time", start: now.Add(time.Hour), league: "NBA", code: http.StatusCreated},
+		{name: "zero start", start: time.Time{}, code: http.StatusBadRequest, field: "start_time", reason: "zero start time"},
+		{name: "end before start", start: now.Add(2 * time.Hour), end: now.Add(time.Hour), code: http.StatusBadRequest, field: "end_time", reason: "end before start"},
+		{name: "start in past", start: now.Add(-time.Hour), code: http.StatusBadRequest, field: "start_time", reason: "start in the past"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := map[string]interface{}{
+				"channel":    "ESPN",
+				"start_time": tt.start.Format(time.RFC3339),
+				"metadata":   map[string]string{"league": tt.league},
+			}
+			if !tt.end.IsZero() {
+				body["end_time"] = tt.end.Format(time.RFC3339)
+			}
+			jsonBody, _ := json.Marshal(body)
+
+			req := httptest.NewRequest("POST", "/api/v1/events", bytes.NewReader(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tt.code, w.Code, w.Body.String())
+			if tt.code != http.StatusBadRequest {
+				return
+			}
+			var resp handlers.ValidationErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.field, resp.Field)
+			assert.Equal(t, tt.reason, resp.Reason)
+			assert.NotEmpty(t, resp.Error)
+		})
+	}
+}
+
 func TestCreateEvent_InvalidJSON(t *testing.T) {
 	router, _, _, _ := setupTestRouter()
 
@@ -154,8 +209,8 @@ func TestListEvents_Empty(t *testing.T) {
 func TestListEvents_WithEvents(t *testing.T) {
 	router, sched, _, _ := setupTestRouter()
 
-	sched.CreateEvent("ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
-	sched.CreateEvent("FOX", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	createEvent(t, sched, "ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	createEvent(t, sched, "FOX", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 
 	req := httptest.NewRequest("GET", "/api/v1/events", nil)
 	w := httptest.NewRecorder()
@@ -174,7 +229,7 @@ func TestListEvents_WithEvents(t *testing.T) {
 func TestGetEvent_Success(t *testing.T) {
 	router, sched, _, _ := setupTestRouter()
 
-	evt := sched.CreateEvent("ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{
+	evt := createEvent(t, sched, "ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{
 		Title: "Test Game",
 	})
 
@@ -204,9 +259,11 @@ func TestGetEvent_NotFound(t *testing.T) {
 // --- Start Event Tests ---
 
 func TestStartEvent_Success(t *testing.T) {
-	router, sched, _, _ := setupTestRouter()
+	router, sched, coord, _ := setupTestRouter()
+	_, err := coord.RegisterDevice("antbox-1", "Living Room", 1)
+	require.NoError(t, err)
 
-	evt := sched.CreateEvent("ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, sched, "ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 	require.NoError(t, sched.Transition(evt.ID, scheduler.StateScheduled))
 
 	req := httptest.NewRequest("PUT", "/api/v1/events/"+evt.ID+"/start", nil)
@@ -216,17 +273,66 @@ func TestStartEvent_Success(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	var resp map[string]interface{}
-	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
 	require.NoError(t, err)
 	assert.Contains(t, resp, "event")
 	assert.Contains(t, resp, "recording")
+	assert.Contains(t, resp, "tuner")
+}
+
+func TestStartEvent_AssignsTunerForChannel(t *testing.T) {
+	router, sched, coord, _ := setupTestRouter()
+	_, err := coord.RegisterDevice("antbox-1", "Living Room", 1)
+	require.NoError(t, err)
+	_, err = coord.RegisterDevice("antbox-2", "Den", 1)
+	require.NoError(t, err)
+	require.NoError(t, coord.SetDeviceChannels("antbox-1", []string{"CBS"}))
+	require.NoError(t, coord.SetDeviceChannels("antbox-2", []string{"ESPN-HD"}))
+	coord.RelateChannels("ESPN", "ESPN-HD")
+
+	evt := createEvent(t, sched, "ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	require.NoError(t, sched.Transition(evt.ID, scheduler.StateScheduled))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/api/v1/events/"+evt.ID+"/start", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Recording recorder.Recording     `json:"recording"`
+		Tuner     coordinator.Allocation `json:"tuner"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "antbox-2", resp.Tuner.DeviceID)
+	assert.Equal(t, "ESPN-HD", resp.Tuner.Channel, "the related channel the device carries")
+	assert.Equal(t, "srt://ESPN-HD:9000", resp.Recording.StreamURL)
+
+	stored, err := sched.GetEvent(evt.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "antbox-2", stored.DeviceID)
+	assert.Len(t, coord.GetAvailableTuners(), 1)
+
+	// Stopping the event frees its tuner.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/api/v1/events/"+evt.ID+"/stop", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Len(t, coord.GetAvailableTuners(), 2)
+
+	// Without a tuner that carries the channel the event fails.
+	other := createEvent(t, sched, "NBC", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	require.NoError(t, sched.Transition(other.ID, scheduler.StateScheduled))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/api/v1/events/"+other.ID+"/start", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	stored, err = sched.GetEvent(other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, scheduler.StateFailed, stored.State)
 }
 
 func TestStartEvent_InvalidState(t *testing.T) {
 	router, sched, _, _ := setupTestRouter()
 
 	// Event is in pending state (not scheduled), so transitioning to active should fail.
-	evt := sched.CreateEvent("ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, sched, "ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 
 	req := httptest.NewRequest("PUT", "/api/v1/events/"+evt.ID+"/start", nil)
 	w := httptest.NewRecorder()
@@ -250,7 +356,7 @@ func TestStartEvent_NotFound(t *testing.T) {
 func TestStopEvent_Success(t *testing.T) {
 	router, sched, _, _ := setupTestRouter()
 
-	evt := sched.CreateEvent("ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, sched, "ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 	require.NoError(t, sched.Transition(evt.ID, scheduler.StateScheduled))
 	require.NoError(t, sched.Transition(evt.ID, scheduler.StateActive))
 	require.NoError(t, sched.Transition(evt.ID, scheduler.StateRecording))
@@ -270,7 +376,7 @@ func TestStopEvent_Success(t *testing.T) {
 func TestStopEvent_NotRecording(t *testing.T) {
 	router, sched, _, _ := setupTestRouter()
 
-	evt := sched.CreateEvent("ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, sched, "ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 	require.NoError(t, sched.Transition(evt.ID, scheduler.StateScheduled))
 
 	req := httptest.NewRequest("PUT", "/api/v1/events/"+evt.ID+"/stop", nil)
@@ -429,3 +535,47 @@ func TestSendDeviceCommand_InvalidJSON(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+// --- Tuner failover ---
+
+func TestFailoverTuner_MovesEvent(t *testing.T) {
+	router, sched, coord, _ := setupTestRouter()
+
+	_, err := coord.RegisterDevice("box-a", "Den", 1)
+	require.NoError(t, err)
+	_, err = coord.RegisterDevice("box-b", "Basement", 1)
+	require.NoError(t, err)
+
+	body, _ := json.Marshal(map[string][]string{"channels": {"ESPN"}})
+	for _, id := range []string{"box-a", "box-b"} {
+		req := httptest.NewRequest("PUT", "/api/v1/devices/"+id+"/channels", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	evt := createEvent(t, sched, "ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	alloc, err := coord.AssignTunerForChannel(evt.ID, evt.Channel)
+	require.NoError(t, err)
+	require.NoError(t, sched.AssignDevice(evt.ID, alloc.DeviceID, alloc.TunerIndex))
+
+	req := httptest.NewRequest("POST", "/api/v1/devices/"+alloc.DeviceID+"/tuners/0/failover", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var moved coordinator.Allocation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &moved))
+	assert.NotEqual(t, alloc.DeviceID, moved.DeviceID)
+
+	got, err := sched.GetEvent(evt.ID)
+	require.NoError(t, err)
+	assert.Equal(t, moved.DeviceID, got.DeviceID)
+
+	// Nothing is left to fail over to.
+	req = httptest.NewRequest("POST", "/api/v1/devices/"+moved.DeviceID+"/tuners/0/failover", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+
+	"antserver/internal/archive"
+	"antserver/internal/coordinator"
+	"antserver/internal/handlers"
+	"antserver/internal/highlights"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockHighlightDetector struct {
+	mu      sync.Mutex
+	markers []highlights.Marker
+	err     error
+	ids     []string
+}
+
+func (m *mockHighlightDetector) DetectHighlights(recordingID string) ([]highlights.Marker, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ids = append(m.ids, recordingID)
+	return m.markers, m.err
+}
+
+func score(atMs int64, label string) highlights.Marker {
+	return highlights.Marker{AtMs: atMs, Kind: highlights.KindScoreChange, Label: label, Confidence: 0.9}
+}
+
+func scene(atMs int64, confidence float64) highlights.Marker {
+	return highlights.Marker{AtMs: atMs, Kind: highlights.KindSceneChange, Confidence: confidence}
+}
+
+func TestNormalizeHighlights(t *testing.T) {
+	tests := []struct {
+		name    string
+		markers []highlights.Marker
+		want    []highlights.Marker
+	}{
+		{name: "empty"},
+		{
+			name:    "ordered by time",
+			markers: []highlights.Marker{score(900000, "14-7"), score(300000, "7-0")},
+			want:    []highlights.Marker{score(300000, "7-0"), score(900000, "14-7")},
+		},
+		{
+			name:    "negative offsets dropped",
+			markers: []highlights.Marker{scene(-1000, 0.9), score(300000, "7-0")},
+			want:    []highlights.Marker{score(300000, "7-0")},
+		},
+		{
+			name:    "burst keeps the most confident",
+			markers: []highlights.Marker{scene(300000, 0.6), scene(304000, 0.95), scene(306000, 0.7)},
+			want:    []highlights.Marker{scene(304000, 0.95)},
+		},
+		{
+			name:    "score change wins a tie",
+			markers: []highlights.Marker{scene(300000, 0.9), score(302000, "7-0")},
+			want:    []highlights.Marker{score(302000, "7-0")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, highlights.Normalize(tt.markers))
+		})
+	}
+}
+
+func TestPipeline_HighlightsSavedWithRecording(t *testing.T) {
+	pipeline, _, d, _, _, _, _, _ := newPipeline(t)
+	rec := recorder.New()
+	recording := rec.StartRecording("event-001", "srt://ESPN:9000")
+	detector := &mockHighlightDetector{markers: []highlights.Marker{
+		score(1800000, "14-7"),
+		score(420000, "7-0"),
+		scene(423000, 0.5),
+	}}
+	pipeline.SetHighlightDetector(detector, rec)
+
+	job, err := pipeline.Start(recording.ID)
+	require.NoError(t, err)
+	require.Equal(t, archive.StatusCompleted, job.Status)
+	assert.Equal(t, []string{recording.ID}, d.ids)
+	assert.Equal(t, []string{recording.ID}, detector.ids)
+
+	want := []highlights.Marker{score(420000, "7-0"), score(1800000, "14-7")}
+	status, err := pipeline.GetStatus(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, want, status.Highlights)
+
+	saved, err := rec.GetRecordingStatus(recording.ID)
+	require.NoError(t, err)
+	assert.Equal(t, want, saved.Highlights)
+
+	// The highlights are part of the recording detail.
+	gin.SetMode(gin.TestMode)
+	h := handlers.New(scheduler.New(), coordinator.New(), rec)
+	router := gin.New()
+	h.RegisterRoutes(router.Group("/api/v1"))
+	req := httptest.NewRequest("GET", "/api/v1/recordings/"+recording.ID, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var detail recorder.RecordingStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+	assert.Equal(t, want, detail.Highlights)
+}
+
+func TestPipeline_HighlightFailuresAreNonFatal(t *testing.T) {
+	t.Run("detector failure", func(t *testing.T) {
+		hook := logtest.NewGlobal()
+		defer hook.Reset()
+
+		pipeline, _, _, _, _, _, _, _ := newPipeline(t)
+		rec := recorder.New()
+		recording := rec.StartRecording("event-001", "srt://ESPN:9000")
+		pipeline.SetHighlightDetector(&mockHighlightDetector{err: errors.New("scoreboard OCR unavailable")}, rec)
+
+		job, err := pipeline.Start(recording.ID)
+		require.NoError(t, err)
+		assert.Equal(t, archive.StatusCompleted, job.Status)
+		assert.Nil(t, job.Highlights)
+
+		saved, err := rec.GetRecordingStatus(recording.ID)
+		require.NoError(t, err)
+		assert.Nil(t, saved.Highlights)
+
+		var warned bool
+		for _, e := range hook.AllEntries() {
+			if e.Message == "highlight extraction skipped, detection failed" {
+				warned = true
+			}
+		}
+		assert.True(t, warned)
+	})
+
+	t.Run("store failure", func(t *testing.T) {
+		pipeline, _, _, _, _, _, _, _ := newPipeline(t)
+		pipeline.SetHighlightDetector(&mockHighlightDetector{markers: []highlights.Marker{score(420000, "7-0")}}, recorder.New())
+
+		job, err := pipeline.Start("rec-unknown")
+		require.NoError(t, err)
+		assert.Equal(t, archive.StatusCompleted, job.Status)
+		assert.Len(t, job.Highlights, 1, "kept on the job even when saving fails")
+	})
+
+	t.Run("commercial detection failure skips highlights", func(t *testing.T) {
+		pipeline, _, d, _, _, _, _, _ := newPipeline(t)
+		d.err = errors.New("comskip crashed")
+		detector := &mockHighlightDetector{markers: []highlights.Marker{score(420000, "7-0")}}
+		pipeline.SetHighlightDetector(detector, nil)
+
+		job, err := pipeline.Start("rec-001")
+		require.NoError(t, err)
+		assert.Equal(t, archive.StatusFailed, job.Status)
+		assert.Empty(t, detector.ids)
+	})
+}
+
+const highlightsSelect = `SELECT highlights FROM archive_jobs`
+
+func TestRecordingHighlights_FromArchiveJobs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := archive.NewPostgresJobStore(db)
+	require.NoError(t, err)
+
+	rec := recorder.New()
+	live := rec.StartRecording("event-001", "srt://ESPN:9000")
+	h := handlers.New(scheduler.New(), coordinator.New(), rec)
+	h.ArchiveJobs = store
+	router := gin.New()
+	h.RegisterRoutes(router.Group("/api/v1"))
+
+	stored := []byte(`[{"at_ms":420000,"kind":"score_change","label":"7-0","confidence":0.9}]`)
+	want := []highlights.Marker{score(420000, "7-0")}
+
+	// A recording no longer in memory is served from its archive job.
+	mock.ExpectQuery(regexp.QuoteMeta(highlightsSelect)).WithArgs("rec-archived").
+		WillReturnRows(sqlmock.NewRows([]string{"highlights"}).AddRow(stored))
+	w := getPath(router, "/api/v1/recordings/rec-archived/highlights")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var markers []highlights.Marker
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &markers))
+	assert.Equal(t, want, markers)
+
+	// The recording detail fills in stored highlights.
+	mock.ExpectQuery(regexp.QuoteMeta(highlightsSelect)).WithArgs(live.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"highlights"}).AddRow(stored))
+	w = getPath(router, "/api/v1/recordings/"+live.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	var detail recorder.RecordingStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+	assert.Equal(t, want, detail.Highlights)
+
+	// Known recordings without highlights get an empty list, unknown ones 404.
+	mock.ExpectQuery(regexp.QuoteMeta(highlightsSelect)).WithArgs(live.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"highlights"}))
+	w = getPath(router, "/api/v1/recordings/"+live.ID+"/highlights")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	mock.ExpectQuery(regexp.QuoteMeta(highlightsSelect)).WithArgs("rec-missing").
+		WillReturnRows(sqlmock.NewRows([]string{"highlights"}))
+	assert.Equal(t, http.StatusNotFound, getPath(router, "/api/v1/recordings/rec-missing/highlights").Code)
+
+	mock.ExpectQuery(regexp.QuoteMeta(highlightsSelect)).WithArgs("rec-archived").
+		WillReturnError(errors.New("connection reset"))
+	assert.Equal(t, http.StatusInternalServerError, getPath(router, "/api/v1/recordings/rec-archived/highlights").Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
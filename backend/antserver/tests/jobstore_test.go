@@ -0,0 +1,331 @@
+package tests
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"antserver/internal/archive"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	jobUpsert = `INSERT INTO archive_jobs`
+	jobSelect = `SELECT id, recording_id, status, current_stage, format, priority`
+)
+
+var jobColumns = []string{
+	"id", "recording_id", "status", "current_stage", "format", "priority",
+	"profile_height", "profile_codec", "encode_weight", "correlation_id",
+	"stages", "poster", "highlights", "created_at", "updated_at",
+}
+
+// stagesMatch matches the stages JSON argument by the status of each stage.
+type stagesMatch []archive.JobStatus
+
+func (m stagesMatch) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	var stages []struct {
+		Status archive.JobStatus `json:"status"`
+	}
+	if json.Unmarshal([]byte(s), &stages) != nil || len(stages) != len(m) {
+		return false
+	}
+	for i := range m {
+		if stages[i].Status != m[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// stageStatuses returns the statuses of the seven stages with the first done
+// completed, the next set to current and the rest pending.
+func stageStatuses(done int, current archive.JobStatus) stagesMatch {
+	m := make(stagesMatch, 7)
+	for i := range m {
+		switch {
+		case i < done:
+			m[i] = archive.StatusCompleted
+		case i == done:
+			m[i] = current
+		default:
+			m[i] = archive.StatusPending
+		}
+	}
+	return m
+}
+
+// expectJobSave expects one upsert of the job with the given status and stages.
+func expectJobSave(mock sqlmock.Sqlmock, recordingID string, status archive.JobStatus, stages stagesMatch) {
+	mock.ExpectExec(regexp.QuoteMeta(jobUpsert)).
+		WithArgs(sqlmock.AnyArg(), recordingID, string(status), sqlmock.AnyArg(), "fmp4", int(archive.PriorityLive),
+			2160, "hevc", 60, "corr-123",
+			stages, nil, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func newStoredPipeline(t *testing.T) (*archive.Pipeline, sqlmock.Sqlmock, *mockEncoder) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+	store, err := archive.NewPostgresJobStore(db)
+	require.NoError(t, err)
+
+	f, d, e, tp, u, i, p := newMocks()
+	pipeline, err := archive.NewPipeline(f, d, e, tp, u, i, p)
+	require.NoError(t, err)
+	pipeline.SetFormatSource(staticFormat("fmp4"))
+	pipeline.SetJobStore(store)
+	return pipeline, mock, e
+}
+
+type staticFormat string
+
+func (s staticFormat) RecordingFormat(string) (string, error) { return string(s), nil }
+
+var storedJobOptions = archive.JobOptions{
+	Priority:      archive.PriorityLive,
+	Profile:       archive.EncodeProfile{Height: 2160, Codec: "hevc"},
+	CorrelationID: "corr-123",
+}
+
+func TestPostgresJobStore_NilDB(t *testing.T) {
+	_, err := archive.NewPostgresJobStore(nil)
+	assert.ErrorIs(t, err, archive.ErrNilDB)
+}
+
+// expectStageSaves expects the saves of a stage starting and completing.
+func expectStageSaves(mock sqlmock.Sqlmock, recordingID string, done int) {
+	expectJobSave(mock, recordingID, archive.StatusRunning, stageStatuses(done, archive.StatusRunning))
+	expectJobSave(mock, recordingID, archive.StatusRunning, stageStatuses(done+1, archive.StatusPending))
+}
+
+func TestJobStore_WriteThroughOnStageCompletion(t *testing.T) {
+	pipeline, mock, _ := newStoredPipeline(t)
+
+	expectJobSave(mock, "rec-001", archive.StatusRunning, stageStatuses(0, archive.StatusPending))
+	for done := 0; done < 7; done++ {
+		expectStageSaves(mock, "rec-001", done)
+	}
+	expectJobSave(mock, "rec-001", archive.StatusCompleted, stageStatuses(7, ""))
+
+	job, err := pipeline.StartWithOptions(context.Background(), "rec-001", storedJobOptions)
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusCompleted, job.Status)
+}
+
+func TestJobStore_WriteThroughOnStageFailure(t *testing.T) {
+	pipeline, mock, enc := newStoredPipeline(t)
+	enc.err = errors.New("ffmpeg exited 1")
+
+	expectJobSave(mock, "rec-002", archive.StatusRunning, stageStatuses(0, archive.StatusPending))
+	expectStageSaves(mock, "rec-002", 0)
+	expectStageSaves(mock, "rec-002", 1)
+	expectJobSave(mock, "rec-002", archive.StatusRunning, stageStatuses(2, archive.StatusRunning))
+	expectJobSave(mock, "rec-002", archive.StatusFailed, stageStatuses(2, archive.StatusFailed))
+
+	job, err := pipeline.StartWithOptions(context.Background(), "rec-002", storedJobOptions)
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusFailed, job.Status)
+}
+
+func TestJobStore_SaveFailureIsNotFatal(t *testing.T) {
+	pipeline, mock, _ := newStoredPipeline(t)
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 16; i++ {
+		mock.ExpectExec(regexp.QuoteMeta(jobUpsert)).WillReturnError(errors.New("connection refused"))
+	}
+
+	job, err := pipeline.Start("rec-003")
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusCompleted, job.Status)
+
+	status, err := pipeline.GetStatus(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusCompleted, status.Status, "the in-memory job stays authoritative")
+}
+
+func TestJobStore_PersistsEncodeWaitingForBudget(t *testing.T) {
+	pipeline, mock, _ := newStoredPipeline(t)
+	pipeline.SetBudget(archive.NewBudget(100))
+
+	expectJobSave(mock, "rec-004", archive.StatusRunning, stageStatuses(0, archive.StatusPending))
+	expectStageSaves(mock, "rec-004", 0)
+	expectStageSaves(mock, "rec-004", 1)
+	expectJobSave(mock, "rec-004", archive.StatusRunning, stageStatuses(2, archive.StatusWaiting))
+	expectStageSaves(mock, "rec-004", 2)
+	for done := 3; done < 7; done++ {
+		expectStageSaves(mock, "rec-004", done)
+	}
+	expectJobSave(mock, "rec-004", archive.StatusCompleted, stageStatuses(7, ""))
+
+	job, err := pipeline.StartWithOptions(context.Background(), "rec-004", storedJobOptions)
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusCompleted, job.Status)
+}
+
+// storedStages encodes stage statuses the way PostgresJobStore stores them.
+func storedStages(t *testing.T, statuses stagesMatch, failure string) []byte {
+	t.Helper()
+	names := []string{"finalize", "detect_commercials", "encode", "trickplay", "upload", "index", "publish"}
+	type stage struct {
+		Name   string            `json:"name"`
+		Status archive.JobStatus `json:"status"`
+		Error  string            `json:"error,omitempty"`
+	}
+	stages := make([]stage, len(names))
+	for i, name := range names {
+		stages[i] = stage{Name: name, Status: statuses[i]}
+		if statuses[i] == archive.StatusFailed {
+			stages[i].Error = failure
+		}
+	}
+	data, err := json.Marshal(stages)
+	require.NoError(t, err)
+	return data
+}
+
+func TestJobStore_HydrateAndRetry(t *testing.T) {
+	pipeline, mock, enc := newStoredPipeline(t)
+	created := time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(jobSelect)).WillReturnRows(sqlmock.NewRows(jobColumns).
+		AddRow("job-failed", "rec-010", "failed", "encode", "fmp4", 10, 2160, "hevc", 60, "corr-123",
+			storedStages(t, stageStatuses(2, archive.StatusFailed), "ffmpeg exited 1"), nil, nil, created, created).
+		AddRow("job-done", "rec-011", "completed", "", "mpegts", 0, 1080, "h264", 25, "",
+			storedStages(t, stageStatuses(7, ""), ""), []byte(`{"PosterMs":5000,"Candidates":[]}`), []byte(`[]`), created, created))
+
+	n, err := pipeline.Hydrate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	job, err := pipeline.GetStatus("job-failed")
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusFailed, job.Status)
+	assert.Equal(t, "fmp4", job.Format)
+	assert.Equal(t, archive.PriorityLive, job.Priority)
+	assert.Equal(t, archive.EncodeProfile{Height: 2160, Codec: "hevc"}, job.Profile)
+	assert.Equal(t, 60, job.EncodeWeight)
+	assert.Equal(t, "corr-123", job.CorrelationID)
+	assert.Equal(t, "ffmpeg exited 1", job.Stages[2].Error)
+
+	done, err := pipeline.GetStatus("job-done")
+	require.NoError(t, err)
+	require.NotNil(t, done.Poster)
+	assert.Equal(t, int64(5000), done.Poster.PosterMs)
+
+	// Retry resumes at encode with the restored settings.
+	expectJobSave(mock, "rec-010", archive.StatusRunning, stageStatuses(2, archive.StatusPending))
+	for done := 2; done < 7; done++ {
+		expectStageSaves(mock, "rec-010", done)
+	}
+	expectJobSave(mock, "rec-010", archive.StatusCompleted, stageStatuses(7, ""))
+
+	require.NoError(t, pipeline.Retry("job-failed"))
+	job, err = pipeline.GetStatus("job-failed")
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusCompleted, job.Status)
+	require.Len(t, enc.reqs, 1)
+	assert.Equal(t, archive.EncodeRequest{
+		RecordingID: "rec-010",
+		Format:      "fmp4",
+		Profile:     archive.EncodeProfile{Height: 2160, Codec: "hevc"},
+	}, enc.reqs[0])
+}
+
+func TestJobStore_HydrateMarksInterruptedJobsFailed(t *testing.T) {
+	pipeline, mock, _ := newStoredPipeline(t)
+	created := time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(jobSelect)).WillReturnRows(sqlmock.NewRows(jobColumns).
+		AddRow("job-running", "rec-020", "running", "trickplay", "fmp4", 10, 2160, "hevc", 60, "corr-123",
+			storedStages(t, stageStatuses(3, archive.StatusRunning), ""), nil, nil, created, created))
+	expectJobSave(mock, "rec-020", archive.StatusFailed, stageStatuses(3, archive.StatusFailed))
+
+	_, err := pipeline.Hydrate(context.Background())
+	require.NoError(t, err)
+
+	job, err := pipeline.GetStatus("job-running")
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusFailed, job.Status)
+	assert.Equal(t, "trickplay", job.CurrentStage)
+	assert.Equal(t, "archive: interrupted by restart", job.Stages[3].Error)
+}
+
+// recentSince matches the cutoff Hydrate passes to LoadJobs.
+type recentSince struct{}
+
+func (recentSince) Match(v driver.Value) bool {
+	since, ok := v.(time.Time)
+	return ok && time.Since(since)-archive.HydrateWindow < time.Minute && time.Since(since) >= archive.HydrateWindow
+}
+
+func TestJobStore_HydrateLoadsUnfinishedAndRecentJobs(t *testing.T) {
+	pipeline, mock, _ := newStoredPipeline(t)
+	mock.ExpectQuery(regexp.QuoteMeta(jobSelect) + `.*WHERE status NOT IN \(\$1, \$2\) OR updated_at >= \$3`).
+		WithArgs("completed", "failed", recentSince{}).
+		WillReturnRows(sqlmock.NewRows(jobColumns))
+
+	n, err := pipeline.Hydrate(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestUnavailableStages_RetryFailsAtCurrentStage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := archive.NewPostgresJobStore(db)
+	require.NoError(t, err)
+
+	stages := archive.UnavailableStages{}
+	pipeline, err := archive.NewPipeline(stages, stages, stages, stages, stages, stages, stages)
+	require.NoError(t, err)
+	pipeline.SetJobStore(store)
+
+	created := time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(jobSelect)).WillReturnRows(sqlmock.NewRows(jobColumns).
+		AddRow("job-failed", "rec-010", "failed", "encode", "fmp4", 10, 2160, "hevc", 60, "corr-123",
+			storedStages(t, stageStatuses(2, archive.StatusFailed), "ffmpeg exited 1"), nil, nil, created, created))
+	_, err = pipeline.Hydrate(context.Background())
+	require.NoError(t, err)
+
+	// Stored jobs are served; a retry cannot run the stage here and fails
+	// it again instead of skipping it.
+	mock.ExpectExec(jobUpsert).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(jobUpsert).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(jobUpsert).WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, pipeline.Retry("job-failed"))
+
+	job, err := pipeline.GetStatus("job-failed")
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusFailed, job.Status)
+	assert.Equal(t, archive.StageEncode, job.CurrentStage)
+	assert.Equal(t, archive.ErrStageUnavailable.Error(), job.Stages[2].Error)
+	assert.Equal(t, archive.StatusPending, job.Stages[3].Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobStore_HydrateError(t *testing.T) {
+	pipeline, mock, _ := newStoredPipeline(t)
+	mock.ExpectQuery(regexp.QuoteMeta(jobSelect)).WillReturnError(errors.New("connection refused"))
+
+	_, err := pipeline.Hydrate(context.Background())
+	assert.Error(t, err)
+	assert.Empty(t, pipeline.ListJobs())
+}
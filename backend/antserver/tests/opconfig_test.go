@@ -0,0 +1,307 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"antserver/internal/coordinator"
+	"antserver/internal/handlers"
+	"antserver/internal/opconfig"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+	"antserver/internal/watchdog"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeOpConfig(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func newReloader(t *testing.T, sched *scheduler.Scheduler) (*opconfig.Reloader, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "operational.json")
+	r, err := opconfig.NewReloader(path, sched)
+	require.NoError(t, err)
+	return r, path
+}
+
+func TestOpConfigParse_OverlaysDefaults(t *testing.T) {
+	settings, err := opconfig.Parse([]byte(`{
+		"retry_policies": {"tuner_failure": {"max_attempts": 6}},
+		"drift": {"max_drift": "10m"}
+	}`))
+	require.NoError(t, err)
+
+	defaults := scheduler.DefaultSettings()
+	assert.Equal(t, 6, settings.RetryPolicies[scheduler.RetryTunerFailure].MaxAttempts)
+	assert.Equal(t, 2*time.Minute, settings.RetryPolicies[scheduler.RetryTunerFailure].Delay)
+	assert.Equal(t, defaults.RetryPolicies[scheduler.RetryIngestFailure], settings.RetryPolicies[scheduler.RetryIngestFailure])
+	assert.Equal(t, time.Minute, settings.Drift.CheckInterval)
+	assert.Equal(t, 10*time.Minute, settings.Drift.MaxDrift)
+}
+
+func TestOpConfigParse_ReportsAllErrors(t *testing.T) {
+	_, err := opconfig.Parse([]byte(`{
+		"retry_policies": {
+			"tuner_failure": {"max_attempts": -1},
+			"lightning": {"max_attempts": 1}
+		},
+		"drift": {"check_interval": "0s"}
+	}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "retry_policies.tuner_failure.max_attempts")
+	assert.Contains(t, err.Error(), `unknown retry type "lightning"`)
+	assert.Contains(t, err.Error(), "drift.check_interval")
+
+	_, err = opconfig.Parse([]byte(`{"drift": {"max_drfit": "1m"}}`))
+	assert.Error(t, err, "unknown fields are rejected")
+}
+
+func TestOpConfigReload_ChangesNextRetryDecision(t *testing.T) {
+	sched := scheduler.New()
+	r, path := newReloader(t, sched)
+	evt := createEvent(t, sched, "ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+
+	// Default tuner policy allows three attempts.
+	for i := 0; i < 2; i++ {
+		ok, err := sched.Retry(evt.ID, scheduler.RetryTunerFailure)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	writeOpConfig(t, path, `{"retry_policies": {"tuner_failure": {"max_attempts": 2, "delay": "45s"}}}`)
+	_, err := r.Reload()
+	require.NoError(t, err)
+
+	ok, err := sched.Retry(evt.ID, scheduler.RetryTunerFailure)
+	require.NoError(t, err)
+	assert.False(t, ok, "lowered limit applies to the next decision")
+
+	delay, err := sched.GetRetryDelay(scheduler.RetryTunerFailure)
+	require.NoError(t, err)
+	assert.Equal(t, 45*time.Second, delay)
+
+	got, err := sched.GetEvent(evt.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, got.RetryAttempts[scheduler.RetryTunerFailure], "counters survive the reload")
+
+	writeOpConfig(t, path, `{"retry_policies": {"tuner_failure": {"max_attempts": 4}}}`)
+	_, err = r.Reload()
+	require.NoError(t, err)
+
+	ok, err = sched.Retry(evt.ID, scheduler.RetryTunerFailure)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	got, _ = sched.GetEvent(evt.ID)
+	assert.Equal(t, 3, got.RetryAttempts[scheduler.RetryTunerFailure])
+}
+
+func TestOpConfigReload_DriftAppliesImmediately(t *testing.T) {
+	clock := newMockClock()
+	sched := scheduler.NewWithClock(clock)
+	r, path := newReloader(t, sched)
+	evt := createEvent(t, sched, "ESPN", clock.Now(), clock.Now().Add(time.Hour), scheduler.EventMetadata{})
+
+	clock.Advance(3 * time.Minute)
+	_, exceeded, err := sched.CheckDrift(evt.ID)
+	require.NoError(t, err)
+	assert.False(t, exceeded)
+
+	writeOpConfig(t, path, `{"drift": {"max_drift": "2m"}}`)
+	_, err = r.Reload()
+	require.NoError(t, err)
+
+	_, exceeded, err = sched.CheckDrift(evt.ID)
+	require.NoError(t, err)
+	assert.True(t, exceeded)
+}
+
+func TestOpConfigReload_PaddingAppliesToNextWindow(t *testing.T) {
+	clock := newMockClock()
+	sched := scheduler.NewWithClock(clock)
+	r, path := newReloader(t, sched)
+	start := clock.Now().Add(10 * time.Minute)
+	evt := createEvent(t, sched, "ESPN", start, start.Add(time.Hour), scheduler.EventMetadata{})
+
+	from, to, err := sched.RecordingWindow(evt.ID)
+	require.NoError(t, err)
+	assert.Equal(t, evt.StartTime, from)
+	assert.Equal(t, evt.EndTime, to)
+
+	writeOpConfig(t, path, `{"padding": {"pre_roll": "2m", "post_roll": "10m"}}`)
+	_, err = r.Reload()
+	require.NoError(t, err)
+
+	from, to, err = sched.RecordingWindow(evt.ID)
+	require.NoError(t, err)
+	assert.Equal(t, evt.StartTime.Add(-2*time.Minute), from)
+	assert.Equal(t, evt.EndTime.Add(10*time.Minute), to)
+
+	// Drift is measured from the padded start.
+	clock.Advance(9 * time.Minute)
+	drift, _, err := sched.CheckDrift(evt.ID)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, drift)
+}
+
+func TestOpConfigReload_StallThresholdAppliesToWatchdog(t *testing.T) {
+	sched := scheduler.New()
+	r, path := newReloader(t, sched)
+	wd, clock := newWatchdog(t)
+	require.NoError(t, r.SetStallMonitor(wd))
+
+	loop := &wedgedLoop{}
+	require.NoError(t, wd.Register("scheduler", time.Second, loop.run))
+	require.Eventually(t, func() bool { return loop.runs.Load() == 1 }, time.Second, time.Millisecond)
+
+	writeOpConfig(t, path, `{"stall": {"loop_multiple": 5}}`)
+	_, err := r.Reload()
+	require.NoError(t, err)
+
+	// Past the default three intervals but within the reloaded five.
+	clock.Advance(4 * time.Second)
+	wd.Check()
+	assert.True(t, wd.Ready())
+
+	clock.Advance(1001 * time.Millisecond)
+	wd.Check()
+	assert.False(t, wd.Ready())
+
+	writeOpConfig(t, path, `{"stall": {"loop_multiple": 0.5}, "padding": {"pre_roll": "-1m"}}`)
+	_, err = r.Reload()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stall.loop_multiple")
+	assert.Contains(t, err.Error(), "padding.pre_roll")
+	assert.Equal(t, 5.0, sched.Settings().Stall.LoopMultiple)
+
+	assert.ErrorIs(t, wd.SetStallMultiple(0.5), watchdog.ErrInvalidConfig)
+}
+
+func TestOpConfigReload_InvalidRejectedWholesale(t *testing.T) {
+	sched := scheduler.New()
+	r, path := newReloader(t, sched)
+
+	writeOpConfig(t, path, `{"retry_policies": {"ingest_failure": {"max_attempts": 8}}}`)
+	_, err := r.Reload()
+	require.NoError(t, err)
+	before := r.Effective()
+
+	// The valid tuner change must not be applied alongside the invalid drift.
+	writeOpConfig(t, path, `{
+		"retry_policies": {"tuner_failure": {"max_attempts": 9}},
+		"drift": {"max_drift": "-1m"}
+	}`)
+	_, err = r.Reload()
+	require.Error(t, err)
+
+	after := r.Effective()
+	assert.Equal(t, before, after)
+	assert.Equal(t, 8, sched.Settings().RetryPolicies[scheduler.RetryIngestFailure].MaxAttempts)
+	assert.Equal(t, 3, sched.Settings().RetryPolicies[scheduler.RetryTunerFailure].MaxAttempts)
+
+	writeOpConfig(t, path, `{not json`)
+	_, err = r.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, before, r.Effective())
+}
+
+func TestOpConfigReload_LogsDiff(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	sched := scheduler.New()
+	r, path := newReloader(t, sched)
+
+	writeOpConfig(t, path, `{
+		"retry_policies": {"drift": {"max_attempts": 2}},
+		"drift": {"check_interval": "30s"}
+	}`)
+	changes, err := r.Reload()
+	require.NoError(t, err)
+
+	assert.Equal(t, []opconfig.Change{
+		{Field: "drift.check_interval", Old: "1m0s", New: "30s"},
+		{Field: "retry_policies.drift.max_attempts", Old: "1", New: "2"},
+	}, changes)
+
+	var entry *log.Entry
+	for _, e := range hook.AllEntries() {
+		if e.Message == "operational config reloaded" {
+			entry = e
+		}
+	}
+	require.NotNil(t, entry)
+	diff, ok := entry.Data["diff"].(log.Fields)
+	require.True(t, ok)
+	assert.Equal(t, "1m0s -> 30s", diff["drift.check_interval"])
+	assert.Equal(t, "1 -> 2", diff["retry_policies.drift.max_attempts"])
+}
+
+func TestOpConfigReload_NoFile(t *testing.T) {
+	r, err := opconfig.NewReloader("", scheduler.New())
+	require.NoError(t, err)
+
+	_, err = r.Reload()
+	assert.ErrorIs(t, err, opconfig.ErrNoConfigFile)
+	assert.Equal(t, opconfig.SourceDefaults, r.Effective().Source)
+}
+
+func TestConfigEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sched := scheduler.New()
+	r, path := newReloader(t, sched)
+
+	router := gin.New()
+	h := handlers.New(sched, coordinator.New(), recorder.New())
+	h.OpConfig = r
+	h.RegisterRoutes(router.Group("/api/v1"))
+
+	writeOpConfig(t, path, `{"retry_policies": {"ingest_failure": {"delay": "1m"}}}`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/config/reload", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var reloadResp handlers.ReloadConfigResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reloadResp))
+	assert.Equal(t, []opconfig.Change{{Field: "retry_policies.ingest_failure.delay", Old: "30s", New: "1m0s"}}, reloadResp.Changes)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/config/effective", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var eff handlers.EffectiveConfigResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &eff))
+	assert.Equal(t, "file:"+path, eff.Source)
+	assert.Equal(t, handlers.RetryPolicyView{MaxAttempts: 5, Delay: "1m0s"}, eff.RetryPolicies["ingest_failure"])
+	assert.Equal(t, "5m0s", eff.Drift.MaxDrift)
+	assert.Equal(t, handlers.PaddingView{PreRoll: "0s", PostRoll: "0s"}, eff.Padding)
+	assert.Equal(t, 3.0, eff.Stall.LoopMultiple)
+
+	writeOpConfig(t, path, `{"drift": {"check_interval": "soon", "max_drift": "0s"}}`)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/config/reload", nil))
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var rejected handlers.ReloadConfigError
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rejected))
+	assert.Len(t, rejected.Errors, 2)
+}
+
+func TestConfigEndpoints_NotConfigured(t *testing.T) {
+	router, _, _, _ := setupTestRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/config/effective", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
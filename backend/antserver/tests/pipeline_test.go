@@ -40,15 +40,17 @@ func (m *mockDetector) Detect(recordingID string) error {
 }
 
 type mockEncoder struct {
-	mu  sync.Mutex
-	err error
-	ids []string
+	mu   sync.Mutex
+	err  error
+	ids  []string
+	reqs []archive.EncodeRequest
 }
 
-func (m *mockEncoder) Encode(recordingID string) error {
+func (m *mockEncoder) Encode(req archive.EncodeRequest) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.ids = append(m.ids, recordingID)
+	m.ids = append(m.ids, req.RecordingID)
+	m.reqs = append(m.reqs, req)
 	return m.err
 }
 
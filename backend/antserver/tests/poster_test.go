@@ -0,0 +1,275 @@
+package tests
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"antserver/internal/archive"
+	"antserver/internal/commercial"
+	"antserver/internal/poster"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const hourMs = int64(3600000)
+
+func marker(startMs, endMs int64, confidence float64) commercial.Marker {
+	return commercial.Marker{StartMs: startMs, EndMs: endMs, Confidence: confidence, Source: "comskip"}
+}
+
+func TestContentWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		markers []commercial.Marker
+		want    []poster.Window
+	}{
+		{
+			name: "no commercials",
+			want: []poster.Window{{StartMs: 0, EndMs: hourMs}},
+		},
+		{
+			name: "breaks mid-program",
+			markers: []commercial.Marker{
+				marker(1800000, 1980000, 0.90),
+				marker(600000, 780000, 0.95),
+			},
+			want: []poster.Window{
+				{StartMs: 0, EndMs: 595000},
+				{StartMs: 785000, EndMs: 1795000},
+				{StartMs: 1985000, EndMs: hourMs},
+			},
+		},
+		{
+			name:    "low confidence ignored",
+			markers: []commercial.Marker{marker(600000, 780000, 0.5)},
+			want:    []poster.Window{{StartMs: 0, EndMs: hourMs}},
+		},
+		{
+			name: "overlapping breaks merge",
+			markers: []commercial.Marker{
+				marker(100000, 200000, 0.95),
+				marker(150000, 300000, 0.95),
+			},
+			want: []poster.Window{
+				{StartMs: 0, EndMs: 95000},
+				{StartMs: 305000, EndMs: hourMs},
+			},
+		},
+		{
+			name:    "break at start",
+			markers: []commercial.Marker{marker(0, 60000, 0.95)},
+			want:    []poster.Window{{StartMs: 65000, EndMs: hourMs}},
+		},
+		{
+			name:    "break at end",
+			markers: []commercial.Marker{marker(3500000, hourMs, 0.95)},
+			want:    []poster.Window{{StartMs: 0, EndMs: 3495000}},
+		},
+		{
+			name: "short gap between breaks dropped",
+			markers: []commercial.Marker{
+				marker(100000, 200000, 0.95),
+				marker(212000, 300000, 0.95),
+			},
+			want: []poster.Window{
+				{StartMs: 0, EndMs: 95000},
+				{StartMs: 305000, EndMs: hourMs},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := poster.ContentWindows(hourMs, tt.markers, commercial.PromptThreshold)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	assert.Nil(t, poster.ContentWindows(0, nil, commercial.PromptThreshold))
+}
+
+func TestCandidateTimes(t *testing.T) {
+	windows := []poster.Window{{StartMs: 0, EndMs: 1000}, {StartMs: 2000, EndMs: 4000}}
+	assert.Equal(t, []int64{500, 2500, 3500}, poster.CandidateTimes(windows, 3))
+	assert.Nil(t, poster.CandidateTimes(nil, 3))
+	assert.Nil(t, poster.CandidateTimes(windows, 0))
+}
+
+func TestRankFrames(t *testing.T) {
+	ranked := poster.Rank([]poster.FrameScore{
+		{AtMs: 1, Luma: 0.02, Motion: 1.0}, // black frame, however busy
+		{AtMs: 2, Luma: 0.5, Motion: 0.5},
+		{AtMs: 3, Luma: 0.9, Motion: 0.2},
+		{AtMs: 4, Luma: 0.5, Motion: 0.5},
+	})
+
+	var order []int64
+	for _, f := range ranked {
+		order = append(order, f.AtMs)
+	}
+	assert.Equal(t, []int64{2, 4, 3, 1}, order)
+	assert.InDelta(t, 0.5, ranked[0].Score, 1e-9)
+}
+
+// --- Pipeline integration ---
+
+type scoringTrickplay struct {
+	mockTrickplay
+	mu         sync.Mutex
+	candidates []int64
+	err        error
+}
+
+func (m *scoringTrickplay) ScoreFrames(recordingID string, candidatesMs []int64) ([]poster.FrameScore, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.candidates = append([]int64(nil), candidatesMs...)
+	if m.err != nil {
+		return nil, m.err
+	}
+	scores := make([]poster.FrameScore, len(candidatesMs))
+	for i, at := range candidatesMs {
+		// The third candidate is the busiest frame.
+		motion := 0.2
+		if i == 2 {
+			motion = 0.9
+		}
+		scores[i] = poster.FrameScore{AtMs: at, Luma: 0.5, Motion: motion}
+	}
+	return scores, nil
+}
+
+type mockCutPoints struct {
+	durationMs int64
+	markers    []commercial.Marker
+	err        error
+}
+
+func (m *mockCutPoints) CutPoints(recordingID string) (int64, []commercial.Marker, error) {
+	return m.durationMs, m.markers, m.err
+}
+
+type artworkPublisher struct {
+	mockPublisher
+	mu         sync.Mutex
+	received   []archive.PosterSelection
+	artworkErr error
+}
+
+func (m *artworkPublisher) PublishArtwork(recordingID string, sel archive.PosterSelection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.received = append(m.received, sel)
+	return m.artworkErr
+}
+
+func newPosterPipeline(t *testing.T, tp archive.TrickplayGenerator, pub archive.Publisher) *archive.Pipeline {
+	t.Helper()
+	f, d, e, _, u, i, _ := newMocks()
+	p, err := archive.NewPipeline(f, d, e, tp, u, i, pub)
+	require.NoError(t, err)
+	return p
+}
+
+func TestPipeline_PosterFromProgramContent(t *testing.T) {
+	tp := &scoringTrickplay{}
+	pub := &artworkPublisher{}
+	p := newPosterPipeline(t, tp, pub)
+	cuts := &mockCutPoints{
+		durationMs: hourMs,
+		markers:    []commercial.Marker{marker(600000, 780000, 0.95), marker(1800000, 1980000, 0.95)},
+	}
+	p.SetCutPointSource(cuts)
+
+	job, err := p.Start("rec-poster")
+	require.NoError(t, err)
+	require.Equal(t, archive.StatusCompleted, job.Status)
+
+	windows := poster.ContentWindows(cuts.durationMs, cuts.markers, commercial.PromptThreshold)
+	require.Len(t, tp.candidates, poster.DefaultCandidates)
+	for _, at := range tp.candidates {
+		inside := false
+		for _, w := range windows {
+			if at >= w.StartMs && at < w.EndMs {
+				inside = true
+			}
+		}
+		assert.True(t, inside, "candidate %d lies in program content", at)
+	}
+
+	status, err := p.GetStatus(job.ID)
+	require.NoError(t, err)
+	require.NotNil(t, status.Poster)
+	assert.Equal(t, tp.candidates[2], status.Poster.PosterMs)
+	assert.Len(t, status.Poster.Candidates, poster.DefaultCandidates)
+
+	// Alternatives are handed to the publisher with the poster first.
+	require.Len(t, pub.received, 1)
+	assert.Equal(t, *status.Poster, pub.received[0])
+	assert.Equal(t, pub.received[0].PosterMs, pub.received[0].Candidates[0].AtMs)
+}
+
+func TestPipeline_PosterFallback(t *testing.T) {
+	t.Run("no commercial data", func(t *testing.T) {
+		tp := &scoringTrickplay{}
+		pub := &artworkPublisher{}
+		p := newPosterPipeline(t, tp, pub)
+		p.SetCutPointSource(&mockCutPoints{durationMs: hourMs})
+
+		job, err := p.Start("rec-no-cuts")
+		require.NoError(t, err)
+		assert.Equal(t, archive.StatusCompleted, job.Status)
+		assert.Nil(t, job.Poster)
+		assert.Nil(t, tp.candidates, "frames are not scored without cut points")
+		assert.Empty(t, pub.received)
+	})
+
+	t.Run("no cut point source", func(t *testing.T) {
+		tp := &scoringTrickplay{}
+		p := newPosterPipeline(t, tp, &artworkPublisher{})
+
+		job, err := p.Start("rec-unconfigured")
+		require.NoError(t, err)
+		assert.Nil(t, job.Poster)
+		assert.Nil(t, tp.candidates)
+	})
+
+	t.Run("scoring failure keeps default poster", func(t *testing.T) {
+		tp := &scoringTrickplay{err: errors.New("ffmpeg crashed")}
+		p := newPosterPipeline(t, tp, &artworkPublisher{})
+		p.SetCutPointSource(&mockCutPoints{durationMs: hourMs, markers: []commercial.Marker{marker(0, 60000, 0.95)}})
+
+		job, err := p.Start("rec-score-fail")
+		require.NoError(t, err)
+		assert.Equal(t, archive.StatusCompleted, job.Status)
+		assert.Nil(t, job.Poster)
+	})
+
+	t.Run("artwork failure does not fail publish", func(t *testing.T) {
+		tp := &scoringTrickplay{}
+		pub := &artworkPublisher{artworkErr: errors.New("library unavailable")}
+		p := newPosterPipeline(t, tp, pub)
+		p.SetCutPointSource(&mockCutPoints{durationMs: hourMs, markers: []commercial.Marker{marker(0, 60000, 0.95)}})
+
+		job, err := p.Start("rec-artwork-fail")
+		require.NoError(t, err)
+		assert.Equal(t, archive.StatusCompleted, job.Status)
+		assert.Len(t, pub.received, 1)
+		assert.Equal(t, []string{"rec-artwork-fail"}, pub.ids, "the recording is published exactly once")
+	})
+
+	t.Run("generator without scoring", func(t *testing.T) {
+		f, d, e, tp, u, i, _ := newMocks()
+		pub := &artworkPublisher{}
+		p, err := archive.NewPipeline(f, d, e, tp, u, i, pub)
+		require.NoError(t, err)
+		p.SetCutPointSource(&mockCutPoints{durationMs: hourMs, markers: []commercial.Marker{marker(0, 60000, 0.95)}})
+
+		job, err := p.Start("rec-plain")
+		require.NoError(t, err)
+		assert.Nil(t, job.Poster)
+		assert.Empty(t, pub.received)
+	})
+}
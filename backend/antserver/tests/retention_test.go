@@ -0,0 +1,436 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"antserver/internal/coordinator"
+	"antserver/internal/handlers"
+	"antserver/internal/recorder"
+	"antserver/internal/retention"
+	"antserver/internal/scheduler"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockObjectStore holds keys and lists them by string prefix, as S3 does.
+type mockObjectStore struct {
+	mu      sync.Mutex
+	keys    []string
+	deleted []string
+	failKey string
+}
+
+func (m *mockObjectStore) List(ctx context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	for _, key := range m.keys {
+		if strings.HasPrefix(key, prefix) {
+			out = append(out, key)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockObjectStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if key == m.failKey {
+		return errors.New("minio unavailable")
+	}
+	m.deleted = append(m.deleted, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+type mockSearchIndex struct {
+	mu      sync.Mutex
+	removed []string
+}
+
+func (m *mockSearchIndex) Remove(ctx context.Context, recordingID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removed = append(m.removed, recordingID)
+	return nil
+}
+
+var retentionNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+const (
+	listPoliciesQuery   = `SELECT family_id, keep_days, keep_count FROM recording_retention_policies ORDER BY family_id`
+	completedRecsQuery  = `FROM dvr_recordings WHERE family_id = $1 AND status = 'completed'`
+	deleteRecordingExec = `DELETE FROM dvr_recordings WHERE id = $1`
+)
+
+func newRetentionJanitor(t *testing.T) (*retention.Janitor, sqlmock.Sqlmock, *mockObjectStore, *mockSearchIndex) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store, err := retention.NewStore(db)
+	require.NoError(t, err)
+
+	objects := &mockObjectStore{}
+	index := &mockSearchIndex{}
+	janitor, err := retention.NewJanitor(store, objects, index)
+	require.NoError(t, err)
+	janitor.SetTestNow(func() time.Time { return retentionNow })
+
+	return janitor, mock, objects, index
+}
+
+func recordingRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "family_id", "storage_path", "start_time"})
+}
+
+func TestExpired_KeepDays(t *testing.T) {
+	recs := []retention.Recording{
+		{ID: "new", StartTime: retentionNow.AddDate(0, 0, -2)},
+		{ID: "old", StartTime: retentionNow.AddDate(0, 0, -31)},
+		{ID: "edge", StartTime: retentionNow.AddDate(0, 0, -30)},
+	}
+
+	expired := retention.Expired(retention.Policy{KeepDays: 30}, recs, retentionNow)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "old", expired[0].ID)
+}
+
+func TestExpired_KeepCount(t *testing.T) {
+	recs := []retention.Recording{
+		{ID: "oldest", StartTime: retentionNow.Add(-3 * time.Hour)},
+		{ID: "newest", StartTime: retentionNow.Add(-1 * time.Hour)},
+		{ID: "middle", StartTime: retentionNow.Add(-2 * time.Hour)},
+	}
+
+	expired := retention.Expired(retention.Policy{KeepCount: 2}, recs, retentionNow)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "oldest", expired[0].ID)
+
+	assert.Empty(t, retention.Expired(retention.Policy{}, recs, retentionNow))
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	assert.ErrorIs(t, retention.Policy{}.Validate(), retention.ErrEmptyFamilyID)
+	assert.ErrorIs(t, retention.Policy{FamilyID: "fam", KeepDays: -1}.Validate(), retention.ErrInvalidPolicy)
+	assert.NoError(t, retention.Policy{FamilyID: "fam", KeepDays: 7}.Validate())
+}
+
+func TestNewJanitor_NilDependency(t *testing.T) {
+	_, err := retention.NewStore(nil)
+	assert.ErrorIs(t, err, retention.ErrNilDB)
+
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := retention.NewStore(db)
+	require.NoError(t, err)
+
+	_, err = retention.NewJanitor(store, nil, &mockSearchIndex{})
+	assert.ErrorIs(t, err, retention.ErrNilObjectStore)
+	_, err = retention.NewJanitor(store, &mockObjectStore{}, nil)
+	assert.ErrorIs(t, err, retention.ErrNilIndex)
+}
+
+func TestJanitor_DeletesExpiredAndRetainsInWindow(t *testing.T) {
+	janitor, mock, objects, index := newRetentionJanitor(t)
+	objects.keys = []string{
+		"recordings/evt-1/rec-recent.ts",
+		"recordings/evt-2/rec-expired.ts",
+		"recordings/evt-2/rec-expired.m3u8",
+		"recordings/evt-2/rec-expired/segment_00000.ts",
+		"recordings/evt-2/rec-expired/segment_00001.ts",
+		"recordings/evt-2/rec-expired-rerun.ts",
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(listPoliciesQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"family_id", "keep_days", "keep_count"}).
+			AddRow("fam-1", 30, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(completedRecsQuery)).
+		WithArgs("fam-1").
+		WillReturnRows(recordingRows().
+			AddRow("rec-recent", "fam-1", "recordings/evt-1/rec-recent.ts", retentionNow.AddDate(0, 0, -5)).
+			AddRow("rec-expired", "fam-1", "recordings/evt-2/rec-expired.ts", retentionNow.AddDate(0, 0, -45)))
+	mock.ExpectExec(regexp.QuoteMeta(deleteRecordingExec)).
+		WithArgs("rec-expired").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	res, err := janitor.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, retention.Result{Families: 1, Deleted: 1}, res)
+	// The container, playlist and segments go; another recording of the
+	// same event stays.
+	assert.Equal(t, []string{
+		"recordings/evt-2/rec-expired.ts",
+		"recordings/evt-2/rec-expired.m3u8",
+		"recordings/evt-2/rec-expired/segment_00000.ts",
+		"recordings/evt-2/rec-expired/segment_00001.ts",
+	}, objects.deleted)
+	assert.Equal(t, []string{"recordings/evt-1/rec-recent.ts", "recordings/evt-2/rec-expired-rerun.ts"}, objects.keys)
+	assert.Equal(t, []string{"rec-expired"}, index.removed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJanitor_KeepCountPerFamily(t *testing.T) {
+	janitor, mock, objects, _ := newRetentionJanitor(t)
+	objects.keys = []string{"a-new.ts", "a-old.ts", "b-1.ts", "b-2.ts"}
+
+	mock.ExpectQuery(regexp.QuoteMeta(listPoliciesQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"family_id", "keep_days", "keep_count"}).
+			AddRow("fam-1", 0, 1).
+			AddRow("fam-2", 0, 5))
+	mock.ExpectQuery(regexp.QuoteMeta(completedRecsQuery)).
+		WithArgs("fam-1").
+		WillReturnRows(recordingRows().
+			AddRow("a-new", "fam-1", "a-new.ts", retentionNow.Add(-time.Hour)).
+			AddRow("a-old", "fam-1", "a-old.ts", retentionNow.Add(-48*time.Hour)))
+	mock.ExpectExec(regexp.QuoteMeta(deleteRecordingExec)).
+		WithArgs("a-old").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(completedRecsQuery)).
+		WithArgs("fam-2").
+		WillReturnRows(recordingRows().
+			AddRow("b-1", "fam-2", "b-1.ts", retentionNow.Add(-time.Hour)).
+			AddRow("b-2", "fam-2", "b-2.ts", retentionNow.Add(-48*time.Hour)))
+
+	res, err := janitor.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, retention.Result{Families: 2, Deleted: 1}, res)
+	assert.Equal(t, []string{"a-old.ts"}, objects.deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJanitor_ObjectFailureKeepsRow(t *testing.T) {
+	janitor, mock, objects, index := newRetentionJanitor(t)
+	objects.keys = []string{"stuck.ts"}
+	objects.failKey = "stuck.ts"
+
+	mock.ExpectQuery(regexp.QuoteMeta(listPoliciesQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"family_id", "keep_days", "keep_count"}).
+			AddRow("fam-1", 7, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(completedRecsQuery)).
+		WithArgs("fam-1").
+		WillReturnRows(recordingRows().
+			AddRow("rec-stuck", "fam-1", "stuck.ts", retentionNow.AddDate(0, 0, -10)).
+			AddRow("rec-gone", "fam-1", "", retentionNow.AddDate(0, 0, -20)))
+	// Only the recording without media is deleted; the stuck row stays for
+	// the next run.
+	mock.ExpectExec(regexp.QuoteMeta(deleteRecordingExec)).
+		WithArgs("rec-gone").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	res, err := janitor.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, retention.Result{Families: 1, Deleted: 1, Failed: 1}, res)
+	assert.Equal(t, []string{"rec-gone"}, index.removed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJanitor_RepeatedRunIsNoop(t *testing.T) {
+	janitor, mock, objects, _ := newRetentionJanitor(t)
+
+	// Second run after a successful deletion sees only in-window recordings.
+	mock.ExpectQuery(regexp.QuoteMeta(listPoliciesQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"family_id", "keep_days", "keep_count"}).
+			AddRow("fam-1", 30, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(completedRecsQuery)).
+		WithArgs("fam-1").
+		WillReturnRows(recordingRows().
+			AddRow("rec-recent", "fam-1", "rec-recent.ts", retentionNow.AddDate(0, 0, -1)))
+
+	res, err := janitor.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Deleted)
+	assert.Empty(t, objects.deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJanitor_LoopRunsUntilCancelled(t *testing.T) {
+	janitor, mock, _, _ := newRetentionJanitor(t)
+	mock.ExpectQuery(regexp.QuoteMeta(listPoliciesQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"family_id", "keep_days", "keep_count"}))
+
+	var mu sync.Mutex
+	pats := 0
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		janitor.Loop(time.Hour)(ctx, func() {
+			mu.Lock()
+			pats++
+			mu.Unlock()
+		})
+	}()
+
+	require.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, pats)
+}
+
+func TestStore_SetAndGetPolicy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := retention.NewStore(db)
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO recording_retention_policies`)).
+		WithArgs("fam-1", 14, 50).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, store.SetPolicy(context.Background(), retention.Policy{FamilyID: "fam-1", KeepDays: 14, KeepCount: 50}))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT keep_days, keep_count FROM recording_retention_policies WHERE family_id = $1`)).
+		WithArgs("fam-1").
+		WillReturnRows(sqlmock.NewRows([]string{"keep_days", "keep_count"}).AddRow(14, 50))
+	p, err := store.GetPolicy(context.Background(), "fam-1")
+	require.NoError(t, err)
+	assert.Equal(t, retention.Policy{FamilyID: "fam-1", KeepDays: 14, KeepCount: 50}, p)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT keep_days, keep_count FROM recording_retention_policies WHERE family_id = $1`)).
+		WithArgs("fam-missing").
+		WillReturnRows(sqlmock.NewRows([]string{"keep_days", "keep_count"}))
+	_, err = store.GetPolicy(context.Background(), "fam-missing")
+	assert.ErrorIs(t, err, retention.ErrPolicyNotFound)
+
+	assert.ErrorIs(t, store.SetPolicy(context.Background(), retention.Policy{FamilyID: "fam-1", KeepCount: -1}), retention.ErrInvalidPolicy)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func setupRetentionRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+	store, err := retention.NewStore(db)
+	require.NoError(t, err)
+
+	h := handlers.New(scheduler.New(), coordinator.New(), recorder.New())
+	h.Retention = store
+
+	router := gin.New()
+	h.RegisterRoutes(router.Group("/api/v1"))
+	return router, mock
+}
+
+func putRetentionPolicy(router *gin.Engine, familyID string, body interface{}) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(body)
+	req := httptest.NewRequest("PUT", "/api/v1/retention/policies/"+familyID, bytes.NewReader(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRetentionPolicies_SetAndList(t *testing.T) {
+	router, mock := setupRetentionRouter(t)
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO recording_retention_policies`)).
+		WithArgs("fam-1", 30, 100).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	w := putRetentionPolicy(router, "fam-1", map[string]int{"keep_days": 30, "keep_count": 100})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var set retention.Policy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	assert.Equal(t, retention.Policy{FamilyID: "fam-1", KeepDays: 30, KeepCount: 100}, set)
+
+	mock.ExpectQuery(regexp.QuoteMeta(listPoliciesQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"family_id", "keep_days", "keep_count"}).
+			AddRow("fam-1", 30, 100))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/retention/policies", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var list []retention.Policy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, []retention.Policy{set}, list)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT keep_days, keep_count FROM recording_retention_policies WHERE family_id = $1`)).
+		WithArgs("fam-2").
+		WillReturnRows(sqlmock.NewRows([]string{"keep_days", "keep_count"}))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/retention/policies/fam-2", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRetentionPolicies_RejectsNegativeLimits(t *testing.T) {
+	router, _ := setupRetentionRouter(t)
+
+	w := putRetentionPolicy(router, "fam-1", map[string]int{"keep_days": -1})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRetentionPolicies_NotConfigured(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handlers.New(scheduler.New(), coordinator.New(), recorder.New())
+	router := gin.New()
+	h.RegisterRoutes(router.Group("/api/v1"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/retention/policies", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestMeiliIndex_Remove(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	status := http.StatusAccepted
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization"))
+		code := status
+		mu.Unlock()
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	index, err := retention.NewMeiliIndex(srv.URL+"/", "secret", "recordings")
+	require.NoError(t, err)
+	require.NoError(t, index.Remove(context.Background(), "rec-1"))
+
+	// A missing index means nothing is indexed.
+	mu.Lock()
+	status = http.StatusNotFound
+	mu.Unlock()
+	require.NoError(t, index.Remove(context.Background(), "rec-2"))
+
+	mu.Lock()
+	status = http.StatusInternalServerError
+	mu.Unlock()
+	assert.Error(t, index.Remove(context.Background(), "rec-3"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "DELETE /indexes/recordings/documents/rec-1 Bearer secret", requests[0])
+	assert.Len(t, requests, 3)
+
+	_, err = retention.NewMeiliIndex("", "", "recordings")
+	assert.ErrorIs(t, err, retention.ErrEmptySearchURL)
+}
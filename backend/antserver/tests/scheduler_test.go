@@ -22,6 +22,14 @@ func newMockClock() *mockClock {
 	return &mockClock{now: time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC)}
 }
 
+// createEvent creates an event and fails the test if the scheduler rejects it.
+func createEvent(t *testing.T, s *scheduler.Scheduler, channel string, start, end time.Time, meta scheduler.EventMetadata) *scheduler.Event {
+	t.Helper()
+	evt, err := s.CreateEvent(channel, start, end, meta)
+	require.NoError(t, err)
+	return evt
+}
+
 // --- Event State Machine Tests ---
 
 func TestCreateEvent(t *testing.T) {
@@ -29,7 +37,7 @@ func TestCreateEvent(t *testing.T) {
 	start := time.Now().Add(1 * time.Hour)
 	end := start.Add(3 * time.Hour)
 
-	evt := s.CreateEvent("ESPN", start, end, scheduler.EventMetadata{
+	evt := createEvent(t, s, "ESPN", start, end, scheduler.EventMetadata{
 		League: "NBA",
 		Title:  "Lakers vs Celtics",
 	})
@@ -48,7 +56,7 @@ func TestCreateEventAutoEndTime(t *testing.T) {
 	s := scheduler.New()
 	start := time.Now().Add(1 * time.Hour)
 
-	evt := s.CreateEvent("ESPN", start, time.Time{}, scheduler.EventMetadata{
+	evt := createEvent(t, s, "ESPN", start, time.Time{}, scheduler.EventMetadata{
 		League: "NFL",
 	})
 
@@ -61,12 +69,91 @@ func TestCreateEventAutoEndTimeNoLeague(t *testing.T) {
 	s := scheduler.New()
 	start := time.Now().Add(1 * time.Hour)
 
-	evt := s.CreateEvent("ESPN", start, time.Time{}, scheduler.EventMetadata{})
+	evt := createEvent(t, s, "ESPN", start, time.Time{}, scheduler.EventMetadata{})
 
 	// Without a league, end time stays zero when no league provided.
 	assert.True(t, evt.EndTime.IsZero())
 }
 
+func TestRescheduleRejectsEndBeforeStart(t *testing.T) {
+	s := scheduler.NewWithClock(newMockClock())
+	start := time.Now().Add(time.Hour)
+	evt := createEvent(t, s, "ESPN", start, start.Add(time.Hour), scheduler.EventMetadata{})
+
+	for _, end := range []time.Time{start.Add(time.Hour), start.Add(2 * time.Hour)} {
+		err := s.Reschedule(evt.ID, start.Add(2*time.Hour), end)
+		var verr *scheduler.ValidationError
+		require.ErrorAs(t, err, &verr)
+		assert.Equal(t, "end_time", verr.Field)
+		assert.ErrorIs(t, err, scheduler.ErrEndBeforeStart)
+	}
+
+	got, err := s.GetEvent(evt.ID)
+	require.NoError(t, err)
+	assert.Equal(t, start, got.StartTime, "a rejected reschedule leaves the window unchanged")
+	assert.Equal(t, start.Add(time.Hour), got.EndTime)
+
+	require.NoError(t, s.Reschedule(evt.ID, start.Add(2*time.Hour), start.Add(3*time.Hour)))
+}
+
+func TestValidateEventTimes(t *testing.T) {
+	clock := newMockClock()
+	s := scheduler.NewWithClock(clock)
+	now := clock.Now()
+
+	tests := []struct {
+		name  string
+		start time.Time
+		end   time.Time
+		want  error
+		field string
+	}{
+		{name: "valid", start: now.Add(time.Hour), end: now.Add(3 * time.Hour)},
+		{name: "zero end derived later", start: now.Add(time.Hour)},
+		{name: "start within tolerance", start: now.Add(-scheduler.PastStartTolerance), end: now.Add(time.Hour)},
+		{name: "zero start", end: now.Add(time.Hour), want: scheduler.ErrZeroStartTime, field: "start_time"},
+		{name: "end before start", start: now.Add(2 * time.Hour), end: now.Add(time.Hour), want: scheduler.ErrEndBeforeStart, field: "end_time"},
+		{name: "end equals start", start: now.Add(time.Hour), end: now.Add(time.Hour), want: scheduler.ErrEndBeforeStart, field: "end_time"},
+		{name: "start in past", start: now.Add(-scheduler.PastStartTolerance - time.Second), end: now.Add(time.Hour), want: scheduler.ErrStartInPast, field: "start_time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.ValidateEventTimes(tt.start, tt.end)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tt.want)
+			var verr *scheduler.ValidationError
+			require.ErrorAs(t, err, &verr)
+			assert.Equal(t, tt.field, verr.Field)
+		})
+	}
+
+	// The tolerance follows the injected clock.
+	start := now.Add(time.Minute)
+	require.NoError(t, s.ValidateEventTimes(start, time.Time{}))
+	clock.Advance(time.Minute + scheduler.PastStartTolerance + time.Second)
+	assert.ErrorIs(t, s.ValidateEventTimes(start, time.Time{}), scheduler.ErrStartInPast)
+}
+
+func TestCreateEvent_RejectsInvalidTimes(t *testing.T) {
+	clock := newMockClock()
+	s := scheduler.NewWithClock(clock)
+	now := clock.Now()
+
+	_, err := s.CreateEvent("ESPN", now.Add(2*time.Hour), now.Add(time.Hour), scheduler.EventMetadata{})
+	assert.ErrorIs(t, err, scheduler.ErrEndBeforeStart)
+
+	_, err = s.CreateEventWithCorrelationID("cid-past", "ESPN", now.Add(-time.Hour), time.Time{}, scheduler.EventMetadata{League: "NBA"})
+	var verr *scheduler.ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, "start_time", verr.Field)
+
+	assert.Empty(t, s.ListEvents(), "rejected events are not stored")
+}
+
 func TestValidStateTransitions(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -127,7 +214,7 @@ func TestValidStateTransitions(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := scheduler.New()
-			evt := s.CreateEvent("test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+			evt := createEvent(t, s, "test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 
 			for _, target := range tt.states {
 				err := s.Transition(evt.ID, target)
@@ -178,7 +265,7 @@ func TestInvalidStateTransitions(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := scheduler.New()
-			evt := s.CreateEvent("test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+			evt := createEvent(t, s, "test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 
 			for _, state := range tt.setup {
 				require.NoError(t, s.Transition(evt.ID, state))
@@ -202,7 +289,7 @@ func TestTransitionNonExistentEvent(t *testing.T) {
 
 func TestRetryTunerFailure(t *testing.T) {
 	s := scheduler.New()
-	evt := s.CreateEvent("test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, s, "test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 
 	// Tuner failure: 3 retries at 2 minute intervals.
 	for i := 0; i < 3; i++ {
@@ -219,7 +306,7 @@ func TestRetryTunerFailure(t *testing.T) {
 
 func TestRetryIngestFailure(t *testing.T) {
 	s := scheduler.New()
-	evt := s.CreateEvent("test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, s, "test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 
 	// Ingest failure: 5 retries at 30 second intervals.
 	for i := 0; i < 5; i++ {
@@ -235,7 +322,7 @@ func TestRetryIngestFailure(t *testing.T) {
 
 func TestRetryDrift(t *testing.T) {
 	s := scheduler.New()
-	evt := s.CreateEvent("test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, s, "test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 
 	// Drift: 1 retry, immediate.
 	allowed, err := s.Retry(evt.ID, scheduler.RetryDrift)
@@ -266,7 +353,7 @@ func TestRetryDelays(t *testing.T) {
 
 func TestRetryUnknownType(t *testing.T) {
 	s := scheduler.New()
-	evt := s.CreateEvent("test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, s, "test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 
 	_, err := s.Retry(evt.ID, scheduler.RetryType("unknown"))
 	assert.Error(t, err)
@@ -287,7 +374,7 @@ func TestDriftBeforeStartTime(t *testing.T) {
 	s := scheduler.NewWithClock(clock)
 
 	start := clock.Now().Add(1 * time.Hour)
-	evt := s.CreateEvent("test-ch", start, start.Add(3*time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, s, "test-ch", start, start.Add(3*time.Hour), scheduler.EventMetadata{})
 
 	drift, exceeded, err := s.CheckDrift(evt.ID)
 	require.NoError(t, err)
@@ -300,7 +387,7 @@ func TestDriftWithinThreshold(t *testing.T) {
 	s := scheduler.NewWithClock(clock)
 
 	start := clock.Now()
-	evt := s.CreateEvent("test-ch", start, start.Add(3*time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, s, "test-ch", start, start.Add(3*time.Hour), scheduler.EventMetadata{})
 
 	// Advance 3 minutes (under 5 minute threshold).
 	clock.Advance(3 * time.Minute)
@@ -316,7 +403,7 @@ func TestDriftExceedsThreshold(t *testing.T) {
 	s := scheduler.NewWithClock(clock)
 
 	start := clock.Now()
-	evt := s.CreateEvent("test-ch", start, start.Add(3*time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, s, "test-ch", start, start.Add(3*time.Hour), scheduler.EventMetadata{})
 
 	// Advance 6 minutes (over 5 minute threshold).
 	clock.Advance(6 * time.Minute)
@@ -332,7 +419,7 @@ func TestDriftExactThreshold(t *testing.T) {
 	s := scheduler.NewWithClock(clock)
 
 	start := clock.Now()
-	evt := s.CreateEvent("test-ch", start, start.Add(3*time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, s, "test-ch", start, start.Add(3*time.Hour), scheduler.EventMetadata{})
 
 	// Advance exactly 5 minutes (at threshold, not exceeded).
 	clock.Advance(5 * time.Minute)
@@ -386,8 +473,8 @@ func TestListEvents(t *testing.T) {
 	assert.Empty(t, events)
 
 	// Create some events.
-	s.CreateEvent("ch1", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
-	s.CreateEvent("ch2", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	createEvent(t, s, "ch1", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	createEvent(t, s, "ch2", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 
 	events = s.ListEvents()
 	assert.Len(t, events, 2)
@@ -402,7 +489,7 @@ func TestGetEventNotFound(t *testing.T) {
 
 func TestGetEventReturnsCopy(t *testing.T) {
 	s := scheduler.New()
-	evt := s.CreateEvent("test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	evt := createEvent(t, s, "test-ch", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
 
 	copy1, err := s.GetEvent(evt.ID)
 	require.NoError(t, err)
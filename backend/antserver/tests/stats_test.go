@@ -0,0 +1,322 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"antserver/internal/handlers"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+	"antserver/internal/stats"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	statsDeleteDay = `DELETE FROM recording_stats WHERE day = $1`
+	statsInsert    = `INSERT INTO recording_stats`
+)
+
+var statsNow = time.Date(2026, 2, 14, 10, 0, 0, 0, time.UTC)
+
+func newStatsRollup(t *testing.T, sched *scheduler.Scheduler, rec *recorder.Recorder, cfg stats.RollupConfig) (*stats.Rollup, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store, err := stats.NewStore(db)
+	require.NoError(t, err)
+	source, err := stats.NewLiveSource(sched, rec)
+	require.NoError(t, err)
+
+	rollup, err := stats.NewRollup(source, store, sched, cfg)
+	require.NoError(t, err)
+	rollup.SetTestNow(func() time.Time { return statsNow })
+	return rollup, mock
+}
+
+// finishEvent creates an event and drives it to complete or failed.
+func finishEvent(t *testing.T, s *scheduler.Scheduler, channel, league string, start, end time.Time, failed bool) *scheduler.Event {
+	t.Helper()
+	evt := createEvent(t, s, channel, start, end, scheduler.EventMetadata{League: league})
+	states := []scheduler.EventState{scheduler.StateScheduled, scheduler.StateActive, scheduler.StateRecording}
+	if failed {
+		states = append(states, scheduler.StateFailed)
+	} else {
+		states = append(states, scheduler.StateFinalizing, scheduler.StateComplete)
+	}
+	for _, st := range states {
+		require.NoError(t, s.Transition(evt.ID, st))
+	}
+	return evt
+}
+
+// expectDay expects one ReplaceDay transaction; each insert is given as
+// channel, device, league, completed, failed.
+func expectDay(mock sqlmock.Sqlmock, day string, inserts ...[]interface{}) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(statsDeleteDay)).WithArgs(day).WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, ins := range inserts {
+		mock.ExpectExec(regexp.QuoteMeta(statsInsert)).
+			WithArgs(day, ins[0], ins[1], ins[2], ins[3], ins[4], 0, ins[5], 0, 0, ins[6], 0).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+}
+
+func TestAggregate_GroupsAndUnknowns(t *testing.T) {
+	day := time.Date(2026, 2, 13, 0, 0, 0, 0, time.UTC)
+	rows, err := stats.Aggregate(day, []stats.Outcome{
+		{EventID: "a", Channel: "ESPN", DeviceID: "antbox-1", League: "NBA", Result: stats.ResultCompleted},
+		{EventID: "b", Channel: "ESPN", DeviceID: "antbox-1", League: "NBA", Result: stats.ResultFailed,
+			Retries: map[scheduler.RetryType]int{scheduler.RetryTunerFailure: 2}, GapSeconds: 30},
+		{EventID: "c", Channel: "FOX", Result: stats.ResultPreempted},
+	})
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+
+	assert.Equal(t, 1, rows[0].Completed)
+	assert.Equal(t, 1, rows[0].Failed)
+	assert.Equal(t, 2, rows[0].Retries[scheduler.RetryTunerFailure])
+	assert.Equal(t, 30.0, rows[0].GapSeconds)
+
+	assert.Equal(t, "FOX", rows[1].Channel)
+	assert.Equal(t, stats.UnknownDimension, rows[1].DeviceID)
+	assert.Equal(t, stats.UnknownDimension, rows[1].League)
+	assert.Equal(t, 1, rows[1].Preempted)
+
+	_, err = stats.Aggregate(day, []stats.Outcome{{EventID: "x", Result: "exploded"}})
+	assert.ErrorIs(t, err, stats.ErrUnknownResult)
+}
+
+func TestRollup_MidnightAttributedToStartDate(t *testing.T) {
+	sched := scheduler.NewWithClock(newMockClock())
+	evt := finishEvent(t, sched, "ESPN", "NBA",
+		time.Date(2026, 2, 13, 22, 30, 0, 0, time.UTC),
+		time.Date(2026, 2, 14, 1, 30, 0, 0, time.UTC), false)
+	require.NoError(t, sched.AssignDevice(evt.ID, "antbox-1", 0))
+
+	rollup, mock := newStatsRollup(t, sched, nil, stats.RollupConfig{RerollDays: 1})
+
+	// 2026-02-14 holds no events and is left as stored.
+	expectDay(mock, "2026-02-13", []interface{}{"ESPN", "antbox-1", "NBA", 1, 0, 0, 0.0})
+
+	require.NoError(t, rollup.RunOnce(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRollup_IdempotentReruns(t *testing.T) {
+	sched := scheduler.NewWithClock(newMockClock())
+	rec := recorder.New()
+	evt := finishEvent(t, sched, "ESPN", "NFL",
+		time.Date(2026, 2, 14, 1, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 14, 5, 0, 0, 0, time.UTC), true)
+	_, err := sched.Retry(evt.ID, scheduler.RetryTunerFailure)
+	require.NoError(t, err)
+
+	r := rec.StartRecording(evt.ID, "srt://ESPN:9000")
+	gapStart := time.Date(2026, 2, 14, 2, 0, 0, 0, time.UTC)
+	require.NoError(t, rec.BeginGap(r.ID, gapStart, recorder.GapReasonTransportFailed))
+	require.NoError(t, rec.ResumeSegment(r.ID, gapStart.Add(45*time.Second)))
+
+	rollup, mock := newStatsRollup(t, sched, rec, stats.RollupConfig{RerollDays: 1})
+
+	// Both runs rewrite the day with identical rows rather than adding to it.
+	for i := 0; i < 2; i++ {
+		expectDay(mock, "2026-02-14", []interface{}{"ESPN", stats.UnknownDimension, "NFL", 0, 1, 1, 45.0})
+	}
+
+	require.NoError(t, rollup.RunOnce(context.Background()))
+	require.NoError(t, rollup.RunOnce(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRollup_LateResultReRolled(t *testing.T) {
+	// The events predate the rollup, so create them on an earlier clock.
+	sched := scheduler.NewWithClock(&mockClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)})
+	evt := createEvent(t, sched, "FOX", time.Date(2026, 2, 12, 20, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 12, 23, 0, 0, 0, time.UTC), scheduler.EventMetadata{League: "NHL"})
+	for _, st := range []scheduler.EventState{scheduler.StateScheduled, scheduler.StateActive, scheduler.StateRecording, scheduler.StateFinalizing} {
+		require.NoError(t, sched.Transition(evt.ID, st))
+	}
+
+	rollup, mock := newStatsRollup(t, sched, nil, stats.RollupConfig{RerollDays: 2})
+
+	// First run: the archive result has not arrived, so the event is not counted.
+	expectDay(mock, "2026-02-12")
+	require.NoError(t, rollup.RunOnce(context.Background()))
+
+	require.NoError(t, sched.Transition(evt.ID, scheduler.StateComplete))
+
+	// Next run re-rolls recent days and picks it up.
+	expectDay(mock, "2026-02-12", []interface{}{"FOX", stats.UnknownDimension, "NHL", 1, 0, 0, 0.0})
+	require.NoError(t, rollup.RunOnce(context.Background()))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRollup_PrunesRawEventsBeyondWindow(t *testing.T) {
+	// The events predate the rollup, so create them on an earlier clock.
+	sched := scheduler.NewWithClock(&mockClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)})
+	old := finishEvent(t, sched, "ESPN", "NBA",
+		time.Date(2026, 1, 1, 19, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 22, 0, 0, 0, time.UTC), false)
+	recent := finishEvent(t, sched, "ESPN", "NBA",
+		time.Date(2026, 2, 10, 19, 0, 0, 0, time.UTC), time.Date(2026, 2, 10, 22, 0, 0, 0, time.UTC), false)
+
+	rollup, mock := newStatsRollup(t, sched, nil, stats.RollupConfig{RerollDays: 1, RawRetention: 24 * time.Hour})
+	require.NoError(t, rollup.RunOnce(context.Background()))
+
+	// The 24h retention would cut into the re-roll window, so the cutoff is
+	// clamped to its first day; both events are older than that.
+	_, err := sched.GetEvent(old.ID)
+	assert.Error(t, err)
+	_, err = sched.GetEvent(recent.ID)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRollup_SkipsDaysWithoutRawData(t *testing.T) {
+	// After a restart the scheduler is empty; stored days must survive.
+	rollup, mock := newStatsRollup(t, scheduler.NewWithClock(newMockClock()), nil, stats.RollupConfig{RerollDays: 3})
+	require.NoError(t, rollup.RunOnce(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRollup_LoopPatsAndReturnsOnCancel(t *testing.T) {
+	rollup, mock := newStatsRollup(t, scheduler.NewWithClock(newMockClock()), nil, stats.RollupConfig{RerollDays: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	pats := 0
+	rollup.Loop(0)(ctx, func() { pats++ })
+	assert.Equal(t, 1, pats)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRollup_SkipsDaysBeforeSourceStarted(t *testing.T) {
+	sched := scheduler.NewWithClock(newMockClock())
+	finishEvent(t, sched, "ESPN", "NBA",
+		time.Date(2026, 2, 13, 19, 0, 0, 0, time.UTC), time.Date(2026, 2, 13, 22, 0, 0, 0, time.UTC), false)
+	finishEvent(t, sched, "ESPN", "NBA",
+		time.Date(2026, 2, 14, 1, 0, 0, 0, time.UTC), time.Date(2026, 2, 14, 3, 0, 0, 0, time.UTC), false)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := stats.NewStore(db)
+	require.NoError(t, err)
+	source, err := stats.NewLiveSource(sched, nil)
+	require.NoError(t, err)
+	// Restarted mid-day on the 13th: that day only holds events created since.
+	source.SetSince(time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC))
+	rollup, err := stats.NewRollup(source, store, nil, stats.RollupConfig{RerollDays: 1})
+	require.NoError(t, err)
+	rollup.SetTestNow(func() time.Time { return statsNow })
+
+	expectDay(mock, "2026-02-14", []interface{}{"ESPN", stats.UnknownDimension, "NBA", 1, 0, 0, 0.0})
+	require.NoError(t, rollup.RunOnce(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func reliabilityRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"key", "completed", "failed", "preempted",
+		"tuner_retries", "ingest_retries", "drift_retries", "gap_seconds", "failovers"})
+}
+
+func expectReliabilityQueries(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT channel,`)).
+		WithArgs("2026-02-01", "2026-02-14").
+		WillReturnRows(reliabilityRows().
+			AddRow("ESPN", 18, 2, 0, 3, 1, 0, 120.0, 1).
+			AddRow("FOX", 5, 5, 0, 6, 0, 0, 600.0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT device_id,`)).
+		WithArgs("2026-02-01", "2026-02-14").
+		WillReturnRows(reliabilityRows().
+			AddRow("antbox-1", 20, 1, 0, 2, 1, 0, 60.0, 1).
+			AddRow("antbox-2", 3, 6, 0, 7, 0, 0, 660.0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT league,`)).
+		WithArgs("2026-02-01", "2026-02-14").
+		WillReturnRows(reliabilityRows().
+			AddRow("NBA", 23, 7, 0, 9, 1, 0, 720.0, 1))
+}
+
+func TestStore_ReliabilityReport(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := stats.NewStore(db)
+	require.NoError(t, err)
+
+	expectReliabilityQueries(mock)
+
+	from := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 2, 14, 0, 0, 0, 0, time.UTC)
+	report, err := store.Reliability(context.Background(), from, to, 2)
+	require.NoError(t, err)
+
+	assert.Equal(t, 30, report.Overall.Total)
+	assert.InDelta(t, 23.0/30.0, report.Overall.SuccessRate, 0.0001)
+	assert.Equal(t, 9, report.Overall.Retries[scheduler.RetryTunerFailure])
+
+	require.Len(t, report.ByChannel, 2)
+	assert.InDelta(t, 0.9, report.ByChannel[0].SuccessRate, 0.0001)
+	assert.InDelta(t, 0.5, report.ByChannel[1].SuccessRate, 0.0001)
+
+	require.Len(t, report.WorstOffenders, 2)
+	assert.Equal(t, "league", report.WorstOffenders[0].Dimension)
+	assert.Equal(t, "NBA", report.WorstOffenders[0].Key)
+	assert.Equal(t, "device", report.WorstOffenders[1].Dimension)
+	assert.Equal(t, "antbox-2", report.WorstOffenders[1].Key)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = store.Reliability(context.Background(), to, from, 0)
+	assert.ErrorIs(t, err, stats.ErrInvalidRange)
+}
+
+func TestGetReliabilityStats(t *testing.T) {
+	router, _, _, _ := setupTestRouter()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/stats/reliability", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := stats.NewStore(db)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	h := handlers.New(nil, nil, nil)
+	h.Stats = store
+	r := gin.New()
+	h.RegisterRoutes(r.Group("/api/v1"))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/stats/reliability?from=Feb-1", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/stats/reliability?from=2026-02-14&to=2026-02-01", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	expectReliabilityQueries(mock)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/stats/reliability?from=2026-02-01&to=2026-02-14", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var report stats.ReliabilityReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, "2026-02-01", report.From)
+	assert.Len(t, report.ByDevice, 2)
+	assert.NotEmpty(t, report.WorstOffenders)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
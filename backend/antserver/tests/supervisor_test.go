@@ -0,0 +1,358 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"antserver/internal/coordinator"
+	"antserver/internal/handlers"
+	"antserver/internal/ingest"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failTransport connects a transport and then drives it into the failed state
+// by breaking the connector and exhausting reconnection attempts.
+func failTransport(t *testing.T, tr *ingest.Transport, conn *mockConnector) {
+	t.Helper()
+
+	conn.mu.Lock()
+	conn.srtErr = errors.New("srt down")
+	conn.rtmpErr = errors.New("rtmp down")
+	conn.mu.Unlock()
+
+	tr.TriggerReconnect()
+}
+
+func newSupervisedTransport(t *testing.T) (*ingest.Transport, *mockConnector) {
+	t.Helper()
+
+	conn := &mockConnector{}
+	tr, err := ingest.NewTransport(conn)
+	require.NoError(t, err)
+	tr.SetTestSleep(func(time.Duration) { time.Sleep(time.Millisecond) })
+	require.NoError(t, tr.Connect("stream-123"))
+	return tr, conn
+}
+
+func waitForRecordingState(t *testing.T, r *recorder.Recorder, id string, cond func(*recorder.RecordingStatus) bool) *recorder.RecordingStatus {
+	t.Helper()
+
+	deadline := time.After(2 * time.Second)
+	for {
+		status, err := r.GetRecordingStatus(id)
+		require.NoError(t, err)
+		if cond(status) {
+			return status
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("recording %s did not reach expected state (state: %s)", id, status.State)
+		default:
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestNewCaptureSupervisor_NilFactory(t *testing.T) {
+	_, err := recorder.NewCaptureSupervisor(recorder.New(), nil)
+	assert.ErrorIs(t, err, recorder.ErrNilTransportFactory)
+}
+
+func TestCaptureSupervisor_ResumesBeforeEndTime(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+
+	var mu sync.Mutex
+	var created []*ingest.Transport
+	factory := func(streamID string) (*ingest.Transport, error) {
+		tr, err := ingest.NewTransport(&mockConnector{})
+		if err != nil {
+			return nil, err
+		}
+		tr.SetTestSleep(func(time.Duration) { time.Sleep(time.Millisecond) })
+		mu.Lock()
+		created = append(created, tr)
+		mu.Unlock()
+		return tr, nil
+	}
+
+	sup, err := recorder.NewCaptureSupervisor(r, factory)
+	require.NoError(t, err)
+
+	tr, conn := newSupervisedTransport(t)
+	require.NoError(t, sup.Supervise(rec.ID, "stream-123", time.Now().Add(time.Hour), tr))
+
+	failTransport(t, tr, conn)
+
+	status := waitForRecordingState(t, r, rec.ID, func(s *recorder.RecordingStatus) bool {
+		return len(s.Segments) == 2
+	})
+
+	assert.Equal(t, recorder.RecordingActive, status.State)
+	require.Len(t, status.Gaps, 1)
+	assert.Equal(t, recorder.GapReasonTransportFailed, status.Gaps[0].Reason)
+	assert.False(t, status.Gaps[0].Start.IsZero())
+	assert.False(t, status.Gaps[0].End.IsZero())
+	assert.False(t, status.Segments[0].EndedAt.IsZero())
+	assert.Equal(t, 1, status.Segments[1].Index)
+
+	mu.Lock()
+	require.Len(t, created, 1)
+	assert.Equal(t, ingest.StateConnected, created[0].GetState())
+	mu.Unlock()
+
+	// The failed transport's connection is released before resuming.
+	assert.Equal(t, ingest.StateDisconnected, tr.GetState())
+	conn.mu.Lock()
+	assert.Equal(t, 1, conn.closeCalls)
+	conn.mu.Unlock()
+
+	sup.Stop(rec.ID)
+	created[0].Disconnect()
+}
+
+func TestCaptureSupervisor_ClockReplacedWhileResuming(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+
+	factory := func(streamID string) (*ingest.Transport, error) {
+		return nil, errors.New("device unreachable")
+	}
+	sup, err := recorder.NewCaptureSupervisor(r, factory)
+	require.NoError(t, err)
+	sup.SetTestSleep(func(time.Duration) { time.Sleep(time.Millisecond) })
+
+	tr, conn := newSupervisedTransport(t)
+	require.NoError(t, sup.Supervise(rec.ID, "stream-123", time.Now().Add(time.Hour), tr))
+	failTransport(t, tr, conn)
+
+	waitForRecordingState(t, r, rec.ID, func(s *recorder.RecordingStatus) bool {
+		return len(s.Gaps) == 1
+	})
+
+	// Run with -race: the resume loop reads the clock under the lock.
+	end := time.Now().Add(2 * time.Hour)
+	sup.SetTestNow(func() time.Time { return end })
+	sup.SetTestSleep(func(time.Duration) {})
+
+	status := waitForRecordingState(t, r, rec.ID, func(s *recorder.RecordingStatus) bool {
+		return s.State == recorder.RecordingComplete
+	})
+	assert.Len(t, status.Segments, 1)
+}
+
+func TestCaptureSupervisor_FinalizesAfterEndTime(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+
+	factoryCalls := 0
+	factory := func(streamID string) (*ingest.Transport, error) {
+		factoryCalls++
+		return ingest.NewTransport(&mockConnector{})
+	}
+
+	sup, err := recorder.NewCaptureSupervisor(r, factory)
+	require.NoError(t, err)
+
+	tr, conn := newSupervisedTransport(t)
+	require.NoError(t, sup.Supervise(rec.ID, "stream-123", time.Now().Add(-time.Minute), tr))
+
+	failTransport(t, tr, conn)
+
+	status := waitForRecordingState(t, r, rec.ID, func(s *recorder.RecordingStatus) bool {
+		return s.State == recorder.RecordingComplete
+	})
+
+	assert.Empty(t, status.Gaps)
+	assert.Len(t, status.Segments, 1)
+	assert.Equal(t, 0, factoryCalls)
+}
+
+func TestCaptureSupervisor_EndTimePassesWhileResuming(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+
+	end := time.Now().Add(time.Minute)
+	var clockMu sync.Mutex
+	current := time.Now()
+
+	factory := func(streamID string) (*ingest.Transport, error) {
+		return nil, errors.New("device unreachable")
+	}
+
+	sup, err := recorder.NewCaptureSupervisor(r, factory)
+	require.NoError(t, err)
+	sup.SetTestNow(func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return current
+	})
+	sup.SetTestSleep(func(d time.Duration) {
+		clockMu.Lock()
+		current = current.Add(d)
+		clockMu.Unlock()
+	})
+	sup.SetResumeDelay(30 * time.Second)
+
+	tr, conn := newSupervisedTransport(t)
+	require.NoError(t, sup.Supervise(rec.ID, "stream-123", end, tr))
+
+	failTransport(t, tr, conn)
+
+	status := waitForRecordingState(t, r, rec.ID, func(s *recorder.RecordingStatus) bool {
+		return s.State == recorder.RecordingComplete
+	})
+
+	require.Len(t, status.Gaps, 1)
+	assert.Equal(t, end, status.Gaps[0].End, "gap should be closed at the event end time")
+	assert.Len(t, status.Segments, 1)
+}
+
+// transportFactory builds transports on mock connectors; the first fail
+// calls return an error instead.
+type transportFactory struct {
+	mu      sync.Mutex
+	fail    int
+	calls   int
+	created []*ingest.Transport
+	conns   []*mockConnector
+}
+
+func (f *transportFactory) build(streamID string) (*ingest.Transport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.fail {
+		return nil, errors.New("device unreachable")
+	}
+	conn := &mockConnector{}
+	tr, err := ingest.NewTransport(conn)
+	if err != nil {
+		return nil, err
+	}
+	tr.SetTestSleep(func(time.Duration) { time.Sleep(time.Millisecond) })
+	f.created = append(f.created, tr)
+	f.conns = append(f.conns, conn)
+	return tr, nil
+}
+
+func TestCaptureSupervisor_StartAndStop(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+	factory := &transportFactory{}
+
+	sup, err := recorder.NewCaptureSupervisor(r, factory.build)
+	require.NoError(t, err)
+	require.NoError(t, sup.Start(rec.ID, "ESPN", time.Now().Add(time.Hour)))
+	assert.Error(t, sup.Start(rec.ID, "ESPN", time.Now().Add(time.Hour)), "already supervised")
+
+	require.Len(t, factory.created, 1)
+	assert.Equal(t, ingest.StateConnected, factory.created[0].GetState())
+
+	sup.Stop(rec.ID)
+	assert.Equal(t, ingest.StateDisconnected, factory.created[0].GetState())
+}
+
+func TestCaptureSupervisor_StartResumesAfterFailedConnect(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+	factory := &transportFactory{fail: 2}
+
+	sup, err := recorder.NewCaptureSupervisor(r, factory.build)
+	require.NoError(t, err)
+	sup.SetTestSleep(func(time.Duration) {})
+	require.NoError(t, sup.Start(rec.ID, "ESPN", time.Time{}))
+
+	status := waitForRecordingState(t, r, rec.ID, func(s *recorder.RecordingStatus) bool {
+		return len(s.Segments) == 2
+	})
+	assert.Equal(t, recorder.RecordingActive, status.State)
+	require.Len(t, status.Gaps, 1)
+	assert.Equal(t, recorder.GapReasonTransportFailed, status.Gaps[0].Reason)
+	assert.False(t, status.Gaps[0].End.IsZero())
+
+	factory.mu.Lock()
+	assert.Equal(t, 3, factory.calls)
+	factory.mu.Unlock()
+	sup.Stop(rec.ID)
+}
+
+func TestStartEvent_SupervisesCapture(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sched := scheduler.New()
+	rec := recorder.New()
+	factory := &transportFactory{}
+	sup, err := recorder.NewCaptureSupervisor(rec, factory.build)
+	require.NoError(t, err)
+
+	coord := coordinator.New()
+	_, err = coord.RegisterDevice("antbox-1", "Living Room", 1)
+	require.NoError(t, err)
+	h := handlers.New(sched, coord, rec)
+	h.Capture = sup
+	router := gin.New()
+	h.RegisterRoutes(router.Group("/api/v1"))
+
+	evt := createEvent(t, sched, "ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	require.NoError(t, sched.Transition(evt.ID, scheduler.StateScheduled))
+
+	req := httptest.NewRequest("PUT", "/api/v1/events/"+evt.ID+"/start", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	require.Len(t, factory.created, 1)
+	tr := factory.created[0]
+	assert.Equal(t, ingest.StateConnected, tr.GetState())
+
+	// A failure mid-event resumes capture on a fresh transport.
+	failTransport(t, tr, factory.conns[0])
+	recording, err := rec.ActiveRecordingForEvent(evt.ID)
+	require.NoError(t, err)
+	waitForRecordingState(t, rec, recording.ID, func(s *recorder.RecordingStatus) bool {
+		return len(s.Segments) == 2
+	})
+
+	req = httptest.NewRequest("PUT", "/api/v1/events/"+evt.ID+"/stop", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	require.Len(t, factory.created, 2)
+	assert.Equal(t, ingest.StateDisconnected, factory.created[1].GetState(), "stopping the event disconnects the capture")
+}
+
+func TestRecorderGapLifecycle(t *testing.T) {
+	r := recorder.New()
+	rec := r.StartRecording("event-001", "srt://ESPN:9000")
+
+	err := r.ResumeSegment(rec.ID, time.Now())
+	assert.Error(t, err, "resume without an open gap should fail")
+
+	start := time.Now()
+	require.NoError(t, r.BeginGap(rec.ID, start, recorder.GapReasonTransportFailed))
+	assert.Error(t, r.BeginGap(rec.ID, start, recorder.GapReasonTransportFailed), "only one gap may be open")
+
+	end := start.Add(20 * time.Second)
+	require.NoError(t, r.ResumeSegment(rec.ID, end))
+
+	status, err := r.GetRecordingStatus(rec.ID)
+	require.NoError(t, err)
+	require.Len(t, status.Gaps, 1)
+	assert.Equal(t, start, status.Gaps[0].Start)
+	assert.Equal(t, end, status.Gaps[0].End)
+	require.Len(t, status.Segments, 2)
+	assert.Equal(t, start, status.Segments[0].EndedAt)
+	assert.Equal(t, end, status.Segments[1].StartedAt)
+}
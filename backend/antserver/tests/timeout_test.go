@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"antserver/internal/channels"
+	"antserver/internal/coordinator"
+	"antserver/internal/handlers"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTimeoutRouter(t *testing.T, timeouts handlers.RequestTimeouts) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+	store, err := channels.NewStore(db)
+	require.NoError(t, err)
+
+	h := handlers.New(scheduler.New(), coordinator.New(), recorder.New())
+	h.Channels = store
+
+	router := gin.New()
+	router.Use(handlers.Timeout(timeouts))
+	h.RegisterRoutes(router.Group("/api/v1"))
+	return router, mock
+}
+
+func getPath(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTimeout_SlowQueryCancelled(t *testing.T) {
+	router, mock := setupTimeoutRouter(t, handlers.RequestTimeouts{Default: 20 * time.Millisecond})
+	mock.ExpectQuery(regexp.QuoteMeta(channelSelect)).
+		WillDelayFor(time.Second).
+		WillReturnRows(channelRows())
+
+	start := time.Now()
+	w := getPath(router, "/api/v1/channels")
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "the query is cancelled at the deadline")
+	require.Equal(t, http.StatusGatewayTimeout, w.Code, w.Body.String())
+
+	var resp handlers.TimeoutResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, handlers.ErrorCodeTimeout, resp.Code)
+	assert.Equal(t, "20ms", resp.Timeout)
+}
+
+func TestTimeout_RouteOverride(t *testing.T) {
+	router, mock := setupTimeoutRouter(t, handlers.RequestTimeouts{
+		Default: 10 * time.Millisecond,
+		Routes:  map[string]time.Duration{"GET /api/v1/channels": time.Second},
+	})
+	mock.ExpectQuery(regexp.QuoteMeta(channelSelect)).
+		WillDelayFor(50 * time.Millisecond).
+		WillReturnRows(channelRows())
+
+	w := getPath(router, "/api/v1/channels")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Other routes keep the default.
+	mock.ExpectQuery(regexp.QuoteMeta(channelByID)).WithArgs("ch-1").
+		WillDelayFor(time.Second).
+		WillReturnRows(channelRows())
+	w = getPath(router, "/api/v1/channels/ch-1")
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
+
+func TestTimeout_ErrorsBeforeDeadlineStay500(t *testing.T) {
+	router, mock := setupTimeoutRouter(t, handlers.RequestTimeouts{Default: time.Second})
+	mock.ExpectQuery(regexp.QuoteMeta(channelSelect)).WillReturnError(errors.New("connection reset"))
+
+	w := getPath(router, "/api/v1/channels")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestTimeout_HandlerWithoutResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(handlers.Timeout(handlers.RequestTimeouts{Default: 10 * time.Millisecond}))
+	router.GET("/slow", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+	})
+	router.GET("/fast", func(c *gin.Context) {
+		_, hasDeadline := c.Request.Context().Deadline()
+		c.JSON(http.StatusOK, gin.H{"deadline": hasDeadline})
+	})
+
+	assert.Equal(t, http.StatusGatewayTimeout, getPath(router, "/slow").Code)
+
+	w := getPath(router, "/fast")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deadline": true}`, w.Body.String())
+}
+
+func TestDefaultRouteTimeouts(t *testing.T) {
+	routes := handlers.DefaultRouteTimeouts()
+	assert.Greater(t, routes["POST /api/v1/events/import"], handlers.DefaultRequestTimeout)
+}
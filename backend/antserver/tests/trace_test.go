@@ -0,0 +1,263 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"antserver/internal/archive"
+	"antserver/internal/coordinator"
+	"antserver/internal/handlers"
+	"antserver/internal/ingest"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+	"antserver/internal/trace"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useActivityLog installs a fresh activity log as the only logrus hook for
+// the duration of the test.
+func useActivityLog(t *testing.T) *trace.Log {
+	t.Helper()
+	activity := trace.NewLog(0, 0)
+	old := log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+	log.AddHook(activity)
+	t.Cleanup(func() { log.StandardLogger().ReplaceHooks(old) })
+	return activity
+}
+
+type traceFixture struct {
+	router   *gin.Engine
+	sched    *scheduler.Scheduler
+	coord    *coordinator.Coordinator
+	rec      *recorder.Recorder
+	pipeline *archive.Pipeline
+	activity *trace.Log
+}
+
+func newTraceFixture(t *testing.T) *traceFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	f := &traceFixture{
+		sched:    scheduler.New(),
+		coord:    coordinator.New(),
+		rec:      recorder.New(),
+		activity: useActivityLog(t),
+	}
+	f.pipeline, _, _, _, _, _, _, _ = newPipeline(t)
+
+	h := handlers.New(f.sched, f.coord, f.rec)
+	h.Archive = f.pipeline
+	h.Activity = f.activity
+
+	f.router = gin.New()
+	h.RegisterRoutes(f.router.Group("/api/v1"))
+	return f
+}
+
+func (f *traceFixture) do(t *testing.T, method, path string, body interface{}, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTrace_FullLifecycle(t *testing.T) {
+	f := newTraceFixture(t)
+	const cid = "game-42"
+
+	_, err := f.coord.RegisterDevice("antbox-001", "Living Room", 2)
+	require.NoError(t, err)
+
+	// Create with a caller-supplied correlation ID.
+	w := f.do(t, "POST", "/api/v1/events", map[string]interface{}{
+		"channel":    "ESPN",
+		"start_time": time.Now().Add(time.Hour).Format(time.RFC3339),
+		"metadata":   map[string]string{"league": "NBA"},
+	}, map[string]string{trace.Header: cid})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, cid, w.Header().Get(trace.Header))
+
+	var evt scheduler.Event
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &evt))
+	assert.Equal(t, cid, evt.CorrelationID)
+
+	// An unrelated event must not leak into the trace.
+	other := createEvent(t, f.sched, "TSN1", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	assert.NotEmpty(t, other.CorrelationID)
+	assert.NotEqual(t, cid, other.CorrelationID)
+
+	// Start: the recording inherits the event's correlation ID.
+	w = f.do(t, "PUT", "/api/v1/events/"+evt.ID+"/start", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	recs := f.rec.ListRecordings()
+	require.Len(t, recs, 1)
+	recording := recs[0]
+	assert.Equal(t, cid, recording.CorrelationID)
+
+	// A device command issued for the event carries its correlation ID.
+	w = f.do(t, "POST", "/api/v1/devices/antbox-001/command", map[string]interface{}{
+		"command":  "tune",
+		"event_id": evt.ID,
+	}, nil)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), cid)
+
+	// The ingest transport logs its state changes under the ID.
+	tr, err := ingest.NewTransportWithConfig(&mockConnector{}, ingest.TransportConfig{CorrelationID: cid})
+	require.NoError(t, err)
+	assert.Equal(t, cid, tr.CorrelationID())
+	require.NoError(t, tr.Connect("stream-1"))
+	require.NoError(t, tr.Disconnect())
+
+	// Stop, finalize and archive.
+	w = f.do(t, "PUT", "/api/v1/events/"+evt.ID+"/stop", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, f.rec.StopRecording(recording.ID))
+	require.NoError(t, f.rec.FinalizeRecording(recording.ID))
+
+	job, err := f.pipeline.StartWithOptions(context.Background(), recording.ID, archive.JobOptions{CorrelationID: recording.CorrelationID})
+	require.NoError(t, err)
+	assert.Equal(t, cid, job.CorrelationID)
+
+	// Assemble the trace.
+	w = f.do(t, "GET", "/api/v1/trace/"+cid, nil, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp handlers.TraceResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, cid, resp.CorrelationID)
+	require.Len(t, resp.Events, 1)
+	assert.Equal(t, evt.ID, resp.Events[0].ID)
+	require.Len(t, resp.Recordings, 1)
+	assert.Equal(t, recording.ID, resp.Recordings[0].ID)
+	require.Len(t, resp.ArchiveJobs, 1)
+	assert.Equal(t, job.ID, resp.ArchiveJobs[0].ID)
+
+	var messages []string
+	for i, a := range resp.Timeline {
+		if i > 0 {
+			assert.False(t, a.At.Before(resp.Timeline[i-1].At), "timeline is ordered")
+		}
+		assert.NotEqual(t, other.ID, a.Fields["event_id"], "unrelated events are excluded")
+		messages = append(messages, a.Message)
+	}
+
+	wantOrder := []string{
+		"event created",
+		"event state transition",
+		"recording started",
+		"device command received",
+		"transport state changed",
+		"recording stopped, finalizing",
+		"recording finalized",
+		"archive job started",
+		"archive stage completed",
+		"archive job completed",
+	}
+	pos := 0
+	for _, m := range messages {
+		if pos < len(wantOrder) && m == wantOrder[pos] {
+			pos++
+		}
+	}
+	assert.Equal(t, len(wantOrder), pos, "timeline %v should contain %v in order", messages, wantOrder)
+}
+
+func TestTrace_TimelineSortedByTime(t *testing.T) {
+	f := newTraceFixture(t)
+	evt, err := f.sched.CreateEventWithCorrelationID("cid-sort", "ESPN", time.Now(), time.Now().Add(time.Hour), scheduler.EventMetadata{})
+	require.NoError(t, err)
+	require.Equal(t, "cid-sort", evt.CorrelationID)
+
+	base := time.Date(2026, 2, 13, 20, 0, 0, 0, time.UTC)
+	trace.Entry("cid-sort").WithTime(base.Add(2 * time.Minute)).Info("third")
+	trace.Entry("cid-sort").WithTime(base).Info("first")
+	trace.Entry("cid-sort").WithTime(base.Add(time.Minute)).Info("second")
+
+	w := f.do(t, "GET", "/api/v1/trace/cid-sort", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp handlers.TraceResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	var got []string
+	for _, a := range resp.Timeline {
+		got = append(got, a.Message)
+	}
+	// The "event created" entry was logged with the current time, after base.
+	assert.Equal(t, []string{"first", "second", "third", "event created"}, got)
+}
+
+func TestTrace_UnknownCorrelationID(t *testing.T) {
+	f := newTraceFixture(t)
+	w := f.do(t, "GET", "/api/v1/trace/nope", nil, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCreateEvent_CorrelationIDGeneratedOrRejected(t *testing.T) {
+	router, _, _, _ := setupTestRouter()
+	body := map[string]interface{}{
+		"channel":    "ESPN",
+		"start_time": time.Now().Add(time.Hour).Format(time.RFC3339),
+	}
+
+	jsonBody, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", "/api/v1/events", bytes.NewReader(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEmpty(t, w.Header().Get(trace.Header))
+
+	req = httptest.NewRequest("POST", "/api/v1/events", bytes.NewReader(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(trace.Header, strings.Repeat("x", 129))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestActivityLog_Bounds(t *testing.T) {
+	activity := trace.NewLog(2, 3)
+	logger := log.New()
+	logger.AddHook(activity)
+
+	for i := 0; i < 5; i++ {
+		logger.WithField(trace.Field, "a").WithField("n", i).Info("tick")
+	}
+	logger.WithField(trace.Field, "b").Info("b")
+	logger.Info("no correlation id")
+
+	entries := activity.Entries("a")
+	require.Len(t, entries, 3, "only the most recent entries per id are kept")
+	assert.Equal(t, 2, entries[0].Fields["n"])
+	_, hasID := entries[0].Fields[trace.Field]
+	assert.False(t, hasID)
+
+	logger.WithField(trace.Field, "c").Info("c")
+	assert.Empty(t, activity.Entries("a"), "oldest id evicted")
+	assert.Len(t, activity.Entries("b"), 1)
+	assert.Len(t, activity.Entries("c"), 1)
+}
@@ -527,3 +527,75 @@ func TestGetReconnAttempts(t *testing.T) {
 
 	tr.Disconnect()
 }
+
+func TestNewTransportWithConfig_NegativeDuration(t *testing.T) {
+	_, err := ingest.NewTransportWithConfig(&mockConnector{}, ingest.TransportConfig{MaxReconnectDuration: -time.Second})
+	assert.Error(t, err)
+}
+
+func TestReconnect_MaxDuration_FailsBeforeAttemptCap(t *testing.T) {
+	conn := &mockConnector{}
+	tr, err := ingest.NewTransportWithConfig(conn, ingest.TransportConfig{MaxReconnectDuration: 60 * time.Second})
+	require.NoError(t, err)
+
+	currentTime := time.Now()
+	start := currentTime
+	var timeMu sync.Mutex
+	var advancing int32
+	tr.SetTestNow(func() time.Time {
+		timeMu.Lock()
+		defer timeMu.Unlock()
+		return currentTime
+	})
+	tr.SetTestSleep(func(d time.Duration) {
+		if atomic.LoadInt32(&advancing) == 0 {
+			return
+		}
+		timeMu.Lock()
+		currentTime = currentTime.Add(d)
+		timeMu.Unlock()
+	})
+
+	require.NoError(t, tr.Connect("stream-123"))
+
+	conn.mu.Lock()
+	conn.srtErr = errors.New("srt down")
+	conn.rtmpErr = errors.New("rtmp down")
+	conn.mu.Unlock()
+
+	timeMu.Lock()
+	start = currentTime
+	timeMu.Unlock()
+	atomic.StoreInt32(&advancing, 1)
+	tr.TriggerReconnect()
+
+	require.Eventually(t, func() bool {
+		return tr.GetState() == ingest.StateFailed
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// Backoff 5s, 10s, 20s, then 40s capped to the 25s left in the budget:
+	// the loop gives up at 60s after four attempts, one short of the cap.
+	assert.Less(t, tr.GetReconnAttempts(), ingest.MaxReconnAttempts)
+	timeMu.Lock()
+	defer timeMu.Unlock()
+	assert.Equal(t, 60*time.Second, currentTime.Sub(start))
+}
+
+func TestReconnect_MaxDuration_AttemptCapStillApplies(t *testing.T) {
+	conn := &mockConnector{}
+	tr, err := ingest.NewTransportWithConfig(conn, ingest.TransportConfig{MaxReconnectDuration: time.Hour})
+	require.NoError(t, err)
+	tr.SetTestSleep(func(d time.Duration) {})
+
+	require.NoError(t, tr.Connect("stream-123"))
+	conn.mu.Lock()
+	conn.srtErr = errors.New("srt down")
+	conn.rtmpErr = errors.New("rtmp down")
+	conn.mu.Unlock()
+
+	tr.TriggerReconnect()
+	require.Eventually(t, func() bool {
+		return tr.GetState() == ingest.StateFailed
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, ingest.MaxReconnAttempts, tr.GetReconnAttempts())
+}
@@ -0,0 +1,292 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"antserver/internal/coordinator"
+	"antserver/internal/handlers"
+	"antserver/internal/recorder"
+	"antserver/internal/scheduler"
+	"antserver/internal/watchdog"
+
+	"github.com/gin-gonic/gin"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncClock is a mockClock that is safe to read from loop goroutines.
+type syncClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *syncClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *syncClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newWatchdog(t *testing.T) (*watchdog.Watchdog, *syncClock) {
+	t.Helper()
+	wd, err := watchdog.New(watchdog.Config{
+		StallMultiple:     3,
+		CheckInterval:     time.Second,
+		RestartBackoff:    5 * time.Second,
+		MaxRestartBackoff: 20 * time.Second,
+	})
+	require.NoError(t, err)
+
+	clock := &syncClock{now: time.Date(2026, 2, 13, 12, 0, 0, 0, time.UTC)}
+	wd.SetTestNow(clock.Now)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	wd.Start(ctx)
+	return wd, clock
+}
+
+// wedgedLoop pats on its first run only and then blocks, so every restart is
+// counted and the loop stays stalled.
+type wedgedLoop struct {
+	runs atomic.Int32
+}
+
+func (l *wedgedLoop) run(ctx context.Context, pat func()) {
+	if l.runs.Add(1) == 1 {
+		pat()
+	}
+	<-ctx.Done()
+}
+
+func loopStatus(t *testing.T, wd *watchdog.Watchdog, name string) watchdog.LoopStatus {
+	t.Helper()
+	for _, st := range wd.Status() {
+		if st.Name == name {
+			return st
+		}
+	}
+	t.Fatalf("loop %s not registered", name)
+	return watchdog.LoopStatus{}
+}
+
+func TestWatchdog_Config(t *testing.T) {
+	_, err := watchdog.New(watchdog.DefaultConfig())
+	assert.NoError(t, err)
+
+	cfg := watchdog.DefaultConfig()
+	cfg.StallMultiple = 0.5
+	_, err = watchdog.New(cfg)
+	assert.ErrorIs(t, err, watchdog.ErrInvalidConfig)
+
+	wd, _ := newWatchdog(t)
+	noop := func(ctx context.Context, pat func()) { <-ctx.Done() }
+	require.NoError(t, wd.Register("a", time.Second, noop))
+	assert.ErrorIs(t, wd.Register("a", time.Second, noop), watchdog.ErrDuplicateLoop)
+	assert.ErrorIs(t, wd.Register("b", 0, noop), watchdog.ErrInvalidInterval)
+	assert.ErrorIs(t, wd.Register("c", time.Second, nil), watchdog.ErrNilLoop)
+}
+
+func TestWatchdog_StallDetection(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	wd, clock := newWatchdog(t)
+	loop := &wedgedLoop{}
+	require.NoError(t, wd.Register("scheduler", time.Second, loop.run))
+	require.Eventually(t, func() bool { return loop.runs.Load() == 1 }, time.Second, time.Millisecond)
+
+	// Up to the stall multiple of the interval the loop is healthy.
+	clock.Advance(3 * time.Second)
+	wd.Check()
+	assert.True(t, wd.Ready())
+	assert.False(t, loopStatus(t, wd, "scheduler").Stalled)
+
+	clock.Advance(time.Millisecond)
+	wd.Check()
+	assert.False(t, wd.Ready())
+	st := loopStatus(t, wd, "scheduler")
+	assert.True(t, st.Stalled)
+	assert.Equal(t, 1, st.Restarts)
+	require.Eventually(t, func() bool { return loop.runs.Load() == 2 }, time.Second, time.Millisecond, "restarted")
+
+	// A goroutine dump is logged once, on first detection.
+	clock.Advance(5 * time.Second)
+	wd.Check()
+	dumps := 0
+	for _, e := range hook.AllEntries() {
+		if e.Message == "watchdog goroutine dump" {
+			dumps++
+			assert.Contains(t, e.Data["goroutines"], "goroutine")
+		}
+	}
+	assert.Equal(t, 1, dumps)
+}
+
+func TestWatchdog_RestartBackoff(t *testing.T) {
+	wd, clock := newWatchdog(t)
+	loop := &wedgedLoop{}
+	require.NoError(t, wd.Register("drift", time.Second, loop.run))
+	require.Eventually(t, func() bool { return loop.runs.Load() == 1 }, time.Second, time.Millisecond)
+
+	restartsAfter := func(d time.Duration) int {
+		clock.Advance(d)
+		wd.Check()
+		return loopStatus(t, wd, "drift").Restarts
+	}
+
+	assert.Equal(t, 1, restartsAfter(4*time.Second), "first restart is immediate")
+	assert.Equal(t, 1, restartsAfter(4*time.Second))
+	assert.Equal(t, 2, restartsAfter(time.Second), "after 5s backoff")
+	assert.Equal(t, 2, restartsAfter(9*time.Second))
+	assert.Equal(t, 3, restartsAfter(time.Second), "after 10s backoff")
+	assert.Equal(t, 3, restartsAfter(19*time.Second))
+	assert.Equal(t, 4, restartsAfter(time.Second), "after 20s backoff")
+	assert.Equal(t, 4, restartsAfter(19*time.Second))
+	assert.Equal(t, 5, restartsAfter(time.Second), "capped at the max backoff")
+
+	require.Eventually(t, func() bool { return loop.runs.Load() == 6 }, time.Second, time.Millisecond)
+	assert.False(t, wd.Ready())
+}
+
+func TestWatchdog_ReadinessRecoversAfterRestart(t *testing.T) {
+	wd, clock := newWatchdog(t)
+
+	// The first run wedges without patting; later runs pat normally.
+	var runs atomic.Int32
+	require.NoError(t, wd.Register("liveness", time.Second, func(ctx context.Context, pat func()) {
+		if runs.Add(1) > 1 {
+			pat()
+		}
+		<-ctx.Done()
+	}))
+	require.Eventually(t, func() bool { return runs.Load() == 1 }, time.Second, time.Millisecond)
+
+	clock.Advance(4 * time.Second)
+	wd.Check()
+	assert.False(t, wd.Ready())
+
+	require.Eventually(t, wd.Ready, time.Second, time.Millisecond)
+	st := loopStatus(t, wd, "liveness")
+	assert.False(t, st.Stalled)
+	assert.Equal(t, 1, st.Restarts)
+}
+
+func TestWatchdog_PanicRecovery(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	wd, _ := newWatchdog(t)
+	var runs atomic.Int32
+	require.NoError(t, wd.Register("archive-worker", time.Minute, func(ctx context.Context, pat func()) {
+		pat()
+		if runs.Add(1) == 1 {
+			panic("nil recording")
+		}
+		<-ctx.Done()
+	}))
+
+	require.Eventually(t, func() bool { return loopStatus(t, wd, "archive-worker").Panics == 1 }, time.Second, time.Millisecond)
+	st := loopStatus(t, wd, "archive-worker")
+	assert.Equal(t, "nil recording", st.LastPanic)
+
+	// The panic is picked up by the next check without waiting for a stall.
+	wd.Check()
+	assert.False(t, wd.Ready())
+	assert.Equal(t, 1, loopStatus(t, wd, "archive-worker").Restarts)
+
+	require.Eventually(t, wd.Ready, time.Second, time.Millisecond)
+	assert.Equal(t, int32(2), runs.Load())
+
+	var logged bool
+	for _, e := range hook.AllEntries() {
+		if e.Message == "watchdog loop panicked" {
+			logged = true
+			assert.Equal(t, "archive-worker", e.Data["loop"])
+		}
+	}
+	assert.True(t, logged)
+}
+
+func TestWatchdog_EveryPatsEachIteration(t *testing.T) {
+	var pats, calls atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watchdog.Every(time.Millisecond, func(context.Context) {
+			if calls.Add(1) == 3 {
+				cancel()
+			}
+		})(ctx, func() { pats.Add(1) })
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("loop did not stop on cancel")
+	}
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, calls.Load(), pats.Load())
+}
+
+func TestHealthLoopsAndReady(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wd, clock := newWatchdog(t)
+	loop := &wedgedLoop{}
+	require.NoError(t, wd.Register("stats-rollup", time.Second, loop.run))
+	require.Eventually(t, func() bool { return loop.runs.Load() == 1 }, time.Second, time.Millisecond)
+
+	h := handlers.New(scheduler.New(), coordinator.New(), recorder.New())
+	h.Watchdog = wd
+	router := gin.New()
+	h.RegisterHealthRoutes(router)
+
+	get := func(path string) (*httptest.ResponseRecorder, handlers.LoopHealthResponse) {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp handlers.LoopHealthResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w, resp
+	}
+
+	w, resp := get("/ready")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", resp.Status)
+
+	clock.Advance(10 * time.Second)
+	wd.Check()
+
+	w, resp = get("/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "degraded", resp.Status)
+
+	w, resp = get("/health/loops")
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, resp.Loops, 1)
+	assert.Equal(t, "stats-rollup", resp.Loops[0].Name)
+	assert.True(t, resp.Loops[0].Stalled)
+	assert.Equal(t, "1s", resp.Loops[0].Interval)
+
+	// Without a watchdog the service is always ready.
+	h = handlers.New(scheduler.New(), coordinator.New(), recorder.New())
+	router = gin.New()
+	h.RegisterHealthRoutes(router)
+	w, resp = get("/ready")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, resp.Loops)
+}
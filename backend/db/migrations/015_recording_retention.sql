@@ -0,0 +1,20 @@
+-- Recording Retention Migration
+-- Per-family retention policies for DVR recordings, enforced by the
+-- antserver retention janitor.
+
+CREATE TABLE IF NOT EXISTS recording_retention_policies (
+  family_id UUID PRIMARY KEY REFERENCES families(id) ON DELETE CASCADE,
+  keep_days INT NOT NULL DEFAULT 0 CHECK (keep_days >= 0),   -- 0 = no age limit
+  keep_count INT NOT NULL DEFAULT 0 CHECK (keep_count >= 0), -- 0 = no count limit
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The janitor lists each family's completed recordings newest first. It
+-- selects by status rather than end_time, since scheduled and in-progress
+-- rows carry an end_time as well.
+CREATE INDEX IF NOT EXISTS idx_dvr_recordings_family_completed
+  ON dvr_recordings(family_id, start_time DESC)
+  WHERE status = 'completed';
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON recording_retention_policies TO hasura;
@@ -0,0 +1,23 @@
+-- Recording Stats Migration
+-- Daily reliability aggregates rolled up by the antserver stats job.
+-- Each day is rewritten in full on every rollup, so reruns never double-count.
+
+CREATE TABLE IF NOT EXISTS recording_stats (
+  day DATE NOT NULL,                       -- event start date
+  channel VARCHAR(255) NOT NULL,
+  device_id VARCHAR(255) NOT NULL,         -- 'unknown' when no tuner was recorded
+  league VARCHAR(50) NOT NULL,             -- 'unknown' for non-sports events
+  completed INT NOT NULL DEFAULT 0,
+  failed INT NOT NULL DEFAULT 0,
+  preempted INT NOT NULL DEFAULT 0,
+  tuner_retries INT NOT NULL DEFAULT 0,
+  ingest_retries INT NOT NULL DEFAULT 0,
+  drift_retries INT NOT NULL DEFAULT 0,
+  gap_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+  failovers INT NOT NULL DEFAULT 0,
+  PRIMARY KEY (day, channel, device_id, league)
+);
+
+CREATE INDEX IF NOT EXISTS idx_recording_stats_day ON recording_stats(day);
+
+GRANT SELECT ON recording_stats TO hasura;
@@ -0,0 +1,34 @@
+-- Channel Catalog Migration
+-- antserver registers channels by call sign and records which AntBox devices
+-- can tune each one. Events refer to channels by call sign.
+
+ALTER TABLE channels
+  ADD COLUMN IF NOT EXISTS device_ids JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+-- Existing rows may share a call sign. Blank call signs are not catalog
+-- entries; for the rest keep the oldest row per call sign, point guide and
+-- live event rows at it and drop the duplicates before the index is built.
+UPDATE channels SET call_sign = NULL WHERE btrim(call_sign) = '';
+
+CREATE TEMP TABLE channel_duplicates AS
+SELECT id, keep_id
+FROM (
+  SELECT id,
+         first_value(id) OVER (PARTITION BY call_sign ORDER BY created_at NULLS LAST, id) AS keep_id
+  FROM channels
+  WHERE call_sign IS NOT NULL
+) ranked
+WHERE id <> keep_id;
+
+UPDATE programs p SET channel_id = d.keep_id
+FROM channel_duplicates d WHERE p.channel_id = d.id;
+
+UPDATE live_events e SET channel_id = d.keep_id
+FROM channel_duplicates d WHERE e.channel_id = d.id;
+
+DELETE FROM channels c USING channel_duplicates d WHERE c.id = d.id;
+
+DROP TABLE channel_duplicates;
+
+-- One catalog entry per call sign; antserver relies on this for ON CONFLICT.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_call_sign ON channels(call_sign);
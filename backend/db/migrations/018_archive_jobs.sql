@@ -0,0 +1,26 @@
+-- Archive Jobs Migration
+-- antserver writes each archive job through on every stage transition so
+-- failed and interrupted jobs can be inspected and retried after a restart.
+
+CREATE TABLE IF NOT EXISTS archive_jobs (
+  id UUID PRIMARY KEY,
+  recording_id VARCHAR(255) NOT NULL,
+  status VARCHAR(20) NOT NULL,             -- pending, running, waiting, completed, failed
+  current_stage VARCHAR(50) NOT NULL DEFAULT '',
+  format VARCHAR(20) NOT NULL,             -- mpegts or fmp4
+  priority INT NOT NULL DEFAULT 0,
+  profile_height INT NOT NULL,
+  profile_codec VARCHAR(20) NOT NULL,
+  encode_weight INT NOT NULL,
+  correlation_id VARCHAR(255) NOT NULL DEFAULT '',
+  stages JSONB NOT NULL DEFAULT '[]'::jsonb,
+  poster JSONB,
+  highlights JSONB,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_archive_jobs_recording ON archive_jobs(recording_id);
+CREATE INDEX IF NOT EXISTS idx_archive_jobs_status ON archive_jobs(status);
+
+GRANT SELECT ON archive_jobs TO hasura;